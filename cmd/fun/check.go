@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"io"
+	"os"
+	"strings"
+)
+
+// checkCommand checks the files, or STDIN if there is none, without compiling them. It prints their diagnostics
+// to STDOUT in the format of the -format flag, i.e. the text of each of them, or a JSON array of them,
+// and fails if some of them are errors.
+func checkCommand(files []string, options compiler.Options) error {
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	var diagnostics []*diag.Diagnostic
+	for _, file := range files {
+		diagnostics = append(diagnostics, compiler.Check(openSource(file))...)
+	}
+	if err := printDiagnostics(os.Stdout, diagnostics, *format); err != nil {
+		return err
+	}
+	if diag.HasErrors(diagnostics) {
+		return failed("check", diagnostics)
+	}
+	return nil
+}
+
+// failed returns the error of a command which has printed its diagnostics, e.g. "check failed: 2 errors".
+func failed(command string, diagnostics []*diag.Diagnostic) error {
+	n := 0
+	for _, d := range diagnostics {
+		if d.Severity == diag.Error {
+			n++
+		}
+	}
+	if n == 1 {
+		return fmt.Errorf("%s failed: 1 error", command)
+	}
+	return fmt.Errorf("%s failed: %d errors", command, n)
+}
+
+// printDiagnostics prints the diagnostics in a format, i.e. the text of each of them, or a JSON array of them.
+func printDiagnostics(w io.Writer, diagnostics []*diag.Diagnostic, format string) error {
+	switch format {
+	case "json":
+		if diagnostics == nil {
+			diagnostics = []*diag.Diagnostic{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diagnostics)
+	case "text":
+		for i, d := range diagnostics {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, strings.TrimRight(d.Error(), "\n"))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q of diagnostics, which should be text or json", format)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/docgen"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// docCommand generates the documentation pages of the files, or STDIN if there is none, in Markdown,
+// or in HTML with the -html flag. It prints the pages to STDOUT, or writes each of them to a file of the
+// directory of the -out flag, e.g. list.md of list.fun.
+func docCommand(files []string, options compiler.Options) error {
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	if *out != "" {
+		if err := os.MkdirAll(*out, 0755); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		page, err := docgen.Generate(openSource(file))
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			if err := writePage(os.Stdout, page); err != nil {
+				return err
+			}
+			continue
+		}
+		ext := ".md"
+		if *html {
+			ext = ".html"
+		}
+		f, err := os.Create(filepath.Join(*out, strings.TrimSuffix(page.Title, filepath.Ext(page.Title))+ext))
+		if err != nil {
+			return err
+		}
+		err = writePage(f, page)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePage(w io.Writer, page *docgen.Page) error {
+	if *html {
+		return page.HTML(w)
+	}
+	return page.Markdown(w)
+}
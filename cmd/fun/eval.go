@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/eval"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// evalCommand interprets the program, and prints the value of each val declaration at top level as it is evaluated.
+func evalCommand(files []string, options compiler.Options) error {
+	module, err := compiler.Lower(openSource(fileOf(files)), options)
+	if err != nil {
+		return err
+	}
+	bindings, err := eval.NewMachine().Exec(module)
+	for _, b := range bindings {
+		if b.Id.Name != "_" {
+			fmt.Printf("val %s : %s = %s\n", b.Id.Name, types.Scheme(b.Type), eval.Format(b.Value))
+		}
+	}
+	return err
+}
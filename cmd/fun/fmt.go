@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/printer"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"io"
+	"os"
+	"strings"
+)
+
+// fmtCommand formats the files, or STDIN if there is none, and prints the formatted code to STDOUT.
+// With the -w flag, it writes the formatted code to the files which it changes instead,
+// and with the -d flag, it prints the differences between the code of the files and the formatted code.
+func fmtCommand(files []string, options compiler.Options) error {
+	if len(files) == 0 {
+		if *write {
+			return fmt.Errorf("cannot write the formatted code of STDIN")
+		}
+		files = []string{""}
+	}
+	for _, file := range files {
+		if err := formatFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFile(file string) error {
+	src := openSource(file)
+	code, err := io.ReadAll(src.Reader)
+	if err != nil {
+		return err
+	}
+	formatted, err := printer.Format(&syntax.Source{Reader: bytes.NewReader(code), Path: src.Path},
+		printer.Config{Width: *width})
+	if err != nil {
+		return err
+	}
+	if *diff && !bytes.Equal(code, formatted) {
+		fmt.Print(unifiedDiff(src.Path, "formatted", string(code), string(formatted)))
+	}
+	if *write && !bytes.Equal(code, formatted) {
+		return os.WriteFile(file, formatted, 0644)
+	}
+	if !*write && !*diff {
+		_, err = os.Stdout.Write(formatted)
+	}
+	return err
+}
+
+// diffContext is the number of the unchanged lines around the changed lines of a hunk of a diff.
+const diffContext = 3
+
+// edit is a line of a diff, which is removed ('-'), added ('+') or unchanged (' ').
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the differences of two versions of a file in the unified format, where the new version
+// is labelled with what changed it, e.g.
+//
+//	--- main.fun
+//	+++ main.fun (formatted)
+//	@@ -1,2 +1,2 @@
+//	-val a=1
+//	+val a = 1
+//	 val b = a
+func unifiedDiff(path, label, a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s (%s)\n", path, path, label)
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		// a hunk from the context before the change up to the context after the last change near it
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(edits) && j <= end+2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+		aStart, bStart := lineNumbers(edits[:start])
+		aCount, bCount := lineNumbers(edits[start:stop])
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aStart+1, aCount, bStart+1, bCount)
+		for _, e := range edits[start:stop] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+// lineNumbers returns the numbers of the lines of the old and the new versions in the edits.
+func lineNumbers(edits []edit) (int, int) {
+	a, b := 0, 0
+	for _, e := range edits {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits from the lines a to the lines b by their longest common subsequence.
+func diffLines(a, b []string) []edit {
+	// lengths[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lengths[i+1][j] >= lengths[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/lsp"
+	"os"
+)
+
+// lspCommand serves the Language Server Protocol over STDIN and STDOUT, for editors. The files and the options are unused.
+func lspCommand(files []string, options compiler.Options) error {
+	return lsp.NewServer(os.Stdin, os.Stdout).Serve()
+}
@@ -1,21 +1,97 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	merror "github.com/hashicorp/go-multierror"
 	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/diag"
 	"github.com/lilac/fun-lang/pkg/syntax"
 	"os"
+	"strconv"
 )
 
 var (
 	help = flag.Bool("help", false, "Show this help")
+	mono = flag.Bool("mono", false, "Specialize polymorphic functions per instance instead of generating Go generics")
+	lift = flag.Bool("lift", false, "Lift the local functions which do not escape to top level functions")
+	tail = flag.Bool("tailcalls", false, "Report the tail calls which are not optimised to STDERR")
+	dump = flag.Bool("dump-ir", false, "Print the IR after the lowering and after each pass to STDERR")
+	anf  = flag.Bool("dump-anf", false, "Print the A-normal form of the IR after the passes to STDERR")
+	env  = flag.Bool("dump-types", false, "Print the types of the declared variables to STDERR")
+
+	format = flag.String("format", "text", "The format of the diagnostics of the check and rename commands: text or json")
+	at     = flag.String("at", "", "The position line:column of the expression whose type the types command prints")
+	write  = flag.Bool("w", false, "Write the code of the fmt and rename commands to the files instead of STDOUT")
+	diff   = flag.Bool("d", false, "Print the differences between the files and their code of the fmt and rename commands")
+	width  = flag.Int("width", 80, "The maximum width of the lines of the fmt command")
+	html   = flag.Bool("html", false, "Generate the pages of the doc command in HTML instead of Markdown")
+	out    = flag.String("out", "", "The directory where the doc command writes the pages instead of STDOUT")
+
+	verbose = flag.Bool("v", false, "Report the tests which pass too for the test command")
+
+	level = 0
 )
 
-const usageHeader = `Usage: fun [flags] [file]
+// levelFlag is a flag like -O1, which selects an optimisation level when it is given.
+type levelFlag int
+
+func (l levelFlag) String() string {
+	return ""
+}
+
+func (l levelFlag) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err == nil && on {
+		level = int(l)
+	}
+	return err
+}
+
+func (l levelFlag) IsBoolFlag() bool {
+	return true
+}
+
+func init() {
+	flag.Var(levelFlag(0), "O0", "Disable the optimisations of the IR (default)")
+	flag.Var(levelFlag(1), "O1", "Fold constants and remove unused let bindings")
+	flag.Var(levelFlag(2), "O2", "Inline small functions in addition to -O1")
+}
+
+// command runs on the file arguments after the flags are parsed, where no file is STDIN.
+type command func(files []string, options compiler.Options) error
+
+// commands are the commands which the first argument may name. Without one, the source is compiled.
+var commands = map[string]command{
+	"check":  checkCommand,
+	"doc":    docCommand,
+	"eval":   evalCommand,
+	"fmt":    fmtCommand,
+	"rename": renameCommand,
+	"repl":   replCommand,
+	"lsp":    lspCommand,
+	"test":   testCommand,
+	"types":  typesCommand,
+}
+
+const usageHeader = `Usage: fun [command] [flags] [file]
 
   Compiler of the Fun language.
   When [file] is not given, it will read the source code from STDIN.
+  The check, doc and fmt commands take any number of files.
+
+Commands:
+  check   Parse and type-check the files without compiling them, print their errors and warnings, and exit with 1 on errors
+  doc     Generate the Markdown pages, or HTML with -html, of the declarations with their types and doc comments (** ... *)
+  eval    Interpret the program, and print the values of its declarations
+  fmt     Print the files in the canonical layout with their comments, or write it to them with -w, or print its diff with -d
+  rename  Rename the variable at line:column of [file] to a name without changing what the other names refer to:
+          fun rename [flags] file line:column name
+  repl    Read and evaluate declarations and expressions interactively, after loading [file] if it is given
+  lsp     Serve the Language Server Protocol over STDIN and STDOUT for editors
+  test    Run the tests of [file], i.e. its functions test_xxx : unit -> unit with assert and assertEqual, by go test
+  types   Print the types of the expressions ordered by position, or of the innermost expression at -at line:column
 
 Flags:`
 
@@ -26,32 +102,69 @@ func usage() {
 
 func main() {
 	flag.Usage = usage
-	flag.Parse()
+	name, run := "compile", compile
+	args := os.Args[1:]
+	if len(args) > 0 && commands[args[0]] != nil {
+		name, run, args = args[0], commands[args[0]], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	if *help {
 		usage()
 		os.Exit(0)
 	}
 
-	var err error
-	var file string = ""
-
-	if flag.NArg() > 0 {
-		file = flag.Arg(0)
+	options := compiler.Options{Monomorphize: *mono, Lift: *lift, OptLevel: level}
+	if *dump {
+		options.DumpIR = os.Stderr
 	}
-	src, err := syntax.NewSourceFromFile(file)
+	if *anf {
+		options.DumpANF = os.Stderr
+	}
+	if *tail {
+		options.TailCalls = os.Stderr
+	}
+	if *env {
+		options.DumpTypes = os.Stderr
+	}
+	err := run(flag.Args(), options)
+	handleError(name, err)
+}
 
+// openSource opens the file, or STDIN if it is empty, and exits on an error.
+func openSource(file string) *syntax.Source {
+	src, err := syntax.NewSourceFromFile(file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error on opening file: %s\n", err.Error())
 		os.Exit(1)
 	}
+	return src
+}
 
-	err = compiler.Compile(src)
-	handleError(err)
+// fileOf returns the file of the arguments of a command which takes a file, or an empty file for STDIN.
+func fileOf(files []string) string {
+	if len(files) > 0 {
+		return files[0]
+	}
+	return ""
 }
 
-func handleError(err error) {
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+func compile(files []string, options compiler.Options) error {
+	return compiler.Compile(openSource(fileOf(files)), options)
+}
+
+// handleError prints the error of a command, and exits with 1 for it. The errors of a multierror,
+// e.g. of the passes of the compiler, are printed like the diagnostics of the check command.
+func handleError(command string, err error) {
+	if err == nil {
+		return
+	}
+	var multi *merror.Error
+	if errors.As(err, &multi) {
+		diagnostics := diag.From(err)
+		printDiagnostics(os.Stderr, diagnostics, "text")
+		err = failed(command, diagnostics)
 	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
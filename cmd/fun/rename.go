@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/rename"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"io"
+	"os"
+)
+
+// renameCommand renames the variable at a position of a file, i.e. its declaration and its references,
+// and prints the renamed code to STDOUT, or writes it to the file with the -w flag, or prints the differences
+// with the -d flag. The arguments are the file, the position line:column and the new name, e.g.
+//
+//	fun rename -w main.fun 3:5 total
+//
+// It refuses a renaming which would change what another identifier refers to, and prints every conflict.
+func renameCommand(files []string, options compiler.Options) error {
+	if len(files) != 3 {
+		return fmt.Errorf("usage: fun rename [flags] file line:column name")
+	}
+	file, name := files[0], files[2]
+	line, column, err := parsePosition(files[1])
+	if err != nil {
+		return err
+	}
+	src := openSource(file)
+	code, err := io.ReadAll(src.Reader)
+	if err != nil {
+		return err
+	}
+	edits, err := rename.Rename(&syntax.Source{Reader: bytes.NewReader(code), Path: src.Path}, line, column, name)
+	if err != nil {
+		diagnostics := diag.From(err)
+		if len(diagnostics) == 0 {
+			return err
+		}
+		if err := printDiagnostics(os.Stdout, diagnostics, *format); err != nil {
+			return err
+		}
+		return failed("rename", diagnostics)
+	}
+	renamed := rename.Apply(string(code), edits)
+	if *diff && renamed != string(code) {
+		fmt.Print(unifiedDiff(src.Path, "renamed", string(code), renamed))
+	}
+	if *write && renamed != string(code) {
+		return os.WriteFile(file, []byte(renamed), 0644)
+	}
+	if !*write && !*diff {
+		fmt.Print(renamed)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/repl"
+	"os"
+)
+
+// replCommand reads the inputs from STDIN interactively, after it evaluates the declarations of the file if it is given.
+func replCommand(files []string, options compiler.Options) error {
+	r := repl.New(options, os.Stdout)
+	if file := fileOf(files); file != "" {
+		r.Load(file)
+	}
+	return r.Run(os.Stdin)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// testModule is the go.mod of the package of the tests, which may import the standard packages of Go.
+const testModule = "module funtest\n\ngo 1.18\n"
+
+// testCommand runs the tests of the file, i.e. its top level functions test_xxx of the type unit -> unit,
+// which use the assertions assert and assertEqual, e.g.
+//
+//	fun test_add () = assertEqual 3 (1 + 2)
+//
+// It compiles them into a Go package in a temporary directory, and runs go test in it, which reports
+// each failed test by its name with the position of the failed assertion in the source.
+// With the -v flag, it reports the tests which pass too.
+func testCommand(files []string, options compiler.Options) error {
+	pkg, err := compiler.CompileTests(openSource(fileOf(files)), options)
+	if err != nil {
+		return err
+	}
+	if len(pkg.Tests) == 0 {
+		fmt.Println("no tests")
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "funtest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for name, code := range map[string][]byte{
+		"go.mod":       []byte(testModule),
+		"main.go":      pkg.Main,
+		"main_test.go": pkg.TestFile,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), code, 0644); err != nil {
+			return err
+		}
+	}
+	args := []string{"test", "-count=1"}
+	if *verbose {
+		args = append(args, "-v")
+	}
+	cmd := exec.Command("go", append(args, ".")...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("test failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/typing"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// typesCommand prints the types of the expressions of the file in the order of their positions,
+// or the type of the innermost expression at the position of the -at flag, one per line, e.g.
+//
+//	2:9-2:15 f true : int
+func typesCommand(files []string, options compiler.Options) error {
+	typed, err := compiler.Infer(openSource(fileOf(files)))
+	if err != nil {
+		return err
+	}
+	if *at == "" {
+		for _, t := range typed.Inference.Types() {
+			printTyped(typed.File, t)
+		}
+		return nil
+	}
+	line, column, err := parsePosition(*at)
+	if err != nil {
+		return err
+	}
+	t, ok := typed.Inference.TypeAt(line, column)
+	if !ok {
+		return fmt.Errorf("no expression at %s", *at)
+	}
+	printTyped(typed.File, t)
+	return nil
+}
+
+// lineBreak matches the end of a line with the indentation of the next one.
+var lineBreak = regexp.MustCompile(`[ \t\r]*\n[ \t]*`)
+
+// parsePosition parses a position like 2:9 of a line and a column, which are one based.
+func parsePosition(s string) (int, int, error) {
+	l, c, ok := strings.Cut(s, ":")
+	line, err := strconv.Atoi(l)
+	if err != nil || !ok {
+		return 0, 0, fmt.Errorf("invalid position %q, which should be line:column", s)
+	}
+	column, err := strconv.Atoi(c)
+	if err != nil || line < 1 || column < 1 {
+		return 0, 0, fmt.Errorf("invalid position %q, which should be line:column", s)
+	}
+	return line, column, nil
+}
+
+// printTyped prints the range and the code of an expression as it is in the source, with the parentheses around it,
+// where the lines of the code are joined by spaces.
+func printTyped(file *syntax.File, t typing.TypedExp) {
+	start, end, ok := file.Span(t.Exp)
+	if !ok {
+		start, end = t.Exp.Start(), t.Exp.End()
+	}
+	code := lineBreak.ReplaceAllString(file.Text(t.Exp), " ")
+	fmt.Printf("%d:%d-%d:%d %s : %v\n", start.Line, start.Column, end.Line, end.Column, code, t.Type)
+}
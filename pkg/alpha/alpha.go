@@ -4,9 +4,11 @@ import (
 	"fmt"
 	merror "github.com/hashicorp/go-multierror"
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/builtin"
 	. "github.com/lilac/fun-lang/pkg/common"
+	"github.com/lilac/fun-lang/pkg/diag"
 	"github.com/lilac/fun-lang/pkg/syntax"
-	"github.com/rhysd/locerr"
+	"github.com/lilac/fun-lang/pkg/types"
 )
 
 // rename identifiers to make them unique (alpha conversion)
@@ -14,6 +16,7 @@ import (
 type Transformer struct {
 	time  uint // a monotonically increasing number to make names unique
 	error error
+	types map[string]bool // the declared extern types
 }
 
 type NameEnv = Env[string, string]
@@ -35,6 +38,26 @@ func (t *Transformer) transformExp(env *NameEnv, exp ast.Exp) ast.Exp {
 	//	return t.transformVar(env, &node)
 	case *ast.Var:
 		return t.transformVar(env, node)
+	case *ast.Select:
+		for i, arm := range node.Arms {
+			armEnv := NewEnv(env)
+			if arm.Chan != nil {
+				node.Arms[i].Chan = t.transformExp(env, arm.Chan)
+			}
+			if arm.Value != nil {
+				node.Arms[i].Value = t.transformExp(env, arm.Value)
+			}
+			if arm.Pattern != nil {
+				t.transformPattern(armEnv, arm.Pattern)
+			}
+			node.Arms[i].Exp = t.transformExp(armEnv, arm.Exp)
+		}
+		return node
+	case *ast.Member:
+		if !t.types[node.Type.Name] {
+			t.errorfIn(node, diag.UndefinedType, "Undefined type '%s'", node.Type.Name)
+		}
+		return node
 	case *ast.Fn:
 		for i, m := range node.Matches {
 			var matchEnv = NewEnv(env)
@@ -46,6 +69,12 @@ func (t *Transformer) transformExp(env *NameEnv, exp ast.Exp) ast.Exp {
 	case *ast.LetIn:
 		letEnv := NewEnv(env)
 		for i, d := range node.Decs {
+			switch extern := d.(type) {
+			case *ast.ExternDec:
+				t.errorfIn(extern.GoName, diag.InvalidDeclaration, "Extern declaration of '%s' is only allowed at the top level", extern.Arg.Id.Name)
+			case *ast.ExternTypeDec:
+				t.errorfIn(extern.GoName, diag.InvalidDeclaration, "Extern declaration of type '%s' is only allowed at the top level", extern.Name.Name)
+			}
 			node.Decs[i] = t.transformDec(letEnv, d)
 		}
 		node.Body = t.transformExp(letEnv, node.Body)
@@ -100,20 +129,20 @@ func (t *Transformer) transformExp(env *NameEnv, exp ast.Exp) ast.Exp {
 
 func (t *Transformer) transformVar(env *Env[string, string], v *ast.Var) ast.Exp {
 	if v.Id.Name == "_" {
-		t.errorfIn(v, "Cannot use '_' in variable reference")
+		t.errorfIn(v, diag.UndefinedVariable, "Cannot use '_' in variable reference")
 		return v
 	}
 	name, ok := env.LookUp(v.Id.Name)
 	if ok {
 		v.Id.Value = name
 	} else {
-		t.errorfIn(v, "Undefined variable '%s'", v.Id.Name)
+		t.errorfIn(v, diag.UndefinedVariable, "Undefined variable '%s'", v.Id.Name)
 	}
 	return v
 }
 
-func (t *Transformer) errorfIn(exp ast.Exp, format string, args ...interface{}) {
-	e := locerr.ErrorfIn(exp.Start(), exp.End(), format, args...)
+func (t *Transformer) errorfIn(exp ast.Exp, code string, format string, args ...interface{}) {
+	e := diag.Errorf(code, exp.Start(), exp.End(), format, args...)
 	t.error = merror.Append(t.error, e)
 }
 
@@ -122,10 +151,16 @@ func (t *Transformer) transformPattern(env *Env[string, string], pattern ast.Pat
 	case *ast.VarPattern:
 		// check duplicate id in the same pattern list.
 		if env.Contain(node.Id.Name) {
-			t.errorfIn(pattern, "Duplicate identifier '%s' in pattern", node.Id.Name)
+			t.errorfIn(pattern, diag.InvalidPattern, "Duplicate identifier '%s' in pattern", node.Id.Name)
 		} else {
 			t.bind(env, &node.Id)
 		}
+	case *ast.CtorPattern:
+		if _, ok := types.Constructors[node.Ctor.Name]; !ok {
+			t.errorfIn(pattern, diag.UndefinedConstructor, "Undefined constructor '%s'", node.Ctor.Name)
+		}
+		node.Ctor.Value = node.Ctor.Name
+		t.transformPattern(env, node.Arg)
 	}
 	return pattern
 }
@@ -149,37 +184,85 @@ func (t *Transformer) transformDec(env *NameEnv, dec ast.Dec) ast.Dec {
 		node.Body = e
 		t.bind(env, &node.Arg.Id)
 	case *ast.FunDec:
-		id := &node.Binds[0].Id
-		arity := len(node.Binds[0].Patterns)
-		/*
-			We don't need the check since the grammar has dictated that.
-			if arity == 0 {
-				t.errorfIn(node.Binds[0], "A function should have at least one argument: %s", id.Name)
-			}
-		*/
-		t.bind(env, id)
-		for _, bind := range node.Binds {
-			if bind.Id.Name != id.Name {
-				t.errorfIn(bind, "Function name is not consistent: %s", bind.Id.Name)
-			}
-			if len(bind.Patterns) != arity {
-				t.errorfIn(bind, "Function arity is not consistent: the arity of \"%s\" is %d", id.Name, arity)
-			}
-			bind.Id.Value = id.Value
-			// a new environment for each bind
-			bindEnv := NewEnv(env)
-			for _, pattern := range bind.Patterns {
-				_ = t.transformPattern(bindEnv, pattern)
+		t.bind(env, &node.Binds[0].Id)
+		t.transformFunDec(env, node)
+	case *ast.RecDec:
+		// the functions are in scope of all their bodies.
+		names := map[string]bool{}
+		for _, fun := range node.Funs {
+			id := &fun.Binds[0].Id
+			if names[id.Name] {
+				t.errorfIn(fun.Binds[0], diag.InvalidDeclaration, "Duplicate function '%s' in a recursive declaration", id.Name)
 			}
-			e := t.transformExp(bindEnv, bind.Exp)
-			bind.Exp = e
+			names[id.Name] = true
+			t.bind(env, id)
+		}
+		for _, fun := range node.Funs {
+			t.transformFunDec(env, fun)
+		}
+	case *ast.ExternDec:
+		t.bind(env, &node.Arg.Id)
+	case *ast.ExternTypeDec:
+		if t.types[node.Name.Name] {
+			t.errorfIn(node.GoName, diag.InvalidDeclaration, "Duplicate type '%s'", node.Name.Name)
+		}
+		if t.types == nil {
+			t.types = map[string]bool{}
 		}
+		t.types[node.Name.Name] = true
 	}
 	return dec
 }
 
-func (t *Transformer) Transform(module *ast.Module) {
+// transformFunDec transforms the clauses of a function, whose name has been bound.
+func (t *Transformer) transformFunDec(env *NameEnv, node *ast.FunDec) {
+	id := &node.Binds[0].Id
+	arity := len(node.Binds[0].Patterns)
+	/*
+		We don't need the check since the grammar has dictated that.
+		if arity == 0 {
+			t.errorfIn(node.Binds[0], diag.InvalidDeclaration, "A function should have at least one argument: %s", id.Name)
+		}
+	*/
+	for _, bind := range node.Binds {
+		if bind.Id.Name != id.Name {
+			t.errorfIn(bind, diag.InvalidDeclaration, "Function name is not consistent: %s", bind.Id.Name)
+		}
+		if len(bind.Patterns) != arity {
+			t.errorfIn(bind, diag.InvalidDeclaration, "Function arity is not consistent: the arity of \"%s\" is %d", id.Name, arity)
+		}
+		bind.Id.Value = id.Value
+		// a new environment for each bind
+		bindEnv := NewEnv(env)
+		for _, pattern := range bind.Patterns {
+			_ = t.transformPattern(bindEnv, pattern)
+		}
+		e := t.transformExp(bindEnv, bind.Exp)
+		bind.Exp = e
+	}
+}
+
+// NewGlobalEnv returns the environment of the top level, where the built-in constructors and values keep their names.
+func NewGlobalEnv() *NameEnv {
 	env := NewEnv[string, string](nil)
+	for ctor := range types.Constructors {
+		env.Add(ctor, ctor)
+	}
+	for _, name := range builtin.Names {
+		env.Add(name, name)
+	}
+	return env
+}
+
+func (t *Transformer) Transform(module *ast.Module) {
+	t.TransformIn(NewGlobalEnv(), module)
+}
+
+// TransformIn transforms a module in an environment of the top level, which its declarations are added to,
+// so that the modules of an interactive session may refer to the declarations of the previous ones.
+// Error returns the errors of the module after it, without those of the previous modules.
+func (t *Transformer) TransformIn(env *NameEnv, module *ast.Module) {
+	t.error = nil
 	for i, dec := range module.Decs {
 		module.Decs[i] = t.transformDec(env, dec)
 	}
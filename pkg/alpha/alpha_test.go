@@ -106,3 +106,12 @@ func TestTransform(t *testing.T) {
 	assert.NoError(t, transformer.error)
 	assert.Equal(t, strings.Join(expectedLines, "\n"), s)
 }
+
+func TestExternAtTopLevel(t *testing.T) {
+	lines := []string{
+		`extern val sqrt : float -> float = "math.Sqrt"`,
+		`val a = let extern val abs : float -> float = "math.Abs" in sqrt (abs 1.0) end`,
+	}
+	transformer := run(t, lines)
+	assertErrorContains(t, transformer.error, "Extern declaration of 'abs' is only allowed at the top level")
+}
@@ -0,0 +1,210 @@
+// Package anf contains the A-normal form of ir modules, in which every intermediate result is named.
+//
+// The operands of the operations, applications and constructors are atoms, i.e. constants, variables, primitives and
+// Go members, which need no evaluation. The other expressions are bound by Let, so that the order of the evaluation is
+// explicit, and a Let maps to a Go statement. An If or a Select may be bound by a Let as well, which is a join point:
+// the result of the branch which is taken, given by its Ret, is the value of the variable.
+package anf
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// Atom is an ir expression which needs no evaluation: a constant, an *ir.Var, an *ir.Primitive or an *ir.Member.
+type Atom = ir.Exp
+
+// IsAtom returns whether an ir expression is an atom.
+func IsAtom(exp ir.Exp) bool {
+	switch exp.(type) {
+	case *ir.Unit, *ir.Bool, *ir.Char, *ir.Int, *ir.Float, *ir.String, *ir.Var, *ir.Primitive, *ir.Member:
+		return true
+	}
+	return false
+}
+
+// Exp is a sequence of let bindings, which ends with the result of a body or a branch, or with a jump.
+type Exp interface {
+	exp()
+}
+
+// Value is the computation which a Let binds, whose operands are atoms.
+type Value interface {
+	value()
+}
+
+// Let evaluates Value and binds it to Id in Body. Id is _ if the value is only evaluated for its side effects.
+type Let struct {
+	Id    ast.Identifier
+	Type  types.Type
+	Value Value
+	Body  Exp
+}
+
+// LetRec declares functions, which are in scope of all their bodies and of Body.
+type LetRec struct {
+	Funs []*Fun
+	Body Exp
+}
+
+// Ret is the result of the enclosing function or branch.
+type Ret struct {
+	Atom Atom
+}
+
+// Jump is a tail call of a function of the recursive declaration of the enclosing function, like an ir.Jump.
+type Jump struct {
+	Fun  *ir.Var
+	Args []Atom
+	Type types.Type
+}
+
+// Fail aborts the evaluation when no pattern matches the value, like an ir.MatchFailure.
+type Fail struct {
+	Type types.Type
+}
+
+// If evaluates one of its branches. It is a value when a Let binds its result, and an expression in tail position.
+type If struct {
+	Cond Atom
+	Then Exp
+	Else Exp
+	Type types.Type
+}
+
+// Select waits until the channel operation of an arm can proceed, and evaluates the body of the arm, like an ir.Select.
+// Like an If, it is a value or an expression.
+type Select struct {
+	Arms []SelectArm
+	Type types.Type
+}
+
+// SelectArm receives a value from Chan into Id, or sends Value to Chan when it is not nil.
+// The default arm has no channel.
+type SelectArm struct {
+	Chan  Atom
+	Value Atom
+	Id    *ir.Arg
+	Body  Exp
+}
+
+func (Let) exp()    {}
+func (LetRec) exp() {}
+func (Ret) exp()    {}
+func (Jump) exp()   {}
+func (Fail) exp()   {}
+func (If) exp()     {}
+func (Select) exp() {}
+
+// Atomic is the value of an atom.
+type Atomic struct {
+	Atom Atom
+}
+
+type Not struct {
+	Child Atom
+}
+
+type Neg struct {
+	Child Atom
+}
+
+// BinaryOp is an operation on two atoms. The operands of && and || are both evaluated, so the converter makes an If of
+// an operation whose right operand needs an evaluation.
+type BinaryOp struct {
+	Op    ir.Op
+	Left  Atom
+	Right Atom
+}
+
+type Tuple struct {
+	Elements []Atom
+}
+
+type App struct {
+	Fun Atom
+	Arg Atom
+}
+
+// Call applies a function to several arguments at once, like an ir.Call.
+type Call struct {
+	Fun  *ir.Var
+	Args []Atom
+}
+
+// Fn is a function of one argument, where Type is the arrow type of the function.
+type Fn struct {
+	Id   ast.Identifier
+	Type types.Type
+	Body Exp
+}
+
+type Variant struct {
+	Ctor string
+	Arg  Atom
+	Type types.Type
+}
+
+type IsVariant struct {
+	Ctor  string
+	Value Atom
+}
+
+type Payload struct {
+	Ctor  string
+	Value Atom
+	Type  types.Type
+}
+
+func (Atomic) value()    {}
+func (Not) value()       {}
+func (Neg) value()       {}
+func (BinaryOp) value()  {}
+func (Tuple) value()     {}
+func (App) value()       {}
+func (Call) value()      {}
+func (Fn) value()        {}
+func (Variant) value()   {}
+func (IsVariant) value() {}
+func (Payload) value()   {}
+func (If) value()        {}
+func (Select) value()    {}
+
+type Dec interface {
+	dec()
+}
+
+// Val is a value at top level, which is computed by Body.
+type Val struct {
+	Id   ast.Identifier
+	Type types.Type
+	Body Exp
+}
+
+// Fun is a function of Env and then Args, like an ir.FunDec. Type is the type of the function of Args.
+type Fun struct {
+	Id   ast.Identifier
+	Type types.Type
+	Env  []ir.Arg
+	Args []ir.Arg
+	Body Exp
+}
+
+// Rec declares functions at top level, which are in scope of all their bodies.
+type Rec struct {
+	Funs []*Fun
+}
+
+// Extern is an extern declaration of the ir, i.e. an *ir.ExternDec or an *ir.ExternTypeDec.
+type Extern struct {
+	Dec ir.Dec
+}
+
+func (Val) dec()    {}
+func (Rec) dec()    {}
+func (Extern) dec() {}
+
+type Module struct {
+	Decs []Dec
+}
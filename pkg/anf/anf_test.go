@@ -0,0 +1,67 @@
+package anf
+
+import (
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIsAtom(t *testing.T) {
+	assert.True(t, IsAtom(irtest.Int(1)))
+	assert.True(t, IsAtom(irtest.Var("x", types.IntType)))
+	assert.True(t, IsAtom(&ir.Primitive{Name: "spawn"}))
+	assert.False(t, IsAtom(&ir.Neg{Child: irtest.Int(1)}))
+	assert.False(t, IsAtom(&ir.Tuple{}))
+}
+
+func TestConvert(t *testing.T) {
+	n, acc := irtest.Var("n", types.IntType), irtest.Var("acc", types.IntType)
+	sum := irtest.Fun("sum", irtest.Binary, []ir.Arg{irtest.Arg("n", types.IntType), irtest.Arg("acc", types.IntType)},
+		&ir.IfThen{
+			Cond: ir.NewBinaryOp(ir.Eq, n, &ir.Int{}),
+			Then: acc,
+			Else: &ir.Jump{Fun: irtest.Var("sum", irtest.Binary), Args: []ir.Exp{ir.NewBinaryOp(ir.Minus, n, irtest.Int(1)), ir.NewBinaryOp(ir.Add, acc, n)},
+				Type: types.IntType},
+		})
+	a := irtest.Val("a", types.IntType,
+		ir.NewBinaryOp(ir.Mul, &ir.Call{Fun: irtest.Var("sum", irtest.Binary), Args: []ir.Exp{irtest.Int(3), &ir.Int{}}}, irtest.Int(2)))
+	module := Convert(&ir.Module{Decs: []ir.Dec{sum, a}})
+	assert.Equal(t, "fun sum$1 (n$1 : int) (acc$1 : int) =\n"+
+		"  let $t1 : bool = n$1 = 0 in\n"+
+		"  if $t1 then\n"+
+		"    ret acc$1\n"+
+		"  else\n"+
+		"    let $t2 : int = n$1 - 1 in\n"+
+		"    let $t3 : int = acc$1 + n$1 in\n"+
+		"    jump sum$1 ($t2, $t3)\n"+
+		"val a$1 : int =\n"+
+		"  let $t4 : int = call sum$1 (3, 0) in\n"+
+		"  let $t5 : int = $t4 * 2 in\n"+
+		"  ret $t5", module.String())
+	assert.NoError(t, Validate(module))
+}
+
+func TestValidate(t *testing.T) {
+	x := irtest.Var("x", types.IntType)
+	module := &Module{Decs: []Dec{
+		&Val{Id: irtest.Id("a"), Type: types.IntType, Body: &Ret{Atom: x}},
+		&Val{Id: irtest.Id("b"), Type: types.IntType, Body: &Let{Id: x.Id, Type: types.IntType,
+			Value: &Neg{Child: &ir.Neg{Child: irtest.Int(1)}}, Body: &Ret{Atom: x}}},
+		&Val{Id: irtest.Id("a"), Type: types.IntType, Body: &Jump{Fun: irtest.Var("b", irtest.Binary), Type: types.IntType}},
+	}}
+	var messages []string
+	if multi, ok := Validate(module).(*merror.Error); assert.True(t, ok) {
+		for _, err := range multi.Errors {
+			messages = append(messages, err.Error())
+		}
+	}
+	assert.Equal(t, []string{
+		"a$1: x$1 is not bound",
+		"b$1: the operand -1 is not an atom",
+		"a$1: the jump to b$1 is not in tail position of its recursive declaration",
+		"a$1: a$1 is bound again in its scope",
+	}, messages)
+}
@@ -0,0 +1,217 @@
+package anf
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// blank is the variable of a value which is only evaluated for its side effects.
+var blank = ast.Identifier{Name: "_", Value: "_"}
+
+type converter struct {
+	time uint // a monotonically increasing number to make the names of the temporary variables unique
+}
+
+// Convert names the intermediate results of a module, in the order of their evaluation.
+// The jumps of the module must be in tail position of the function bodies, as the tailcall package makes them.
+func Convert(module *ir.Module) *Module {
+	c := &converter{}
+	decs := make([]Dec, 0, len(module.Decs))
+	for _, dec := range module.Decs {
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			decs = append(decs, &Val{Id: d.Id, Type: d.Type, Body: c.tail(d.Body)})
+		case *ir.FunDec:
+			decs = append(decs, &Rec{Funs: []*Fun{c.fun(d)}})
+		case *ir.RecDec:
+			decs = append(decs, &Rec{Funs: c.funs(d.Funs)})
+		default:
+			decs = append(decs, &Extern{Dec: dec})
+		}
+	}
+	return &Module{Decs: decs}
+}
+
+// newVar makes a temporary variable.
+func (c *converter) newVar(t types.Type) *ir.Var {
+	c.time++
+	name := fmt.Sprintf("$t%d", c.time)
+	return &ir.Var{Id: ast.Identifier{Name: name, Value: name}, Type: t}
+}
+
+func (c *converter) fun(d *ir.FunDec) *Fun {
+	return &Fun{Id: d.Id, Type: d.Type, Env: d.Env, Args: d.Args, Body: c.tail(d.Body)}
+}
+
+func (c *converter) funs(decs []*ir.FunDec) []*Fun {
+	funs := make([]*Fun, len(decs))
+	for i, dec := range decs {
+		funs[i] = c.fun(dec)
+	}
+	return funs
+}
+
+// tail converts an expression whose value is the result of a body or a branch.
+func (c *converter) tail(exp ir.Exp) Exp {
+	return c.exp(exp, func(value Value) Exp {
+		switch v := value.(type) {
+		case *Atomic:
+			return &Ret{Atom: v.Atom}
+		case *If:
+			return v
+		case *Select:
+			return v
+		}
+		t := c.newVar(ir.TypeOf(exp))
+		return &Let{Id: t.Id, Type: t.Type, Value: value, Body: &Ret{Atom: t}}
+	})
+}
+
+// atom converts an expression, and binds its value to a temporary variable unless it is an atom.
+func (c *converter) atom(exp ir.Exp, k func(Atom) Exp) Exp {
+	return c.exp(exp, func(value Value) Exp {
+		if v, ok := value.(*Atomic); ok {
+			return k(v.Atom)
+		}
+		t := c.newVar(ir.TypeOf(exp))
+		return &Let{Id: t.Id, Type: t.Type, Value: value, Body: k(t)}
+	})
+}
+
+// atoms converts expressions from left to right.
+func (c *converter) atoms(exps []ir.Exp, k func([]Atom) Exp) Exp {
+	atoms := make([]Atom, 0, len(exps))
+	var next func(i int) Exp
+	next = func(i int) Exp {
+		if i == len(exps) {
+			return k(atoms)
+		}
+		return c.atom(exps[i], func(a Atom) Exp {
+			atoms = append(atoms, a)
+			return next(i + 1)
+		})
+	}
+	return next(0)
+}
+
+// exp converts an expression, whose value is given to the continuation k, which makes the rest of the evaluation.
+func (c *converter) exp(exp ir.Exp, k func(Value) Exp) Exp {
+	if IsAtom(exp) {
+		return k(&Atomic{Atom: exp})
+	}
+	switch e := exp.(type) {
+	case *ir.Not:
+		return c.atom(e.Child, func(a Atom) Exp { return k(&Not{Child: a}) })
+	case *ir.Neg:
+		return c.atom(e.Child, func(a Atom) Exp { return k(&Neg{Child: a}) })
+	case *ir.BinaryOp:
+		return c.binaryOp(e, k)
+	case *ir.Tuple:
+		return c.atoms(e.Elements, func(as []Atom) Exp { return k(&Tuple{Elements: as}) })
+	case *ir.Sequence:
+		last := len(e.Elements) - 1
+		var next func(i int) Exp
+		next = func(i int) Exp {
+			if i == last {
+				return c.exp(e.Elements[i], k)
+			}
+			return c.exp(e.Elements[i], func(value Value) Exp {
+				if _, ok := value.(*Atomic); ok {
+					return next(i + 1)
+				}
+				return &Let{Id: blank, Type: ir.TypeOf(e.Elements[i]), Value: value, Body: next(i + 1)}
+			})
+		}
+		return next(0)
+	case *ir.App:
+		return c.atom(e.Fun, func(f Atom) Exp {
+			return c.atom(e.Arg, func(a Atom) Exp { return k(&App{Fun: f, Arg: a}) })
+		})
+	case *ir.Call:
+		return c.atoms(e.Args, func(as []Atom) Exp { return k(&Call{Fun: e.Fun, Args: as}) })
+	case *ir.Jump:
+		return c.atoms(e.Args, func(as []Atom) Exp { return &Jump{Fun: e.Fun, Args: as, Type: e.Type} })
+	case *ir.IfThen:
+		return c.atom(e.Cond, func(cond Atom) Exp {
+			return k(&If{Cond: cond, Then: c.tail(e.Then), Else: c.tail(e.Else), Type: ir.TypeOf(e)})
+		})
+	case *ir.LetIn:
+		return c.decs(e.Decs, func() Exp { return c.exp(e.Body, k) })
+	case *ir.Fn:
+		return k(&Fn{Id: e.Id, Type: e.Type, Body: c.tail(e.Body)})
+	case *ir.MatchFailure:
+		return &Fail{Type: e.Type}
+	case *ir.Variant:
+		return c.atom(e.Arg, func(a Atom) Exp { return k(&Variant{Ctor: e.Ctor, Arg: a, Type: e.Type}) })
+	case *ir.IsVariant:
+		return c.atom(e.Value, func(a Atom) Exp { return k(&IsVariant{Ctor: e.Ctor, Value: a}) })
+	case *ir.Payload:
+		return c.atom(e.Value, func(a Atom) Exp { return k(&Payload{Ctor: e.Ctor, Value: a, Type: e.Type}) })
+	case *ir.Select:
+		return c.selectArms(e, k)
+	}
+	panic("Bug: unexpected ir expression")
+}
+
+// binaryOp converts an operation, where the right operand of && and || is only evaluated if the left one does not
+// decide the result.
+func (c *converter) binaryOp(e *ir.BinaryOp, k func(Value) Exp) Exp {
+	return c.atom(e.Left, func(left Atom) Exp {
+		if (e.Op == ir.And || e.Op == ir.Or) && !IsAtom(e.Right) {
+			short := &Ret{Atom: &ir.Bool{Value: e.Op == ir.Or}}
+			if e.Op == ir.And {
+				return k(&If{Cond: left, Then: c.tail(e.Right), Else: short, Type: types.BoolType})
+			}
+			return k(&If{Cond: left, Then: short, Else: c.tail(e.Right), Type: types.BoolType})
+		}
+		return c.atom(e.Right, func(right Atom) Exp { return k(&BinaryOp{Op: e.Op, Left: left, Right: right}) })
+	})
+}
+
+// selectArms evaluates the channels and the sent values of the arms in order, before the select.
+func (c *converter) selectArms(e *ir.Select, k func(Value) Exp) Exp {
+	var operands []ir.Exp
+	for _, arm := range e.Arms {
+		if arm.Chan != nil {
+			operands = append(operands, arm.Chan)
+		}
+		if arm.Value != nil {
+			operands = append(operands, arm.Value)
+		}
+	}
+	return c.atoms(operands, func(as []Atom) Exp {
+		arms := make([]SelectArm, len(e.Arms))
+		for i, arm := range e.Arms {
+			if arm.Chan != nil {
+				arms[i].Chan, as = as[0], as[1:]
+			}
+			if arm.Value != nil {
+				arms[i].Value, as = as[0], as[1:]
+			}
+			arms[i].Id = arm.Id
+			arms[i].Body = c.tail(arm.Body)
+		}
+		return k(&Select{Arms: arms, Type: e.Type})
+	})
+}
+
+// decs converts the declarations of a let expression in order, and then the rest.
+func (c *converter) decs(decs []ir.Dec, rest func() Exp) Exp {
+	if len(decs) == 0 {
+		return rest()
+	}
+	next := func() Exp { return c.decs(decs[1:], rest) }
+	switch d := decs[0].(type) {
+	case *ir.ValDec:
+		return c.exp(d.Body, func(value Value) Exp {
+			return &Let{Id: d.Id, Type: d.Type, Value: value, Body: next()}
+		})
+	case *ir.FunDec:
+		return &LetRec{Funs: []*Fun{c.fun(d)}, Body: next()}
+	case *ir.RecDec:
+		return &LetRec{Funs: c.funs(d.Funs), Body: next()}
+	}
+	panic("Bug: unexpected local declaration")
+}
@@ -0,0 +1,216 @@
+package anf
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"strings"
+)
+
+// indentUnit is the indentation of a nested body.
+const indentUnit = "  "
+
+// String prints the module with a binding per line, where the bodies of the functions and the branches are indented.
+// The atoms and the declarations of externs are printed like the ir.
+func (m Module) String() string {
+	decs := make([]string, len(m.Decs))
+	for i, dec := range m.Decs {
+		decs[i] = DecString(dec)
+	}
+	return strings.Join(decs, "\n")
+}
+
+// DecString prints a declaration.
+func DecString(dec Dec) string {
+	var p printer
+	switch d := dec.(type) {
+	case *Val:
+		fmt.Fprintf(&p.b, "val %s : %v =", d.Id.Value, d.Type)
+		p.body(d.Body, 1)
+	case *Rec:
+		p.funs(d.Funs, 0)
+	case *Extern:
+		return ir.DecString(d.Dec)
+	default:
+		panic("Bug: unexpected anf declaration")
+	}
+	return p.b.String()
+}
+
+// ExpString prints an expression at the indentation of the first line.
+func ExpString(exp Exp) string {
+	var p printer
+	p.exp(exp, 0)
+	return p.b.String()
+}
+
+type printer struct {
+	b strings.Builder
+}
+
+func (p *printer) indent(depth int) {
+	p.b.WriteString(strings.Repeat(indentUnit, depth))
+}
+
+// body prints an expression on the next lines.
+func (p *printer) body(exp Exp, depth int) {
+	p.b.WriteString("\n")
+	p.indent(depth)
+	p.exp(exp, depth)
+}
+
+// funs prints functions which are declared together, the first one after the current position.
+func (p *printer) funs(funs []*Fun, depth int) {
+	for i, fun := range funs {
+		if i == 0 {
+			p.b.WriteString("fun ")
+		} else {
+			p.b.WriteString("\n")
+			p.indent(depth)
+			p.b.WriteString("and ")
+		}
+		p.b.WriteString(fun.Id.Value)
+		if len(fun.Env) > 0 {
+			env := make([]string, len(fun.Env))
+			for j, arg := range fun.Env {
+				env[j] = argString(arg)
+			}
+			fmt.Fprintf(&p.b, " [%s]", strings.Join(env, ", "))
+		}
+		for _, arg := range fun.Args {
+			fmt.Fprintf(&p.b, " (%s)", argString(arg))
+		}
+		p.b.WriteString(" =")
+		p.body(fun.Body, depth+1)
+	}
+}
+
+func argString(arg ir.Arg) string {
+	return fmt.Sprintf("%s : %v", arg.Id.Value, arg.Type)
+}
+
+// exp prints an expression after the current position, whose following lines are indented by depth.
+func (p *printer) exp(exp Exp, depth int) {
+	switch e := exp.(type) {
+	case *Let:
+		fmt.Fprintf(&p.b, "let %s : %v = ", e.Id.Value, e.Type)
+		if p.value(e.Value, depth) {
+			p.b.WriteString("\n")
+			p.indent(depth)
+			p.b.WriteString("in")
+		} else {
+			p.b.WriteString(" in")
+		}
+		p.body(e.Body, depth)
+	case *LetRec:
+		p.b.WriteString("let ")
+		p.funs(e.Funs, depth)
+		p.b.WriteString("\n")
+		p.indent(depth)
+		p.b.WriteString("in")
+		p.body(e.Body, depth)
+	case *Ret:
+		p.b.WriteString("ret " + atom(e.Atom))
+	case *Jump:
+		fmt.Fprintf(&p.b, "jump %s (%s)", e.Fun.Id.Value, atomsString(e.Args))
+	case *Fail:
+		p.b.WriteString("matchFailure")
+	case *If:
+		p.value(e, depth)
+	case *Select:
+		p.value(e, depth)
+	default:
+		panic("Bug: unexpected anf expression")
+	}
+}
+
+// value prints a value, and returns whether it spans several lines.
+func (p *printer) value(value Value, depth int) bool {
+	switch v := value.(type) {
+	case *Atomic:
+		p.b.WriteString(ir.ExpString(v.Atom))
+	case *Not:
+		p.b.WriteString("not " + atom(v.Child))
+	case *Neg:
+		p.b.WriteString("-" + atom(v.Child))
+	case *BinaryOp:
+		fmt.Fprintf(&p.b, "%s %v %s", atom(v.Left), v.Op, atom(v.Right))
+	case *Tuple:
+		fmt.Fprintf(&p.b, "(%s)", atomsString(v.Elements))
+	case *App:
+		fmt.Fprintf(&p.b, "%s %s", atom(v.Fun), atom(v.Arg))
+	case *Call:
+		fmt.Fprintf(&p.b, "call %s (%s)", v.Fun.Id.Value, atomsString(v.Args))
+	case *Variant:
+		fmt.Fprintf(&p.b, "%s %s", v.Ctor, atom(v.Arg))
+	case *IsVariant:
+		fmt.Fprintf(&p.b, "is %s %s", v.Ctor, atom(v.Value))
+	case *Payload:
+		fmt.Fprintf(&p.b, "payload %s %s", v.Ctor, atom(v.Value))
+	case *Fn:
+		fmt.Fprintf(&p.b, "fn %s =>", v.Id.Value)
+		p.body(v.Body, depth+1)
+		return true
+	case *If:
+		fmt.Fprintf(&p.b, "if %s then", atom(v.Cond))
+		p.body(v.Then, depth+1)
+		p.b.WriteString("\n")
+		p.indent(depth)
+		p.b.WriteString("else")
+		p.body(v.Else, depth+1)
+		return true
+	case *Select:
+		p.b.WriteString("select")
+		for _, arm := range v.Arms {
+			p.b.WriteString("\n")
+			p.indent(depth)
+			p.b.WriteString("| " + armString(arm) + " =>")
+			p.body(arm.Body, depth+1)
+		}
+		p.b.WriteString("\n")
+		p.indent(depth)
+		p.b.WriteString("end")
+		return true
+	default:
+		panic("Bug: unexpected anf value")
+	}
+	return false
+}
+
+// armString prints the channel operation of an arm.
+func armString(arm SelectArm) string {
+	switch {
+	case arm.Chan == nil:
+		return "else"
+	case arm.Value != nil:
+		return fmt.Sprintf("%s ! %s", atom(arm.Chan), atom(arm.Value))
+	case arm.Id != nil:
+		return fmt.Sprintf("%s ? %s", atom(arm.Chan), arm.Id.Id.Value)
+	}
+	return fmt.Sprintf("%s ? _", atom(arm.Chan))
+}
+
+func atomsString(atoms []Atom) string {
+	elements := make([]string, len(atoms))
+	for i, a := range atoms {
+		elements[i] = ir.ExpString(a)
+	}
+	return strings.Join(elements, ", ")
+}
+
+// atom prints an atom, which is parenthesized if it is a negative number or a member.
+func atom(a Atom) string {
+	s := ir.ExpString(a)
+	switch e := a.(type) {
+	case *ir.Int:
+		if e.Value < 0 {
+			return "(" + s + ")"
+		}
+	case *ir.Float:
+		if e.Value < 0 {
+			return "(" + s + ")"
+		}
+	case *ir.Member:
+		return "(" + s + ")"
+	}
+	return s
+}
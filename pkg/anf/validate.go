@@ -0,0 +1,206 @@
+package anf
+
+import (
+	"fmt"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+)
+
+type validator struct {
+	dec    string         // the top level declaration which is validated
+	bound  map[string]int // the number of bindings of each variable in scope
+	errors *merror.Error
+}
+
+// Validate checks the invariants of the A-normal form, which the code generation relies on:
+// the operands are atoms, every variable is bound before it is used and is not bound again in its scope,
+// and a jump is in tail position of a function of the recursive declaration, with all its arguments.
+func Validate(module *Module) error {
+	v := &validator{bound: map[string]int{}}
+	for _, dec := range module.Decs {
+		switch d := dec.(type) {
+		case *Val:
+			v.dec = d.Id.Value
+			v.exp(d.Body, nil)
+			v.bind(d.Id)
+		case *Rec:
+			v.dec = d.Funs[0].Id.Value
+			v.funs(d.Funs)
+		case *Extern:
+			if extern, ok := d.Dec.(*ir.ExternDec); ok {
+				v.bind(extern.Id)
+			}
+		}
+	}
+	return v.errors.ErrorOrNil()
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	err := fmt.Errorf("%s: %s", v.dec, fmt.Sprintf(format, args...))
+	v.errors = merror.Append(v.errors, err)
+}
+
+func (v *validator) bind(id ast.Identifier) {
+	if id == blank {
+		return
+	}
+	if v.bound[id.Value] > 0 {
+		v.errorf("%s is bound again in its scope", id.Value)
+	}
+	v.bound[id.Value]++
+}
+
+func (v *validator) unbind(id ast.Identifier) {
+	if id != blank {
+		v.bound[id.Value]--
+	}
+}
+
+// funs binds functions which are declared together, and validates their bodies, where the functions are in scope.
+func (v *validator) funs(funs []*Fun) {
+	for _, fun := range funs {
+		v.bind(fun.Id)
+	}
+	for _, fun := range funs {
+		params := append(append([]ir.Arg{}, fun.Env...), fun.Args...)
+		for _, param := range params {
+			v.bind(param.Id)
+		}
+		v.exp(fun.Body, funs)
+		for _, param := range params {
+			v.unbind(param.Id)
+		}
+	}
+}
+
+func (v *validator) atom(a Atom) {
+	switch e := a.(type) {
+	case *ir.Var:
+		v.use(e)
+	case nil:
+		v.errorf("an operand is missing")
+	default:
+		if !IsAtom(a) {
+			v.errorf("the operand %s is not an atom", ir.ExpString(a))
+		}
+	}
+}
+
+func (v *validator) atoms(atoms []Atom) {
+	for _, a := range atoms {
+		v.atom(a)
+	}
+}
+
+func (v *validator) use(x *ir.Var) {
+	if v.bound[x.Id.Value] == 0 {
+		v.errorf("%s is not bound", x.Id.Value)
+	}
+}
+
+// exp validates an expression, where loop is the recursive declaration of the function whose result the expression
+// is, or nil if a jump is not in tail position.
+func (v *validator) exp(exp Exp, loop []*Fun) {
+	switch e := exp.(type) {
+	case *Let:
+		v.value(e.Value)
+		v.bind(e.Id)
+		v.exp(e.Body, loop)
+		v.unbind(e.Id)
+	case *LetRec:
+		v.funs(e.Funs)
+		v.exp(e.Body, loop)
+		for _, fun := range e.Funs {
+			v.unbind(fun.Id)
+		}
+	case *Ret:
+		v.atom(e.Atom)
+	case *Jump:
+		v.use(e.Fun)
+		v.atoms(e.Args)
+		v.jump(e, loop)
+	case *Fail:
+	case *If:
+		v.atom(e.Cond)
+		v.exp(e.Then, loop)
+		v.exp(e.Else, loop)
+	case *Select:
+		v.selectArms(e, loop)
+	default:
+		v.errorf("unexpected expression %T", exp)
+	}
+}
+
+// jump checks that a jump targets a function of the enclosing declaration.
+func (v *validator) jump(j *Jump, loop []*Fun) {
+	for _, fun := range loop {
+		if fun.Id.Value != j.Fun.Id.Value {
+			continue
+		}
+		if n := len(fun.Env) + len(fun.Args); len(j.Args) != n {
+			v.errorf("the jump to %s has %d arguments instead of %d", fun.Id.Value, len(j.Args), n)
+		}
+		return
+	}
+	v.errorf("the jump to %s is not in tail position of its recursive declaration", j.Fun.Id.Value)
+}
+
+// value validates a value bound by a Let, whose branches are not in tail position.
+func (v *validator) value(value Value) {
+	switch e := value.(type) {
+	case *Atomic:
+		v.atom(e.Atom)
+	case *Not:
+		v.atom(e.Child)
+	case *Neg:
+		v.atom(e.Child)
+	case *BinaryOp:
+		v.atom(e.Left)
+		v.atom(e.Right)
+	case *Tuple:
+		v.atoms(e.Elements)
+	case *App:
+		v.atom(e.Fun)
+		v.atom(e.Arg)
+	case *Call:
+		v.use(e.Fun)
+		v.atoms(e.Args)
+	case *Variant:
+		v.atom(e.Arg)
+	case *IsVariant:
+		v.atom(e.Value)
+	case *Payload:
+		v.atom(e.Value)
+	case *Fn:
+		v.bind(e.Id)
+		v.exp(e.Body, nil)
+		v.unbind(e.Id)
+	case *If:
+		v.exp(e, nil)
+	case *Select:
+		v.exp(e, nil)
+	default:
+		v.errorf("unexpected value %T", value)
+	}
+}
+
+func (v *validator) selectArms(e *Select, loop []*Fun) {
+	for _, arm := range e.Arms {
+		if arm.Chan != nil {
+			v.atom(arm.Chan)
+		}
+		if arm.Value != nil {
+			v.atom(arm.Value)
+		}
+	}
+	for _, arm := range e.Arms {
+		if arm.Id != nil {
+			v.bind(arm.Id.Id)
+		}
+		v.exp(arm.Body, loop)
+		if arm.Id != nil {
+			v.unbind(arm.Id.Id)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"github.com/lilac/fun-lang/pkg/token"
 	"strings"
 )
 
@@ -11,9 +12,10 @@ type Dec interface {
 }
 
 type ValDec struct {
-	Vars []Var // type variables
-	Arg  Arg
-	Body Exp
+	HasToken       // the token of the declared name
+	Vars     []Var // type variables
+	Arg      Arg
+	Body     Exp
 }
 
 type FunDec struct {
@@ -21,8 +23,35 @@ type FunDec struct {
 	Binds []FunBind
 }
 
+// RecDec declares mutually recursive functions.
+// e.g. fun even n = n = 0 || odd (n - 1) and odd n = n <> 0 && even (n - 1)
+type RecDec struct {
+	Funs []*FunDec
+}
+
+// ExternDec binds a Go package member to an identifier with the declared type.
+// e.g. extern val sqrt : float -> float = "math.Sqrt"
+type ExternDec struct {
+	HasToken
+	Arg    Arg
+	GoName *String // the qualified name of the Go member
+}
+
+// ExternTypeDec imports a Go named type as an abstract type.
+// e.g. extern type builder = "strings.Builder"
+type ExternTypeDec struct {
+	HasToken
+	Name   Identifier
+	GoName *String // the qualified name of the Go type
+}
+
 type Module struct {
 	Decs []Dec
+	// Comments are the comments of the source in their order, which are not a part of the declarations.
+	Comments []*token.Token
+	// Docs are the texts of the documentation comments (** ... *) of the top-level declarations, i.e. of the
+	// val, fun and extern declarations and of the functions of the recursive declarations, which they precede.
+	Docs map[Dec]string
 }
 
 func (v ValDec) Kind() string {
@@ -46,6 +75,34 @@ func (f FunDec) String() string {
 	return fmt.Sprintf("fun %s", s)
 }
 
+func (r RecDec) Kind() string {
+	return "fun"
+}
+
+func (r RecDec) String() string {
+	funs := make([]string, len(r.Funs))
+	for i, fun := range r.Funs {
+		funs[i] = strings.TrimPrefix(fun.String(), "fun ")
+	}
+	return "fun " + strings.Join(funs, " and ")
+}
+
+func (e ExternDec) Kind() string {
+	return "extern"
+}
+
+func (e ExternDec) String() string {
+	return fmt.Sprintf("extern val %v : %v = %v", e.Arg.Id, e.Arg.Type, e.GoName)
+}
+
+func (e ExternTypeDec) Kind() string {
+	return "extern"
+}
+
+func (e ExternTypeDec) String() string {
+	return fmt.Sprintf("extern type %v = %v", e.Name, e.GoName)
+}
+
 func (m Module) String() string {
 	decs := make([]string, len(m.Decs))
 	for i, dec := range m.Decs {
@@ -52,8 +52,9 @@ type IfThen struct {
 
 type LetIn struct {
 	HasToken
-	Decs []Dec
-	Body Exp
+	Decs     []Dec
+	Body     Exp
+	EndToken *token.Token
 }
 
 type Arg struct {
@@ -66,6 +67,23 @@ type Fn struct {
 	Matches []Match
 }
 
+// Select waits until the channel operation of an arm can proceed, and evaluates the arm.
+// e.g. select c ? x => x | d ! 1 => 0 | else => -1 end
+type Select struct {
+	HasToken
+	Arms     []SelectArm
+	EndToken *token.Token
+}
+
+// SelectArm receives a value from Chan and matches it with Pattern, or sends Value to Chan.
+// The default arm has neither a channel nor a value.
+type SelectArm struct {
+	Chan    Exp
+	Pattern Pattern
+	Value   Exp
+	Exp     Exp
+}
+
 type TypeAnnotation struct {
 	Exp      Exp
 	Type     types.Type
@@ -144,7 +162,29 @@ func (l LetIn) Start() locerr.Pos {
 }
 
 func (l LetIn) End() locerr.Pos {
-	return l.Body.End()
+	return l.EndToken.End()
+}
+
+func (s Select) End() locerr.Pos {
+	return s.EndToken.End()
+}
+
+func (s Select) String() string {
+	arms := make([]string, len(s.Arms))
+	for i, arm := range s.Arms {
+		arms[i] = arm.String()
+	}
+	return fmt.Sprintf("select %s end", strings.Join(arms, " | "))
+}
+
+func (a SelectArm) String() string {
+	switch {
+	case a.Chan == nil:
+		return fmt.Sprintf("else => %v", a.Exp)
+	case a.Value != nil:
+		return fmt.Sprintf("%s ! %s => %v", atom(a.Chan), atom(a.Value), a.Exp)
+	}
+	return fmt.Sprintf("%s ? %v => %v", atom(a.Chan), a.Pattern, a.Exp)
 }
 
 func (t TypeAnnotation) Start() locerr.Pos {
@@ -1,5 +1,11 @@
 package ast
 
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
+)
+
 /*
  Identifiers
  id	::=  	letter⟨letter | digit | ' | _⟩*	alphanumeric
@@ -21,6 +27,14 @@ type Var struct {
 	Id Identifier
 }
 
+// Member refers to a member of an extern type by the qualified name, e.g. builder.WriteString
+type Member struct {
+	HasToken
+	Type     Identifier // the name of the extern type
+	Name     Identifier
+	EndToken *token.Token
+}
+
 func (i Identifier) String() string {
 	if len(i.Value) > 0 {
 		return i.Value
@@ -31,3 +45,11 @@ func (i Identifier) String() string {
 func (v Var) String() string {
 	return v.Id.String()
 }
+
+func (m Member) End() locerr.Pos {
+	return m.EndToken.End()
+}
+
+func (m Member) String() string {
+	return fmt.Sprintf("%s.%s", m.Type, m.Name)
+}
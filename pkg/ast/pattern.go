@@ -21,6 +21,13 @@ type VarPattern struct {
 	Id Identifier
 }
 
+// CtorPattern matches a value made by a constructor, and matches its argument with a pattern, e.g. Ok x
+type CtorPattern struct {
+	HasToken
+	Ctor Identifier
+	Arg  Pattern
+}
+
 type Match struct {
 	Pattern Pattern
 	Exp     Exp
@@ -50,6 +57,21 @@ func (v VarPattern) IsPattern() bool {
 	return true
 }
 
+func (c CtorPattern) String() string {
+	if _, ok := c.Arg.(*CtorPattern); ok {
+		return fmt.Sprintf("%v (%v)", c.Ctor, c.Arg)
+	}
+	return fmt.Sprintf("%v %v", c.Ctor, c.Arg)
+}
+
+func (c CtorPattern) End() locerr.Pos {
+	return c.Arg.End()
+}
+
+func (c CtorPattern) IsPattern() bool {
+	return true
+}
+
 func (m Match) String() string {
 	return fmt.Sprintf("%v => %v", m.Pattern, m.Exp)
 }
@@ -57,7 +79,11 @@ func (m Match) String() string {
 func (b FunBind) String() string {
 	patterns := make([]string, len(b.Patterns))
 	for i, pattern := range b.Patterns {
-		patterns[i] = pattern.String()
+		if _, ok := pattern.(*CtorPattern); ok {
+			patterns[i] = fmt.Sprintf("(%v)", pattern)
+		} else {
+			patterns[i] = pattern.String()
+		}
 	}
 	pat := strings.Join(patterns, " ")
 	if b.ResultType != nil {
@@ -6,7 +6,7 @@ import "fmt"
 // Note: a lower number has higher precedence
 func precedence(exp Exp) uint8 {
 	switch exp.(type) {
-	case Unit, *Unit, Bool, *Bool, Int, *Int, Float, *Float, String, *String, Char, *Char, Var, *Var, LetIn, *LetIn:
+	case Unit, *Unit, Bool, *Bool, Int, *Int, Float, *Float, String, *String, Char, *Char, Var, *Var, Member, *Member, LetIn, *LetIn, Select, *Select:
 		// these expressions' starting and ending positions are clear, so they never need a parenthesis.
 		return 1
 	case Not, *Not, Neg, *Neg:
@@ -48,3 +48,11 @@ func parenthesis(parent, child Exp) string {
 		return child.String()
 	}
 }
+
+// atom returns the string of an expression, which is parenthesized unless the expression is atomic.
+func atom(exp Exp) string {
+	if precedence(exp) == 1 {
+		return exp.String()
+	}
+	return fmt.Sprintf("(%v)", exp)
+}
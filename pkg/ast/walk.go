@@ -0,0 +1,80 @@
+package ast
+
+// Inspect visits a node and its children in the order of the source, like go/ast.Inspect.
+// A node is a *Module, a Dec, a *FunBind or an Exp, where a pattern is an Exp.
+// The children of a node are visited if f returns true for it.
+func Inspect(node interface{}, f func(node interface{}) bool) {
+	if !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *Module:
+		for _, dec := range n.Decs {
+			Inspect(dec, f)
+		}
+	case *ValDec:
+		Inspect(n.Body, f)
+	case *FunDec:
+		for i := range n.Binds {
+			Inspect(&n.Binds[i], f)
+		}
+	case *RecDec:
+		for _, fun := range n.Funs {
+			Inspect(fun, f)
+		}
+	case *FunBind:
+		for _, pattern := range n.Patterns {
+			Inspect(pattern, f)
+		}
+		Inspect(n.Exp, f)
+	case *Apply:
+		Inspect(n.Fun, f)
+		Inspect(n.Arg, f)
+	case *Not:
+		Inspect(n.Child, f)
+	case *Neg:
+		Inspect(n.Child, f)
+	case *InfixApp:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *Tuple:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case *Sequence:
+		for _, element := range n.Elements {
+			Inspect(element, f)
+		}
+	case *IfThen:
+		Inspect(n.Cond, f)
+		Inspect(n.Then, f)
+		Inspect(n.Else, f)
+	case *LetIn:
+		for _, dec := range n.Decs {
+			Inspect(dec, f)
+		}
+		Inspect(n.Body, f)
+	case *Fn:
+		for _, match := range n.Matches {
+			Inspect(match.Pattern, f)
+			Inspect(match.Exp, f)
+		}
+	case *Select:
+		for _, arm := range n.Arms {
+			if arm.Chan != nil {
+				Inspect(arm.Chan, f)
+			}
+			if arm.Value != nil {
+				Inspect(arm.Value, f)
+			}
+			if arm.Pattern != nil {
+				Inspect(arm.Pattern, f)
+			}
+			Inspect(arm.Exp, f)
+		}
+	case *TypeAnnotation:
+		Inspect(n.Exp, f)
+	case *CtorPattern:
+		Inspect(n.Arg, f)
+	}
+}
@@ -0,0 +1,40 @@
+package ast
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	x := &Var{HasToken{tok}, Identifier{Name: "x"}}
+	y := &Var{HasToken{tok}, Identifier{Name: "y"}}
+	fn := &Fn{HasToken{tok}, []Match{{Pattern: &VarPattern{HasToken{tok}, Identifier{Name: "x"}}, Exp: x}}}
+	body := &LetIn{HasToken{tok}, []Dec{&ValDec{Arg: Arg{Id: Identifier{Name: "y"}}, Body: fn}}, &Apply{Fun: y, Arg: &Int{HasToken{tok}, 1}}, tok}
+	module := &Module{Decs: []Dec{&FunDec{Binds: []FunBind{{Id: Identifier{Name: "f"}, Exp: body}}}}}
+
+	var names []string
+	Inspect(module, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *Var:
+			names = append(names, n.Id.Name)
+		case *VarPattern:
+			names = append(names, "pattern "+n.Id.Name)
+		case *Fn:
+			return false
+		}
+		return true
+	})
+	assert.Equal(t, []string{"y"}, names)
+
+	names = nil
+	Inspect(fn, func(node interface{}) bool {
+		if v, ok := node.(*VarPattern); ok {
+			names = append(names, "pattern "+v.Id.Name)
+		}
+		if v, ok := node.(*Var); ok {
+			names = append(names, v.Id.Name)
+		}
+		return true
+	})
+	assert.Equal(t, []string{"pattern x", "x"}, names)
+}
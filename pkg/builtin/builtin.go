@@ -0,0 +1,101 @@
+// Package builtin defines the values which are available in every module, e.g. the primitives of concurrency
+// and the assertions of the tests.
+package builtin
+
+import (
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// The built-in values, which are functions of goroutines and channels.
+const (
+	Spawn   = "spawn"   // spawn : (unit -> unit) -> unit
+	Channel = "channel" // channel : int -> 'a chan
+	Send    = "send"    // send : 'a chan -> 'a -> unit
+	Recv    = "recv"    // recv : 'a chan -> 'a
+	Close   = "close"   // close : 'a chan -> unit
+)
+
+// The built-in assertions, which fail with the position of the reference to them in the source, e.g. for the tests.
+const (
+	Assert      = "assert"      // assert : bool -> unit
+	AssertEqual = "assertEqual" // assertEqual : 'a -> 'a -> unit, of the expected and the actual values
+)
+
+// Names are the names of the built-in values.
+var Names = []string{Spawn, Channel, Send, Recv, Close, Assert, AssertEqual}
+
+// IsBuiltin returns whether a name refers to a built-in value.
+func IsBuiltin(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ChanType returns the type of channels of the element type.
+func ChanType(elem types.Type) types.Type {
+	return &types.CtorType{Ctor: interop.ChanCtor, Args: []types.Type{elem}}
+}
+
+// AsChan returns the element type if the type is a channel type.
+func AsChan(t types.Type) (types.Type, bool) {
+	if c, ok := t.Prune().(*types.CtorType); ok && c.Ctor == interop.ChanCtor && len(c.Args) == 1 {
+		return c.Args[0], true
+	}
+	return nil, false
+}
+
+// Type returns the type of a built-in value, whose type variables are made by newVar,
+// or nil if there is no such value.
+func Type(name string, newVar func() types.Type) types.Type {
+	switch name {
+	case Spawn:
+		return types.Arrow(types.Arrow(types.UnitType, types.UnitType), types.UnitType)
+	case Channel:
+		return types.Arrow(types.IntType, ChanType(newVar()))
+	case Send:
+		a := newVar()
+		return types.Arrow(ChanType(a), types.Arrow(a, types.UnitType))
+	case Recv:
+		a := newVar()
+		return types.Arrow(ChanType(a), a)
+	case Close:
+		return types.Arrow(ChanType(newVar()), types.UnitType)
+	case Assert:
+		return types.Arrow(types.BoolType, types.UnitType)
+	case AssertEqual:
+		a := newVar()
+		return types.Arrow(a, types.Arrow(a, types.UnitType))
+	}
+	return nil
+}
+
+// Incomparable returns a part of a type whose values cannot be compared for equality like in Go, e.g. a function type,
+// or nil if the values of the type can be compared. A type variable is comparable.
+func Incomparable(t types.Type) types.Type {
+	c, ok := t.Prune().(*types.CtorType)
+	if !ok {
+		return nil
+	}
+	switch c.Ctor {
+	case "->", interop.SliceCtor, interop.MapCtor:
+		return c
+	}
+	for _, arg := range c.Args {
+		if part := Incomparable(arg); part != nil {
+			return part
+		}
+	}
+	return nil
+}
+
+// Arity returns the number of arguments which a built-in function takes before it acts.
+func Arity(name string) int {
+	if name == Send || name == AssertEqual {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,120 @@
+package codegen
+
+import (
+	"bytes"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	goast "go/ast"
+	"go/format"
+	"go/parser"
+	gotoken "go/token"
+	gotypes "go/types"
+	"testing"
+)
+
+// generate formats the Go file of a module.
+func generate(t *testing.T, decs ...ir.Dec) string {
+	file, err := Generate(&ir.Module{Decs: decs})
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	var b bytes.Buffer
+	assert.NoError(t, format.Node(&b, gotoken.NewFileSet(), file))
+	return b.String()
+}
+
+// check type checks a Go file which imports nothing.
+func check(t *testing.T, source string) {
+	fset := gotoken.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", source, 0)
+	if assert.NoError(t, err) {
+		_, err = (&gotypes.Config{}).Check("main", fset, []*goast.File{file}, nil)
+		assert.NoError(t, err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	n, acc := irtest.Var("n", types.IntType), irtest.Var("acc", types.IntType)
+	sum := irtest.Fun("sum", irtest.Binary, []ir.Arg{irtest.Arg("n", types.IntType), irtest.Arg("acc", types.IntType)},
+		&ir.IfThen{
+			Cond: ir.NewBinaryOp(ir.Eq, n, &ir.Int{}),
+			Then: acc,
+			Else: &ir.Jump{Fun: irtest.Var("sum", irtest.Binary), Args: []ir.Exp{ir.NewBinaryOp(ir.Minus, n, irtest.Int(1)), ir.NewBinaryOp(ir.Add, acc, n)},
+				Type: types.IntType},
+		})
+	a := irtest.Val("a", types.IntType, &ir.Call{Fun: irtest.Var("sum", irtest.Binary), Args: []ir.Exp{irtest.Int(3), &ir.Int{}}})
+	inc := irtest.Val("inc", irtest.IntToInt,
+		&ir.App{Fun: irtest.Var("sum", irtest.Binary), Arg: irtest.Int(1)})
+	source := generate(t, sum, a, inc)
+	assert.Equal(t, `package main
+
+func sum_1(n_1 int64, acc_1 int64) int64 {
+	for {
+		if n_1 == 0 {
+			return acc_1
+		} else {
+			n_1, acc_1 = n_1-1, acc_1+n_1
+			continue
+		}
+	}
+}
+
+var a_1 int64
+var inc_1 func(int64) int64
+
+func init() {
+	a_1 = sum_1(3, 0)
+	inc_1 = func(x1 int64) int64 {
+		return sum_1(1, x1)
+	}
+}
+func main() {
+}
+`, source)
+	check(t, source)
+}
+
+func TestGenerateGenericFunction(t *testing.T) {
+	a := types.NewVar(1)
+	identity := irtest.Fun("identity", types.Arrow(a, a), []ir.Arg{irtest.Arg("x", a)}, irtest.Var("x", a))
+	b := irtest.Val("b", types.BoolType,
+		&ir.Call{Fun: irtest.Var("identity", types.Arrow(types.BoolType, types.BoolType)), Args: []ir.Exp{&ir.Bool{Value: true}}})
+	source := generate(t, identity, b)
+	assert.Contains(t, source, "func identity_1[A any](x_1 A) A {\n\treturn x_1\n}\n")
+	assert.Contains(t, source, "\tb_1 = identity_1[bool](true)\n")
+	check(t, source)
+}
+
+func TestGenerateTests(t *testing.T) {
+	var b bytes.Buffer
+	file := GenerateTests([]Test{{Name: "test_add", Id: irtest.Id("test_add")}, {Name: "test_sub", Id: irtest.Id("test_sub")}})
+	assert.NoError(t, format.Node(&b, gotoken.NewFileSet(), file))
+	assert.Equal(t, `package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_add(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			t.FailNow()
+		}
+	}()
+	test_add_1(struct{}{})
+}
+func Test_sub(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+			t.FailNow()
+		}
+	}()
+	test_sub_1(struct{}{})
+}
+`, b.String())
+}
@@ -1,122 +1,952 @@
+// Package codegen generates Go code from the intermediate representation.
 package codegen
 
 import (
+	"fmt"
+	merror "github.com/hashicorp/go-multierror"
 	fast "github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/builtin"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
 	"go/ast"
 	"go/token"
+	gotypes "go/types"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func GenFunction(fun *fast.Fn) *ast.FuncLit {
-	/*
-		func (n int) int {
-			if n > 2 {
-				return fib(n-1) + fib(n-2)
-			} else {
-				return 1
+var binaryOps = map[ir.Op]token.Token{
+	ir.Add:       token.ADD,
+	ir.Minus:     token.SUB,
+	ir.Mul:       token.MUL,
+	ir.Div:       token.QUO,
+	ir.Mod:       token.REM,
+	ir.Eq:        token.EQL,
+	ir.NotEq:     token.NEQ,
+	ir.Less:      token.LSS,
+	ir.LessEq:    token.LEQ,
+	ir.Greater:   token.GTR,
+	ir.GreaterEq: token.GEQ,
+	ir.And:       token.LAND,
+	ir.Or:        token.LOR,
+}
+
+type generator struct {
+	imports  map[string]string        // the name of each imported package by path
+	paths    map[string]string        // the path of each imported package by name
+	used     map[string]bool          // the identifiers which are referenced
+	decTypes map[string]types.Type    // the declared type of each value or function
+	arities  map[string]int           // the number of parameters of each declared function
+	externs  map[string]*gotypes.Func // the Go function bound by each extern
+	mapping  *interop.Mapping         // the Go types of extern types, and of the type parameters in scope
+	generics map[string]*generic      // the type parameters of each generic function
+	loop     *loop                    // the loop of the function body being generated, if it jumps
+	loopVars map[string]bool          // the parameters of the functions which jump, which the loops assign again
+	time     uint                     // a monotonically increasing number to make temporary names unique
+	error    error
+}
+
+// continuation turns the value of an expression into a statement, e.g. a return statement.
+type continuation = func(ast.Expr) ast.Stmt
+
+// Generate translates a module into a Go file of the main package.
+// Top level functions become Go functions, and top level values are initialized in order by the init function.
+func Generate(module *ir.Module) (*ast.File, error) {
+	g := &generator{
+		imports:  map[string]string{},
+		paths:    map[string]string{},
+		used:     map[string]bool{},
+		decTypes: map[string]types.Type{},
+		arities:  map[string]int{},
+		externs:  map[string]*gotypes.Func{},
+		mapping:  interop.NewMapping(),
+		generics: map[string]*generic{},
+		loopVars: map[string]bool{},
+	}
+	g.collect(module.Decs)
+	g.collectGenerics(module.Decs)
+
+	decls := constraintDecls(g.generics)
+	var inits []ast.Stmt
+	for _, dec := range module.Decs {
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			decls = append(decls, varDecl(name(d.Id), g.typeExpr(d.Type)))
+			inits = append(inits, g.genStmts(d.Body, assignTo(name(d.Id)))...)
+		case *ir.FunDec:
+			decls = append(decls, g.genFuncDecl(d, []*ir.FunDec{d}))
+		case *ir.RecDec:
+			// Go functions are in scope of each other.
+			for _, fun := range d.Funs {
+				decls = append(decls, g.genFuncDecl(fun, d.Funs))
+			}
+		}
+	}
+	if len(inits) > 0 {
+		decls = append(decls, funcDecl("init", inits))
+	}
+	decls = append(decls, funcDecl("main", nil))
+	if imports := g.importDecl(); imports != nil {
+		decls = append([]ast.Decl{imports}, decls...)
+	}
+	file := &ast.File{
+		Name:  ast.NewIdent("main"),
+		Decls: decls,
+	}
+	return file, g.error
+}
+
+func (g *generator) errorf(format string, args ...interface{}) {
+	g.error = merror.Append(g.error, fmt.Errorf(format, args...))
+}
+
+// collect records the declarations and references of identifiers.
+func (g *generator) collect(decs []ir.Dec) {
+	for _, dec := range decs {
+		g.declare(dec)
+		ir.InspectDec(dec, func(exp ir.Exp) bool {
+			switch e := exp.(type) {
+			case *ir.Var:
+				g.used[e.Id.Value] = true
+			case *ir.LetIn:
+				for _, d := range e.Decs {
+					g.declare(d)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// collectGenerics finds the polymorphic top level functions, and the constraints of their type parameters.
+// The type variables of top level values are not generic, because they may be shared by functions, e.g. the element type of a channel.
+func (g *generator) collectGenerics(decs []ir.Dec) {
+	nonGeneric := map[*types.Var]bool{}
+	for _, dec := range decs {
+		if d, ok := dec.(*ir.ValDec); ok {
+			for _, v := range types.Vars(d.Type) {
+				nonGeneric[v] = true
 			}
 		}
-	*/
+	}
+	var funs []*ir.FunDec
+	for _, dec := range decs {
+		for _, d := range funDecs(dec) {
+			if gen := newGeneric(d, nonGeneric); gen != nil {
+				g.generics[d.Id.Value] = gen
+				funs = append(funs, d)
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, d := range funs {
+			changed = g.propagate(d) || changed
+		}
+	}
+	for _, d := range funs {
+		g.generics[d.Id.Value].makeParams()
+	}
+}
+
+// funDecs returns the functions of a function declaration or a recursive declaration.
+func funDecs(dec ir.Dec) []*ir.FunDec {
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		return []*ir.FunDec{d}
+	case *ir.RecDec:
+		return d.Funs
+	}
+	return nil
+}
+
+func (g *generator) declare(dec ir.Dec) {
+	switch d := dec.(type) {
+	case *ir.ValDec:
+		g.decTypes[d.Id.Value] = d.Type
+	case *ir.FunDec:
+		g.decTypes[d.Id.Value] = d.EnvType()
+		g.arities[d.Id.Value] = len(d.Env) + len(d.Args)
+	case *ir.RecDec:
+		for _, fun := range d.Funs {
+			g.declare(fun)
+		}
+	case *ir.ExternDec:
+		g.decTypes[d.Id.Value] = d.Type
+		g.externs[d.Id.Value] = d.Func
+	case *ir.ExternTypeDec:
+		g.mapping.Add(d.Name, d.Named)
+	}
+}
+
+// name returns the Go identifier of a unique name.
+func name(id interface{ String() string }) *ast.Ident {
+	return ast.NewIdent(strings.ReplaceAll(id.String(), "$", "_"))
+}
+
+func (g *generator) newName(prefix string) *ast.Ident {
+	g.time++
+	return ast.NewIdent(fmt.Sprintf("%s%d", prefix, g.time))
+}
+
+func (g *generator) importDecl() *ast.GenDecl {
+	if len(g.imports) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	decl := &ast.GenDecl{Tok: token.IMPORT}
+	if len(paths) > 1 {
+		decl.Lparen = 1 // any valid position makes the printer group the imports
+	}
+	for _, path := range paths {
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+		if n := g.imports[path]; !strings.HasSuffix(path, n) {
+			spec.Name = ast.NewIdent(n)
+		}
+		decl.Specs = append(decl.Specs, spec)
+	}
+	return decl
+}
+
+// qualified returns the selector of a Go package member, and imports the package on demand.
+func (g *generator) qualified(obj gotypes.Object) ast.Expr {
+	path := obj.Pkg().Path()
+	pkgName, ok := g.imports[path]
+	if !ok {
+		pkgName = obj.Pkg().Name()
+		for i := 2; g.paths[pkgName] != ""; i++ {
+			pkgName = fmt.Sprintf("%s%d", obj.Pkg().Name(), i)
+		}
+		g.imports[path] = pkgName
+		g.paths[pkgName] = path
+	}
+	return &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(obj.Name())}
+}
+
+// genFuncDecl generates a top level function of a recursive declaration, which is a Go generic function if it is polymorphic.
+// The free variables of a lifted function are the parameters before the first argument.
+func (g *generator) genFuncDecl(dec *ir.FunDec, group []*ir.FunDec) *ast.FuncDecl {
+	gen := g.generics[dec.Id.Value]
+	if gen != nil {
+		mapping := g.mapping
+		g.mapping = mapping.WithTypeParams(gen.params)
+		defer func() { g.mapping = mapping }()
+	}
+	lit := g.genFuncLit(dec, group)
+	if gen != nil {
+		lit.Type.TypeParams = gen.typeParamList()
+	}
+	return &ast.FuncDecl{Name: name(dec.Id), Type: lit.Type, Body: lit.Body}
+}
+
+// genFuncLit generates a function of several parameters, which are the free variables and then the arguments.
+func (g *generator) genFuncLit(dec *ir.FunDec, group []*ir.FunDec) *ast.FuncLit {
+	fields := make([]*ast.Field, 0, len(dec.Env)+len(dec.Args))
+	for _, param := range params(dec) {
+		fields = append(fields, &ast.Field{Names: []*ast.Ident{name(param.Id)}, Type: g.typeExpr(param.Type)})
+	}
+	res := dec.Type
+	for range dec.Args {
+		res = types.Result(res)
+	}
 	return &ast.FuncLit{
 		Type: &ast.FuncType{
-			Func: token.NoPos,
-			Params: &ast.FieldList{
-				List: []*ast.Field{
-					{
-						Names: []*ast.Ident{
-							{
-								Name: "n",
-							},
-						},
-						Type: &ast.Ident{
-							Name: "int",
-						},
-					},
-				},
-			},
-			Results: &ast.FieldList{
-				List: []*ast.Field{
-					{
-						Type: &ast.Ident{
-							Name: "int",
-						},
-					},
-				},
-			},
+			Params:  &ast.FieldList{List: fields},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: g.typeExpr(res)}}},
 		},
-		Body: &ast.BlockStmt{
-			List: []ast.Stmt{
-				&ast.IfStmt{
-					Cond: &ast.BinaryExpr{
-						X: &ast.Ident{
-							Name: "n",
-						},
-						Op: token.GTR,
-						Y: &ast.BasicLit{
-							Kind:  token.INT,
-							Value: "2",
-						},
-					},
-					Body: &ast.BlockStmt{
-						List: []ast.Stmt{
-							&ast.ReturnStmt{
-								Results: []ast.Expr{
-									&ast.BinaryExpr{
-										X: &ast.CallExpr{
-											Fun: &ast.Ident{
-												Name: "fib",
-											},
-											Args: []ast.Expr{
-												&ast.BinaryExpr{
-													X: &ast.Ident{
-														Name: "n",
-													},
-													Op: token.SUB,
-													Y: &ast.BasicLit{
-														Kind:  token.INT,
-														Value: "1",
-													},
-												},
-											},
-											Ellipsis: 0,
-										},
-										Op: token.ADD,
-										Y: &ast.CallExpr{
-											Fun: &ast.Ident{
-												Name: "fib",
-											},
-											Args: []ast.Expr{
-												&ast.BinaryExpr{
-													X: &ast.Ident{
-														Name: "n",
-													},
-													Op: token.SUB,
-													Y: &ast.BasicLit{
-														Kind:  token.INT,
-														Value: "2",
-													},
-												},
-											},
-											Ellipsis: 0,
-										},
-									},
-								},
-							},
-						},
-					},
-					Else: &ast.BlockStmt{
-						List: []ast.Stmt{
-							&ast.ReturnStmt{
-								Results: []ast.Expr{
-									&ast.BasicLit{
-										Kind:  token.INT,
-										Value: "1",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
+		Body: &ast.BlockStmt{List: g.genFuncBody(dec, group)},
+	}
+}
+
+// genStmts generates the statements which evaluate an expression, and pass the value to the continuation.
+func (g *generator) genStmts(exp ir.Exp, k continuation) []ast.Stmt {
+	switch e := exp.(type) {
+	case *ir.IfThen:
+		stmt := &ast.IfStmt{
+			Cond: g.genExp(e.Cond),
+			Body: &ast.BlockStmt{List: g.genStmts(e.Then, k)},
+		}
+		els := g.genStmts(e.Else, k)
+		if elseIf, ok := els[0].(*ast.IfStmt); ok && len(els) == 1 {
+			stmt.Else = elseIf
+		} else {
+			stmt.Else = &ast.BlockStmt{List: els}
+		}
+		return []ast.Stmt{stmt}
+	case *ir.LetIn:
+		var stmts []ast.Stmt
+		for _, dec := range e.Decs {
+			stmts = append(stmts, g.genLocalDec(dec)...)
+		}
+		return append(stmts, g.genStmts(e.Body, k)...)
+	case *ir.Sequence:
+		var stmts []ast.Stmt
+		last := len(e.Elements) - 1
+		for _, element := range e.Elements[:last] {
+			stmts = append(stmts, g.genStmts(element, discard)...)
+		}
+		return append(stmts, g.genStmts(e.Elements[last], k)...)
+	case *ir.MatchFailure:
+		return []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  ast.NewIdent("panic"),
+			Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"match failure"`}},
+		}}}
+	case *ir.App:
+		if stmts, value, ok := g.goCall(e); ok {
+			return appendStmt(stmts, k(value))
+		}
+	case *ir.Jump:
+		return g.genJump(e)
+	case *ir.Select:
+		clauses := make([]ast.Stmt, len(e.Arms))
+		for i, arm := range e.Arms {
+			clause := &ast.CommClause{Body: g.genStmts(arm.Body, k)}
+			if arm.Chan != nil {
+				ch := g.genExp(arm.Chan)
+				recv := &ast.UnaryExpr{Op: token.ARROW, X: ch}
+				switch {
+				case arm.Value != nil:
+					clause.Comm = &ast.SendStmt{Chan: ch, Value: g.genExp(arm.Value)}
+				case arm.Id != nil && g.used[arm.Id.Id.Value]:
+					clause.Comm = define([]ast.Expr{name(arm.Id.Id)}, recv)
+				default:
+					clause.Comm = &ast.ExprStmt{X: recv}
+				}
+			}
+			clauses[i] = clause
+		}
+		return []ast.Stmt{&ast.SelectStmt{Body: &ast.BlockStmt{List: clauses}}}
+	}
+	return appendStmt(nil, k(g.genExp(exp)))
+}
+
+func appendStmt(stmts []ast.Stmt, stmt ast.Stmt) []ast.Stmt {
+	if stmt == nil {
+		return stmts
+	}
+	return append(stmts, stmt)
+}
+
+func ret(value ast.Expr) ast.Stmt {
+	return &ast.ReturnStmt{Results: []ast.Expr{value}}
+}
+
+func assignTo(id *ast.Ident) continuation {
+	return func(value ast.Expr) ast.Stmt {
+		return &ast.AssignStmt{Lhs: []ast.Expr{id}, Tok: token.ASSIGN, Rhs: []ast.Expr{value}}
+	}
+}
+
+// discard evaluates a value only for side effects.
+func discard(value ast.Expr) ast.Stmt {
+	switch value.(type) {
+	case *ast.CallExpr:
+		return &ast.ExprStmt{X: value}
+	case *ast.CompositeLit:
+		if isUnit(value) {
+			return nil
+		}
+	}
+	return &ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent("_")}, Tok: token.ASSIGN, Rhs: []ast.Expr{value}}
+}
+
+func (g *generator) genLocalDec(dec ir.Dec) []ast.Stmt {
+	switch d := dec.(type) {
+	case *ir.ValDec:
+		if !g.used[d.Id.Value] {
+			return g.genStmts(d.Body, discard)
+		}
+		id := name(d.Id)
+		stmts := g.genStmts(d.Body, assignTo(id))
+		if assign, ok := stmts[0].(*ast.AssignStmt); ok && len(stmts) == 1 {
+			value := assign.Rhs[0]
+			if !isConstant(value) {
+				// the Go type is clear unless the value is an untyped constant.
+				return []ast.Stmt{&ast.AssignStmt{Lhs: []ast.Expr{id}, Tok: token.DEFINE, Rhs: []ast.Expr{value}}}
+			}
+			return []ast.Stmt{&ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{
+				&ast.ValueSpec{Names: []*ast.Ident{id}, Type: g.typeExpr(d.Type), Values: []ast.Expr{value}},
+			}}}}
+		}
+		decl := &ast.DeclStmt{Decl: varDecl(id, g.typeExpr(d.Type))}
+		return append([]ast.Stmt{decl}, stmts...)
+	case *ir.FunDec:
+		if !g.used[d.Id.Value] {
+			return nil
+		}
+		id := name(d.Id)
+		lit := g.genFuncLit(d, []*ir.FunDec{d})
+		if !references(d.Body, d.Id.Value) {
+			return []ast.Stmt{&ast.AssignStmt{Lhs: []ast.Expr{id}, Tok: token.DEFINE, Rhs: []ast.Expr{lit}}}
+		}
+		// a recursive function has to be declared before its definition.
+		decl := &ast.DeclStmt{Decl: varDecl(id, lit.Type)}
+		return []ast.Stmt{decl, assignTo(id)(lit)}
+	case *ir.RecDec:
+		// the functions are declared before their definitions, which refer to each other.
+		var decls, assigns []ast.Stmt
+		for _, fun := range d.Funs {
+			if !g.used[fun.Id.Value] {
+				continue
+			}
+			id := name(fun.Id)
+			lit := g.genFuncLit(fun, d.Funs)
+			decls = append(decls, &ast.DeclStmt{Decl: varDecl(id, lit.Type)})
+			assigns = append(assigns, assignTo(id)(lit))
+		}
+		return append(decls, assigns...)
+	}
+	g.errorf("unexpected local declaration %T", dec)
+	return nil
+}
+
+// references returns whether an identifier occurs in the expression.
+func references(exp ir.Exp, id string) bool {
+	found := false
+	ir.Inspect(exp, func(e ir.Exp) bool {
+		if v, ok := e.(*ir.Var); ok && v.Id.Value == id {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (g *generator) genExp(exp ir.Exp) ast.Expr {
+	switch e := exp.(type) {
+	case *ir.Unit:
+		return unitLit()
+	case *ir.Bool:
+		return ast.NewIdent(strconv.FormatBool(e.Value))
+	case *ir.Int:
+		return &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(e.Value, 10)}
+	case *ir.Float:
+		return &ast.BasicLit{Kind: token.FLOAT, Value: formatFloat(e.Value)}
+	case *ir.String:
+		return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(e.Value)}
+	case *ir.Char:
+		return &ast.BasicLit{Kind: token.CHAR, Value: strconv.QuoteRune(e.Value)}
+	case *ir.Var:
+		if g.externs[e.Id.Value] != nil {
+			return g.genGoFunc(e, g.decTypes[e.Id.Value], 1)
+		}
+		if g.arities[e.Id.Value] > 1 {
+			return g.genCurried(e, e.Type, nil)
+		}
+		if gen := g.generics[e.Id.Value]; gen != nil {
+			return g.instantiate(e, gen)
+		}
+		return name(e.Id)
+	case *ir.Member:
+		if e.Kind == interop.MethodMember && e.Params {
+			return g.genGoFunc(e, e.Type, 2)
+		}
+		return g.genGoFunc(e, e.Type, 1)
+	case *ir.Not:
+		return &ast.UnaryExpr{Op: token.NOT, X: parenthesize(g.genExp(e.Child), token.UnaryPrec)}
+	case *ir.Neg:
+		return &ast.UnaryExpr{Op: token.SUB, X: parenthesize(g.genExp(e.Child), token.UnaryPrec)}
+	case *ir.BinaryOp:
+		op := binaryOps[e.Op]
+		left, right := g.genExp(e.Left), g.genExp(e.Right)
+		if (op == token.QUO || op == token.REM) && isZero(right) {
+			// Go rejects a division by a constant zero, so the divisor is a variable, which fails or is infinite at run time.
+			divisor := g.newName("d")
+			return g.iife(ir.TypeOf(e), []ast.Stmt{
+				&ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{
+					&ast.ValueSpec{Names: []*ast.Ident{divisor}, Type: g.typeExpr(ir.TypeOf(e.Right)), Values: []ast.Expr{right}},
+				}}},
+				ret(&ast.BinaryExpr{X: parenthesize(left, op.Precedence()), Op: op, Y: divisor}),
+			})
+		}
+		return &ast.BinaryExpr{
+			X:  parenthesize(left, op.Precedence()),
+			Op: op,
+			Y:  parenthesize(right, op.Precedence()+1),
+		}
+	case *ir.Tuple:
+		elements := make([]ast.Expr, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = g.genExp(element)
+		}
+		return &ast.CompositeLit{Type: g.typeExpr(ir.TypeOf(e)), Elts: elements}
+	case *ir.App:
+		return g.genApp(e)
+	case *ir.Fn:
+		arg, res, _ := types.AsArrow(e.Type)
+		return &ast.FuncLit{
+			Type: g.funcType(name(e.Id), arg, res),
+			Body: &ast.BlockStmt{List: g.genStmts(e.Body, ret)},
+		}
+	case *ir.Variant:
+		key := interop.ResultValueField
+		elements := []ast.Expr{&ast.KeyValueExpr{Key: ast.NewIdent(interop.ResultOkField), Value: ast.NewIdent("true")}}
+		if e.Ctor == types.ErrCtor {
+			key = interop.ResultErrField
+			elements = nil
+		}
+		elements = append(elements, &ast.KeyValueExpr{Key: ast.NewIdent(key), Value: g.genExp(e.Arg)})
+		return &ast.CompositeLit{Type: g.typeExpr(e.Type), Elts: elements}
+	case *ir.IsVariant:
+		ok := selector(g.genExp(e.Value), interop.ResultOkField)
+		if e.Ctor == types.ErrCtor {
+			return &ast.UnaryExpr{Op: token.NOT, X: ok}
+		}
+		return ok
+	case *ir.Payload:
+		if e.Ctor == types.ErrCtor {
+			return selector(g.genExp(e.Value), interop.ResultErrField)
+		}
+		return selector(g.genExp(e.Value), interop.ResultValueField)
+	case *ir.Primitive:
+		return g.genGoFunc(e, e.Type, builtin.Arity(e.Name))
+	case *ir.Call:
+		return g.genCall(e)
+	case *ir.IfThen, *ir.LetIn, *ir.Sequence, *ir.MatchFailure, *ir.Select:
+		return g.iife(ir.TypeOf(e), g.genStmts(e, ret))
+	}
+	panic("Bug: unexpected ir expression")
+}
+
+// iife makes an immediately invoked function expression of the statements.
+func (g *generator) iife(t types.Type, stmts []ast.Stmt) ast.Expr {
+	return &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: g.typeExpr(t)}}},
 		},
+		Body: &ast.BlockStmt{List: stmts},
+	}}
+}
+
+func (g *generator) genApp(app *ir.App) ast.Expr {
+	if stmts, value, ok := g.goCall(app); ok {
+		if len(stmts) == 0 {
+			return value
+		}
+		return g.iife(ir.TypeOf(app), append(stmts, ret(value)))
+	}
+	if v, args := spine(app); v != nil && g.arities[v.Id.Value] > len(args) {
+		return g.genPartial(v, ir.TypeOf(app), args)
+	}
+	arg := g.genExp(app.Arg)
+	if v, ok := app.Fun.(*ir.Var); ok && g.generics[v.Id.Value] != nil {
+		// Go infers the type arguments from a typed argument, if the parameter has all the type parameters.
+		gen := g.generics[v.Id.Value]
+		param, _, _ := types.AsArrow(g.decTypes[v.Id.Value])
+		var fun ast.Expr = name(v.Id)
+		if !gen.inferable(param) || isConstant(arg) {
+			fun = g.instantiate(v, gen)
+		}
+		return &ast.CallExpr{Fun: fun, Args: []ast.Expr{arg}}
+	}
+	var result ast.Expr = &ast.CallExpr{Fun: g.genExp(app.Fun), Args: []ast.Expr{arg}}
+	// a polymorphic local function or value works on the empty interface, so the values of an instance are converted.
+	if v, ok := app.Fun.(*ir.Var); ok {
+		if decType, ok := g.decTypes[v.Id.Value]; ok {
+			param, res, _ := types.AsArrow(decType)
+			if g.isPolymorphic(param) {
+				result.(*ast.CallExpr).Args[0] = g.typed(arg, ir.TypeOf(app.Arg))
+			}
+			if resType := ir.TypeOf(app); g.isPolymorphic(res) && !g.isPolymorphic(resType) {
+				result = &ast.TypeAssertExpr{X: result, Type: g.typeExpr(resType)}
+			}
+		}
+	}
+	return result
+}
+
+// genCall generates a call of a function of several parameters.
+// The arguments and the result of a polymorphic local function are converted like those of an application.
+func (g *generator) genCall(call *ir.Call) ast.Expr {
+	gen := g.generics[call.Fun.Id.Value]
+	args := make([]ast.Expr, len(call.Args))
+	params := make([]types.Type, len(call.Args))
+	t := g.decTypes[call.Fun.Id.Value]
+	constant := false
+	for i, arg := range call.Args {
+		params[i], t, _ = types.AsArrow(t)
+		args[i] = g.genExp(arg)
+		constant = constant || isConstant(args[i])
+		if gen == nil && g.isPolymorphic(params[i]) {
+			args[i] = g.typed(args[i], ir.TypeOf(arg))
+		}
+	}
+	var fun ast.Expr = name(call.Fun.Id)
+	if gen != nil {
+		if !gen.inferable(types.TupleType(params)) || constant {
+			fun = g.instantiate(call.Fun, gen)
+		}
+		return &ast.CallExpr{Fun: fun, Args: args}
+	}
+	var result ast.Expr = &ast.CallExpr{Fun: fun, Args: args}
+	if resType := ir.TypeOf(call); g.isPolymorphic(t) && !g.isPolymorphic(resType) {
+		result = &ast.TypeAssertExpr{X: result, Type: g.typeExpr(resType)}
+	}
+	return result
+}
+
+// spine returns the variable which an application applies to its arguments, or nil if it applies another expression.
+func spine(app *ir.App) (*ir.Var, []ir.Exp) {
+	args := []ir.Exp{app.Arg}
+	for {
+		switch f := app.Fun.(type) {
+		case *ir.Var:
+			return f, args
+		case *ir.App:
+			args = append([]ir.Exp{f.Arg}, args...)
+			app = f
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// genPartial generates a partial application of a function of several parameters, which is a function of the type
+// that captures the arguments, e.g. func(x3 A) A { return compose_3(f_8, f_8, x3) }.
+// An argument is evaluated once before the function, unless it is a constant or a variable which keeps its value.
+func (g *generator) genPartial(v *ir.Var, t types.Type, args []ir.Exp) ast.Expr {
+	var stmts []ast.Stmt
+	captured := make([]ir.Exp, len(args))
+	for i, arg := range args {
+		if g.isStable(arg) {
+			captured[i] = arg
+			continue
+		}
+		id := g.newName("a")
+		stmts = append(stmts, define([]ast.Expr{id}, g.genExp(arg)))
+		captured[i] = &ir.Var{Id: fast.Identifier{Name: id.Name, Value: id.Name}, Type: ir.TypeOf(arg)}
+	}
+	fun := g.genCurried(v, t, captured)
+	if len(stmts) == 0 {
+		return fun
+	}
+	return g.iife(t, append(stmts, ret(fun)))
+}
+
+// isStable returns whether an expression has no effects and the same value wherever it is evaluated.
+func (g *generator) isStable(exp ir.Exp) bool {
+	switch e := exp.(type) {
+	case *ir.Unit, *ir.Bool, *ir.Int, *ir.Float, *ir.String, *ir.Char:
+		return true
+	case *ir.Var:
+		return !g.loopVars[e.Id.Value]
+	}
+	return false
+}
+
+// genCurried wraps a function of several parameters in curried function literals of the type, so that it can be used as a value.
+func (g *generator) genCurried(v *ir.Var, t types.Type, args []ir.Exp) ast.Expr {
+	arg, res, _ := types.AsArrow(t)
+	param := g.newName("x")
+	args = append(args[:len(args):len(args)], &ir.Var{Id: fast.Identifier{Name: param.Name, Value: param.Name}, Type: arg})
+	var body ast.Expr
+	if len(args) == g.arities[v.Id.Value] {
+		body = g.genCall(&ir.Call{Fun: v, Args: args})
+	} else {
+		body = g.genCurried(v, res, args)
+	}
+	return &ast.FuncLit{
+		Type: g.funcType(param, arg, res),
+		Body: &ast.BlockStmt{List: []ast.Stmt{ret(body)}},
+	}
+}
+
+// typed converts an untyped constant to the Go type, so that it keeps the type in an interface.
+func (g *generator) typed(value ast.Expr, t types.Type) ast.Expr {
+	if isConstant(value) && !g.isPolymorphic(t) {
+		return &ast.CallExpr{Fun: g.typeExpr(t), Args: []ast.Expr{value}}
+	}
+	return value
+}
+
+// goCall generates the direct use of a Go function or a member of a Go type, when the application supplies all its arguments.
+// It returns the statements to run before the value, and false if the application is not such a use.
+func (g *generator) goCall(app *ir.App) ([]ast.Stmt, ast.Expr, bool) {
+	switch fun := app.Fun.(type) {
+	case *ir.Var:
+		if f := g.externs[fun.Id.Value]; f != nil {
+			argType, resType, _ := types.AsArrow(g.decTypes[fun.Id.Value])
+			stmts, value := g.genGoCall(g.qualified(f), f.Type().(*gotypes.Signature), argType, resType, app.Arg)
+			return stmts, value, true
+		}
+	case *ir.Member:
+		_, resType, _ := types.AsArrow(fun.Type)
+		switch fun.Kind {
+		case interop.AllocMember:
+			var stmts []ast.Stmt
+			if _, ok := app.Arg.(*ir.Unit); !ok {
+				stmts = g.genStmts(app.Arg, discard)
+			}
+			return stmts, g.alloc(g.goType(resType)), true
+		case interop.FieldMember:
+			selector := &ast.SelectorExpr{X: g.genExp(app.Arg), Sel: ast.NewIdent(fun.Object.Name())}
+			return nil, g.convert(selector, fun.Object.Type(), g.goType(resType)), true
+		}
+		if !fun.Params {
+			sig := fun.Object.Type().(*gotypes.Signature)
+			method := &ast.SelectorExpr{X: g.genExp(app.Arg), Sel: ast.NewIdent(fun.Object.Name())}
+			stmts, value := g.genGoCall(method, sig, types.UnitType, resType, nil)
+			return stmts, value, true
+		}
+	case *ir.Primitive:
+		if builtin.Arity(fun.Name) == 1 {
+			stmts, value := g.genPrimitive(fun, app.Arg)
+			return stmts, value, true
+		}
+	case *ir.App:
+		if p, ok := fun.Fun.(*ir.Primitive); ok && builtin.Arity(p.Name) == 2 {
+			stmts, value := g.genPrimitive(p, fun.Arg, app.Arg)
+			return stmts, value, true
+		}
+		if m, ok := fun.Fun.(*ir.Member); ok && m.Kind == interop.MethodMember && m.Params {
+			_, methodType, _ := types.AsArrow(m.Type)
+			argType, resType, _ := types.AsArrow(methodType)
+			sig := m.Object.Type().(*gotypes.Signature)
+			recv := g.genExp(fun.Arg)
+			method := &ast.SelectorExpr{X: recv, Sel: ast.NewIdent(m.Object.Name())}
+			stmts, value := g.genGoCall(method, sig, argType, resType, app.Arg)
+			if _, ok := recv.(*ast.Ident); !ok && len(stmts) > 0 {
+				// the receiver is evaluated before the argument.
+				tmp := g.newName("t")
+				method.X = tmp
+				stmts = append([]ast.Stmt{define([]ast.Expr{tmp}, recv)}, stmts...)
+			}
+			return stmts, value, true
+		}
+	}
+	return nil, nil, false
+}
+
+// genPrimitive generates the application of a built-in function to all its arguments,
+// where goroutines and channels are used by the Go statements and operators.
+func (g *generator) genPrimitive(p *ir.Primitive, args ...ir.Exp) ([]ast.Stmt, ast.Expr) {
+	switch p.Name {
+	case builtin.Spawn:
+		call := &ast.CallExpr{Fun: g.genExp(args[0]), Args: []ast.Expr{unitLit()}}
+		return []ast.Stmt{&ast.GoStmt{Call: call}}, unitLit()
+	case builtin.Channel:
+		return nil, &ast.CallExpr{Fun: ast.NewIdent("make"), Args: []ast.Expr{g.typeExpr(types.Result(p.Type)), g.genExp(args[0])}}
+	case builtin.Send:
+		return []ast.Stmt{&ast.SendStmt{Chan: g.genExp(args[0]), Value: g.genExp(args[1])}}, unitLit()
+	case builtin.Recv:
+		return nil, &ast.UnaryExpr{Op: token.ARROW, X: g.genExp(args[0])}
+	case builtin.Close:
+		call := &ast.CallExpr{Fun: ast.NewIdent("close"), Args: []ast.Expr{g.genExp(args[0])}}
+		return []ast.Stmt{&ast.ExprStmt{X: call}}, unitLit()
+	case builtin.Assert:
+		cond := &ast.UnaryExpr{Op: token.NOT, X: parenthesize(g.genExp(args[0]), token.UnaryPrec)}
+		return []ast.Stmt{failIf(cond, stringLit(p.Pos+": assertion failed"))}, unitLit()
+	case builtin.AssertEqual:
+		// the values are evaluated once in order, and printed if they differ.
+		expected, actual := g.newName("expected"), g.newName("actual")
+		t, _, _ := types.AsArrow(p.Type)
+		value := func(arg ir.Exp) ast.Expr {
+			v := g.genExp(arg)
+			if isConstant(v) && !g.isPolymorphic(t) {
+				// the constants have the type of the values, e.g. int64 rather than int.
+				return &ast.CallExpr{Fun: g.typeExpr(t), Args: []ast.Expr{v}}
+			}
+			return v
+		}
+		message := &ast.CallExpr{Fun: g.qualified(sprintf), Args: []ast.Expr{
+			stringLit(p.Pos + ": assertEqual failed: expected %v, got %v"), expected, actual,
+		}}
+		return []ast.Stmt{
+			define([]ast.Expr{expected, actual}, value(args[0]), value(args[1])),
+			failIf(&ast.BinaryExpr{X: expected, Op: token.NEQ, Y: actual}, message),
+		}, unitLit()
+	}
+	panic("Bug: unknown built-in function " + p.Name)
+}
+
+// sprintf is fmt.Sprintf, which formats the messages of the assertions.
+var sprintf = gotypes.NewFunc(token.NoPos, gotypes.NewPackage("fmt", "fmt"), "Sprintf", nil)
+
+// failIf generates a statement which panics with a message if a condition holds.
+func failIf(cond ast.Expr, message ast.Expr) ast.Stmt {
+	call := &ast.CallExpr{Fun: ast.NewIdent("panic"), Args: []ast.Expr{message}}
+	return &ast.IfStmt{Cond: cond, Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: call}}}}
+}
+
+func stringLit(s string) ast.Expr {
+	return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
+}
+
+// alloc generates the zero value of a Go type, or a pointer to a new zero value.
+func (g *generator) alloc(gt gotypes.Type) ast.Expr {
+	if ptr, ok := gt.(*gotypes.Pointer); ok {
+		return &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{g.goTypeExpr(ptr.Elem())}}
+	}
+	return &ast.StarExpr{X: &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{g.goTypeExpr(gt)}}}
+}
+
+// genGoCall generates a call of a Go function or method, where the argument is spread into the parameters,
+// and the results are collected into the value. A nil argument means that the function has no parameters.
+func (g *generator) genGoCall(fun ast.Expr, sig *gotypes.Signature, argType, resType types.Type, arg ir.Exp) ([]ast.Stmt, ast.Expr) {
+	params := interop.Spread(argType)
+	var stmts []ast.Stmt
+	var args []ast.Expr
+	switch len(params) {
+	case 0:
+		if _, ok := arg.(*ir.Unit); !ok && arg != nil {
+			stmts = g.genStmts(arg, discard)
+		}
+	case 1:
+		args = []ast.Expr{g.genExp(arg)}
+	default:
+		if tuple, ok := arg.(*ir.Tuple); ok {
+			for _, element := range tuple.Elements {
+				args = append(args, g.genExp(element))
+			}
+		} else {
+			tmp := g.newName("t")
+			stmts = []ast.Stmt{define([]ast.Expr{tmp}, g.genExp(arg))}
+			for i := range params {
+				args = append(args, field(tmp, i))
+			}
+		}
+	}
+	for i, param := range params {
+		args[i] = g.convert(args[i], g.goType(param), sig.Params().At(i).Type())
+	}
+	call := &ast.CallExpr{Fun: fun, Args: args}
+
+	mode := interop.ErrorModeOf(resType, sig.Results())
+	if mode == interop.ErrorValue {
+		results := interop.Spread(resType)
+		switch len(results) {
+		case 0:
+			return append(stmts, &ast.ExprStmt{X: call}), unitLit()
+		case 1:
+			return stmts, g.convert(call, sig.Results().At(0).Type(), g.goType(results[0]))
+		}
+		values := make([]ast.Expr, len(results))
+		for i := range values {
+			values[i] = g.newName("r")
+		}
+		stmts = append(stmts, define(values, call))
+		return stmts, g.collectResults(values, sig.Results(), resType)
+	}
+
+	// the last result is an error, which is handled by the mode.
+	values := make([]ast.Expr, sig.Results().Len())
+	for i := range values {
+		values[i] = g.newName("r")
+	}
+	stmts = append(stmts, define(values, call))
+	last := len(values) - 1
+	err := values[last]
+	if mode == interop.ErrorPanic {
+		stmts = append(stmts, &ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: err, Op: token.NEQ, Y: ast.NewIdent("nil")},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("panic"), Args: []ast.Expr{err}}}}},
+		})
+		return stmts, g.collectResults(values[:last], sig.Results(), resType)
+	}
+	valueType, _, _ := types.AsResult(resType)
+	return stmts, &ast.CompositeLit{Type: g.typeExpr(resType), Elts: []ast.Expr{
+		&ast.KeyValueExpr{Key: ast.NewIdent(interop.ResultOkField), Value: &ast.BinaryExpr{X: err, Op: token.EQL, Y: ast.NewIdent("nil")}},
+		&ast.KeyValueExpr{Key: ast.NewIdent(interop.ResultValueField), Value: g.collectResults(values[:last], sig.Results(), valueType)},
+		&ast.KeyValueExpr{Key: ast.NewIdent(interop.ResultErrField), Value: err},
+	}}
+}
+
+// collectResults makes a value of the type from the values of Go results, as Spread describes.
+func (g *generator) collectResults(values []ast.Expr, results *gotypes.Tuple, t types.Type) ast.Expr {
+	ts := interop.Spread(t)
+	switch len(ts) {
+	case 0:
+		return unitLit()
+	case 1:
+		return g.convert(values[0], results.At(0).Type(), g.goType(t))
+	}
+	elements := make([]ast.Expr, len(ts))
+	for i, element := range ts {
+		elements[i] = g.convert(values[i], results.At(i).Type(), g.goType(element))
+	}
+	return &ast.CompositeLit{Type: g.typeExpr(t), Elts: elements}
+}
+
+// genGoFunc wraps a Go function or a member of a Go type in curried function literals of the arity,
+// so that it can be used as a value.
+func (g *generator) genGoFunc(fun ir.Exp, t types.Type, arity int) ast.Expr {
+	arg, res, _ := types.AsArrow(t)
+	param := g.newName("x")
+	app := &ir.App{Fun: fun, Arg: &ir.Var{Id: fast.Identifier{Name: param.Name, Value: param.Name}, Type: arg}}
+	var body []ast.Stmt
+	if arity == 1 {
+		body = g.genStmts(app, ret)
+	} else {
+		body = []ast.Stmt{ret(g.genGoFunc(app, res, arity-1))}
+	}
+	return &ast.FuncLit{
+		Type: g.funcType(param, arg, res),
+		Body: &ast.BlockStmt{List: body},
+	}
+}
+
+func define(lhs []ast.Expr, values ...ast.Expr) ast.Stmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: token.DEFINE, Rhs: values}
+}
+
+func varDecl(id *ast.Ident, t ast.Expr) *ast.GenDecl {
+	return &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{&ast.ValueSpec{Names: []*ast.Ident{id}, Type: t}}}
+}
+
+func funcDecl(name string, stmts []ast.Stmt) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Name: ast.NewIdent(name),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: stmts},
+	}
+}
+
+func unitLit() ast.Expr {
+	return &ast.CompositeLit{Type: unitType()}
+}
+
+// unitType is struct{}, since any valid positions on a line make the printer keep the braces together.
+func unitType() ast.Expr {
+	return &ast.StructType{Fields: &ast.FieldList{Opening: 1, Closing: 1}}
+}
+
+func isUnit(value ast.Expr) bool {
+	if lit, ok := value.(*ast.CompositeLit); ok {
+		if s, ok := lit.Type.(*ast.StructType); ok {
+			return len(s.Fields.List) == 0
+		}
+	}
+	return false
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+// parenthesize wraps an operand in parentheses, when its precedence is lower than the operator's.
+func parenthesize(operand ast.Expr, prec int) ast.Expr {
+	var p int
+	switch e := operand.(type) {
+	case *ast.BinaryExpr:
+		p = e.Op.Precedence()
+	case *ast.UnaryExpr:
+		p = token.UnaryPrec
+	default:
+		return operand
+	}
+	if p < prec {
+		return &ast.ParenExpr{X: operand}
 	}
+	return operand
 }
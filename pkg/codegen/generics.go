@@ -0,0 +1,284 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/builtin"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+	"go/ast"
+	"go/constant"
+	"go/printer"
+	"go/token"
+	gotypes "go/types"
+)
+
+// generic is a polymorphic top level function, which becomes a Go generic function.
+// Local functions and values cannot have type parameters in Go, so their type variables are the empty interface,
+// unless the local functions are specialized per instance beforehand.
+type generic struct {
+	vars        []*types.Var                      // the generic type variables in order of occurrence
+	constraints map[*types.Var]constraint         // the constraint of each variable, by the operations on its values
+	params      map[*types.Var]*gotypes.TypeParam // the Go type parameter of each variable
+}
+
+// constraint is the Go constraint of a type parameter, where each one is satisfied by the types of the next ones.
+type constraint int
+
+const (
+	anyConstraint        constraint = iota
+	comparableConstraint            // compared by equality, or the key of a map
+	numberConstraint                // added, negated or ordered, i.e. int or float
+	integerConstraint               // the remainder of a division, i.e. int
+)
+
+// newGeneric finds the type variables of a function and the constraints of their values in its body.
+// It returns nil if the function is monomorphic.
+func newGeneric(dec *ir.FunDec, nonGeneric map[*types.Var]bool) *generic {
+	gen := &generic{constraints: constrainedVars(dec.Body), params: map[*types.Var]*gotypes.TypeParam{}}
+	forEachCtor(dec.EnvType(), interop.MapCtor, func(ctor *types.CtorType) {
+		for _, v := range types.Vars(ctor.Args[0]) {
+			gen.constrain(v, comparableConstraint)
+		}
+	})
+	for _, v := range types.Vars(dec.EnvType()) {
+		if !nonGeneric[v] {
+			gen.vars = append(gen.vars, v)
+		}
+	}
+	if len(gen.vars) == 0 {
+		return nil
+	}
+	return gen
+}
+
+// constrain raises the constraint of a type variable, and returns whether it changed.
+func (gen *generic) constrain(v *types.Var, c constraint) bool {
+	if c <= gen.constraints[v] {
+		return false
+	}
+	gen.constraints[v] = c
+	return true
+}
+
+// makeParams makes a Go type parameter of each type variable, whose constraint is final.
+func (gen *generic) makeParams() {
+	for i, v := range gen.vars {
+		obj := gotypes.NewTypeName(token.NoPos, nil, typeParamName(i), nil)
+		gen.params[v] = gotypes.NewTypeParam(obj, gen.constraints[v].goType())
+	}
+}
+
+// goType returns the Go interface of a constraint.
+func (c constraint) goType() *gotypes.Interface {
+	switch c {
+	case comparableConstraint:
+		return gotypes.Universe.Lookup("comparable").Type().Underlying().(*gotypes.Interface)
+	case numberConstraint, integerConstraint:
+		terms := []*gotypes.Term{gotypes.NewTerm(true, gotypes.Typ[gotypes.Int64])}
+		if c == numberConstraint {
+			terms = append(terms, gotypes.NewTerm(true, gotypes.Typ[gotypes.Float64]))
+		}
+		return gotypes.NewInterfaceType(nil, []gotypes.Type{gotypes.NewUnion(terms)})
+	}
+	return gotypes.NewInterfaceType(nil, nil)
+}
+
+// String returns the Go name of a constraint, where the number and integer constraints are declared by constraintDecls.
+func (c constraint) String() string {
+	return [...]string{"any", "comparable", "number", "integer"}[c]
+}
+
+// constraintDecls declares the constraints of numbers which the generic functions use, e.g.
+//
+//	type number interface{ ~int64 | ~float64 }
+//
+// Their names never clash with the generated identifiers, which have numeric suffixes.
+func constraintDecls(generics map[string]*generic) []ast.Decl {
+	used := map[constraint]bool{}
+	for _, gen := range generics {
+		for _, c := range gen.constraints {
+			used[c] = true
+		}
+	}
+	var decls []ast.Decl
+	for _, c := range []constraint{numberConstraint, integerConstraint} {
+		if !used[c] {
+			continue
+		}
+		var union ast.Expr = &ast.UnaryExpr{Op: token.TILDE, X: ast.NewIdent("int64")}
+		if c == numberConstraint {
+			union = &ast.BinaryExpr{X: union, Op: token.OR, Y: &ast.UnaryExpr{Op: token.TILDE, X: ast.NewIdent("float64")}}
+		}
+		iface := &ast.InterfaceType{Methods: &ast.FieldList{List: []*ast.Field{{Type: union}}}}
+		decls = append(decls, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{&ast.TypeSpec{Name: ast.NewIdent(c.String()), Type: iface}}})
+	}
+	return decls
+}
+
+// typeParamName returns A, B, ..., Z, A1, B1 and so on, which never clash with the generated identifiers.
+func typeParamName(i int) string {
+	name := string(rune('A' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
+
+// typeParamList generates the type parameters of a generic function.
+func (gen *generic) typeParamList() *ast.FieldList {
+	fields := make([]*ast.Field, len(gen.vars))
+	for i, v := range gen.vars {
+		fields[i] = &ast.Field{Names: []*ast.Ident{ast.NewIdent(gen.params[v].Obj().Name())}, Type: ast.NewIdent(gen.constraints[v].String())}
+	}
+	return &ast.FieldList{List: fields}
+}
+
+// inferable returns whether Go infers all the type arguments from an argument of the type.
+func (gen *generic) inferable(param types.Type) bool {
+	occurs := map[*types.Var]bool{}
+	for _, v := range types.Vars(param) {
+		occurs[v] = true
+	}
+	for _, v := range gen.vars {
+		if !occurs[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// instantiate generates a generic function with explicit type arguments, which are found by matching its type against the instance.
+// A type variable which the instance leaves unbound is the empty interface, or int if it has to be a number.
+func (g *generator) instantiate(v *ir.Var, gen *generic) ast.Expr {
+	bindings := map[*types.Var]types.Type{}
+	types.Match(g.decTypes[v.Id.Value], v.Type, bindings)
+	args := make([]ast.Expr, len(gen.vars))
+	for i, tv := range gen.vars {
+		if t, ok := bindings[tv]; ok {
+			args[i] = g.typeExpr(t)
+		} else if gen.constraints[tv] >= numberConstraint {
+			args[i] = ast.NewIdent("int64")
+		} else {
+			args[i] = ast.NewIdent("any")
+		}
+	}
+	if len(args) == 1 {
+		return &ast.IndexExpr{X: name(v.Id), Index: args[0]}
+	}
+	return &ast.IndexListExpr{X: name(v.Id), Indices: args}
+}
+
+// constrainedVars returns the constraints of the type variables of the values which are compared, e.g. by assertEqual,
+// or which are operands of arithmetic operators.
+func constrainedVars(body ir.Exp) map[*types.Var]constraint {
+	result := map[*types.Var]constraint{}
+	constrain := func(t types.Type, c constraint) {
+		for _, v := range types.Vars(t) {
+			if c > result[v] {
+				result[v] = c
+			}
+		}
+	}
+	ir.Inspect(body, func(exp ir.Exp) bool {
+		switch e := exp.(type) {
+		case *ir.BinaryOp:
+			switch e.Op {
+			case ir.Eq, ir.NotEq:
+				constrain(ir.TypeOf(e.Left), comparableConstraint)
+			case ir.Mod:
+				constrain(ir.TypeOf(e.Left), integerConstraint)
+			case ir.Add, ir.Minus, ir.Mul, ir.Div, ir.Less, ir.LessEq, ir.Greater, ir.GreaterEq:
+				constrain(ir.TypeOf(e.Left), numberConstraint)
+			}
+		case *ir.Neg:
+			constrain(ir.TypeOf(e.Child), numberConstraint)
+		case *ir.Primitive:
+			if e.Name == builtin.AssertEqual {
+				constrain(e.Type, comparableConstraint)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// propagate raises the constraints of a generic function to those of the generic functions which it refers to,
+// e.g. a function which calls another one to add its arguments adds them too. It returns whether a constraint changed.
+func (g *generator) propagate(dec *ir.FunDec) bool {
+	gen := g.generics[dec.Id.Value]
+	generic := map[*types.Var]bool{}
+	for _, v := range gen.vars {
+		generic[v] = true
+	}
+	changed := false
+	ir.Inspect(dec.Body, func(exp ir.Exp) bool {
+		v, ok := exp.(*ir.Var)
+		if !ok || g.generics[v.Id.Value] == nil {
+			return true
+		}
+		callee := g.generics[v.Id.Value]
+		bindings := map[*types.Var]types.Type{}
+		types.Match(g.decTypes[v.Id.Value], v.Type, bindings)
+		for _, cv := range callee.vars {
+			t, ok := bindings[cv]
+			if !ok {
+				continue
+			}
+			for _, w := range types.Vars(t) {
+				if generic[w] && gen.constrain(w, callee.constraints[cv]) {
+					changed = true
+				}
+			}
+		}
+		return true
+	})
+	return changed
+}
+
+// forEachCtor calls f with each type of the constructor in a type.
+func forEachCtor(t types.Type, name string, f func(*types.CtorType)) {
+	if ty, ok := t.Prune().(*types.CtorType); ok {
+		if ty.Ctor == name && len(ty.Args) > 0 {
+			f(ty)
+		}
+		for _, arg := range ty.Args {
+			forEachCtor(arg, name, f)
+		}
+	}
+}
+
+// isConstant returns whether a Go expression is constant, whose type Go cannot infer as the Go type of the value, e.g. int for 1.
+func isConstant(exp ast.Expr) bool {
+	switch e := exp.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		return e.Name == "true" || e.Name == "false"
+	case *ast.ParenExpr:
+		return isConstant(e.X)
+	case *ast.UnaryExpr:
+		return e.Op != token.ARROW && isConstant(e.X)
+	case *ast.BinaryExpr:
+		return isConstant(e.X) && isConstant(e.Y)
+	}
+	return false
+}
+
+// isZero returns whether a Go expression is a constant whose value is zero, e.g. 2 - 2.
+func isZero(exp ast.Expr) bool {
+	if !isConstant(exp) {
+		return false
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), exp); err != nil {
+		return false
+	}
+	tv, err := gotypes.Eval(token.NewFileSet(), nil, token.NoPos, buf.String())
+	if err != nil || tv.Value == nil {
+		return false
+	}
+	kind := tv.Value.Kind()
+	return (kind == constant.Int || kind == constant.Float) && constant.Sign(tv.Value) == 0
+}
@@ -0,0 +1,160 @@
+package codegen
+
+import (
+	"github.com/lilac/fun-lang/pkg/ir"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// loop is the body of a function which jumps, i.e. makes tail calls to itself or to other functions of its recursive declaration.
+type loop struct {
+	funs    []*ir.FunDec // the functions whose bodies are in the loop, where the first is the function itself
+	state   *ast.Ident   // the index of the function to run, or nil if the loop has one function
+	current int          // the index of the function whose body is being generated
+}
+
+// genFuncBody generates the statements of a function body.
+// A function which jumps is a loop, which switches between the bodies of the functions if it jumps to any other,
+// whose parameters are declared before the loop.
+func (g *generator) genFuncBody(dec *ir.FunDec, group []*ir.FunDec) []ast.Stmt {
+	funs := loopFuncs(dec, group)
+	if funs == nil {
+		return g.genStmts(dec.Body, ret)
+	}
+	outer := g.loop
+	g.loop = &loop{funs: funs}
+	defer func() { g.loop = outer }()
+	for _, fun := range funs {
+		for _, param := range params(fun) {
+			g.loopVars[param.Id.Value] = true
+		}
+	}
+
+	var stmts []ast.Stmt
+	declared := map[string]bool{}
+	for _, param := range params(dec) {
+		declared[param.Id.Value] = true
+	}
+	for _, fun := range funs[1:] {
+		for _, param := range params(fun) {
+			if !declared[param.Id.Value] && g.used[param.Id.Value] {
+				stmts = append(stmts, &ast.DeclStmt{Decl: varDecl(name(param.Id), g.typeExpr(param.Type))})
+			}
+			declared[param.Id.Value] = true
+		}
+	}
+
+	if len(funs) == 1 {
+		return append(stmts, &ast.ForStmt{Body: &ast.BlockStmt{List: g.genStmts(dec.Body, ret)}})
+	}
+	g.loop.state = g.newName("s")
+	stmts = append(stmts, define([]ast.Expr{g.loop.state}, intLit(0)))
+	clauses := make([]ast.Stmt, len(funs))
+	for i, fun := range funs {
+		g.loop.current = i
+		clauses[i] = &ast.CaseClause{List: []ast.Expr{intLit(i)}, Body: g.genStmts(fun.Body, ret)}
+	}
+	body := &ast.SwitchStmt{Tag: g.loop.state, Body: &ast.BlockStmt{List: clauses}}
+	return append(stmts, &ast.ForStmt{Body: &ast.BlockStmt{List: []ast.Stmt{body}}})
+}
+
+// genJump assigns the arguments of a jump to the parameters of the function, and continues the loop with its body.
+// The parameters which are not used are assigned to the blank identifier, since the arguments may have side effects.
+func (g *generator) genJump(jump *ir.Jump) []ast.Stmt {
+	target := g.loop.index(jump)
+	var lhs, rhs []ast.Expr
+	for i, param := range params(g.loop.funs[target]) {
+		arg := jump.Args[i]
+		if isVar(arg, param) {
+			continue
+		}
+		var id ast.Expr = name(param.Id)
+		if !g.used[param.Id.Value] {
+			id = ast.NewIdent("_")
+		}
+		value := g.genExp(arg)
+		if g.isPolymorphic(param.Type) {
+			value = g.typed(value, ir.TypeOf(arg))
+		}
+		lhs = append(lhs, id)
+		rhs = append(rhs, value)
+	}
+	var stmts []ast.Stmt
+	if len(lhs) > 0 {
+		stmts = append(stmts, &ast.AssignStmt{Lhs: lhs, Tok: token.ASSIGN, Rhs: rhs})
+	}
+	if g.loop.state != nil && target != g.loop.current {
+		stmts = append(stmts, assignTo(g.loop.state)(intLit(target)))
+	}
+	return append(stmts, &ast.BranchStmt{Tok: token.CONTINUE})
+}
+
+func (l *loop) index(jump *ir.Jump) int {
+	for i, fun := range l.funs {
+		if fun.Id.Value == jump.Fun.Id.Value {
+			return i
+		}
+	}
+	panic("Bug: a jump out of the loop")
+}
+
+// loopFuncs returns the function and the functions of the group which it jumps to, directly or not,
+// or nil if the function does not jump.
+func loopFuncs(dec *ir.FunDec, group []*ir.FunDec) []*ir.FunDec {
+	funs := []*ir.FunDec{dec}
+	found := map[string]bool{dec.Id.Value: true}
+	jumps := false
+	for i := 0; i < len(funs); i++ {
+		forEachJump(funs[i].Body, func(jump *ir.Jump) {
+			jumps = true
+			if found[jump.Fun.Id.Value] {
+				return
+			}
+			found[jump.Fun.Id.Value] = true
+			for _, fun := range group {
+				if fun.Id.Value == jump.Fun.Id.Value {
+					funs = append(funs, fun)
+				}
+			}
+		})
+	}
+	if !jumps {
+		return nil
+	}
+	return funs
+}
+
+// forEachJump calls f with each jump in tail position of a function body, which excludes the jumps of local functions.
+func forEachJump(exp ir.Exp, f func(*ir.Jump)) {
+	switch e := exp.(type) {
+	case *ir.Jump:
+		f(e)
+	case *ir.IfThen:
+		forEachJump(e.Then, f)
+		forEachJump(e.Else, f)
+	case *ir.LetIn:
+		forEachJump(e.Body, f)
+	case *ir.Sequence:
+		forEachJump(e.Elements[len(e.Elements)-1], f)
+	case *ir.Select:
+		for _, arm := range e.Arms {
+			forEachJump(arm.Body, f)
+		}
+	}
+}
+
+// params returns the free variables and then the arguments of a function, which a jump assigns in order.
+func params(dec *ir.FunDec) []ir.Arg {
+	return append(append([]ir.Arg{}, dec.Env...), dec.Args...)
+}
+
+// isVar returns whether an argument is the parameter itself, e.g. a free variable passed on, which needs no assignment.
+func isVar(arg ir.Exp, param ir.Arg) bool {
+	v, ok := arg.(*ir.Var)
+	return ok && v.Id.Value == param.Id.Value
+}
+
+func intLit(i int) ast.Expr {
+	return &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(i)}
+}
@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	fast "github.com/lilac/fun-lang/pkg/ast"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Test is a test of a module, which is a top level function of the type unit -> unit.
+type Test struct {
+	Name string          // the name of the test in the source, e.g. test_add
+	Id   fast.Identifier // the unique name of the function
+}
+
+// GoName returns the name of the Go test function of a test, e.g. Test_add of test_add.
+func (t Test) GoName() string {
+	return "Test_" + strings.TrimPrefix(t.Name, "test_")
+}
+
+// GenerateTests generates a Go test file of the main package, which has a Go test function for each test.
+// A test fails with the value of a panic of the function, e.g. of a failed assertion, which has the position
+// of the assertion in the source. The value is printed as it is, since t.Fatal would prefix it with the position
+// of the Go code.
+func GenerateTests(tests []Test) *ast.File {
+	imports := &ast.GenDecl{Tok: token.IMPORT, Lparen: 1}
+	for _, path := range []string{"fmt", "testing"} {
+		imports.Specs = append(imports.Specs, &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}})
+	}
+	decls := []ast.Decl{imports}
+	for _, t := range tests {
+		decls = append(decls, testFunc(t))
+	}
+	return &ast.File{Name: ast.NewIdent("main"), Decls: decls}
+}
+
+// testFunc declares the Go test function of a test:
+//
+//	func Test_add(t *testing.T) {
+//		defer func() {
+//			if r := recover(); r != nil {
+//				fmt.Println(r)
+//				t.FailNow()
+//			}
+//		}()
+//		test_add_1(struct{}{})
+//	}
+func testFunc(test Test) *ast.FuncDecl {
+	r, t := ast.NewIdent("r"), ast.NewIdent("t")
+	recovered := &ast.IfStmt{
+		Init: &ast.AssignStmt{Lhs: []ast.Expr{r}, Tok: token.DEFINE, Rhs: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent("recover")}}},
+		Cond: &ast.BinaryExpr{X: r, Op: token.NEQ, Y: ast.NewIdent("nil")},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{Fun: selector(ast.NewIdent("fmt"), "Println"), Args: []ast.Expr{r}}},
+			&ast.ExprStmt{X: &ast.CallExpr{Fun: selector(t, "FailNow")}},
+		}},
+	}
+	deferred := &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{recovered}},
+	}}}
+	run := &ast.ExprStmt{X: &ast.CallExpr{Fun: name(test.Id), Args: []ast.Expr{unitLit()}}}
+	param := &ast.Field{Names: []*ast.Ident{t}, Type: &ast.StarExpr{X: selector(ast.NewIdent("testing"), "T")}}
+	return &ast.FuncDecl{
+		Name: ast.NewIdent(test.GoName()),
+		Type: &ast.FuncType{Params: &ast.FieldList{List: []*ast.Field{param}}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{deferred, run}},
+	}
+}
@@ -0,0 +1,126 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/types"
+	"go/ast"
+	"go/token"
+	gotypes "go/types"
+	"strconv"
+)
+
+// goType returns the Go type of a type, as the mapping of the extern types maps it.
+func (g *generator) goType(t types.Type) gotypes.Type {
+	gt, err := g.mapping.ToGo(t)
+	if err != nil {
+		g.errorf("%v", err)
+		return interop.Any
+	}
+	return gt
+}
+
+// typeExpr returns the Go type expression of a type.
+func (g *generator) typeExpr(t types.Type) ast.Expr {
+	return g.goTypeExpr(g.goType(t))
+}
+
+// goTypeExpr returns the expression of a Go type, where the packages of named types are imported on demand.
+func (g *generator) goTypeExpr(gt gotypes.Type) ast.Expr {
+	if gotypes.Identical(gt, interop.Any) {
+		return ast.NewIdent("any")
+	}
+	switch ty := gt.(type) {
+	case *gotypes.Basic:
+		return ast.NewIdent(ty.Name())
+	case *gotypes.TypeParam:
+		return ast.NewIdent(ty.Obj().Name())
+	case *gotypes.Named:
+		if ty.Obj().Pkg() == nil {
+			return ast.NewIdent(ty.Obj().Name())
+		}
+		return g.qualified(ty.Obj())
+	case *gotypes.Pointer:
+		return &ast.StarExpr{X: g.goTypeExpr(ty.Elem())}
+	case *gotypes.Slice:
+		return &ast.ArrayType{Elt: g.goTypeExpr(ty.Elem())}
+	case *gotypes.Array:
+		return &ast.ArrayType{
+			Len: &ast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(ty.Len(), 10)},
+			Elt: g.goTypeExpr(ty.Elem()),
+		}
+	case *gotypes.Map:
+		return &ast.MapType{Key: g.goTypeExpr(ty.Key()), Value: g.goTypeExpr(ty.Elem())}
+	case *gotypes.Chan:
+		dir := map[gotypes.ChanDir]ast.ChanDir{gotypes.SendRecv: ast.SEND | ast.RECV, gotypes.SendOnly: ast.SEND, gotypes.RecvOnly: ast.RECV}
+		return &ast.ChanType{Dir: dir[ty.Dir()], Value: g.goTypeExpr(ty.Elem())}
+	case *gotypes.Struct:
+		fields := make([]*ast.Field, ty.NumFields())
+		for i := range fields {
+			field := ty.Field(i)
+			fields[i] = &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(field.Name())},
+				Type:  g.goTypeExpr(field.Type()),
+			}
+		}
+		if len(fields) == 0 {
+			return unitType()
+		}
+		return &ast.StructType{Fields: &ast.FieldList{List: fields}}
+	case *gotypes.Signature:
+		return &ast.FuncType{
+			Params:  g.fieldList(ty.Params()),
+			Results: g.fieldList(ty.Results()),
+		}
+	}
+	g.errorf("Go type %s cannot be generated", gt)
+	return ast.NewIdent("any")
+}
+
+func (g *generator) fieldList(tuple *gotypes.Tuple) *ast.FieldList {
+	fields := make([]*ast.Field, tuple.Len())
+	for i := range fields {
+		fields[i] = &ast.Field{Type: g.goTypeExpr(tuple.At(i).Type())}
+	}
+	return &ast.FieldList{List: fields}
+}
+
+// funcType returns the Go type of a function of one argument, where the argument is named when name is given.
+func (g *generator) funcType(name *ast.Ident, arg, res types.Type) *ast.FuncType {
+	param := &ast.Field{Type: g.typeExpr(arg)}
+	if name != nil {
+		param.Names = []*ast.Ident{name}
+	}
+	return &ast.FuncType{
+		Params:  &ast.FieldList{List: []*ast.Field{param}},
+		Results: &ast.FieldList{List: []*ast.Field{{Type: g.typeExpr(res)}}},
+	}
+}
+
+// convert converts a value to the Go type, when the Go types of the value differs.
+func (g *generator) convert(value ast.Expr, from, to gotypes.Type) ast.Expr {
+	if gotypes.Identical(from, to) {
+		return value
+	}
+	return &ast.CallExpr{Fun: g.goTypeExpr(to), Args: []ast.Expr{value}}
+}
+
+// isPolymorphic returns whether a type is a type variable after pruning, which is not a type parameter in scope.
+func (g *generator) isPolymorphic(t types.Type) bool {
+	_, ok := t.Prune().(*types.Var)
+	return ok && g.goType(t) == interop.Any
+}
+
+// field returns the selector of a tuple element.
+func field(tuple ast.Expr, i int) ast.Expr {
+	return selector(tuple, fmt.Sprintf("F%d", i))
+}
+
+// selector returns the selector of a struct field, where a composite literal is parenthesized
+// so that it is not taken as a block in a condition.
+func selector(value ast.Expr, name string) ast.Expr {
+	if _, ok := value.(*ast.CompositeLit); ok {
+		value = &ast.ParenExpr{X: value}
+	}
+	return &ast.SelectorExpr{X: value, Sel: ast.NewIdent(name)}
+}
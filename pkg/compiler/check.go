@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/match"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/typing"
+)
+
+// Check analyses the source like the compiler without generating code, i.e. it parses, renames and type-checks it,
+// and checks the matches of its functions. The diagnostics include the errors of all the passes which run,
+// since a pass runs even if the previous ones have errors, except on syntax errors.
+func Check(source *syntax.Source) []*diag.Diagnostic {
+	_, diagnostics := Analyse(source)
+	return diagnostics
+}
+
+// Analyse is Check, which also returns the typed module for the tools which look up the types of its declarations
+// and expressions. The module is nil on syntax errors, and its types are partial if it has other errors.
+func Analyse(source *syntax.Source) (*Typed, []*diag.Diagnostic) {
+	file, err := syntax.ParseFile(source)
+	if err != nil || file.Module == nil {
+		return nil, diag.From(err)
+	}
+	module := file.Module
+
+	transformer := alpha.NewTransformer()
+	transformer.Transform(module)
+	diagnostics := diag.From(transformer.Error())
+
+	externs, err := resolveExterns(module)
+	diagnostics = append(diagnostics, diag.From(err)...)
+
+	ti := &typing.TypeInference{Externals: externs}
+	env, err := ti.Infer(module)
+	// the inference reports an undefined variable again as an undefined symbol.
+	diagnostics = append(diagnostics, diag.Unreported(diagnostics, diag.From(err))...)
+
+	diagnostics = append(diagnostics, match.Check(module)...)
+	return &Typed{Module: module, File: file, Env: env, Inference: ti, externs: externs}, diagnostics
+}
@@ -0,0 +1,62 @@
+package compiler
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func check(lines ...string) []*diag.Diagnostic {
+	return Check(syntax.NewDummySource(strings.Join(lines, "\n")))
+}
+
+func codes(diagnostics []*diag.Diagnostic) []string {
+	var result []string
+	for _, d := range diagnostics {
+		result = append(result, d.Code)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	assert.Empty(t, check("fun fact 0 = 1 | fact n = n * fact (n - 1)", "val a = fact 5"))
+
+	diagnostics := check(
+		"fun get (Ok x) = x",
+		"val a = get (Ok 1) + true",
+		"val b = c",
+	)
+	assert.Equal(t, []string{diag.UndefinedVariable, diag.TypeMismatch, diag.NonExhaustiveMatch},
+		codes(diagnostics))
+	assert.True(t, diag.HasErrors(diagnostics))
+	assert.Equal(t, 2, diagnostics[1].Span.Start.Line)
+	assert.Equal(t, 22, diagnostics[1].Span.Start.Column)
+}
+
+func TestCheckSyntaxErrors(t *testing.T) {
+	diagnostics := check("val a = (1 +)", "val b = #")
+	assert.Equal(t, []string{diag.SyntaxError, diag.IllegalToken}, codes(diagnostics))
+}
+
+func TestCheckWarnings(t *testing.T) {
+	diagnostics := check("val f = fn true => 1 | false => 0 | b => 2")
+	assert.Equal(t, []string{diag.RedundantMatch}, codes(diagnostics))
+	assert.False(t, diag.HasErrors(diagnostics))
+}
+
+func TestAnalyse(t *testing.T) {
+	typed, diagnostics := Analyse(syntax.NewDummySource("fun twice f x = f (f x)\nval a = twice 1"))
+	assert.Equal(t, []string{diag.TypeMismatch}, codes(diagnostics))
+	if assert.NotNil(t, typed) {
+		// the types are partial, but those of the declarations before an error are known.
+		twice := typed.Module.Decs[0].(*ast.FunDec).Binds[0].Id
+		assert.Equal(t, "('a -> 'a) -> 'a -> 'a", types.Scheme(typed.Env[twice.Value]))
+	}
+	typed, diagnostics = Analyse(syntax.NewDummySource("val a = (1 +)"))
+	assert.Nil(t, typed)
+	assert.Equal(t, []string{diag.SyntaxError}, codes(diagnostics))
+}
@@ -2,43 +2,236 @@ package compiler
 
 import (
 	"fmt"
+	merror "github.com/hashicorp/go-multierror"
 	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/anf"
+	"github.com/lilac/fun-lang/pkg/ast"
 	"github.com/lilac/fun-lang/pkg/codegen"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/lift"
+	"github.com/lilac/fun-lang/pkg/mono"
+	"github.com/lilac/fun-lang/pkg/opt"
 	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/tailcall"
 	"github.com/lilac/fun-lang/pkg/typing"
-	"go/printer"
+	"github.com/lilac/fun-lang/pkg/uncurry"
+	goast "go/ast"
+	"go/format"
 	"go/token"
+	gotypes "go/types"
+	"io"
 	"os"
+	"sort"
 )
 
-func Compile(source *syntax.Source) error {
-	ti := typing.TypeInference{}
-	module, err := syntax.Parse(source)
+// Options selects the strategies of the translation.
+type Options struct {
+	// Monomorphize specializes polymorphic functions per instance, instead of generating Go generic functions.
+	// The local ones are specialized anyway, since Go functions cannot declare type parameters.
+	Monomorphize bool
+	// Lift lifts the local functions which do not escape to top level functions.
+	Lift bool
+	// OptLevel selects the optimisations of the ir, from 0 for none to opt.MaxLevel.
+	OptLevel int
+	// DumpIR receives the ir after the lowering and after each pass, if it is not nil.
+	DumpIR io.Writer
+	// DumpANF receives the A-normal form of the ir after the passes, if it is not nil.
+	DumpANF io.Writer
+	// TailCalls receives the tail calls which are not optimised, one per line, if it is not nil.
+	TailCalls io.Writer
+	// DumpTypes receives the types of the declared variables, e.g. val x$1 : int, if it is not nil.
+	DumpTypes io.Writer
+}
+
+func Compile(source *syntax.Source, options Options) error {
+	file, err := translate(source, options)
 	if err != nil {
 		return err
 	}
+	return format.Node(os.Stdout, token.NewFileSet(), file)
+}
+
+// translate compiles the source into a Go file.
+func translate(source *syntax.Source, options Options) (*goast.File, error) {
+	irModule, typed, err := lower(source, options, true)
+	if err != nil {
+		return nil, err
+	}
+	if options.DumpTypes != nil {
+		dumpTypeEnv(options.DumpTypes, typed)
+	}
+
+	// code generation
+	return codegen.Generate(irModule)
+}
+
+// Lower compiles the source into the ir which the interpreter runs, after the passes which the options select.
+func Lower(source *syntax.Source, options Options) (*ir.Module, error) {
+	irModule, _, err := lower(source, options, false)
+	return irModule, err
+}
+
+// lower is Lower, which also returns the typed module. If the ir is for the code generator, the polymorphic values
+// are specialized too, see optimise.
+func lower(source *syntax.Source, options Options, generate bool) (*ir.Module, *Typed, error) {
+	typed, err := Infer(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	ti := typed.Inference
+	irModule, err := optimise(lowerAst(typed.Module, typed.Env, ti.TypeOf, typed.externs), options, generate)
+	return irModule, typed, err
+}
+
+// Typed is a module which is type-checked, whose inference has the types of its expressions.
+type Typed struct {
+	Module    *ast.Module
+	File      *syntax.File   // the tokens of the module, e.g. for the code of an expression
+	Env       typing.TypeEnv // the types of the declarations by their alpha-renamed names
+	Inference *typing.TypeInference
+	externs   *externals
+}
+
+// Infer parses, renames and type-checks the source, and stops at the first pass which has errors.
+func Infer(source *syntax.Source) (*Typed, error) {
+	file, err := syntax.ParseFile(source)
+	if err != nil {
+		return nil, err
+	}
+	module := file.Module
 
 	transformer := alpha.NewTransformer()
 	transformer.Transform(module)
+	if err := transformer.Error(); err != nil {
+		return nil, err
+	}
 
+	externs, err := resolveExterns(module)
+	if err != nil {
+		return nil, err
+	}
+
+	ti := &typing.TypeInference{Externals: externs}
 	env, err := ti.Infer(module)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return &Typed{Module: module, File: file, Env: env, Inference: ti, externs: externs}, nil
+}
+
+// optimise runs the passes which the options select on a lowered module,
+// and prints the tail calls and the A-normal form if the options ask for them.
+// If the ir is for the code generator, the polymorphic values are specialized per instance like the local functions,
+// since Go values cannot be generic, whereas the interpreter keeps them.
+func optimise(irModule *ir.Module, options Options, generate bool) (*ir.Module, error) {
+	if options.DumpIR != nil {
+		opt.Dump(options.DumpIR, "lowered", irModule)
+	}
+	passes := &opt.Manager{Dump: options.DumpIR}
+	switch {
+	case options.Monomorphize:
+		passes.Add("mono", mono.Monomorphize)
+	case generate:
+		passes.Add("specialize", mono.SpecializeValues)
+	default:
+		passes.Add("specialize", mono.SpecializeLocals)
+	}
+	passes.Passes = append(passes.Passes, opt.Passes(options.OptLevel)...)
+	if options.Lift {
+		passes.Add("lift", lift.Lift)
+	}
+	passes.Add("uncurry", uncurry.Uncurry)
+	var misses []tailcall.Miss
+	passes.Add("tailcall", func(module *ir.Module) *ir.Module {
+		module, misses = tailcall.Eliminate(module)
+		return module
+	})
+	irModule = passes.Run(irModule)
+	if options.TailCalls != nil {
+		for _, miss := range misses {
+			fmt.Fprintln(options.TailCalls, miss)
+		}
+	}
+	if options.DumpANF != nil {
+		anfModule := anf.Convert(irModule)
+		if err := anf.Validate(anfModule); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(options.DumpANF, "%v\n", anfModule)
 	}
-	dumpTypeEnv(env)
+	return irModule, nil
+}
 
-	irModule := lowerAst(module, env)
-	fmt.Println(irModule)
+// externals holds the Go members bound by extern declarations.
+// Its importer maps the extern types to Go types, and provides the types of their members.
+type externals struct {
+	*interop.Importer
+	funcs map[*ast.ExternDec]*gotypes.Func
+	types map[*ast.ExternTypeDec]*gotypes.Named
+}
 
-	// code generation
-	fun := codegen.GenFunction(nil)
-	printer.Fprint(os.Stdout, token.NewFileSet(), fun)
-	return nil
+// resolveExterns binds the Go function or type of each extern declaration, in the order of declaration.
+func resolveExterns(module *ast.Module) (*externals, error) {
+	externs := newExternals()
+	return externs, externs.resolve(module)
+}
+
+func newExternals() *externals {
+	return &externals{
+		Importer: interop.NewImporter(),
+		funcs:    map[*ast.ExternDec]*gotypes.Func{},
+		types:    map[*ast.ExternTypeDec]*gotypes.Named{},
+	}
 }
 
-func dumpTypeEnv(env typing.TypeEnv) {
-	for name, t := range env {
-		typ := t.String()
-		fmt.Printf("val %s : %s\n", name, typ)
+// resolve binds the extern declarations of a module, whose types are added to those of the previous modules.
+func (externs *externals) resolve(module *ast.Module) error {
+	var errors *merror.Error
+	for _, dec := range module.Decs {
+		switch extern := dec.(type) {
+		case *ast.ExternDec:
+			fun, err := externs.Resolve(extern)
+			errors = merror.Append(errors, err)
+			externs.funcs[extern] = fun
+		case *ast.ExternTypeDec:
+			named, err := externs.ResolveType(extern)
+			errors = merror.Append(errors, err)
+			externs.types[extern] = named
+		}
+	}
+	return errors.ErrorOrNil()
+}
+
+// dumpTypeEnv writes the types of the declared variables in the order of their declarations in the source.
+func dumpTypeEnv(w io.Writer, typed *Typed) {
+	type declaration struct {
+		id  ast.Identifier
+		pos int
+	}
+	var declarations []declaration
+	declare := func(id ast.Identifier, exp ast.Exp) {
+		declarations = append(declarations, declaration{id, exp.Start().Offset})
+	}
+	ast.Inspect(typed.Module, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *ast.ValDec:
+			declare(n.Arg.Id, n)
+		case *ast.ExternDec:
+			declare(n.Arg.Id, n)
+		case *ast.FunDec:
+			declare(n.Binds[0].Id, &n.Binds[0])
+		case *ast.VarPattern:
+			declare(n.Id, n)
+		}
+		return true
+	})
+	sort.SliceStable(declarations, func(i, j int) bool {
+		return declarations[i].pos < declarations[j].pos
+	})
+	for _, d := range declarations {
+		if t, ok := typed.Env[d.id.Value]; ok {
+			fmt.Fprintf(w, "val %s : %s\n", d.id.Value, t)
+		}
 	}
 }
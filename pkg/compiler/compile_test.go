@@ -0,0 +1,652 @@
+package compiler
+
+import (
+	"bytes"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/opt"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	goast "go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compileAndCheck compiles the program into Go source, and type checks the source with the Go type checker.
+func compileAndCheck(t *testing.T, lines []string) string {
+	return compileAndCheckWith(t, lines, Options{})
+}
+
+func compileAndCheckWith(t testing.TB, lines []string, options Options) string {
+	src := syntax.NewDummySource(strings.Join(lines, "\n"))
+	file, err := translate(src, options)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, format.Node(&buf, token.NewFileSet(), file))
+	code := buf.String()
+
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, "main.go", code, 0)
+	if !assert.NoError(t, err, code) {
+		t.FailNow()
+	}
+	config := gotypes.Config{Importer: importer.Default()}
+	_, err = config.Check("main", fset, []*goast.File{parsed}, nil)
+	assert.NoError(t, err, code)
+	return code
+}
+
+// compileAndBuild compiles the program into a Go module, vets and builds it, and returns the path of the executable.
+func compileAndBuild(t testing.TB, lines []string, options Options) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	code := compileAndCheckWith(t, lines, options)
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module main\n\ngo 1.18\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0644))
+	for _, args := range [][]string{{"vet", "."}, {"build", "-o", "main", "."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); !assert.NoError(t, err, "%s\n%s", out, code) {
+			t.FailNow()
+		}
+	}
+	return filepath.Join(dir, "main")
+}
+
+// run runs an executable, and returns its exit code, which a program sets by exit, i.e. os.Exit.
+func run(t testing.TB, path string) int {
+	out, err := exec.Command(path).CombinedOutput()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode()
+	}
+	assert.NoError(t, err, "%s", out)
+	return 0
+}
+
+// compileAndRun compiles the program into a Go module, vets and runs it, and returns its exit code.
+func compileAndRun(t *testing.T, lines []string, options Options) int {
+	return run(t, compileAndBuild(t, lines, options))
+}
+
+func TestCompileFunctions(t *testing.T) {
+	lines := []string{
+		"fun fib 0 = 0 | fib 1 = 1 | fib n = fib (n - 1) + fib (n - 2)",
+		"fun id x = x",
+		"val n = id 3 + fib 10",
+		"val t = let val x = 1 val y = 2 in (x, not true) end",
+		"val s = let val c = fn true => \"yes\" | false => \"no\" in c (n > 3); c false end",
+		"fun inc x = x + 1",
+		"val i = let val k = 3 * 4 val b = not true in if b then 0 else inc k end",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "func fib_1(_arg1 int64) int64 {")
+	assert.Contains(t, code, "func id_3[A any](x_4 A) A {")
+	assert.Contains(t, code, "id_3[int64](3)")
+	// a constant expression has the Go type of the value, rather than int.
+	assert.Contains(t, code, "var k_13 int64 = 3 * 4")
+	assert.Contains(t, code, "var b_14 bool = !true")
+}
+
+func TestDumpTypes(t *testing.T) {
+	lines := []string{"fun id x = x", "val n = id 1"}
+	var types bytes.Buffer
+	compileAndCheckWith(t, lines, Options{DumpTypes: &types})
+	assert.Equal(t, "val id$1 : 'a -> 'a\nval x$2 : 'a\nval n$3 : int\n", types.String())
+}
+
+func TestCompileGenerics(t *testing.T) {
+	lines := []string{
+		"fun pair x y = (x, y)",
+		"fun eq x y = x = y",
+		"fun apply f x = f x",
+		"fun twice f x = apply f (apply f x)",
+		"fun empty () = channel 1",
+		"val s = \"a\"",
+		"val p = pair s true",
+		"val b = eq s \"b\" && eq 1 2",
+		"val n = twice (fn x => x + 1) 0",
+		"val c = empty ()",
+		"val f = pair 1",
+		"val m = let fun id x = x in (id 1, id s) end",
+		"val q = let val g = fn x => x in (g 1, g s) end",
+		"val h = fn x => x",
+		"val r = h 1",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "func pair_1[A any, B any](x_2 A, y_3 B) struct {")
+	assert.Contains(t, code, "func eq_4[A comparable](x_5 A, y_6 A) bool {")
+	assert.Contains(t, code, "pair_1[string, bool](s_")
+	assert.Contains(t, code, "eq_4[int64](1, 2)")
+	assert.Contains(t, code, "apply_7(f_11, apply_7(f_11, x_12))")
+	assert.Contains(t, code, "empty_13[any](struct{}{})")
+	// a local function or a value is specialized per instance.
+	assert.Contains(t, code, "id_21_int := func(x_22 int64) int64 {")
+	assert.Contains(t, code, "id_21_string := func(x_22 string) string {")
+	assert.Contains(t, code, "{g_25_int(1), g_25_string(s_14)}")
+	assert.Contains(t, code, "r_29 = h_28_int(1)")
+}
+
+func TestCompileGenericValues(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"val add = fn x => fn y => x + y",
+		"val k = fn x => fn y => x",
+		"val f = k 1",
+		"val get = fn Ok x => x | Err _ => 0",
+		"val h = fn x => x",
+		"fun g y = (h y; h 1)",
+		"val _ = exit (add 1 2 + f true + get (Ok 3) + get (Err \"e\") + g true)",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "var add_4_int func(int64) func(int64) int64")
+	assert.Contains(t, code, "var k_7_int_bool func(int64) func(bool) int64")
+	// an instance for the type parameter of a generic function is boxed.
+	assert.Contains(t, code, "func g_14[A any](y_15 A) int64 {")
+	assert.Contains(t, code, "h_13(y_15)")
+	assert.Equal(t, 8, run(t, compileAndBuild(t, lines, Options{})))
+	assert.Equal(t, 8, run(t, compileAndBuild(t, lines, Options{Monomorphize: true})))
+	// the interpreter keeps the values, which it prints and a session refers to.
+	module, err := Lower(syntax.NewDummySource(strings.Join(lines, "\n")), Options{})
+	if assert.NoError(t, err) {
+		var names []string
+		for _, dec := range module.Decs {
+			if d, ok := dec.(*ir.ValDec); ok {
+				names = append(names, d.Id.Value)
+			}
+		}
+		assert.Subset(t, names, []string{"add$4", "k$7", "get$11", "h$13"})
+	}
+}
+
+func TestCompileGenericConstraints(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"fun add x y = x + y",
+		"fun max a b = if a > b then a else b",
+		"fun sum3 a b c = add (add a b) c",
+		"fun rem a b = a % b",
+		"val k = 2",
+		"val f = let fun add x = x + k in add end",
+		"fun pair x = let fun inner y = (x, y) in inner end",
+		"val _ = assertEqual (pair 1 2) (1, 2)",
+		"val n = add 1 2 + max 3 4 + f 1 + sum3 1 1 1 + rem 7 4",
+		"val x = add 1.5 2.5",
+		"val _ = exit (if x > 3.9 then n else 0)",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "type number interface {\n\t~int64 | ~float64\n}")
+	assert.Contains(t, code, "type integer interface {\n\t~int64\n}")
+	assert.Contains(t, code, "func add_2[A number](x_3 A, y_4 A) A {")
+	assert.Contains(t, code, "func max_5[A number](a_6 A, b_7 A) A {")
+	// the constraint of add applies to the arguments of sum3.
+	assert.Contains(t, code, "func sum3_8[A number](a_9 A, b_10 A, c_11 A) A {")
+	assert.Contains(t, code, "func rem_12[A integer](a_13 A, b_14 A) A {")
+	// the local function is specialized for the type parameter of pair, rather than boxed.
+	assert.Contains(t, code, "inner_21 := func(y_22 B) struct {")
+	assert.Equal(t, 16, compileAndRun(t, lines, Options{}))
+	assert.Equal(t, 16, compileAndRun(t, lines, Options{Monomorphize: true}))
+}
+
+func TestMonomorphize(t *testing.T) {
+	lines := []string{
+		"fun pair x y = (x, y)",
+		"fun apply f x = f x",
+		"fun twice f x = apply f (apply f x)",
+		"fun unused x = x",
+		"val p = pair \"a\" (pair 1 2)",
+		"val n = twice (fn x => x + 1) 0",
+		"val s = twice (fn x => x) \"s\"",
+		"val m = let fun id x = x in (id 1, id true) end",
+		"val c = channel 0",
+		"fun put x = send c x",
+		"val a = let val alias = pair in (alias 1 true, alias true 1) end",
+		"val h = twice",
+		"val k = h (fn x => x * 2) 3",
+	}
+	code := compileAndCheckWith(t, lines, Options{Monomorphize: true})
+	assert.NotContains(t, code, "any]")
+	assert.NotContains(t, code, "[A")
+	assert.NotContains(t, code, "unused")
+	assert.Contains(t, code, "func pair_1_string_int_x_int(x_2 string, y_3 struct {")
+	assert.Contains(t, code, "func pair_1_int_int(x_2 int64, y_3 int64) struct {")
+	assert.Contains(t, code, "func apply_4_int_int(f_5 func(int64) int64, x_6 int64) int64 {")
+	assert.Contains(t, code, "func twice_7_string(f_8 func(string) string, x_9 string) string {")
+	assert.Contains(t, code, "id_17_int := func(x_18 int64) int64 {")
+	assert.Contains(t, code, "id_17_bool := func(x_18 bool) bool {")
+	// the aliases of polymorphic functions are specialized too.
+	assert.Contains(t, code, "alias_23_int_bool := func(x1 int64) func(bool) struct {")
+	assert.Contains(t, code, "alias_23_bool_int := func(x3 bool) func(int64) struct {")
+	assert.Contains(t, code, "h_25_int = func(x5 func(int64) int64) func(int64) int64 {")
+}
+
+func TestLambdaLifting(t *testing.T) {
+	lines := []string{
+		"fun sum n =",
+		"  let",
+		"    val k = 2",
+		"    fun go i acc = if i > n then acc else go (i + 1) (acc + i * k)",
+		"    fun twice x = let fun inner y = go y x in inner 0 + inner 1 end",
+		"    val f = fn x => go x 0",
+		"    fun esc z = z + k",
+		"  in twice 0 + f 3 + (fn g => g 1) esc end",
+		"fun pairs x = let fun mk y = (x, y) in mk 1 end",
+	}
+	code := compileAndCheckWith(t, lines, Options{Lift: true})
+	assert.Contains(t, code, "func go_4(n_2 int64, k_3 int64, i_5 int64, acc_6 int64) int64 {")
+	assert.Contains(t, code, "i_5, acc_6 = i_5+1, acc_6+i_5*k_3")
+	assert.Contains(t, code, "func inner_9(n_2 int64, k_3 int64, x_8 int64, y_10 int64) int64 {")
+	assert.Contains(t, code, "return inner_9(n_2, k_3, x_8, 0) + inner_9(n_2, k_3, x_8, 1)")
+	assert.Contains(t, code, "esc_13 := func(z_14 int64) int64 {")
+	assert.Contains(t, code, "func mk_18_int[A any](x_17 A, y_19 int64) struct {")
+	assert.Contains(t, code, "return mk_18_int[A](x_17, 1)")
+
+	code = compileAndCheckWith(t, lines, Options{Lift: true, Monomorphize: true})
+	assert.NotContains(t, code, "mk_18[")
+}
+
+func TestTailCalls(t *testing.T) {
+	lines := []string{
+		"fun loop n acc = if n = 0 then acc else loop (n - 1) (acc + n)",
+		"fun even n = if n = 0 then true else odd (n - 1) and odd n = if n = 0 then false else even (n - 1)",
+		"fun apply f x = f x",
+		"fun mk n acc = if n = 0 then acc else mk (n - 1) (fn u => n + acc u)",
+		"fun count n = let fun go i = if i = 0 then n else go (i - 1) in go n end",
+	}
+	var report bytes.Buffer
+	code := compileAndCheckWith(t, lines, Options{TailCalls: &report})
+	assert.Contains(t, code, `func loop_1(n_2 int64, acc_3 int64) int64 {
+	for {
+		if n_2 == 0 {
+			return acc_3
+		} else {
+			n_2, acc_3 = n_2-1, acc_3+n_2
+			continue
+		}
+	}
+}`)
+	assert.Contains(t, code, `func even_4(n_6 int64) bool {
+	var n_7 int64
+	s1 := 0
+	for {
+		switch s1 {
+		case 0:
+			if n_6 == 0 {
+				return true
+			} else {
+				n_7 = n_6 - 1
+				s1 = 1
+				continue
+			}
+		case 1:`)
+	assert.Contains(t, code, "return mk_11(n_12-1, func(u_14 A) int64 {")
+	assert.Contains(t, code, "go_17 := func(i_18 int64) int64 {\n\t\tfor {")
+	assert.Equal(t, []string{
+		"<dummy>:3:17: the tail call of f in apply is not optimised: f is not declared with apply",
+		"<dummy>:4:39: the tail call of mk in mk is not optimised: a closure in mk captures its parameters",
+		"<dummy>:5:65: the tail call of go in count is not optimised: go is not declared with count",
+	}, strings.Split(strings.TrimSpace(report.String()), "\n"))
+}
+
+func TestUncurrying(t *testing.T) {
+	lines := []string{
+		"fun add x y z = x + y + z",
+		"fun apply f x = f x",
+		"val a = add 1 2 3",
+		"val f = add 1",
+		"val g = apply (add 1 2) 3",
+		"val h = let fun id x y = y in apply id 1 true end",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "func add_1[A number](x_2 A, y_3 A, z_4 A) A {")
+	assert.Contains(t, code, "a_8 = add_1[int64](1, 2, 3)")
+	// a partial application captures its arguments in one function.
+	assert.Contains(t, code, `f_9 = func(x1 int64) func(int64) int64 {
+		return func(x2 int64) int64 {
+			return add_1[int64](1, x1, x2)
+		}
+	}`)
+	assert.Contains(t, code, `g_10 = apply_5[int64, int64](func(x3 int64) int64 {
+		return add_1[int64](1, 2, x3)
+	}, 3)`)
+	assert.Contains(t, code, "return id_11_int_bool(x4, x5)")
+}
+
+func TestPartialApplicationInLoop(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"fun add x y z = x + y + z",
+		"fun last n f = if n = 0 then f 0 else last (n - 1) (add n 10)",
+		"val _ = exit (last 3 (add 0 0))",
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "for {")
+	// the loop assigns n again, so the partial application captures its value.
+	assert.Contains(t, code, "a1 := n_")
+	assert.Equal(t, 11, compileAndRun(t, lines, Options{}))
+}
+
+func TestOptimisation(t *testing.T) {
+	lines := []string{
+		"fun inc x = x + 1",
+		"fun twice f x = f (f x)",
+		"fun fact n = if n = 0 then 1 else n * fact (n - 1)",
+		"val k = 2 * 3 + 1",
+		"val r = let val unused = 10 * k val a = k in inc a + twice inc 0 + (fn x => x - 1) 3 end",
+		"val b = if 1 < 2 && true then fact 3 else 0",
+	}
+	code := compileAndCheckWith(t, lines, Options{OptLevel: 1})
+	assert.Contains(t, code, "k_8 = 7")
+	assert.NotContains(t, code, "unused")
+	assert.Contains(t, code, "b_13 = fact_6(3)")
+
+	var dump bytes.Buffer
+	code = compileAndCheckWith(t, lines, Options{OptLevel: 2, Monomorphize: true, DumpIR: &dump})
+	assert.Contains(t, code, "r_12 = k_8 + 1 + 2 + 2")
+	assert.Contains(t, dump.String(), "(* lowered *)\nfun inc$1 (x$2 : int) = x$2 + 1\n")
+	assert.Contains(t, dump.String(), "(* after inline *)\n")
+	assert.Contains(t, dump.String(), "val r$12 : int = let val unused$9 : int = 10 * k$8 in ((k$8 + 1) + let val x$2$1 : int = 0 + 1 in x$2$1 + 1 end) + (3 - 1) end\n")
+	assert.Contains(t, dump.String(), "(* after dce *)\n")
+	assert.Contains(t, dump.String(), "val r$12 : int = ((k$8 + 1) + 2) + 2\nval b$13 : int = fact$6 3\n")
+	assert.Contains(t, dump.String(), "(* after tailcall *)\n")
+}
+
+func TestCompileDivisionByZero(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"val inf = 1.0 / 0.0",
+		"val _ = exit (if inf > 1000.0 then 3 else 4)",
+	}
+	failing := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"val n = 1 % (2 - 2)",
+		"val _ = exit n",
+	}
+	for _, level := range []int{0, opt.MaxLevel} {
+		// the float division is infinite, and the integer division panics, which exits with 2.
+		assert.Equal(t, 3, compileAndRun(t, lines, Options{OptLevel: level}))
+		assert.Equal(t, 2, compileAndRun(t, failing, Options{OptLevel: level}))
+	}
+}
+
+func TestANF(t *testing.T) {
+	lines := []string{
+		"fun fact n acc = if n = 0 then acc else fact (n - 1) (n * acc)",
+		"val k = fact (2 + 3) 1",
+		"val b = k > 100 && fact 2 1 = 2",
+		"val s = let val x = if b then k * 2 else 0 in x + 1 end",
+	}
+	var dump bytes.Buffer
+	compileAndCheckWith(t, lines, Options{DumpANF: &dump})
+	anf := dump.String()
+	assert.Contains(t, anf, "    let $t2 : int = n$2 - 1 in\n    let $t3 : int = n$2 * acc$3 in\n    jump fact$1 ($t2, $t3)\n")
+	assert.Contains(t, anf, "val k$4 : int =\n  let $t4 : int = 2 + 3 in\n  let $t5 : int = call fact$1 ($t4, 1) in\n  ret $t5\n")
+	assert.Contains(t, anf, "  if $t6 then\n    let $t7 : int = call fact$1 (2, 1) in\n")
+	assert.Contains(t, anf, "  else\n    ret false\n")
+	assert.Contains(t, anf, "  let x$6 : int = if b$5 then\n    let $t9 : int = k$4 * 2 in\n    ret $t9\n  else\n    ret 0\n  in\n")
+}
+
+func TestCompileExtern(t *testing.T) {
+	lines := []string{
+		`extern val sqrt : float -> float = "math.Sqrt"`,
+		`extern val modf : float -> float * float = "math.Modf"`,
+		`extern val repeat : string * int -> string = "strings.Repeat"`,
+		`val r = sqrt 16.0`,
+		`val m = modf r`,
+		`val f = repeat`,
+		`val s = let val p = ("ab", 2) in repeat p; f p end`,
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "math.Sqrt(16.0)")
+	assert.Contains(t, code, ":= math.Modf(r_4)")
+	assert.Contains(t, code, `"strings"`)
+}
+
+func TestCompileGoCompositeTypes(t *testing.T) {
+	lines := []string{
+		`extern val fields : string -> string slice = "strings.Fields"`,
+		`extern val join : string slice * string -> string = "strings.Join"`,
+		`val s = join (fields " a b ", ",")`,
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, `strings.Join(strings.Fields(" a b "), ",")`)
+}
+
+func TestExternSignatureMismatch(t *testing.T) {
+	src := syntax.NewDummySource(`extern val sqrt : int -> float = "math.Sqrt"`)
+	_, err := translate(src, Options{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "parameter 1 has Go type float64, which is incompatible with int")
+	}
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	src := syntax.NewDummySource("val a = 1\nval b = a + c")
+	_, err := translate(src, Options{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Undefined variable 'c' (at <dummy>:2:13)")
+		// the inference does not run on the module with errors.
+		assert.NotContains(t, err.Error(), "undefined symbol")
+	}
+}
+
+func TestCompileGoMethods(t *testing.T) {
+	lines := []string{
+		`extern type builder = "strings.Builder"`,
+		`extern type time = "time.Time"`,
+		`extern val now : unit -> time = "time.Now"`,
+		`val b = builder.new ()`,
+		`val n = builder.WriteString b "fun"; builder.Len b`,
+		`val s = builder.String b`,
+		`val w = builder.WriteString`,
+		`val later = time.After (now ()) (now ())`,
+	}
+	var dump, anf bytes.Buffer
+	code := compileAndCheckWith(t, lines, Options{DumpIR: &dump, DumpANF: &anf})
+	assert.Contains(t, dump.String(), `val b$2 : builder ptr = (member "new" of builder ptr) ()`)
+	assert.Contains(t, anf.String(), `let $t1 : builder ptr = (member "new" of builder ptr) () in`)
+	assert.Contains(t, code, "b_2 = new(strings.Builder)")
+	assert.Contains(t, code, `b_2.WriteString("fun")`)
+	assert.Contains(t, code, "int64(b_2.Len())")
+	assert.Contains(t, code, "time.Now().After(time.Now())")
+}
+
+func TestUndefinedGoMethod(t *testing.T) {
+	src := syntax.NewDummySource(`extern type builder = "strings.Builder"` + "\nval b = builder.Write (builder.new ())")
+	_, err := translate(src, Options{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "method Write: Go type byte has no Fun counterpart")
+	}
+}
+
+func TestCompileGoErrors(t *testing.T) {
+	lines := []string{
+		`extern val atoi : string -> (int, error) result = "strconv.Atoi"`,
+		`extern val mustAtoi : string -> int = "strconv.Atoi"`,
+		`extern type builder = "strings.Builder"`,
+		`val n = (fn Ok n => n | Err _ => 0) (atoi "42") + mustAtoi "1"`,
+		`val written = (fn Ok (Ok _) => true | _ => false) (Ok (builder.WriteString (builder.new ()) "x"))`,
+		`val e = Err "failed"`,
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "Ok: r2 == nil, Value: int64(r1), Err: r2")
+	assert.Contains(t, code, "panic(r4)")
+	assert.Contains(t, code, "if _arg1.Ok {")
+}
+
+func TestCompileChannels(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		`val c = channel 1`,
+		`val done = channel 0`,
+		`val _ = spawn (fn () => (send c 42; close done))`,
+		`val n = recv c + 1`,
+		`val _ = recv done`,
+		`val m = select c ? x => x | done ? _ => 1 end`,
+		`val k = select c ! 2 => 2 | else => 3 end`,
+		`val r = select c ? x => x | else => 0 end`,
+		`val _ = exit (n + m + k + r)`,
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "make(chan int64, 1)")
+	assert.Contains(t, code, "go func(")
+	assert.Contains(t, code, "c_2 <- 42")
+	assert.Contains(t, code, "close(done_3)")
+	assert.Contains(t, code, "select {")
+	assert.Contains(t, code, "default:")
+	assert.Equal(t, 48, compileAndRun(t, lines, Options{}))
+}
+
+func TestCompileRefutableReceives(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		`val c = channel 2`,
+		`val _ = (send c (Ok 3); send c (Err "e"))`,
+		`val a = select c ? Ok x => x end`,
+		`val b = select c ? Ok x => x | else => 0 end`,
+		`val _ = exit (a + b)`,
+	}
+	// the second value is received, but it does not match the pattern.
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, `panic("match failure")`)
+	assert.Equal(t, 2, compileAndRun(t, lines, Options{}))
+	lines[4] = `val b = select c ? Err _ => 4 | else => 0 end`
+	assert.Equal(t, 7, compileAndRun(t, lines, Options{}))
+}
+
+func TestCompileAssertions(t *testing.T) {
+	lines := []string{
+		`fun same x y = assertEqual x y`,
+		`val _ = assert (1 < 2)`,
+		`val _ = assertEqual 3 (1 + 2)`,
+		`val _ = same (1, "a") (1, "a")`,
+	}
+	code := compileAndCheck(t, lines)
+	assert.Contains(t, code, "func same_1[A comparable](x_2 A, y_3 A)")
+	assert.Contains(t, code, `panic(fmt.Sprintf("<dummy>:1:16: assertEqual failed: expected %v, got %v", expected1, actual2))`)
+	assert.Contains(t, code, "if !(1 < 2) {\n\t\tpanic(\"<dummy>:2:9: assertion failed\")")
+	assert.Contains(t, code, "expected3, actual4 := int64(3), int64(1+2)")
+}
+
+func TestCompileTests(t *testing.T) {
+	src := syntax.NewDummySource(strings.Join([]string{
+		`fun test_add () = assertEqual 3 (1 + 2)`,
+		`val test_value = fn () => assert true`,
+		`fun test_even () = assert (even 2) and even n = n = 0 || n <> 1 && even (n - 2)`,
+		`val tested = 1`,
+	}, "\n"))
+	pkg, err := CompileTests(src, Options{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if assert.Len(t, pkg.Tests, 3) {
+		assert.Equal(t, "Test_add", pkg.Tests[0].GoName())
+		assert.Equal(t, "test_value", pkg.Tests[1].Name)
+		assert.Equal(t, "test_even", pkg.Tests[2].Name)
+	}
+	test := string(pkg.TestFile)
+	assert.Contains(t, test, "func Test_add(t *testing.T) {")
+	assert.Contains(t, test, "\t\t\tfmt.Println(r)\n\t\t\tt.FailNow()\n")
+	assert.Contains(t, test, "\ttest_value_2(struct{}{})\n")
+
+	// the test file is a part of the main package.
+	fset := token.NewFileSet()
+	var files []*goast.File
+	for name, code := range map[string][]byte{"main.go": pkg.Main, "main_test.go": pkg.TestFile} {
+		parsed, err := parser.ParseFile(fset, name, code, 0)
+		if !assert.NoError(t, err, string(code)) {
+			t.FailNow()
+		}
+		files = append(files, parsed)
+	}
+	config := gotypes.Config{Importer: importer.Default()}
+	_, err = config.Check("main", fset, files, nil)
+	assert.NoError(t, err)
+}
+
+func TestInvalidTests(t *testing.T) {
+	src := syntax.NewDummySource("fun test_a x = x + 1\nval test_b = fn () => ()\nval test_b = fn () => ()")
+	_, err := CompileTests(src, Options{})
+	if assert.Error(t, err) {
+		message := err.Error()
+		assert.Contains(t, message, "the test 'test_a' should have the type unit -> unit, but it has the type int -> int")
+		assert.Contains(t, message, "duplicate test 'test_b'")
+	}
+}
+
+// TestCompileProgram builds and runs a program of most of the features with every pass, where the exit code is
+// the sum of its results.
+func TestCompileProgram(t *testing.T) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		`extern val atoi : string -> (int, error) result = "strconv.Atoi"`,
+		`extern val itoa : int -> string = "strconv.Itoa"`,
+		`extern type builder = "strings.Builder"`,
+		"fun compose f g x = f (g x)",
+		"fun twice f = compose f f",
+		"fun even n = if n = 0 then true else odd (n - 1)",
+		"and odd n = if n = 0 then false else even (n - 1)",
+		"fun sum n = let val k = 2 fun go i acc = if i > n then acc else go (i + 1) (acc + i * k) in go 0 0 end",
+		"fun adder x = let fun add y = x + y in add end",
+		"fun parse s = (fn Ok n => n | Err _ => 0) (atoi s)",
+		"fun first x = let fun pair y = (x, y) in pair 1 end",
+		`val p = first "a"`,
+		"val c = channel 1",
+		"val done = channel 0",
+		"val _ = spawn (fn () => (send c (parse (itoa 7)); close done))",
+		"val received = select c ? x => x | done ? _ => 0 end",
+		"val _ = recv done",
+		"val b = builder.new ()",
+		`val _ = builder.WriteString b "abc"`,
+		"val length = builder.Len b",
+		`val _ = exit (twice (adder 1) 0 + sum 3 + (if even 10 && odd 7 then 1 else 0) + received + length + parse "x")`,
+	}
+	for _, c := range []struct {
+		name    string
+		options Options
+	}{
+		{"generics", Options{}},
+		{"mono", Options{Monomorphize: true}},
+		{"lift", Options{Lift: true}},
+		{"optimised", Options{OptLevel: opt.MaxLevel}},
+		{"all", Options{Monomorphize: true, Lift: true, OptLevel: opt.MaxLevel}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, 25, compileAndRun(t, lines, c.options))
+		})
+	}
+}
+
+// BenchmarkMonomorphize compares the run time of a program which calls polymorphic functions,
+// as Go generic functions and as their instances.
+func BenchmarkMonomorphize(b *testing.B) {
+	lines := []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"fun add x y = x + y",
+		"fun apply f x = f x",
+		"fun loop n acc = if n = 0 then acc else loop (n - 1) (apply (add n) acc + add 1 0)",
+		"val _ = exit (loop 10000000 0 % 256)",
+	}
+	for _, c := range []struct {
+		name    string
+		options Options
+	}{{"generics", Options{}}, {"mono", Options{Monomorphize: true}}} {
+		b.Run(c.name, func(b *testing.B) {
+			path := compileAndBuild(b, lines, c.options)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				assert.Equal(b, 192, run(b, path))
+			}
+		})
+	}
+}
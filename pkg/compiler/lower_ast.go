@@ -1,11 +1,298 @@
 package compiler
 
 import (
+	"fmt"
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/builtin"
 	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
 	"github.com/lilac/fun-lang/pkg/typing"
 )
 
-func lowerAst(module *ast.Module, env typing.TypeEnv) *ir.Module {
-	return &ir.Module{Decs: nil}
+var binaryOps = map[string]ir.Op{
+	ast.Add:       ir.Add,
+	ast.Minus:     ir.Minus,
+	ast.Mul:       ir.Mul,
+	ast.Div:       ir.Div,
+	ast.Mod:       ir.Mod,
+	ast.Eq:        ir.Eq,
+	ast.NotEq:     ir.NotEq,
+	ast.Less:      ir.Less,
+	ast.LessEq:    ir.LessEq,
+	ast.Greater:   ir.Greater,
+	ast.GreaterEq: ir.GreaterEq,
+	ast.And:       ir.And,
+	ast.Or:        ir.Or,
+}
+
+// lowering translates a typed and alpha transformed ast module into ir.
+type lowering struct {
+	env     typing.TypeEnv
+	typeOf  func(ast.Exp) types.Type
+	externs *externals
+	time    uint // a monotonically increasing number to make generated names unique
+}
+
+func lowerAst(module *ast.Module, env typing.TypeEnv, typeOf func(ast.Exp) types.Type, externs *externals) *ir.Module {
+	l := &lowering{env: env, typeOf: typeOf, externs: externs}
+	return &ir.Module{Decs: l.lowerDecs(module.Decs)}
+}
+
+// newId makes a unique identifier. The '$' prefix ensures that it never clashes with alpha transformed names.
+func (l *lowering) newId(name string) ast.Identifier {
+	l.time++
+	return ast.Identifier{Name: name, Value: fmt.Sprintf("$%s%d", name, l.time)}
+}
+
+func (l *lowering) lowerDecs(decs []ast.Dec) []ir.Dec {
+	result := make([]ir.Dec, len(decs))
+	for i, dec := range decs {
+		result[i] = l.lowerDec(dec)
+	}
+	return result
+}
+
+func (l *lowering) lowerDec(dec ast.Dec) ir.Dec {
+	switch node := dec.(type) {
+	case *ast.ValDec:
+		return &ir.ValDec{
+			Id:   node.Arg.Id,
+			Type: l.env[node.Arg.Id.String()],
+			Body: l.lowerExp(node.Body),
+		}
+	case *ast.FunDec:
+		return l.lowerFunDec(node)
+	case *ast.RecDec:
+		funs := make([]*ir.FunDec, len(node.Funs))
+		for i, fun := range node.Funs {
+			funs[i] = l.lowerFunDec(fun)
+		}
+		return &ir.RecDec{Funs: funs}
+	case *ast.ExternDec:
+		return &ir.ExternDec{
+			Id:   node.Arg.Id,
+			Type: node.Arg.Type,
+			Func: l.externs.funcs[node],
+		}
+	case *ast.ExternTypeDec:
+		return &ir.ExternTypeDec{Name: node.Name.Name, Named: l.externs.types[node]}
+	}
+	panic("Bug: unexpected ast.Dec type")
+}
+
+func (l *lowering) lowerFunDec(dec *ast.FunDec) *ir.FunDec {
+	id := dec.Binds[0].Id
+	funType := l.env[id.String()]
+	arity := len(dec.Binds[0].Patterns)
+	args := make([]ir.Arg, arity)
+
+	// a single clause of variable patterns needs no matching.
+	if len(dec.Binds) == 1 && allVarPatterns(dec.Binds[0].Patterns) {
+		for i, pattern := range dec.Binds[0].Patterns {
+			pid := pattern.(*ast.VarPattern).Id
+			args[i] = ir.Arg{Id: pid, Type: l.env[pid.String()]}
+		}
+		return &ir.FunDec{Id: id, Type: funType, Args: args, Body: l.lowerExp(dec.Binds[0].Exp)}
+	}
+
+	t := funType
+	for i := range args {
+		argType, resType, _ := types.AsArrow(t)
+		args[i] = ir.Arg{Id: l.newId("arg"), Type: argType}
+		t = resType
+	}
+	clauses := make([]clause, len(dec.Binds))
+	for i, bind := range dec.Binds {
+		clauses[i] = clause{patterns: bind.Patterns, body: bind.Exp}
+	}
+	body := l.lowerClauses(args, clauses, t)
+	return &ir.FunDec{Id: id, Type: funType, Args: args, Body: body}
+}
+
+func (l *lowering) lowerFn(fn *ast.Fn) *ir.Fn {
+	fnType := l.typeOf(fn)
+	if len(fn.Matches) == 1 {
+		if pattern, ok := fn.Matches[0].Pattern.(*ast.VarPattern); ok {
+			return &ir.Fn{Id: pattern.Id, Type: fnType, Body: l.lowerExp(fn.Matches[0].Exp)}
+		}
+	}
+	argType, resType, _ := types.AsArrow(fnType)
+	arg := ir.Arg{Id: l.newId("arg"), Type: argType}
+	clauses := make([]clause, len(fn.Matches))
+	for i, match := range fn.Matches {
+		clauses[i] = clause{patterns: []ast.Pattern{match.Pattern}, body: match.Exp}
+	}
+	body := l.lowerClauses([]ir.Arg{arg}, clauses, resType)
+	return &ir.Fn{Id: arg.Id, Type: fnType, Body: body}
+}
+
+type clause struct {
+	patterns []ast.Pattern
+	body     ast.Exp
+}
+
+// lowerClauses translates a list of clauses into a chain of conditions, which are tested in order.
+func (l *lowering) lowerClauses(args []ir.Arg, clauses []clause, resType types.Type) ir.Exp {
+	var result ir.Exp = &ir.MatchFailure{Type: resType}
+	for i := len(clauses) - 1; i >= 0; i-- {
+		var tests []ir.Exp
+		var decs []ir.Dec
+		for j, pattern := range clauses[i].patterns {
+			arg := &ir.Var{Id: args[j].Id, Type: args[j].Type}
+			tests, decs = l.lowerPattern(pattern, arg, args[j].Type, tests, decs)
+		}
+		body := l.lowerExp(clauses[i].body)
+		if len(decs) > 0 {
+			body = &ir.LetIn{Decs: decs, Body: body}
+		}
+		if len(tests) == 0 {
+			result = body
+			continue
+		}
+		cond := tests[0]
+		for _, test := range tests[1:] {
+			cond = ir.NewBinaryOp(ir.And, cond, test)
+		}
+		result = &ir.IfThen{Cond: cond, Then: body, Else: result}
+	}
+	return result
+}
+
+// lowerPattern appends the tests which a value of the type has to pass to match a pattern,
+// and the declarations of the variables bound by the pattern.
+// The tests of a constructor pattern come before the tests of its argument, since they depend on each other.
+func (l *lowering) lowerPattern(pattern ast.Pattern, value ir.Exp, t types.Type, tests []ir.Exp, decs []ir.Dec) ([]ir.Exp, []ir.Dec) {
+	switch p := pattern.(type) {
+	case *ast.ConstPattern:
+		if _, ok := p.Constant.(*ast.Unit); !ok {
+			tests = append(tests, ir.NewBinaryOp(ir.Eq, value, l.lowerExp(p.Constant)))
+		}
+	case *ast.VarPattern:
+		if p.Id.Name != "_" {
+			decs = append(decs, &ir.ValDec{Id: p.Id, Type: t, Body: value})
+		}
+	case *ast.CtorPattern:
+		ctor := p.Ctor.String()
+		argType := l.typeOf(p.Arg)
+		tests = append(tests, &ir.IsVariant{Ctor: ctor, Value: value})
+		return l.lowerPattern(p.Arg, &ir.Payload{Ctor: ctor, Value: value, Type: argType}, argType, tests, decs)
+	}
+	return tests, decs
+}
+
+func (l *lowering) lowerSelect(node *ast.Select) *ir.Select {
+	resType := l.typeOf(node)
+	arms := make([]ir.SelectArm, len(node.Arms))
+	for i, arm := range node.Arms {
+		if arm.Chan == nil {
+			arms[i] = ir.SelectArm{Body: l.lowerExp(arm.Exp)}
+			continue
+		}
+		arms[i].Chan = l.lowerExp(arm.Chan)
+		if arm.Value != nil {
+			arms[i].Value = l.lowerExp(arm.Value)
+			arms[i].Body = l.lowerExp(arm.Exp)
+			continue
+		}
+		// the received value is matched like the argument of a function.
+		argType := l.typeOf(arm.Pattern)
+		if p, ok := arm.Pattern.(*ast.VarPattern); ok {
+			if p.Id.Name != "_" {
+				arms[i].Id = &ir.Arg{Id: p.Id, Type: argType}
+			}
+			arms[i].Body = l.lowerExp(arm.Exp)
+			continue
+		}
+		arg := ir.Arg{Id: l.newId("arg"), Type: argType}
+		arms[i].Id = &arg
+		arms[i].Body = l.lowerClauses([]ir.Arg{arg}, []clause{{patterns: []ast.Pattern{arm.Pattern}, body: arm.Exp}}, resType)
+	}
+	return &ir.Select{Arms: arms, Type: resType}
+}
+
+func allVarPatterns(patterns []ast.Pattern) bool {
+	for _, pattern := range patterns {
+		if _, ok := pattern.(*ast.VarPattern); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *lowering) lowerExps(exps []ast.Exp) []ir.Exp {
+	result := make([]ir.Exp, len(exps))
+	for i, exp := range exps {
+		result[i] = l.lowerExp(exp)
+	}
+	return result
+}
+
+func (l *lowering) lowerExp(exp ast.Exp) ir.Exp {
+	switch node := exp.(type) {
+	case *ast.Unit:
+		return &ir.Unit{}
+	case *ast.Bool:
+		return &ir.Bool{Value: node.Value}
+	case *ast.Int:
+		return &ir.Int{Value: node.Value}
+	case *ast.Float:
+		return &ir.Float{Value: node.Value}
+	case *ast.String:
+		return &ir.String{Value: node.Value}
+	case *ast.Char:
+		return &ir.Char{Value: node.Value}
+	case *ast.Var:
+		if _, ok := types.Constructors[node.Id.String()]; ok {
+			// a constructor as a value is a function which makes variants.
+			t := l.typeOf(node)
+			argType, resType, _ := types.AsArrow(t)
+			arg := l.newId("arg")
+			value := &ir.Variant{Ctor: node.Id.String(), Arg: &ir.Var{Id: arg, Type: argType}, Type: resType}
+			return &ir.Fn{Id: arg, Type: t, Body: value}
+		}
+		if builtin.IsBuiltin(node.Id.String()) {
+			return &ir.Primitive{Name: node.Id.String(), Type: l.typeOf(node), Pos: node.Start().String()}
+		}
+		return &ir.Var{Id: node.Id, Type: l.typeOf(node)}
+	case *ast.Member:
+		member, err := l.externs.Member(node.Type.Name, node.Name.Name)
+		if err != nil {
+			panic("Bug: unresolved member of a well typed module")
+		}
+		return &ir.Member{Member: member}
+	case *ast.Not:
+		return &ir.Not{Child: l.lowerExp(node.Child)}
+	case *ast.Neg:
+		return &ir.Neg{Child: l.lowerExp(node.Child)}
+	case *ast.InfixApp:
+		op, ok := binaryOps[node.Op.String()]
+		if !ok {
+			panic("Bug: unknown operator")
+		}
+		return ir.NewBinaryOp(op, l.lowerExp(node.Left), l.lowerExp(node.Right))
+	case *ast.Tuple:
+		return &ir.Tuple{Elements: l.lowerExps(node.Elements)}
+	case *ast.Sequence:
+		return &ir.Sequence{Elements: l.lowerExps(node.Elements)}
+	case *ast.Apply:
+		if v, ok := node.Fun.(*ast.Var); ok {
+			if _, ok := types.Constructors[v.Id.String()]; ok {
+				return &ir.Variant{Ctor: v.Id.String(), Arg: l.lowerExp(node.Arg), Type: l.typeOf(node)}
+			}
+		}
+		return &ir.App{Fun: l.lowerExp(node.Fun), Arg: l.lowerExp(node.Arg), Pos: node.Start().String()}
+	case *ast.IfThen:
+		return &ir.IfThen{
+			Cond: l.lowerExp(node.Cond),
+			Then: l.lowerExp(node.Then),
+			Else: l.lowerExp(node.Else),
+		}
+	case *ast.LetIn:
+		return &ir.LetIn{Decs: l.lowerDecs(node.Decs), Body: l.lowerExp(node.Body)}
+	case *ast.Fn:
+		return l.lowerFn(node)
+	case *ast.Select:
+		return l.lowerSelect(node)
+	}
+	panic("Bug: unexpected expression type.")
 }
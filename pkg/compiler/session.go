@@ -0,0 +1,98 @@
+package compiler
+
+import (
+	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/common"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/lilac/fun-lang/pkg/typing"
+)
+
+// Session lowers the modules of an interactive session one at a time, where a module may refer to the declarations of
+// the previous ones. The unique names, the types and the extern declarations persist across the modules,
+// and a module with errors declares nothing.
+type Session struct {
+	options     Options
+	transformer *alpha.Transformer
+	names       *alpha.NameEnv
+	externs     *externals
+	inference   *typing.TypeInference
+}
+
+// NewSession starts a session. Monomorphize is ignored, since a polymorphic function is applied by the later modules.
+func NewSession(options Options) *Session {
+	options.Monomorphize = false
+	externs := newExternals()
+	return &Session{
+		options:     options,
+		transformer: alpha.NewTransformer(),
+		names:       alpha.NewGlobalEnv(),
+		externs:     externs,
+		inference:   &typing.TypeInference{Externals: externs},
+	}
+}
+
+// Lower compiles a module of the session into ir, like Lower.
+func (s *Session) Lower(source *syntax.Source) (*ir.Module, error) {
+	module, err := syntax.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.lower(module)
+}
+
+// LowerExp compiles an expression of the session into ir, which declares its value as it.
+// The positions of the errors are those in the code of the expression.
+func (s *Session) LowerExp(source *syntax.Source) (*ir.Module, error) {
+	exp, err := syntax.ParseExp(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.lower(declareIt(exp, source.Path))
+}
+
+// declareIt makes a module which declares the value of an expression as it, whose name is at the start of the expression.
+func declareIt(exp ast.Exp, path string) *ast.Module {
+	start := exp.Start()
+	pos := token.Position{Line: start.Line, Column: start.Column, Offset: start.Offset}
+	it := &token.Token{Kind: syntax.Ident, Value: "it", Location: token.Location{Start: pos, End: pos, Path: path, File: start.File}}
+	return &ast.Module{Decs: []ast.Dec{syntax.NewValDec(it, exp)}}
+}
+
+func (s *Session) lower(module *ast.Module) (*ir.Module, error) {
+	names := common.NewEnv(s.names)
+	s.transformer.TransformIn(names, module)
+	if err := s.transformer.Error(); err != nil {
+		return nil, err
+	}
+	if err := s.externs.resolve(module); err != nil {
+		return nil, err
+	}
+	env, err := s.inference.Infer(module)
+	if err != nil {
+		return nil, err
+	}
+	irModule, err := optimise(lowerAst(module, env, s.inference.TypeOf, s.externs), s.options, false)
+	if err != nil {
+		return nil, err
+	}
+	s.names = names
+	return irModule, nil
+}
+
+// TypeOf infers the type of an expression in the scope of the session without declaring anything.
+func (s *Session) TypeOf(source *syntax.Source) (types.Type, error) {
+	exp, err := syntax.ParseExp(source)
+	if err != nil {
+		return nil, err
+	}
+	module := declareIt(exp, source.Path)
+	s.transformer.TransformIn(common.NewEnv(s.names), module)
+	if err := s.transformer.Error(); err != nil {
+		return nil, err
+	}
+	return s.inference.InferExp(module.Decs[0].(*ast.ValDec).Body)
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"bytes"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/codegen"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/lilac/fun-lang/pkg/types"
+	"go/format"
+	gotoken "go/token"
+	"strings"
+)
+
+// TestPrefix is the prefix of the names of the tests, e.g. fun test_add () = assertEqual 3 (1 + 2).
+const TestPrefix = "test_"
+
+// TestPackage is the code of a Go package of the main package, which runs the tests of a module by go test.
+type TestPackage struct {
+	Main     []byte         // the code of the module
+	TestFile []byte         // the code of the Go test functions of the tests
+	Tests    []codegen.Test // the tests in the order of the source
+}
+
+// CompileTests compiles the source into a Go package with a Go test function for each of its tests,
+// i.e. the top level declarations whose names start with test_, which have the type unit -> unit.
+// A failed assertion of a test is reported at its position in the source, and the failure of a test
+// by the name of its Go test function.
+func CompileTests(source *syntax.Source, options Options) (*TestPackage, error) {
+	irModule, typed, err := lower(source, options, true)
+	if err != nil {
+		return nil, err
+	}
+	tests, err := findTests(typed)
+	if err != nil {
+		return nil, err
+	}
+	file, err := codegen.Generate(irModule)
+	if err != nil {
+		return nil, err
+	}
+	var main, testFile bytes.Buffer
+	if err := format.Node(&main, gotoken.NewFileSet(), file); err != nil {
+		return nil, err
+	}
+	if err := format.Node(&testFile, gotoken.NewFileSet(), codegen.GenerateTests(tests)); err != nil {
+		return nil, err
+	}
+	return &TestPackage{Main: main.Bytes(), TestFile: testFile.Bytes(), Tests: tests}, nil
+}
+
+// findTests returns the tests of a module in the order of the source.
+func findTests(typed *Typed) ([]codegen.Test, error) {
+	var tests []codegen.Test
+	var errors error
+	declared := map[string]*token.Token{}
+	find := func(id ast.Identifier, tok *token.Token) {
+		if !strings.HasPrefix(id.Name, TestPrefix) {
+			return
+		}
+		t := typed.Env[id.Value]
+		if arg, res, ok := types.AsArrow(t); !ok || !types.UnitType.Equal(arg) || !types.UnitType.Equal(res) {
+			errors = merror.Append(errors, diag.Errorf(diag.InvalidTest, tok.Start(), tok.End(),
+				"the test '%s' should have the type unit -> unit, but it has the type %s", id.Name, t))
+			return
+		}
+		if first, ok := declared[id.Name]; ok {
+			d := diag.Errorf(diag.InvalidTest, tok.Start(), tok.End(), "duplicate test '%s'", id.Name)
+			errors = merror.Append(errors, d.Note("the first test '%s' is at %s", id.Name, first.Start()))
+			return
+		}
+		declared[id.Name] = tok
+		tests = append(tests, codegen.Test{Name: id.Name, Id: id})
+	}
+	for _, dec := range typed.Module.Decs {
+		switch d := dec.(type) {
+		case *ast.ValDec:
+			find(d.Arg.Id, d.Token)
+		case *ast.FunDec:
+			find(d.Binds[0].Id, d.Binds[0].Token)
+		case *ast.RecDec:
+			for _, fun := range d.Funs {
+				find(fun.Binds[0].Id, fun.Binds[0].Token)
+			}
+		}
+	}
+	return tests, errors
+}
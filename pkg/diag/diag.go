@@ -0,0 +1,260 @@
+// Package diag defines the diagnostics of the passes of the compiler, e.g. the syntax errors, the type errors and
+// the warnings of the match checking. A diagnostic has a severity, a code which identifies its kind for tools,
+// the span of the code where it occurs, a message, and the notes and the suggestions to fix it.
+//
+// A diagnostic is an error, so that a pass returns its diagnostics like other errors, e.g. in a go-multierror chain,
+// and From collects the diagnostics of such an error.
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/rhysd/locerr"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// The codes of the diagnostics.
+const (
+	IllegalToken         = "illegal-token"
+	SyntaxError          = "syntax-error"
+	InvalidLiteral       = "invalid-literal"
+	UndefinedVariable    = "undefined-variable"
+	UndefinedType        = "undefined-type"
+	InvalidDeclaration   = "invalid-declaration"
+	InvalidPattern       = "invalid-pattern"
+	TypeMismatch         = "type-mismatch"
+	RecursiveType        = "recursive-type"
+	UndefinedSymbol      = "undefined-symbol"
+	UndefinedConstructor = "undefined-constructor"
+	UndefinedMember      = "undefined-member"
+	InvalidOperand       = "invalid-operand"
+	NonExhaustiveMatch   = "non-exhaustive-match"
+	RedundantMatch       = "redundant-match"
+	InvalidRename        = "invalid-rename"
+	RenameConflict       = "rename-conflict"
+	InvalidTest          = "invalid-test"
+	// Unknown is the code of an error which is not a diagnostic, e.g. of the binding of an extern declaration.
+	Unknown = "error"
+)
+
+// Span is the range of the code of a diagnostic, where the end is exclusive. The file of the start is nil if it is unknown.
+type Span struct {
+	Start locerr.Pos
+	End   locerr.Pos
+}
+
+type Diagnostic struct {
+	Severity    Severity
+	Code        string
+	Span        Span
+	Message     string
+	Notes       []string
+	Suggestions []string
+}
+
+// Diagnoser is an error which has a diagnostic, e.g. a type error which keeps its types for the tools.
+type Diagnoser interface {
+	error
+	Diagnostic() *Diagnostic
+}
+
+func Errorf(code string, start, end locerr.Pos, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{Severity: Error, Code: code, Span: Span{start, end}, Message: fmt.Sprintf(format, args...)}
+}
+
+func Warningf(code string, start, end locerr.Pos, format string, args ...interface{}) *Diagnostic {
+	d := Errorf(code, start, end, format, args...)
+	d.Severity = Warning
+	return d
+}
+
+// Note adds a context to the diagnostic.
+func (d *Diagnostic) Note(format string, args ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, args...))
+	return d
+}
+
+// Suggest adds a way to fix the diagnostic.
+func (d *Diagnostic) Suggest(format string, args ...interface{}) *Diagnostic {
+	d.Suggestions = append(d.Suggestions, fmt.Sprintf(format, args...))
+	return d
+}
+
+// Error renders the diagnostic with a snippet of the code like a locerr.Error, where carets mark the span.
+//
+//	Error: type mismatch: expected int, but got bool (at main.fun:2:11)
+//	  Note: in the argument of the application at main.fun:2:9
+//
+//	> val a = f true
+//	>           ^^^^
+func (d *Diagnostic) Error() string {
+	var buf bytes.Buffer
+	severity := d.Severity.String()
+	buf.WriteString(strings.ToUpper(severity[:1]) + severity[1:] + ": " + d.Message)
+	if d.Span.Start.File != nil {
+		fmt.Fprintf(&buf, " (at %s)", d.Span.Start)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&buf, "\n  Note: %s", note)
+	}
+	for _, suggestion := range d.Suggestions {
+		fmt.Fprintf(&buf, "\n  Suggestion: %s", suggestion)
+	}
+	buf.WriteString(snippet(d.Span.Start, d.Span.End))
+	return buf.String()
+}
+
+// position is a position of the JSON form of a diagnostic, where the line and the column are one based,
+// and the offset is the zero based offset in bytes.
+type position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// MarshalJSON encodes the diagnostic as an object with its file, e.g.
+//
+//	{"severity": "error", "code": "type-mismatch", "file": "main.fun",
+//	 "start": {"line": 2, "column": 11, "offset": 26}, "end": {"line": 2, "column": 15, "offset": 30},
+//	 "message": "type mismatch: expected int, but got bool", "notes": [], "suggestions": []}
+//
+// where the file, the start and the end are omitted if the span is unknown.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	object := struct {
+		Severity    Severity  `json:"severity"`
+		Code        string    `json:"code"`
+		File        string    `json:"file,omitempty"`
+		Start       *position `json:"start,omitempty"`
+		End         *position `json:"end,omitempty"`
+		Message     string    `json:"message"`
+		Notes       []string  `json:"notes"`
+		Suggestions []string  `json:"suggestions"`
+	}{Severity: d.Severity, Code: d.Code, Message: d.Message, Notes: d.Notes, Suggestions: d.Suggestions}
+	if start, end := d.Span.Start, d.Span.End; start.File != nil {
+		object.File = start.File.Path
+		object.Start = &position{start.Line, start.Column, start.Offset}
+		object.End = &position{end.Line, end.Column, end.Offset}
+		if end.File == nil {
+			object.End = object.Start
+		}
+	}
+	if object.Notes == nil {
+		object.Notes = []string{}
+	}
+	if object.Suggestions == nil {
+		object.Suggestions = []string{}
+	}
+	return json.Marshal(object)
+}
+
+// From collects the diagnostics of an error, which may be a go-multierror chain of them.
+// An error which is not a diagnostic is an error of the Unknown code, at its location if it is a locerr.Error.
+func From(err error) []*Diagnostic {
+	if err == nil {
+		return nil
+	}
+	var multi *merror.Error
+	if errors.As(err, &multi) {
+		var result []*Diagnostic
+		for _, e := range multi.Errors {
+			result = append(result, From(e)...)
+		}
+		return result
+	}
+	var diagnoser Diagnoser
+	if errors.As(err, &diagnoser) {
+		return []*Diagnostic{diagnoser.Diagnostic()}
+	}
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return []*Diagnostic{d}
+	}
+	var located *locerr.Error
+	if errors.As(err, &located) && len(located.Messages) > 0 {
+		d := &Diagnostic{Code: Unknown, Span: Span{located.Start, located.End}, Message: located.Messages[0]}
+		d.Notes = located.Messages[1:]
+		return []*Diagnostic{d}
+	}
+	return []*Diagnostic{{Code: Unknown, Message: err.Error()}}
+}
+
+// HasErrors returns whether some of the diagnostics are errors rather than warnings.
+func HasErrors(diagnostics []*Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Unreported returns the diagnostics which are not at the spans of the errors which are reported,
+// e.g. the errors of a pass which reports an error of an earlier pass again.
+func Unreported(reported []*Diagnostic, diagnostics []*Diagnostic) []*Diagnostic {
+	spans := map[Span]bool{}
+	for _, d := range reported {
+		if d.Severity == Error {
+			spans[d.Span] = true
+		}
+	}
+	var result []*Diagnostic
+	for _, d := range diagnostics {
+		if !spans[d.Span] {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// snippet renders the first line of a span with carets under the span, or nothing if the code is unknown.
+func snippet(start, end locerr.Pos) string {
+	if start.File == nil || start.Line < 1 {
+		return ""
+	}
+	lines := strings.Split(string(start.File.Code), "\n")
+	if start.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+	runes := []rune(line)
+	from := start.Column - 1
+	to := len(runes)
+	if end.Line == start.Line && end.Column-1 <= to {
+		to = end.Column - 1
+	}
+	if from < 0 || from > len(runes) {
+		return ""
+	}
+	if to <= from {
+		to = from + 1
+	}
+	// keep the tabs before the span, so that the carets line up with it.
+	indent := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, string(runes[:from]))
+	return fmt.Sprintf("\n\n> %s\n> %s%s\n", line, indent, strings.Repeat("^", to-from))
+}
@@ -0,0 +1,61 @@
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/rhysd/locerr"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var source = &locerr.Source{Path: "main.fun", Code: []byte("val a = 1\nval b = a + true\n")}
+
+func pos(line, column, offset int) locerr.Pos {
+	return locerr.Pos{Offset: offset, Line: line, Column: column, File: source}
+}
+
+func TestRender(t *testing.T) {
+	d := Errorf(TypeMismatch, pos(2, 13, 22), pos(2, 17, 26), "type mismatch: expected %s, but got %s", "int", "bool")
+	d.Note("in the right operand").Suggest("remove true")
+	assert.Equal(t, "Error: type mismatch: expected int, but got bool (at main.fun:2:13)\n"+
+		"  Note: in the right operand\n"+
+		"  Suggestion: remove true\n\n"+
+		"> val b = a + true\n"+
+		">             ^^^^\n", d.Error())
+
+	w := Warningf(RedundantMatch, locerr.Pos{}, locerr.Pos{}, "redundant")
+	assert.Equal(t, "Warning: redundant", w.Error())
+}
+
+func TestFrom(t *testing.T) {
+	assert.Nil(t, From(nil))
+
+	d := Errorf(SyntaxError, pos(1, 1, 0), pos(1, 4, 3), "syntax error")
+	located := locerr.ErrorIn(pos(2, 1, 10), pos(2, 4, 13), "cannot bind")
+	var err error = merror.Append(d, merror.Append(located, errors.New("plain")))
+	diagnostics := From(err)
+	if assert.Len(t, diagnostics, 3) {
+		assert.Same(t, d, diagnostics[0])
+		assert.Equal(t, Unknown, diagnostics[1].Code)
+		assert.Equal(t, "cannot bind", diagnostics[1].Message)
+		assert.Equal(t, 2, diagnostics[1].Span.Start.Line)
+		assert.Equal(t, "plain", diagnostics[2].Message)
+		assert.Nil(t, diagnostics[2].Span.Start.File)
+	}
+	assert.True(t, HasErrors(diagnostics))
+	assert.False(t, HasErrors([]*Diagnostic{Warningf(RedundantMatch, locerr.Pos{}, locerr.Pos{}, "redundant")}))
+}
+
+func TestJSON(t *testing.T) {
+	d := Errorf(TypeMismatch, pos(2, 13, 22), pos(2, 17, 26), "type mismatch")
+	d.Note("a note")
+	content, err := json.Marshal([]*Diagnostic{d, Warningf(Unknown, locerr.Pos{}, locerr.Pos{}, "somewhere")})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"severity": "error", "code": "type-mismatch", "file": "main.fun",
+		 "start": {"line": 2, "column": 13, "offset": 22}, "end": {"line": 2, "column": 17, "offset": 26},
+		 "message": "type mismatch", "notes": ["a note"], "suggestions": []},
+		{"severity": "warning", "code": "error", "message": "somewhere", "notes": [], "suggestions": []}
+	]`, string(content))
+}
@@ -0,0 +1,128 @@
+// Package docgen generates the documentation of the Fun libraries as Markdown or HTML pages, which list the
+// top-level declarations of a file with their inferred types and their documentation comments (** ... *), e.g.
+//
+//	(** Doubles a number. *)
+//	fun twice n = n * 2
+//
+// is listed as
+//
+//	## twice
+//
+//	```sml
+//	val twice : int -> int
+//	```
+//
+//	Doubles a number.
+//
+// Every top-level declaration is exported, except the wildcard declarations like val _ = ...
+package docgen
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/types"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Page is the documentation of a file.
+type Page struct {
+	Title   string // the base name of the file
+	Entries []Entry
+}
+
+// Entry is the documentation of a declaration.
+type Entry struct {
+	Name      string
+	Signature string // e.g. val twice : int -> int
+	Doc       string // the text of the documentation comment, or empty
+}
+
+// Generate type-checks the source, and returns the documentation of its declarations in the order of the source.
+func Generate(src *syntax.Source) (*Page, error) {
+	typed, err := compiler.Infer(src)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Title: filepath.Base(src.Path)}
+	add := func(dec ast.Dec, id ast.Identifier) {
+		if id.Name == "_" {
+			return
+		}
+		signature := fmt.Sprintf("val %s : %s", id.Name, types.Scheme(typed.Env[id.Value]))
+		page.Entries = append(page.Entries, Entry{Name: id.Name, Signature: signature, Doc: typed.Module.Docs[dec]})
+	}
+	for _, dec := range typed.Module.Decs {
+		switch d := dec.(type) {
+		case *ast.ValDec:
+			add(d, d.Arg.Id)
+		case *ast.FunDec:
+			add(d, d.Binds[0].Id)
+		case *ast.RecDec:
+			for _, fun := range d.Funs {
+				add(fun, fun.Binds[0].Id)
+			}
+		case *ast.ExternDec:
+			add(d, d.Arg.Id)
+		case *ast.ExternTypeDec:
+			signature := fmt.Sprintf("type %s (* the Go type %s *)", d.Name.Name, d.GoName.Value)
+			page.Entries = append(page.Entries, Entry{Name: d.Name.Name, Signature: signature, Doc: typed.Module.Docs[d]})
+		}
+	}
+	return page, nil
+}
+
+// Markdown writes the page in Markdown, where the documentation comments are Markdown as they are.
+func (p *Page) Markdown(w io.Writer) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# %s\n", p.Title)
+	for _, e := range p.Entries {
+		fmt.Fprintf(&buf, "\n## %s\n\n```sml\n%s\n```\n", e.Name, e.Signature)
+		if e.Doc != "" {
+			fmt.Fprintf(&buf, "\n%s\n", e.Doc)
+		}
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+var page = template.Must(template.New("page").Funcs(template.FuncMap{"paragraphs": paragraphs}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- range .Entries}}
+<section id="{{.Name}}">
+<h2>{{.Name}}</h2>
+<pre><code>{{.Signature}}</code></pre>
+{{- range paragraphs .Doc}}
+<p>{{.}}</p>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes the page in HTML, where the paragraphs of the documentation comments are separated by blank lines.
+func (p *Page) HTML(w io.Writer) error {
+	return page.Execute(w, p)
+}
+
+// paragraphs splits a text into its paragraphs, which are separated by blank lines.
+func paragraphs(text string) []string {
+	var result []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package docgen
+
+import (
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func generate(t *testing.T, lines ...string) *Page {
+	page, err := Generate(syntax.NewDummySource(strings.Join(lines, "\n")))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return page
+}
+
+func TestGenerate(t *testing.T) {
+	page := generate(t,
+		"(** The answer. *)",
+		"val answer = 42",
+		"val _ = answer",
+		"(** Even. *)",
+		"fun even n = n = 0 || odd (n - 1)",
+		"and odd n = n <> 0 && even (n - 1)",
+		"fun swap x y = (y, x)",
+		`extern val exit : int -> unit = "os.Exit"`,
+		`extern type builder = "strings.Builder"`,
+	)
+	assert.Equal(t, "<dummy>", page.Title)
+	assert.Equal(t, []Entry{
+		{"answer", "val answer : int", "The answer."},
+		{"even", "val even : int -> bool", "Even."},
+		{"odd", "val odd : int -> bool", ""},
+		{"swap", "val swap : 'a -> 'b -> 'b * 'a", ""},
+		{"exit", "val exit : int -> unit", ""},
+		{"builder", "type builder (* the Go type strings.Builder *)", ""},
+	}, page.Entries)
+}
+
+func TestGenerateTypeError(t *testing.T) {
+	_, err := Generate(syntax.NewDummySource("val a = 1 + true"))
+	assert.Error(t, err)
+}
+
+func TestMarkdown(t *testing.T) {
+	page := generate(t, "(** Doubles a number.\n\n    e.g. twice 2 = 4 *)", "fun twice n = n * 2", "val one = 1")
+	var buf strings.Builder
+	assert.NoError(t, page.Markdown(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"# <dummy>",
+		"",
+		"## twice",
+		"",
+		"```sml",
+		"val twice : int -> int",
+		"```",
+		"",
+		"Doubles a number.",
+		"",
+		"e.g. twice 2 = 4",
+		"",
+		"## one",
+		"",
+		"```sml",
+		"val one : int",
+		"```",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestHTML(t *testing.T) {
+	page := generate(t, "(** Compares a < b.\n\n    Strictly. *)", "fun less a b = a < b")
+	var buf strings.Builder
+	assert.NoError(t, page.HTML(&buf))
+	html := buf.String()
+	assert.Contains(t, html, "<title>&lt;dummy&gt;</title>")
+	assert.Contains(t, html, `<section id="less">`)
+	assert.Regexp(t, `<pre><code>val less : &#39;\w+ -&gt; &#39;\w+ -&gt; bool</code></pre>`, html)
+	assert.Contains(t, html, "<p>Compares a &lt; b.</p>\n<p>Strictly.</p>")
+}
@@ -0,0 +1,410 @@
+// Package eval interprets ir modules, so that a program runs without the generation of Go code.
+//
+// The interpreter walks the ir in an environment of the values of the variables. A function is a closure of the
+// environment of its declaration, and a jump of the tailcall package is a loop, so that tail recursion runs in
+// constant stack space like the generated code. The Go functions of extern declarations are called by reflection,
+// and must be registered in GoFuncs.
+package eval
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/builtin"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// env maps the variables in scope to their values. The variables of a function body are in its own frame,
+// whose parent is the environment of the closure.
+type env struct {
+	vars   map[string]Value
+	parent *env
+}
+
+func newEnv(parent *env) *env {
+	return &env{vars: map[string]Value{}, parent: parent}
+}
+
+func (e *env) bind(id ast.Identifier, v Value) {
+	e.vars[id.Value] = v
+}
+
+func (e *env) lookup(id ast.Identifier) Value {
+	for scope := e; scope != nil; scope = scope.parent {
+		if v, ok := scope.vars[id.Value]; ok {
+			return v
+		}
+	}
+	panic(fmt.Sprintf("Bug: unbound variable %s", id.Value))
+}
+
+// Binding is the value of a declaration at top level.
+type Binding struct {
+	Id    ast.Identifier
+	Type  types.Type
+	Value Value
+}
+
+// Machine evaluates modules in a global environment, which persists across the modules,
+// so that a module may refer to the declarations of the previous ones.
+type Machine struct {
+	globals *env
+}
+
+func NewMachine() *Machine {
+	return &Machine{globals: newEnv(nil)}
+}
+
+// Exec evaluates the declarations of a module in order, and returns the values of the declared variables,
+// except the functions which the lambda lifting has made.
+// An error at run time, e.g. a match failure or a division by zero, stops the evaluation,
+// and is returned with the values of the declarations before it.
+func (m *Machine) Exec(module *ir.Module) (bindings []Binding, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg := fmt.Sprint(r)
+			if _, ok := r.(runtime.Error); ok {
+				// e.g. "runtime error: integer divide by zero" of Go.
+				msg = strings.TrimPrefix(msg, "runtime error: ")
+			}
+			err = fmt.Errorf("Runtime error: %s", msg)
+		}
+	}()
+	for _, dec := range module.Decs {
+		if val, ok := dec.(*ir.ValDec); ok {
+			v := eval(val.Body, m.globals)
+			m.globals.bind(val.Id, v)
+			bindings = append(bindings, Binding{Id: val.Id, Type: val.Type, Value: v})
+			continue
+		}
+		declare(dec, m.globals)
+		switch d := dec.(type) {
+		case *ir.FunDec:
+			bindings = m.appendFun(bindings, d)
+		case *ir.RecDec:
+			for _, fun := range d.Funs {
+				bindings = m.appendFun(bindings, fun)
+			}
+		case *ir.ExternDec:
+			bindings = append(bindings, Binding{Id: d.Id, Type: d.Type, Value: m.globals.lookup(d.Id)})
+		}
+	}
+	return bindings, nil
+}
+
+func (m *Machine) appendFun(bindings []Binding, fun *ir.FunDec) []Binding {
+	if len(fun.Env) > 0 {
+		return bindings
+	}
+	return append(bindings, Binding{Id: fun.Id, Type: fun.Type, Value: m.globals.lookup(fun.Id)})
+}
+
+// Lookup returns the value of a global variable.
+func (m *Machine) Lookup(id ast.Identifier) (Value, bool) {
+	v, ok := m.globals.vars[id.Value]
+	return v, ok
+}
+
+// jump is the result of a function body which ends with an ir.Jump, which the call of the function loops on.
+type jump struct {
+	fun  string
+	args []Value
+}
+
+// declare binds the functions and the extern values of a declaration other than a val declaration.
+func declare(dec ir.Dec, scope *env) {
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		scope.bind(d.Id, closure([]*ir.FunDec{d}, d, scope))
+	case *ir.RecDec:
+		for _, fun := range d.Funs {
+			scope.bind(fun.Id, closure(d.Funs, fun, scope))
+		}
+	case *ir.ExternDec:
+		scope.bind(d.Id, externFunc(d))
+	case *ir.ExternTypeDec:
+	default:
+		panic("Bug: unexpected ir declaration")
+	}
+}
+
+// closure makes the curried function of the free variables and the arguments of a function,
+// which is called with all of them at once.
+func closure(group []*ir.FunDec, fun *ir.FunDec, scope *env) Value {
+	arity := len(fun.Env) + len(fun.Args)
+	return curry(arity, func(args []Value) Value {
+		return call(group, fun, scope, args)
+	})
+}
+
+// curry makes a function of one argument, which collects arity arguments before it calls f.
+func curry(arity int, f func([]Value) Value) Func {
+	var collect func(args []Value) Func
+	collect = func(args []Value) Func {
+		return func(arg Value) Value {
+			args := append(args[:len(args):len(args)], arg)
+			if len(args) == arity {
+				return f(args)
+			}
+			return collect(args)
+		}
+	}
+	return collect(nil)
+}
+
+// call evaluates the body of a function of a recursive declaration, and loops while the body jumps to a function of it.
+func call(group []*ir.FunDec, fun *ir.FunDec, scope *env, args []Value) Value {
+	for {
+		frame := newEnv(scope)
+		for i, param := range append(append([]ir.Arg{}, fun.Env...), fun.Args...) {
+			frame.bind(param.Id, args[i])
+		}
+		v := eval(fun.Body, frame)
+		j, ok := v.(*jump)
+		if !ok {
+			return v
+		}
+		for _, target := range group {
+			if target.Id.Value == j.fun {
+				fun = target
+			}
+		}
+		args = j.args
+	}
+}
+
+func apply(f Value, arg Value) Value {
+	return f.(Func)(arg)
+}
+
+func evalAll(exps []ir.Exp, scope *env) []Value {
+	values := make([]Value, len(exps))
+	for i, exp := range exps {
+		values[i] = eval(exp, scope)
+	}
+	return values
+}
+
+func eval(exp ir.Exp, scope *env) Value {
+	switch e := exp.(type) {
+	case *ir.Unit:
+		return Unit{}
+	case *ir.Bool:
+		return e.Value
+	case *ir.Int:
+		return e.Value
+	case *ir.Float:
+		return e.Value
+	case *ir.String:
+		return e.Value
+	case *ir.Char:
+		return e.Value
+	case *ir.Var:
+		return scope.lookup(e.Id)
+	case *ir.Not:
+		return !eval(e.Child, scope).(bool)
+	case *ir.Neg:
+		switch v := eval(e.Child, scope).(type) {
+		case int64:
+			return -v
+		case float64:
+			return -v
+		}
+		panic("Bug: negation of a value which is not a number")
+	case *ir.BinaryOp:
+		return binaryOp(e, scope)
+	case *ir.Tuple:
+		return Tuple(evalAll(e.Elements, scope))
+	case *ir.Sequence:
+		last := len(e.Elements) - 1
+		for _, element := range e.Elements[:last] {
+			eval(element, scope)
+		}
+		return eval(e.Elements[last], scope)
+	case *ir.App:
+		f := eval(e.Fun, scope)
+		return apply(f, eval(e.Arg, scope))
+	case *ir.Call:
+		v := scope.lookup(e.Fun.Id)
+		for _, arg := range evalAll(e.Args, scope) {
+			v = apply(v, arg)
+		}
+		return v
+	case *ir.Jump:
+		return &jump{fun: e.Fun.Id.Value, args: evalAll(e.Args, scope)}
+	case *ir.IfThen:
+		if eval(e.Cond, scope).(bool) {
+			return eval(e.Then, scope)
+		}
+		return eval(e.Else, scope)
+	case *ir.LetIn:
+		frame := newEnv(scope)
+		for _, dec := range e.Decs {
+			if val, ok := dec.(*ir.ValDec); ok {
+				frame.bind(val.Id, eval(val.Body, frame))
+				continue
+			}
+			declare(dec, frame)
+		}
+		return eval(e.Body, frame)
+	case *ir.Fn:
+		return Func(func(arg Value) Value {
+			frame := newEnv(scope)
+			frame.bind(e.Id, arg)
+			return eval(e.Body, frame)
+		})
+	case *ir.MatchFailure:
+		panic("match failure")
+	case *ir.Variant:
+		return Variant{Ctor: e.Ctor, Arg: eval(e.Arg, scope)}
+	case *ir.IsVariant:
+		return eval(e.Value, scope).(Variant).Ctor == e.Ctor
+	case *ir.Payload:
+		return eval(e.Value, scope).(Variant).Arg
+	case *ir.Primitive:
+		return primitive(e)
+	case *ir.Member:
+		return member(e)
+	case *ir.Select:
+		return selectArms(e, scope)
+	}
+	panic("Bug: unexpected ir expression")
+}
+
+func binaryOp(e *ir.BinaryOp, scope *env) Value {
+	left := eval(e.Left, scope)
+	switch e.Op {
+	case ir.And:
+		return left.(bool) && eval(e.Right, scope).(bool)
+	case ir.Or:
+		return left.(bool) || eval(e.Right, scope).(bool)
+	}
+	right := eval(e.Right, scope)
+	switch e.Op {
+	case ir.Eq:
+		return equal(left, right)
+	case ir.NotEq:
+		return !equal(left, right)
+	}
+	switch l := left.(type) {
+	case int64:
+		r := right.(int64)
+		switch e.Op {
+		case ir.Add:
+			return l + r
+		case ir.Minus:
+			return l - r
+		case ir.Mul:
+			return l * r
+		case ir.Div:
+			return l / r
+		case ir.Mod:
+			return l % r
+		}
+		return compare(e.Op, l < r, l == r)
+	case float64:
+		r := right.(float64)
+		switch e.Op {
+		case ir.Add:
+			return l + r
+		case ir.Minus:
+			return l - r
+		case ir.Mul:
+			return l * r
+		case ir.Div:
+			return l / r
+		}
+		return compare(e.Op, l < r, l == r)
+	case string:
+		r := right.(string)
+		if e.Op == ir.Add {
+			return l + r
+		}
+		return compare(e.Op, l < r, l == r)
+	case rune:
+		r := right.(rune)
+		return compare(e.Op, l < r, l == r)
+	}
+	panic(fmt.Sprintf("Bug: operator %v on %s", e.Op, Format(left)))
+}
+
+// compare evaluates a comparison from the results of < and ==.
+func compare(op ir.Op, less, eq bool) bool {
+	switch op {
+	case ir.Less:
+		return less
+	case ir.LessEq:
+		return less || eq
+	case ir.Greater:
+		return !less && !eq
+	case ir.GreaterEq:
+		return !less
+	}
+	panic(fmt.Sprintf("Bug: unexpected operator %v", op))
+}
+
+// primitive returns the curried function of a built-in function.
+func primitive(p *ir.Primitive) Value {
+	name := p.Name
+	return curry(builtin.Arity(name), func(args []Value) Value {
+		switch name {
+		case builtin.Spawn:
+			go apply(args[0], Unit{})
+			return Unit{}
+		case builtin.Channel:
+			return make(chan Value, args[0].(int64))
+		case builtin.Send:
+			args[0].(chan Value) <- args[1]
+			return Unit{}
+		case builtin.Recv:
+			return <-args[0].(chan Value)
+		case builtin.Close:
+			close(args[0].(chan Value))
+			return Unit{}
+		case builtin.Assert:
+			if !args[0].(bool) {
+				panic(fmt.Sprintf("%s: assertion failed", p.Pos))
+			}
+			return Unit{}
+		case builtin.AssertEqual:
+			if !equal(args[0], args[1]) {
+				panic(fmt.Sprintf("%s: assertEqual failed: expected %s, got %s", p.Pos, Format(args[0]), Format(args[1])))
+			}
+			return Unit{}
+		}
+		panic("Bug: unknown built-in function " + name)
+	})
+}
+
+// selectArms waits for the channel operation of an arm like the Go select statement, and evaluates the body of the arm.
+func selectArms(e *ir.Select, scope *env) Value {
+	cases := make([]reflect.SelectCase, len(e.Arms))
+	for i, arm := range e.Arms {
+		switch {
+		case arm.Chan == nil:
+			cases[i].Dir = reflect.SelectDefault
+		case arm.Value != nil:
+			cases[i].Dir = reflect.SelectSend
+			cases[i].Chan = reflect.ValueOf(eval(arm.Chan, scope))
+			cases[i].Send = reflect.ValueOf(&[]Value{eval(arm.Value, scope)}[0]).Elem()
+		default:
+			cases[i].Dir = reflect.SelectRecv
+			cases[i].Chan = reflect.ValueOf(eval(arm.Chan, scope))
+		}
+	}
+	chosen, received, _ := reflect.Select(cases)
+	arm := e.Arms[chosen]
+	frame := scope
+	if arm.Id != nil {
+		frame = newEnv(scope)
+		var v Value
+		if received.IsValid() {
+			v = received.Interface()
+		}
+		frame.bind(arm.Id.Id, v)
+	}
+	return eval(arm.Body, frame)
+}
@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// allOptions are the translations which the values must not depend on.
+var allOptions = []compiler.Options{
+	{},
+	{OptLevel: 2},
+	{Monomorphize: true, Lift: true},
+	{OptLevel: 2, Monomorphize: true, Lift: true},
+}
+
+// run evaluates a program with each of the options, and returns the printed values of its declarations by their names,
+// except the functions, which the passes may add.
+func run(t *testing.T, lines []string) map[string]string {
+	var values map[string]string
+	for _, options := range allOptions {
+		module, err := compiler.Lower(syntax.NewDummySource(strings.Join(lines, "\n")), options)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		bindings, err := NewMachine().Exec(module)
+		assert.NoError(t, err)
+		result := map[string]string{}
+		for _, b := range bindings {
+			if _, ok := b.Value.(Func); ok {
+				continue
+			}
+			result[b.Id.Name] = Format(b.Value)
+		}
+		if values != nil {
+			assert.Equal(t, values, result, "options %+v", options)
+		}
+		values = result
+	}
+	return values
+}
+
+func TestEval(t *testing.T) {
+	lines := []string{
+		"fun fib 0 = 0 | fib 1 = 1 | fib n = fib (n - 1) + fib (n - 2)",
+		"fun loop n acc = if n = 0 then acc else loop (n - 1) (acc + 1)",
+		"fun even n = if n = 0 then true else odd (n - 1)",
+		"and odd n = if n = 0 then false else even (n - 1)",
+		"fun add x y z = x + y + z + 0",
+		"fun twice f x = f (f x)",
+		"val a = fib 10",
+		"val b = loop 100000 0",
+		"val c = (even 10, odd 10, not (7 % 2 = 1) || 1.5 * 2.0 >= 3.0)",
+		"val d = let val inc = add 1 2 in twice inc 0 end",
+		"val e = let val x = 1 in (x, \"s\", 7 / 2 - x, -2.5, ()) end",
+		"val f = let fun mk n acc = if n = 0 then acc else mk (n - 1) (fn u => n + acc u) in mk 3 (fn u => 0) () end",
+		"val g = 1 <> 2 && 2.0 = 2.0 && (3 > 2 || 1 / 0 = 0)",
+	}
+	values := run(t, lines)
+	assert.Equal(t, "55", values["a"])
+	assert.Equal(t, "100000", values["b"])
+	assert.Equal(t, "(true, false, true)", values["c"])
+	assert.Equal(t, "6", values["d"])
+	assert.Equal(t, `(1, "s", 2, -2.5, ())`, values["e"])
+	assert.Equal(t, "6", values["f"])
+	assert.Equal(t, "true", values["g"])
+}
+
+func TestEvalGoFuncs(t *testing.T) {
+	lines := []string{
+		`extern val sqrt : float -> float = "math.Sqrt"`,
+		`extern val modf : float -> float * float = "math.Modf"`,
+		`extern val repeat : string * int -> string = "strings.Repeat"`,
+		`extern val atoi : string -> (int, error) result = "strconv.Atoi"`,
+		`val r = sqrt 16.0`,
+		`val m = modf 2.5`,
+		`val s = repeat ("ab", 2)`,
+		`val n = (fn Ok n => n | Err _ => 0) (atoi "42")`,
+		`val e = (fn Ok _ => false | Err _ => true) (atoi "z")`,
+	}
+	values := run(t, lines)
+	assert.Equal(t, "4.0", values["r"])
+	assert.Equal(t, "(2.0, 0.5)", values["m"])
+	assert.Equal(t, `"abab"`, values["s"])
+	assert.Equal(t, "42", values["n"])
+	assert.Equal(t, "true", values["e"])
+}
+
+func TestEvalChannels(t *testing.T) {
+	lines := []string{
+		"val c = channel 0",
+		"val done = channel 1",
+		"fun produce n = if n = 0 then close done else (send c n; produce (n - 1))",
+		"val _ = spawn (fn () => produce 5)",
+		"fun sum acc = select c ? x => sum (acc + x) | done ? _ => acc end",
+		"val s = sum 0",
+	}
+	assert.Equal(t, "15", run(t, lines)["s"])
+}
+
+func TestEvalRuntimeError(t *testing.T) {
+	src := syntax.NewDummySource("val a = 1\nfun f 0 = 1\nval b = f 1\nval c = 2")
+	module, err := compiler.Lower(src, compiler.Options{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	bindings, err := NewMachine().Exec(module)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "match failure")
+	}
+	if assert.Len(t, bindings, 2) {
+		assert.Equal(t, "1", Format(bindings[0].Value))
+		assert.Equal(t, "fn", Format(bindings[1].Value))
+	}
+
+	// the error of Go is not prefixed twice.
+	module, err = compiler.Lower(syntax.NewDummySource("val z = 0\nval a = 1 / z"), compiler.Options{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = NewMachine().Exec(module)
+	if assert.Error(t, err) {
+		assert.Equal(t, "Runtime error: integer divide by zero", err.Error())
+	}
+}
+
+func TestEvalAssertions(t *testing.T) {
+	values := run(t, []string{
+		"fun same x y = assertEqual x y",
+		"val a = assert (1 < 2)",
+		"val b = same (1, \"a\") (1, \"a\")",
+		"val c = assertEqual (Ok 1) (Ok 1)",
+	})
+	assert.Equal(t, map[string]string{"a": "()", "b": "()", "c": "()"}, values)
+
+	for _, c := range []struct{ code, message string }{
+		{"val a = assert (1 > 2)", "Runtime error: <dummy>:1:9: assertion failed"},
+		{"val f = assertEqual 3\nval b = f (1 + 1)", "Runtime error: <dummy>:1:9: assertEqual failed: expected 3, got 2"},
+	} {
+		module, err := compiler.Lower(syntax.NewDummySource(c.code), compiler.Options{})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		_, err = NewMachine().Exec(module)
+		if assert.Error(t, err) {
+			assert.Equal(t, c.message, err.Error())
+		}
+	}
+}
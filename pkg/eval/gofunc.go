@@ -0,0 +1,184 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+	gotypes "go/types"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GoFuncs are the Go functions which the extern declarations may bind, by their qualified names.
+// The interpreter cannot load a Go function which is not linked into it, so a program which calls another one fails,
+// and an embedder may add the functions which its programs need.
+var GoFuncs = map[string]interface{}{
+	"os.Exit":            os.Exit,
+	"os.Getenv":          os.Getenv,
+	"math.Abs":           math.Abs,
+	"math.Ceil":          math.Ceil,
+	"math.Cos":           math.Cos,
+	"math.Exp":           math.Exp,
+	"math.Floor":         math.Floor,
+	"math.Log":           math.Log,
+	"math.Max":           math.Max,
+	"math.Min":           math.Min,
+	"math.Modf":          math.Modf,
+	"math.Pow":           math.Pow,
+	"math.Sin":           math.Sin,
+	"math.Sqrt":          math.Sqrt,
+	"strconv.Atoi":       strconv.Atoi,
+	"strconv.FormatInt":  strconv.FormatInt,
+	"strconv.Itoa":       strconv.Itoa,
+	"strconv.ParseBool":  strconv.ParseBool,
+	"strconv.ParseFloat": strconv.ParseFloat,
+	"strconv.ParseInt":   strconv.ParseInt,
+	"strconv.Quote":      strconv.Quote,
+	"strings.Contains":   strings.Contains,
+	"strings.Count":      strings.Count,
+	"strings.Fields":     strings.Fields,
+	"strings.HasPrefix":  strings.HasPrefix,
+	"strings.HasSuffix":  strings.HasSuffix,
+	"strings.Index":      strings.Index,
+	"strings.Join":       strings.Join,
+	"strings.Repeat":     strings.Repeat,
+	"strings.Replace":    strings.Replace,
+	"strings.Split":      strings.Split,
+	"strings.ToLower":    strings.ToLower,
+	"strings.ToUpper":    strings.ToUpper,
+	"strings.TrimSpace":  strings.TrimSpace,
+	"unicode.IsDigit":    unicode.IsDigit,
+	"unicode.IsLetter":   unicode.IsLetter,
+	"unicode.IsSpace":    unicode.IsSpace,
+}
+
+// externFunc returns the function of an extern declaration, which fails when it is applied
+// if the Go function is not in GoFuncs.
+func externFunc(d *ir.ExternDec) Value {
+	name := d.Func.FullName()
+	f, ok := GoFuncs[name]
+	sig := d.Func.Type().(*gotypes.Signature)
+	arg, res, _ := types.AsArrow(d.Type)
+	return Func(func(v Value) Value {
+		if !ok {
+			panic(fmt.Sprintf("the Go function %s is not available in the interpreter", name))
+		}
+		return goCall(reflect.ValueOf(f), sig, arg, res, v)
+	})
+}
+
+// member returns the function of a member of an extern type, which takes the receiver as the first argument.
+func member(e *ir.Member) Value {
+	switch e.Kind {
+	case interop.FieldMember:
+		return Func(func(recv Value) Value {
+			_, res, _ := types.AsArrow(e.Type)
+			field := reflect.Indirect(reflect.ValueOf(recv)).FieldByName(e.Object.Name())
+			return fromGo(field, res)
+		})
+	case interop.MethodMember:
+		sig := e.Object.Type().(*gotypes.Signature)
+		_, t, _ := types.AsArrow(e.Type)
+		return Func(func(recv Value) Value {
+			method := reflect.ValueOf(recv).MethodByName(e.Object.Name())
+			if !e.Params {
+				return goCall(method, sig, types.UnitType, t, Unit{})
+			}
+			arg, res, _ := types.AsArrow(t)
+			return Func(func(v Value) Value {
+				return goCall(method, sig, arg, res, v)
+			})
+		})
+	}
+	panic("a value of a Go type cannot be allocated in the interpreter")
+}
+
+// goCall calls a Go function like the generated code, where the argument is spread into the parameters,
+// and the results are collected into the value, where a last error result is handled by the error mode.
+func goCall(f reflect.Value, sig *gotypes.Signature, argType, resType types.Type, arg Value) Value {
+	params := interop.Spread(argType)
+	var args []Value
+	switch len(params) {
+	case 0:
+	case 1:
+		args = []Value{arg}
+	default:
+		args = arg.(Tuple)
+	}
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		in[i] = toGo(a, f.Type().In(i))
+	}
+	out := f.Call(in)
+
+	mode := interop.ErrorModeOf(resType, sig.Results())
+	if mode == interop.ErrorValue {
+		return collect(out, resType)
+	}
+	last := len(out) - 1
+	err, _ := out[last].Interface().(error)
+	if mode == interop.ErrorPanic {
+		if err != nil {
+			panic(err)
+		}
+		return collect(out[:last], resType)
+	}
+	if err != nil {
+		return Variant{Ctor: types.ErrCtor, Arg: err}
+	}
+	valueType, _, _ := types.AsResult(resType)
+	return Variant{Ctor: types.OkCtor, Arg: collect(out[:last], valueType)}
+}
+
+// collect makes a value of the type from the results of a Go function, as interop.Spread describes.
+func collect(out []reflect.Value, t types.Type) Value {
+	ts := interop.Spread(t)
+	switch len(ts) {
+	case 0:
+		return Unit{}
+	case 1:
+		return fromGo(out[0], t)
+	}
+	values := make(Tuple, len(ts))
+	for i, element := range ts {
+		values[i] = fromGo(out[i], element)
+	}
+	return values
+}
+
+// toGo converts a value to a Go parameter, e.g. an int to a Go int.
+func toGo(v Value, t reflect.Type) reflect.Value {
+	if v == nil {
+		return reflect.Zero(t)
+	}
+	switch v.(type) {
+	case Tuple, Func, Variant:
+		panic(errors.New("a tuple, a function or a result cannot be passed to a Go function in the interpreter"))
+	}
+	value := reflect.ValueOf(v)
+	if value.Type() != t && value.Type().ConvertibleTo(t) {
+		return value.Convert(t)
+	}
+	return value
+}
+
+// fromGo converts a Go value to a value of the type, e.g. a Go int to an int.
+func fromGo(v reflect.Value, t types.Type) Value {
+	switch {
+	case t.Equal(types.IntType):
+		return v.Int()
+	case t.Equal(types.FloatType):
+		return v.Float()
+	case t.Equal(types.CharType):
+		return rune(v.Int())
+	case t.Equal(types.UnitType):
+		return Unit{}
+	}
+	return v.Interface()
+}
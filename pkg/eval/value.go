@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Value is the value of an expression. The values of the basic types are the Go values of the types which
+// interop.Mapping maps them to, i.e. Unit, bool, int64, float64, string and rune, and the other values are as follows.
+//
+//	a * b         -> Tuple
+//	a -> b        -> Func
+//	(a, e) result -> Variant
+//	a chan        -> chan Value
+//
+// The values of Go types, e.g. the values of extern types and slices, are the Go values themselves.
+type Value interface{}
+
+// Unit is the value of the unit type.
+type Unit struct{}
+
+type Tuple []Value
+
+// Func is a function value, which takes one argument like the functions of the language.
+type Func func(Value) Value
+
+// Variant is a value made by a constructor, e.g. Ok 1.
+type Variant struct {
+	Ctor string
+	Arg  Value
+}
+
+// Format prints a value in the syntax of the language, where a function is printed as fn.
+func Format(v Value) string {
+	switch v := v.(type) {
+	case Unit:
+		return "()"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case string:
+		return strconv.Quote(v)
+	case rune:
+		return strconv.QuoteRune(v)
+	case Tuple:
+		elements := make([]string, len(v))
+		for i, element := range v {
+			elements[i] = Format(element)
+		}
+		return "(" + strings.Join(elements, ", ") + ")"
+	case Func:
+		return "fn"
+	case Variant:
+		arg := Format(v.Arg)
+		if _, ok := v.Arg.(Variant); ok {
+			arg = "(" + arg + ")"
+		}
+		return v.Ctor + " " + arg
+	case chan Value:
+		return "<chan>"
+	}
+	return fmt.Sprintf("<%v>", v)
+}
+
+// equal compares values structurally, like the comparison of the Go values which the code generator makes.
+func equal(a, b Value) bool {
+	switch a := a.(type) {
+	case Tuple:
+		b := b.(Tuple)
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case Variant:
+		b := b.(Variant)
+		return a.Ctor == b.Ctor && equal(a.Arg, b.Arg)
+	}
+	return a == b
+}
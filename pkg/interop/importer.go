@@ -0,0 +1,110 @@
+// Package interop makes the members of Go packages accessible from Fun.
+package interop
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/rhysd/locerr"
+	"go/importer"
+	"go/token"
+	gotypes "go/types"
+	"strings"
+)
+
+// Importer loads Go packages from the export data of the local Go installation.
+// Its mapping holds the Go types imported by extern types.
+type Importer struct {
+	*Mapping
+	importer gotypes.Importer
+	packages map[string]*gotypes.Package
+}
+
+func NewImporter() *Importer {
+	return &Importer{
+		Mapping:  NewMapping(),
+		importer: importer.ForCompiler(token.NewFileSet(), "gc", nil),
+		packages: map[string]*gotypes.Package{},
+	}
+}
+
+func (i *Importer) Import(path string) (*gotypes.Package, error) {
+	if pkg, ok := i.packages[path]; ok {
+		return pkg, nil
+	}
+	pkg, err := i.importer.Import(path)
+	if err != nil {
+		return nil, err
+	}
+	i.packages[path] = pkg
+	return pkg, nil
+}
+
+// lookup finds an exported package level object by its qualified name.
+func (i *Importer) lookup(name string) (gotypes.Object, error) {
+	dot := strings.LastIndex(name, ".")
+	if dot <= 0 || dot == len(name)-1 || strings.LastIndex(name, "/") > dot {
+		return nil, fmt.Errorf("'%s' is not a qualified Go name like \"math.Sqrt\"", name)
+	}
+	path, member := name[:dot], name[dot+1:]
+	pkg, err := i.Import(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import Go package \"%s\": %v", path, err)
+	}
+	obj := pkg.Scope().Lookup(member)
+	if obj == nil || !obj.Exported() {
+		return nil, fmt.Errorf("package %s has no exported member %s", path, member)
+	}
+	return obj, nil
+}
+
+// LookupFunc finds a package level function by its qualified name, e.g. "math.Sqrt" or "path/filepath.Join".
+func (i *Importer) LookupFunc(name string) (*gotypes.Func, error) {
+	obj, err := i.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	fun, ok := obj.(*gotypes.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function", name)
+	}
+	return fun, nil
+}
+
+// Resolve looks up the Go function bound by an extern declaration, and checks its signature against the declared type.
+func (i *Importer) Resolve(dec *ast.ExternDec) (*gotypes.Func, error) {
+	fun, err := i.LookupFunc(dec.GoName.Value)
+	if err == nil {
+		err = i.CheckSignature(dec.Arg.Type, fun.Type().(*gotypes.Signature))
+	}
+	if err != nil {
+		return nil, locerr.ErrorfIn(dec.GoName.Start(), dec.GoName.End(), "Cannot bind '%s': %v", dec.Arg.Id.Name, err)
+	}
+	return fun, nil
+}
+
+// LookupType finds a package level named type by its qualified name, e.g. "strings.Builder".
+func (i *Importer) LookupType(name string) (*gotypes.Named, error) {
+	obj, err := i.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	typeName, ok := obj.(*gotypes.TypeName)
+	if !ok || typeName.IsAlias() {
+		return nil, fmt.Errorf("%s is not a named type", name)
+	}
+	named, ok := typeName.Type().(*gotypes.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("generic Go type %s is not supported", name)
+	}
+	return named, nil
+}
+
+// ResolveType looks up the Go type imported by an extern type declaration, and adds it to the mapping.
+func (i *Importer) ResolveType(dec *ast.ExternTypeDec) (*gotypes.Named, error) {
+	named, err := i.LookupType(dec.GoName.Value)
+	if err != nil {
+		return nil, locerr.ErrorfIn(dec.GoName.Start(), dec.GoName.End(), "Cannot import type '%s': %v", dec.Name.Name, err)
+	}
+	i.Add(dec.Name.Name, named)
+	return named, nil
+}
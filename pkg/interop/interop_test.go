@@ -0,0 +1,162 @@
+package interop
+
+import (
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	gotypes "go/types"
+	"testing"
+)
+
+func assertErrorContains(t *testing.T, err error, msg string) {
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestLookupFunc(t *testing.T) {
+	importer := NewImporter()
+	fun, err := importer.LookupFunc("path/filepath.Base")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Base", fun.Name())
+		assert.Equal(t, "path/filepath", fun.Pkg().Path())
+	}
+	_, err = importer.LookupFunc("math.Pi")
+	assertErrorContains(t, err, "math.Pi is not a function")
+	_, err = importer.LookupFunc("math.sqrt")
+	assertErrorContains(t, err, "package math has no exported member sqrt")
+	_, err = importer.LookupFunc("Sqrt")
+	assertErrorContains(t, err, "is not a qualified Go name")
+}
+
+func TestCheckSignature(t *testing.T) {
+	importer := NewImporter()
+	signature := func(name string) *gotypes.Signature {
+		fun, err := importer.LookupFunc(name)
+		assert.NoError(t, err)
+		return fun.Type().(*gotypes.Signature)
+	}
+	tuple := func(ts ...types.Type) types.Type {
+		return types.TupleType(ts)
+	}
+	arrow := types.Arrow
+	assert.NoError(t, importer.CheckSignature(arrow(types.FloatType, types.FloatType), signature("math.Sqrt")))
+	assert.NoError(t, importer.CheckSignature(arrow(tuple(types.StringType, types.IntType), types.StringType), signature("strings.Repeat")))
+	assert.NoError(t, importer.CheckSignature(arrow(types.FloatType, tuple(types.FloatType, types.FloatType)), signature("math.Modf")))
+	assert.NoError(t, importer.CheckSignature(arrow(types.UnitType, types.IntType), signature("os.Getpid")))
+
+	err := importer.CheckSignature(types.FloatType, signature("math.Sqrt"))
+	assertErrorContains(t, err, "not a function type")
+	err = importer.CheckSignature(arrow(types.FloatType, types.FloatType), signature("math.Modf"))
+	assertErrorContains(t, err, "the Go function has 2 result(s), but the declared type has 1")
+	err = importer.CheckSignature(arrow(types.StringType, types.UnitType), signature("fmt.Println"))
+	assertErrorContains(t, err, "variadic Go functions are not supported")
+}
+
+func TestErrorMode(t *testing.T) {
+	importer := NewImporter()
+	fun, err := importer.LookupFunc("strconv.Atoi")
+	assert.NoError(t, err)
+	sig := fun.Type().(*gotypes.Signature)
+	cases := []struct {
+		res  types.Type
+		mode ErrorMode
+	}{
+		{types.ResultType(types.IntType, ErrorType), ErrorResult},
+		{types.IntType, ErrorPanic},
+		{types.TupleType([]types.Type{types.IntType, ErrorType}), ErrorValue},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.mode, ErrorModeOf(c.res, sig.Results()), c.res.String())
+		assert.NoError(t, importer.CheckSignature(types.Arrow(types.StringType, c.res), sig))
+	}
+	err = importer.CheckSignature(types.Arrow(types.StringType, types.ResultType(types.FloatType, ErrorType)), sig)
+	assertErrorContains(t, err, "result 1 has Go type int, which is incompatible with float")
+}
+
+func TestMapping(t *testing.T) {
+	mapping := NewMapping()
+	ctor := func(name string, args ...types.Type) types.Type {
+		return &types.CtorType{Ctor: name, Args: args}
+	}
+	cases := []struct {
+		fun    types.Type
+		goType string
+	}{
+		{types.IntType, "int64"},
+		{types.FloatType, "float64"},
+		{types.CharType, "rune"},
+		{types.UnitType, "struct{}"},
+		{types.TupleType([]types.Type{types.IntType, types.StringType}), "struct{F0 int64; F1 string}"},
+		{types.Arrow(types.BoolType, types.UnitType), "func(bool) struct{}"},
+		{ctor(SliceCtor, types.StringType), "[]string"},
+		{ctor(MapCtor, types.StringType, types.IntType), "map[string]int64"},
+		{ctor(PointerCtor, types.FloatType), "*float64"},
+		{ctor(ChanCtor, types.BoolType), "chan bool"},
+	}
+	for _, c := range cases {
+		gt, err := mapping.ToGo(c.fun)
+		if assert.NoError(t, err) {
+			assert.Equal(t, c.goType, gt.String())
+			back, err := mapping.FromGo(gt)
+			assert.NoError(t, err)
+			assert.Equal(t, c.fun.String(), back.String())
+		}
+	}
+
+	_, err := mapping.ToGo(ctor("list", types.IntType))
+	assertErrorContains(t, err, "type int list has no Go counterpart")
+	_, err = mapping.ToGo(ctor(MapCtor, types.Arrow(types.IntType, types.IntType), types.IntType))
+	assertErrorContains(t, err, "is not comparable in Go")
+	_, err = mapping.FromGo(gotypes.NewChan(gotypes.RecvOnly, gotypes.Typ[gotypes.Int]))
+	assertErrorContains(t, err, "Go type <-chan int has no Fun counterpart")
+	_, err = mapping.FromGo(gotypes.Typ[gotypes.Uint8])
+	assertErrorContains(t, err, "Go type uint8 has no Fun counterpart")
+
+	a, b := types.NewVar(0), types.NewVar(1)
+	param := gotypes.NewTypeParam(gotypes.NewTypeName(0, nil, "A", nil), gotypes.NewInterfaceType(nil, nil))
+	generic := mapping.WithTypeParams(map[*types.Var]*gotypes.TypeParam{a: param})
+	gt, err := generic.ToGo(types.Arrow(a, b))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "func(A) any", gt.String())
+	}
+}
+
+func TestMember(t *testing.T) {
+	importer := NewImporter()
+	for name, goName := range map[string]string{"builder": "strings.Builder", "time": "time.Time", "rat": "math/big.Rat"} {
+		named, err := importer.LookupType(goName)
+		if assert.NoError(t, err) {
+			importer.Add(name, named)
+		}
+	}
+	cases := []struct {
+		typeName string
+		member   string
+		kind     MemberKind
+		t        string
+	}{
+		{"builder", NewMember, AllocMember, "unit -> builder ptr"},
+		{"builder", "WriteString", MethodMember, "builder ptr -> string -> (int, error) result"},
+		{"builder", "Len", MethodMember, "builder ptr -> int"},
+		{"builder", "Reset", MethodMember, "builder ptr -> unit"},
+		{"time", "Unix", MethodMember, "time -> int"},
+		{"time", "Before", MethodMember, "time -> time -> bool"},
+		{"time", NewMember, AllocMember, "unit -> time ptr"},
+	}
+	for _, c := range cases {
+		member, err := importer.Member(c.typeName, c.member)
+		if assert.NoError(t, err, c.member) {
+			assert.Equal(t, c.kind, member.Kind)
+			assert.Equal(t, c.t, member.Type.String())
+		}
+	}
+
+	_, err := importer.Member("builder", "grow")
+	assertErrorContains(t, err, "Go type strings.Builder has no exported field or method grow")
+	_, err = importer.Member("rat", "SetFrac")
+	assertErrorContains(t, err, "method SetFrac: Go type math/big.Int has no Fun counterpart")
+	_, err = importer.Member("buffer", "Len")
+	assertErrorContains(t, err, "type buffer is not an extern type")
+	_, err = importer.LookupType("strings.ToUpper")
+	assertErrorContains(t, err, "strings.ToUpper is not a named type")
+}
@@ -0,0 +1,290 @@
+package interop
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/types"
+	gotypes "go/types"
+)
+
+// The type constructors of Go composite types.
+const (
+	SliceCtor   = "slice"
+	MapCtor     = "map"
+	PointerCtor = "ptr"
+	ChanCtor    = "chan"
+)
+
+// ErrorCtor is the type constructor of the Go error interface.
+const ErrorCtor = "error"
+
+// ErrorType is the type of Go errors.
+var ErrorType types.Type = &types.CtorType{Ctor: ErrorCtor}
+
+// The fields of the Go struct of a result, where Ok tells which of the value and the error is valid.
+const (
+	ResultOkField    = "Ok"
+	ResultValueField = "Value"
+	ResultErrField   = "Err"
+)
+
+var (
+	// EmptyStruct is the Go type of unit.
+	EmptyStruct = gotypes.NewStruct(nil, nil)
+	// Any is the Go type of type variables, which can hold any value.
+	Any = gotypes.Universe.Lookup("any").Type()
+	// Error is the Go error interface.
+	Error = gotypes.Universe.Lookup("error").Type()
+)
+
+// Mapping maps types to Go types and vice versa, where the Go named types imported by extern types are abstract types.
+type Mapping struct {
+	named  map[string]*gotypes.Named // the Go type of each extern type
+	names  map[*gotypes.TypeName]string
+	params map[*types.Var]*gotypes.TypeParam // the Go type parameters of type variables, e.g. those of a generic function
+}
+
+func NewMapping() *Mapping {
+	return &Mapping{
+		named: map[string]*gotypes.Named{},
+		names: map[*gotypes.TypeName]string{},
+	}
+}
+
+// Add maps an extern type to a Go named type.
+func (m *Mapping) Add(name string, named *gotypes.Named) {
+	m.named[name] = named
+	m.names[named.Obj()] = name
+}
+
+// WithTypeParams returns a mapping of the same extern types, which maps the type variables to Go type parameters.
+func (m *Mapping) WithTypeParams(params map[*types.Var]*gotypes.TypeParam) *Mapping {
+	return &Mapping{named: m.named, names: m.names, params: params}
+}
+
+// ToGo returns the Go type that represents a type.
+// An extern type is the Go named type, and the other types are mapped as follows.
+//
+//	int      -> int64
+//	float    -> float64
+//	char     -> rune
+//	unit     -> struct{}
+//	a * b    -> struct{ F0 A; F1 B }
+//	a -> b   -> func(A) B
+//	a slice  -> []A
+//	(a, b) map -> map[A]B
+//	a ptr    -> *A
+//	a chan   -> chan A
+//	(a, e) result -> struct{ Ok bool; Value A; Err E }
+//	'a       -> A, if it is a type parameter, or any otherwise
+func (m *Mapping) ToGo(t types.Type) (gotypes.Type, error) {
+	switch ty := t.Prune().(type) {
+	case *types.Var:
+		if param, ok := m.params[ty]; ok {
+			return param, nil
+		}
+		return Any, nil
+	case *types.CtorType:
+		switch ty.Ctor {
+		case "unit":
+			return EmptyStruct, nil
+		case "bool":
+			return gotypes.Typ[gotypes.Bool], nil
+		case "int":
+			return gotypes.Typ[gotypes.Int64], nil
+		case "float":
+			return gotypes.Typ[gotypes.Float64], nil
+		case "string":
+			return gotypes.Typ[gotypes.String], nil
+		case "char":
+			return gotypes.Universe.Lookup("rune").Type(), nil
+		case ErrorCtor:
+			return Error, nil
+		}
+		if named, ok := m.named[ty.Ctor]; ok && len(ty.Args) == 0 {
+			return named, nil
+		}
+		args, err := m.toGoTypes(ty.Args)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ty.Ctor == "*":
+			fields := make([]*gotypes.Var, len(args))
+			for i, arg := range args {
+				fields[i] = gotypes.NewField(0, nil, fmt.Sprintf("F%d", i), arg, false)
+			}
+			return gotypes.NewStruct(fields, nil), nil
+		case ty.Ctor == "->":
+			return funcType(args[0], args[1]), nil
+		case ty.Ctor == SliceCtor && len(args) == 1:
+			return gotypes.NewSlice(args[0]), nil
+		case ty.Ctor == MapCtor && len(args) == 2:
+			if !gotypes.Comparable(args[0]) {
+				return nil, fmt.Errorf("the key type %s of %s is not comparable in Go", ty.Args[0], t)
+			}
+			return gotypes.NewMap(args[0], args[1]), nil
+		case ty.Ctor == PointerCtor && len(args) == 1:
+			return gotypes.NewPointer(args[0]), nil
+		case ty.Ctor == ChanCtor && len(args) == 1:
+			return gotypes.NewChan(gotypes.SendRecv, args[0]), nil
+		case ty.Ctor == types.ResultCtor && len(args) == 2:
+			return gotypes.NewStruct([]*gotypes.Var{
+				gotypes.NewField(0, nil, ResultOkField, gotypes.Typ[gotypes.Bool], false),
+				gotypes.NewField(0, nil, ResultValueField, args[0], false),
+				gotypes.NewField(0, nil, ResultErrField, args[1], false),
+			}, nil), nil
+		}
+	}
+	return nil, fmt.Errorf("type %s has no Go counterpart", t)
+}
+
+func (m *Mapping) toGoTypes(ts []types.Type) ([]gotypes.Type, error) {
+	result := make([]gotypes.Type, len(ts))
+	for i, t := range ts {
+		gt, err := m.ToGo(t)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = gt
+	}
+	return result, nil
+}
+
+func funcType(arg, res gotypes.Type) *gotypes.Signature {
+	params := gotypes.NewTuple(gotypes.NewParam(0, nil, "", arg))
+	results := gotypes.NewTuple(gotypes.NewParam(0, nil, "", res))
+	return gotypes.NewSignatureType(nil, nil, nil, params, results, false)
+}
+
+// FromGo returns the type that represents a Go type. It is the inverse of ToGo,
+// except that the Go int type is also represented by int.
+func (m *Mapping) FromGo(gt gotypes.Type) (types.Type, error) {
+	if gotypes.Identical(gt, Error) {
+		return ErrorType, nil
+	}
+	switch ty := gt.(type) {
+	case *gotypes.Named:
+		if name, ok := m.names[ty.Obj()]; ok {
+			return &types.CtorType{Ctor: name}, nil
+		}
+	case *gotypes.Basic:
+		switch ty.Kind() {
+		case gotypes.Bool:
+			return types.BoolType, nil
+		case gotypes.Int, gotypes.Int64:
+			return types.IntType, nil
+		case gotypes.Float64:
+			return types.FloatType, nil
+		case gotypes.String:
+			return types.StringType, nil
+		case gotypes.Int32:
+			return types.CharType, nil
+		}
+	case *gotypes.Struct:
+		if ty.NumFields() == 0 {
+			return types.UnitType, nil
+		}
+		if ty.NumFields() == 3 && ty.Field(0).Name() == ResultOkField && ty.Field(1).Name() == ResultValueField && ty.Field(2).Name() == ResultErrField {
+			return m.ctorFromGo(types.ResultCtor, ty.Field(1).Type(), ty.Field(2).Type())
+		}
+		ts := make([]types.Type, ty.NumFields())
+		for i := range ts {
+			field := ty.Field(i)
+			if field.Name() != fmt.Sprintf("F%d", i) {
+				return nil, fmt.Errorf("Go type %s is not a tuple", gt)
+			}
+			t, err := m.FromGo(field.Type())
+			if err != nil {
+				return nil, err
+			}
+			ts[i] = t
+		}
+		return types.TupleType(ts), nil
+	case *gotypes.Signature:
+		return m.FromSignature(ty)
+	case *gotypes.Slice:
+		return m.ctorFromGo(SliceCtor, ty.Elem())
+	case *gotypes.Map:
+		return m.ctorFromGo(MapCtor, ty.Key(), ty.Elem())
+	case *gotypes.Pointer:
+		return m.ctorFromGo(PointerCtor, ty.Elem())
+	case *gotypes.Chan:
+		if ty.Dir() == gotypes.SendRecv {
+			return m.ctorFromGo(ChanCtor, ty.Elem())
+		}
+	}
+	return nil, fmt.Errorf("Go type %s has no Fun counterpart", gt)
+}
+
+func (m *Mapping) ctorFromGo(ctor string, gts ...gotypes.Type) (types.Type, error) {
+	args := make([]types.Type, len(gts))
+	for i, gt := range gts {
+		t, err := m.FromGo(gt)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = t
+	}
+	return &types.CtorType{Ctor: ctor, Args: args}, nil
+}
+
+// FromSignature returns the function type of a Go function signature,
+// where the parameters and results are collected as Spread describes, and a last error result makes a result type.
+func (m *Mapping) FromSignature(sig *gotypes.Signature) (types.Type, error) {
+	if sig.Variadic() {
+		return nil, fmt.Errorf("variadic Go functions are not supported")
+	}
+	arg, err := m.FromTuple(sig.Params())
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.FromResults(sig.Results())
+	if err != nil {
+		return nil, err
+	}
+	return types.Arrow(arg, res), nil
+}
+
+// FromTuple returns the type of a list of Go values, as the inverse of Spread.
+func (m *Mapping) FromTuple(tuple *gotypes.Tuple) (types.Type, error) {
+	ts := make([]types.Type, tuple.Len())
+	for i := range ts {
+		t, err := m.FromGo(tuple.At(i).Type())
+		if err != nil {
+			return nil, err
+		}
+		ts[i] = t
+	}
+	switch len(ts) {
+	case 0:
+		return types.UnitType, nil
+	case 1:
+		return ts[0], nil
+	}
+	return types.TupleType(ts), nil
+}
+
+// FromResults returns the type of the results of a Go function. It is like FromTuple,
+// except that the results ending with an error are represented by (a, error) result, where a is the type of the other results.
+func (m *Mapping) FromResults(results *gotypes.Tuple) (types.Type, error) {
+	n := results.Len()
+	if n == 0 || !gotypes.Identical(results.At(n-1).Type(), Error) {
+		return m.FromTuple(results)
+	}
+	value, err := m.FromTuple(gotypes.NewTuple(tupleVars(results)[:n-1]...))
+	if err != nil {
+		return nil, err
+	}
+	return types.ResultType(value, ErrorType), nil
+}
+
+// Convertible returns whether a value of the Go type converts to and from the Go type of t,
+// i.e. the types are identical, or a Go int represents an int.
+func (m *Mapping) Convertible(t types.Type, gt gotypes.Type) bool {
+	mapped, err := m.ToGo(t)
+	if err != nil {
+		return false
+	}
+	basic, ok := gt.(*gotypes.Basic)
+	return gotypes.Identical(mapped, gt) || ok && basic.Kind() == gotypes.Int && t.Equal(types.IntType)
+}
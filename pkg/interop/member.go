@@ -0,0 +1,102 @@
+package interop
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/types"
+	gotypes "go/types"
+)
+
+// NewMember is the name of the member which allocates a zero value of an extern type, like the Go builtin new.
+const NewMember = "new"
+
+type MemberKind int
+
+const (
+	MethodMember MemberKind = iota
+	FieldMember
+	AllocMember
+)
+
+// Member is a member of an extern type: a method, an exported field of a struct type, or the allocation of a zero value.
+type Member struct {
+	Kind MemberKind
+	// Object is the *gotypes.Func of a method, or the *gotypes.Var of a field.
+	Object gotypes.Object
+	// Type is the function type of the member, taking the receiver as the first argument.
+	Type types.Type
+	// Params tells whether a method takes an argument after the receiver.
+	Params bool
+}
+
+// Member finds a member of an extern type T, and returns it with its type as follows.
+//
+//	new              : unit -> T ptr
+//	field F of type A: R -> A
+//	method M()   B   : R -> B
+//	method M(A)  B   : R -> A -> B
+//
+// The parameters and results of methods are spread like those of Go functions, and a last error result makes a result type.
+// The receiver R of a method is T if the method is in the method set of the Go type, and T ptr otherwise, i.e. it has a pointer receiver.
+// The receiver of a field is T ptr if any method has a pointer receiver, since such values are shared by pointers in Go, and T otherwise.
+func (m *Mapping) Member(typeName, name string) (*Member, error) {
+	named, ok := m.named[typeName]
+	if !ok {
+		return nil, fmt.Errorf("type %s is not an extern type", typeName)
+	}
+	value := &types.CtorType{Ctor: typeName}
+	pointer := &types.CtorType{Ctor: PointerCtor, Args: []types.Type{value}}
+	if name == NewMember {
+		return &Member{Kind: AllocMember, Type: types.Arrow(types.UnitType, pointer)}, nil
+	}
+	pkg := named.Obj().Pkg()
+	obj, _, _ := gotypes.LookupFieldOrMethod(gotypes.NewPointer(named), false, pkg, name)
+	if obj == nil || !obj.Exported() {
+		return nil, fmt.Errorf("Go type %s has no exported field or method %s", named, name)
+	}
+	switch obj := obj.(type) {
+	case *gotypes.Var:
+		t, err := m.FromGo(obj.Type())
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", name, err)
+		}
+		var recv types.Type = value
+		if gotypes.NewMethodSet(named).Len() < gotypes.NewMethodSet(gotypes.NewPointer(named)).Len() {
+			recv = pointer
+		}
+		return &Member{Kind: FieldMember, Object: obj, Type: types.Arrow(recv, t)}, nil
+	case *gotypes.Func:
+		sig := obj.Type().(*gotypes.Signature)
+		if sig.Variadic() {
+			return nil, fmt.Errorf("method %s: variadic Go functions are not supported", name)
+		}
+		arg, err := m.FromTuple(sig.Params())
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %v", name, err)
+		}
+		res, err := m.FromResults(sig.Results())
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %v", name, err)
+		}
+		var recv types.Type = value
+		if gotypes.NewMethodSet(named).Lookup(pkg, name) == nil {
+			recv = pointer
+		}
+		member := &Member{Kind: MethodMember, Object: obj, Params: sig.Params().Len() > 0}
+		if member.Params {
+			member.Type = types.Arrow(recv, types.Arrow(arg, res))
+		} else {
+			member.Type = types.Arrow(recv, res)
+		}
+		return member, nil
+	}
+	return nil, fmt.Errorf("%s of Go type %s is not a field or method", name, named)
+}
+
+// MemberType returns the type of a member of an extern type.
+func (m *Mapping) MemberType(typeName, name string) (types.Type, error) {
+	member, err := m.Member(typeName, name)
+	if err != nil {
+		return nil, err
+	}
+	return member.Type, nil
+}
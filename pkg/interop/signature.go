@@ -0,0 +1,105 @@
+package interop
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/types"
+	gotypes "go/types"
+)
+
+// Spread splits a type into the list of Go values it is passed as.
+// The unit type means no value, a tuple means one value per element, and any other type means a single value.
+func Spread(t types.Type) []types.Type {
+	if t.Equal(types.UnitType) {
+		return nil
+	}
+	if ts, ok := types.AsTuple(t); ok {
+		return ts
+	}
+	return []types.Type{t}
+}
+
+// ErrorMode tells how the last error result of a Go function is returned, as the declared result type selects.
+type ErrorMode int
+
+const (
+	// ErrorValue returns the error as an ordinary value of type error.
+	ErrorValue ErrorMode = iota
+	// ErrorResult returns Err of a non-nil error, and Ok of the other results otherwise.
+	ErrorResult
+	// ErrorPanic panics with a non-nil error, and returns the other results otherwise.
+	ErrorPanic
+)
+
+// ErrorModeOf returns the error mode of a declared result type for the results of a Go function.
+// It is ErrorResult for (a, error) result, ErrorPanic if the type omits the last error, and ErrorValue otherwise.
+func ErrorModeOf(res types.Type, results *gotypes.Tuple) ErrorMode {
+	n := results.Len()
+	if n == 0 || !gotypes.Identical(results.At(n-1).Type(), Error) {
+		return ErrorValue
+	}
+	if _, err, ok := types.AsResult(res); ok && err.Equal(ErrorType) {
+		return ErrorResult
+	}
+	if len(Spread(res)) == n-1 {
+		return ErrorPanic
+	}
+	return ErrorValue
+}
+
+// ValueResults returns the types of the results of a Go function other than the error which the error mode handles.
+func ValueResults(mode ErrorMode, res types.Type) []types.Type {
+	if mode == ErrorResult {
+		value, _, _ := types.AsResult(res)
+		return Spread(value)
+	}
+	return Spread(res)
+}
+
+// CheckSignature checks if a function type is compatible with a Go function signature.
+// The argument is spread into the parameters, and the result into the results of the Go function,
+// except for the last error result which the ErrorMode handles.
+func (m *Mapping) CheckSignature(t types.Type, sig *gotypes.Signature) error {
+	arg, res, ok := types.AsArrow(t)
+	if !ok {
+		return fmt.Errorf("the declared type %s is not a function type", t)
+	}
+	goType, err := m.FromSignature(sig)
+	if err != nil {
+		return err
+	}
+	if err := m.checkValues("parameter", Spread(arg), tupleVars(sig.Params())); err != nil {
+		return fmt.Errorf("%v; the Go function has type %s", err, goType)
+	}
+	results := tupleVars(sig.Results())
+	mode := ErrorModeOf(res, sig.Results())
+	if mode != ErrorValue {
+		results = results[:len(results)-1]
+	}
+	if err := m.checkValues("result", ValueResults(mode, res), results); err != nil {
+		return fmt.Errorf("%v; the Go function has type %s", err, goType)
+	}
+	return nil
+}
+
+func (m *Mapping) checkValues(kind string, ts []types.Type, vars []*gotypes.Var) error {
+	if len(ts) != len(vars) {
+		return fmt.Errorf("the Go function has %d %s(s), but the declared type has %d", len(vars), kind, len(ts))
+	}
+	for i, t := range ts {
+		if _, err := m.ToGo(t); err != nil {
+			return err
+		}
+		if gt := vars[i].Type(); !m.Convertible(t, gt) {
+			return fmt.Errorf("%s %d has Go type %s, which is incompatible with %s", kind, i+1, gt, t)
+		}
+	}
+	return nil
+}
+
+func tupleVars(tuple *gotypes.Tuple) []*gotypes.Var {
+	vars := make([]*gotypes.Var, tuple.Len())
+	for i := range vars {
+		vars[i] = tuple.At(i)
+	}
+	return vars
+}
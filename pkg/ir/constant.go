@@ -24,7 +24,7 @@ func (c Char) tag() expTag {
 }
 
 type Int struct {
-	Value int
+	Value int64
 }
 
 func (i Int) tag() expTag {
@@ -3,6 +3,7 @@ package ir
 import (
 	"github.com/lilac/fun-lang/pkg/ast"
 	"github.com/lilac/fun-lang/pkg/types"
+	gotypes "go/types"
 )
 
 type decTag int8
@@ -10,6 +11,9 @@ type decTag int8
 const (
 	valDecTag = iota
 	funDecTag
+	recDecTag
+	externDecTag
+	externTypeDecTag
 )
 
 type Dec interface {
@@ -33,12 +37,53 @@ type FunDec struct {
 	Type types.Type
 	Args []Arg
 	Body Exp
+	// Env is the free variables of a lifted function, which are passed with the first argument by a Call.
+	Env []Arg
 }
 
 func (f FunDec) tag() decTag {
 	return funDecTag
 }
 
+// EnvType returns the type of a function of its free variables and then its arguments, which is Type if Env is empty.
+func (f *FunDec) EnvType() types.Type {
+	t := f.Type
+	for i := len(f.Env) - 1; i >= 0; i-- {
+		t = types.Arrow(f.Env[i].Type, t)
+	}
+	return t
+}
+
+// RecDec declares mutually recursive functions, which are in scope of all their bodies.
+type RecDec struct {
+	Funs []*FunDec
+}
+
+func (r RecDec) tag() decTag {
+	return recDecTag
+}
+
+// ExternDec binds a Go function, whose signature has been checked against Type.
+type ExternDec struct {
+	Id   ast.Identifier
+	Type types.Type
+	Func *gotypes.Func
+}
+
+func (e ExternDec) tag() decTag {
+	return externDecTag
+}
+
+// ExternTypeDec maps an extern type to a Go named type.
+type ExternTypeDec struct {
+	Name  string
+	Named *gotypes.Named
+}
+
+func (e ExternTypeDec) tag() decTag {
+	return externTypeDecTag
+}
+
 type Module struct {
 	Decs []Dec
 }
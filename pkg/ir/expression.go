@@ -4,6 +4,7 @@ package ir
 
 import (
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/interop"
 	"github.com/lilac/fun-lang/pkg/types"
 )
 
@@ -31,6 +32,15 @@ const (
 	ifThenTag
 	letInTag
 	funTag
+	matchFailureTag
+	memberTag
+	variantTag
+	isVariantTag
+	payloadTag
+	primitiveTag
+	selectTag
+	callTag
+	jumpTag
 )
 
 type Exp interface {
@@ -56,7 +66,8 @@ func (s Sequence) tag() expTag {
 }
 
 type Var struct {
-	Id ast.Identifier
+	Id   ast.Identifier
+	Type types.Type // the type instantiated at the reference
 }
 
 func (v Var) tag() expTag {
@@ -64,8 +75,9 @@ func (v Var) tag() expTag {
 }
 
 type App struct {
-	Id  ast.Identifier
+	Fun Exp
 	Arg Exp
+	Pos string // the position of the application in the source, e.g. main.fun:3:9, or empty if a pass makes it
 }
 
 func (a App) tag() expTag {
@@ -96,6 +108,7 @@ type Arg struct {
 	Type types.Type
 }
 
+// Fn is a function of one argument, where Id names the argument and Type is the arrow type of the function.
 type Fn struct {
 	Id   ast.Identifier
 	Type types.Type
@@ -105,3 +118,172 @@ type Fn struct {
 func (f Fn) tag() expTag {
 	return funTag
 }
+
+// MatchFailure aborts the evaluation when no pattern matches the value.
+type MatchFailure struct {
+	Type types.Type
+}
+
+func (m MatchFailure) tag() expTag {
+	return matchFailureTag
+}
+
+// Member refers to a member of an extern type, i.e. a method or a field of a Go type, or the allocation of a zero value.
+type Member struct {
+	*interop.Member
+}
+
+func (m Member) tag() expTag {
+	return memberTag
+}
+
+// Variant makes a value of a datatype with a constructor, e.g. Ok 1.
+type Variant struct {
+	Ctor string
+	Arg  Exp
+	Type types.Type
+}
+
+func (v Variant) tag() expTag {
+	return variantTag
+}
+
+// IsVariant tests whether a value of a datatype is made by the constructor.
+type IsVariant struct {
+	Ctor  string
+	Value Exp
+}
+
+func (i IsVariant) tag() expTag {
+	return isVariantTag
+}
+
+// Payload is the argument of the constructor which made a value of a datatype.
+type Payload struct {
+	Ctor  string
+	Value Exp
+	Type  types.Type
+}
+
+func (p Payload) tag() expTag {
+	return payloadTag
+}
+
+// Primitive is a built-in function, e.g. spawn.
+type Primitive struct {
+	Name string
+	Type types.Type // the type instantiated at the reference
+	Pos  string     // the position of the reference, e.g. main.fun:3:9, which the assertions report when they fail
+}
+
+func (p Primitive) tag() expTag {
+	return primitiveTag
+}
+
+// Select waits until the channel operation of an arm can proceed, and evaluates the body of the arm.
+type Select struct {
+	Arms []SelectArm
+	Type types.Type
+}
+
+// SelectArm receives a value from Chan into Id, or sends Value to Chan when it is not nil.
+// The default arm has no channel.
+type SelectArm struct {
+	Chan  Exp
+	Value Exp
+	Id    *Arg // the variable of the received value, if it is used
+	Body  Exp
+}
+
+func (s Select) tag() expTag {
+	return selectTag
+}
+
+// Call applies a function to several arguments at once, e.g. a lifted function to its free variables and its first argument.
+// The type of Fun is the curried type of the function of all the arguments.
+type Call struct {
+	Fun  *Var
+	Args []Exp
+	Pos  string // the position of the application which the call is made of, like App.Pos
+}
+
+func (c Call) tag() expTag {
+	return callTag
+}
+
+// Jump is a tail call of the function itself or of a function in its recursive declaration, which is a loop in Go.
+// It assigns the free variables and then the arguments of the function to its parameters, and jumps to its body.
+// Type is the type of the result.
+type Jump struct {
+	Fun  *Var
+	Args []Exp
+	Type types.Type
+}
+
+func (j Jump) tag() expTag {
+	return jumpTag
+}
+
+// TypeOf returns the type of the expression.
+func TypeOf(exp Exp) types.Type {
+	switch e := exp.(type) {
+	case *Unit:
+		return types.UnitType
+	case *Bool, *Not, *IsVariant:
+		return types.BoolType
+	case *Char:
+		return types.CharType
+	case *Int:
+		return types.IntType
+	case *Float:
+		return types.FloatType
+	case *String:
+		return types.StringType
+	case *Neg:
+		return TypeOf(e.Child)
+	case *BinaryOp:
+		if e.Op.IsArithmetic() {
+			return TypeOf(e.Left)
+		}
+		return types.BoolType
+	case *Tuple:
+		ts := make([]types.Type, len(e.Elements))
+		for i, element := range e.Elements {
+			ts[i] = TypeOf(element)
+		}
+		return types.TupleType(ts)
+	case *Sequence:
+		return TypeOf(e.Elements[len(e.Elements)-1])
+	case *Var:
+		return e.Type
+	case *App:
+		return types.Result(TypeOf(e.Fun))
+	case *IfThen:
+		return TypeOf(e.Then)
+	case *LetIn:
+		return TypeOf(e.Body)
+	case *Fn:
+		return e.Type
+	case *MatchFailure:
+		return e.Type
+	case *Member:
+		return e.Type
+	case *Variant:
+		return e.Type
+	case *Payload:
+		return e.Type
+	case *Primitive:
+		return e.Type
+	case *Select:
+		return e.Type
+	case *Jump:
+		return e.Type
+	case *Call:
+		t := e.Fun.Type
+		for range e.Args {
+			t = types.Result(t)
+		}
+		return t
+	}
+	panic("Bug: unexpected ir expression")
+}
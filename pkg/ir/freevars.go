@@ -0,0 +1,60 @@
+package ir
+
+import "github.com/lilac/fun-lang/pkg/ast"
+
+// FreeVars returns the variables which are referred but not bound in an expression, in order of first occurrence.
+// Since the alpha transformation makes names unique, a name bound anywhere in the expression is not free.
+func FreeVars(exp Exp) []ast.Identifier {
+	bound := map[string]bool{}
+	bind := func(id ast.Identifier) { bound[id.Value] = true }
+	bindFun := func(d *FunDec) {
+		bind(d.Id)
+		for _, arg := range d.Args {
+			bind(arg.Id)
+		}
+		for _, arg := range d.Env {
+			bind(arg.Id)
+		}
+	}
+	bindDec := func(dec Dec) {
+		switch d := dec.(type) {
+		case *ValDec:
+			bind(d.Id)
+		case *FunDec:
+			bindFun(d)
+		case *RecDec:
+			for _, fun := range d.Funs {
+				bindFun(fun)
+			}
+		}
+	}
+	var refs []ast.Identifier
+	Inspect(exp, func(e Exp) bool {
+		switch e := e.(type) {
+		case *Var:
+			refs = append(refs, e.Id)
+		case *Fn:
+			bind(e.Id)
+		case *LetIn:
+			for _, dec := range e.Decs {
+				bindDec(dec)
+			}
+		case *Select:
+			for _, arm := range e.Arms {
+				if arm.Id != nil {
+					bind(arm.Id.Id)
+				}
+			}
+		}
+		return true
+	})
+	var result []ast.Identifier
+	seen := map[string]bool{}
+	for _, id := range refs {
+		if !bound[id.Value] && !seen[id.Value] {
+			seen[id.Value] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
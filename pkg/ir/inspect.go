@@ -0,0 +1,80 @@
+package ir
+
+// Inspect traverses an expression in depth-first order, including the bodies of local declarations.
+// It calls f for each expression, and the children of an expression are skipped if f returns false.
+func Inspect(exp Exp, f func(Exp) bool) {
+	if !f(exp) {
+		return
+	}
+	switch e := exp.(type) {
+	case *Not:
+		Inspect(e.Child, f)
+	case *Neg:
+		Inspect(e.Child, f)
+	case *BinaryOp:
+		Inspect(e.Left, f)
+		Inspect(e.Right, f)
+	case *Tuple:
+		for _, element := range e.Elements {
+			Inspect(element, f)
+		}
+	case *Sequence:
+		for _, element := range e.Elements {
+			Inspect(element, f)
+		}
+	case *App:
+		Inspect(e.Fun, f)
+		Inspect(e.Arg, f)
+	case *IfThen:
+		Inspect(e.Cond, f)
+		Inspect(e.Then, f)
+		Inspect(e.Else, f)
+	case *LetIn:
+		for _, dec := range e.Decs {
+			InspectDec(dec, f)
+		}
+		Inspect(e.Body, f)
+	case *Fn:
+		Inspect(e.Body, f)
+	case *Variant:
+		Inspect(e.Arg, f)
+	case *IsVariant:
+		Inspect(e.Value, f)
+	case *Payload:
+		Inspect(e.Value, f)
+	case *Call:
+		Inspect(e.Fun, f)
+		for _, arg := range e.Args {
+			Inspect(arg, f)
+		}
+	case *Jump:
+		// the function is not called, so it is not a reference.
+		for _, arg := range e.Args {
+			Inspect(arg, f)
+		}
+	case *Select:
+		for _, arm := range e.Arms {
+			if arm.Chan != nil {
+				Inspect(arm.Chan, f)
+			}
+			if arm.Value != nil {
+				Inspect(arm.Value, f)
+			}
+			Inspect(arm.Body, f)
+		}
+	}
+}
+
+// InspectDec traverses the body of a declaration with Inspect.
+func InspectDec(dec Dec, f func(Exp) bool) {
+	switch d := dec.(type) {
+	case *ValDec:
+		Inspect(d.Body, f)
+	case *FunDec:
+		Inspect(d.Body, f)
+	case *RecDec:
+		for _, fun := range d.Funs {
+			Inspect(fun.Body, f)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package irtest builds ir modules for the tests of the passes, which cannot lower source code since the compiler
+// imports them. The unique name of an identifier is its name with the suffix $1, like a name of the alpha transformation.
+package irtest
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+var (
+	IntToInt = types.Arrow(types.IntType, types.IntType)
+	Binary   = types.Arrow(types.IntType, IntToInt) // int -> int -> int
+)
+
+func Id(name string) ast.Identifier {
+	return ast.Identifier{Name: name, Value: name + "$1"}
+}
+
+// Var refers to a variable at a type.
+func Var(name string, t types.Type) *ir.Var {
+	return &ir.Var{Id: Id(name), Type: t}
+}
+
+func Arg(name string, t types.Type) ir.Arg {
+	return ir.Arg{Id: Id(name), Type: t}
+}
+
+func Int(value int64) *ir.Int {
+	return &ir.Int{Value: value}
+}
+
+func Val(name string, t types.Type, body ir.Exp) *ir.ValDec {
+	return &ir.ValDec{Id: Id(name), Type: t, Body: body}
+}
+
+// Fun declares a function of the arguments, whose type is the curried type of the function.
+func Fun(name string, t types.Type, args []ir.Arg, body ir.Exp) *ir.FunDec {
+	return &ir.FunDec{Id: Id(name), Type: t, Args: args, Body: body}
+}
+
+// Apply applies a function to the arguments one at a time.
+func Apply(fun ir.Exp, args ...ir.Exp) ir.Exp {
+	for _, arg := range args {
+		fun = &ir.App{Fun: fun, Arg: arg}
+	}
+	return fun
+}
+
+// Lines prints the declarations of a module, one per element.
+func Lines(module *ir.Module) []string {
+	lines := make([]string, len(module.Decs))
+	for i, dec := range module.Decs {
+		lines[i] = ir.DecString(dec)
+	}
+	return lines
+}
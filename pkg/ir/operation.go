@@ -36,6 +36,11 @@ const (
 	Or
 )
 
+// IsArithmetic returns whether the operator yields a number rather than a boolean.
+func (op Op) IsArithmetic() bool {
+	return op <= Mod
+}
+
 type BinaryOp struct {
 	Left  Exp
 	Op    Op
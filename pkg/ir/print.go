@@ -0,0 +1,188 @@
+package ir
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/interop"
+	"github.com/lilac/fun-lang/pkg/types"
+	"strconv"
+	"strings"
+)
+
+var opNames = map[Op]string{
+	Add:       "+",
+	Minus:     "-",
+	Mul:       "*",
+	Div:       "/",
+	Mod:       "%",
+	Eq:        "=",
+	NotEq:     "<>",
+	Less:      "<",
+	LessEq:    "<=",
+	Greater:   ">",
+	GreaterEq: ">=",
+	And:       "&&",
+	Or:        "||",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// String prints the module in the syntax of the source language, one declaration per line.
+// The identifiers are the unique names of the alpha transformation, and the nodes which have no syntax are printed like
+// calls of pseudo functions, e.g. call f$1 (x$2, 1), so that a module can be read in a dump but not parsed.
+func (m Module) String() string {
+	decs := make([]string, len(m.Decs))
+	for i, dec := range m.Decs {
+		decs[i] = DecString(dec)
+	}
+	return strings.Join(decs, "\n")
+}
+
+// DecString prints a declaration.
+func DecString(dec Dec) string {
+	switch d := dec.(type) {
+	case *ValDec:
+		return fmt.Sprintf("val %s : %v = %s", d.Id.Value, d.Type, ExpString(d.Body))
+	case *FunDec:
+		return "fun " + funString(d)
+	case *RecDec:
+		funs := make([]string, len(d.Funs))
+		for i, fun := range d.Funs {
+			funs[i] = funString(fun)
+		}
+		return "fun " + strings.Join(funs, " and ")
+	case *ExternDec:
+		return fmt.Sprintf("extern val %s : %v = %q", d.Id.Value, d.Type, d.Func.FullName())
+	case *ExternTypeDec:
+		return fmt.Sprintf("extern type %s = %q", d.Name, d.Named.String())
+	}
+	panic("Bug: unexpected ir declaration")
+}
+
+// funString prints a function without the keyword, where the free variables of a lifted function are in brackets.
+func funString(d *FunDec) string {
+	var b strings.Builder
+	b.WriteString(d.Id.Value)
+	if len(d.Env) > 0 {
+		env := make([]string, len(d.Env))
+		for i, arg := range d.Env {
+			env[i] = argString(arg)
+		}
+		fmt.Fprintf(&b, " [%s]", strings.Join(env, ", "))
+	}
+	for _, arg := range d.Args {
+		fmt.Fprintf(&b, " (%s)", argString(arg))
+	}
+	fmt.Fprintf(&b, " = %s", ExpString(d.Body))
+	return b.String()
+}
+
+func argString(arg Arg) string {
+	return fmt.Sprintf("%s : %v", arg.Id.Value, arg.Type)
+}
+
+// ExpString prints an expression.
+func ExpString(exp Exp) string {
+	switch e := exp.(type) {
+	case *Unit:
+		return "()"
+	case *Bool:
+		return strconv.FormatBool(e.Value)
+	case *Int:
+		return strconv.FormatInt(e.Value, 10)
+	case *Float:
+		return strconv.FormatFloat(e.Value, 'g', -1, 64)
+	case *String:
+		return strconv.Quote(e.Value)
+	case *Char:
+		return strconv.QuoteRune(e.Value)
+	case *Var:
+		return e.Id.Value
+	case *Not:
+		return "not " + atom(e.Child)
+	case *Neg:
+		return "-" + atom(e.Child)
+	case *BinaryOp:
+		return fmt.Sprintf("%s %v %s", atom(e.Left), e.Op, atom(e.Right))
+	case *Tuple:
+		return fmt.Sprintf("(%s)", expsString(e.Elements, ", "))
+	case *Sequence:
+		return fmt.Sprintf("(%s)", expsString(e.Elements, "; "))
+	case *App:
+		if _, ok := e.Fun.(*App); ok {
+			return fmt.Sprintf("%s %s", ExpString(e.Fun), atom(e.Arg))
+		}
+		return fmt.Sprintf("%s %s", atom(e.Fun), atom(e.Arg))
+	case *IfThen:
+		return fmt.Sprintf("if %s then %s else %s", ExpString(e.Cond), ExpString(e.Then), ExpString(e.Else))
+	case *LetIn:
+		decs := make([]string, len(e.Decs))
+		for i, dec := range e.Decs {
+			decs[i] = DecString(dec)
+		}
+		return fmt.Sprintf("let %s in %s end", strings.Join(decs, " "), ExpString(e.Body))
+	case *Fn:
+		return fmt.Sprintf("fn %s => %s", e.Id.Value, ExpString(e.Body))
+	case *MatchFailure:
+		return "matchFailure"
+	case *Member:
+		if e.Kind == interop.AllocMember {
+			// the allocation has no Go object, so it is named by the pointer type which it makes.
+			return fmt.Sprintf("member %q of %s", interop.NewMember, types.Result(e.Type))
+		}
+		return fmt.Sprintf("member %q", e.Object.Name())
+	case *Variant:
+		return fmt.Sprintf("%s %s", e.Ctor, atom(e.Arg))
+	case *IsVariant:
+		return fmt.Sprintf("is %s %s", e.Ctor, atom(e.Value))
+	case *Payload:
+		return fmt.Sprintf("payload %s %s", e.Ctor, atom(e.Value))
+	case *Primitive:
+		return e.Name
+	case *Select:
+		arms := make([]string, len(e.Arms))
+		for i, arm := range e.Arms {
+			arms[i] = armString(arm)
+		}
+		return fmt.Sprintf("select %s end", strings.Join(arms, " | "))
+	case *Call:
+		return fmt.Sprintf("call %s (%s)", e.Fun.Id.Value, expsString(e.Args, ", "))
+	case *Jump:
+		return fmt.Sprintf("jump %s (%s)", e.Fun.Id.Value, expsString(e.Args, ", "))
+	}
+	panic("Bug: unexpected ir expression")
+}
+
+func armString(arm SelectArm) string {
+	switch {
+	case arm.Chan == nil:
+		return fmt.Sprintf("else => %s", ExpString(arm.Body))
+	case arm.Value != nil:
+		return fmt.Sprintf("%s ! %s => %s", atom(arm.Chan), atom(arm.Value), ExpString(arm.Body))
+	case arm.Id != nil:
+		return fmt.Sprintf("%s ? %s => %s", atom(arm.Chan), arm.Id.Id.Value, ExpString(arm.Body))
+	}
+	return fmt.Sprintf("%s ? _ => %s", atom(arm.Chan), ExpString(arm.Body))
+}
+
+func expsString(exps []Exp, sep string) string {
+	elements := make([]string, len(exps))
+	for i, exp := range exps {
+		elements[i] = ExpString(exp)
+	}
+	return strings.Join(elements, sep)
+}
+
+// atom prints an expression, which is parenthesized unless its syntax is delimited.
+func atom(exp Exp) string {
+	switch exp.(type) {
+	case *Unit, *Bool, *Int, *Float, *String, *Char, *Var, *Tuple, *Sequence, *LetIn, *Select, *Primitive:
+		s := ExpString(exp)
+		if e, ok := exp.(*Int); ok && e.Value < 0 {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	return "(" + ExpString(exp) + ")"
+}
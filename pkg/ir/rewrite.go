@@ -0,0 +1,87 @@
+package ir
+
+// Rewrite returns a copy of an expression whose children are rewritten by f, including the bodies of local declarations,
+// or the expression itself if it has no children. Like Inspect, the functions of a Call and a Jump are not rewritten,
+// since they are the variables of declared functions. A pass rewrites the expressions which it changes, and calls Rewrite
+// with itself for the others.
+func Rewrite(exp Exp, f func(Exp) Exp) Exp {
+	switch e := exp.(type) {
+	case *Not:
+		return &Not{Child: f(e.Child)}
+	case *Neg:
+		return &Neg{Child: f(e.Child)}
+	case *BinaryOp:
+		return NewBinaryOp(e.Op, f(e.Left), f(e.Right))
+	case *Tuple:
+		return &Tuple{Elements: rewriteExps(e.Elements, f)}
+	case *Sequence:
+		return &Sequence{Elements: rewriteExps(e.Elements, f)}
+	case *App:
+		return &App{Fun: f(e.Fun), Arg: f(e.Arg), Pos: e.Pos}
+	case *IfThen:
+		return &IfThen{Cond: f(e.Cond), Then: f(e.Then), Else: f(e.Else)}
+	case *LetIn:
+		return &LetIn{Decs: RewriteDecs(e.Decs, f), Body: f(e.Body)}
+	case *Fn:
+		return &Fn{Id: e.Id, Type: e.Type, Body: f(e.Body)}
+	case *Variant:
+		return &Variant{Ctor: e.Ctor, Arg: f(e.Arg), Type: e.Type}
+	case *IsVariant:
+		return &IsVariant{Ctor: e.Ctor, Value: f(e.Value)}
+	case *Payload:
+		return &Payload{Ctor: e.Ctor, Value: f(e.Value), Type: e.Type}
+	case *Call:
+		return &Call{Fun: e.Fun, Args: rewriteExps(e.Args, f), Pos: e.Pos}
+	case *Jump:
+		return &Jump{Fun: e.Fun, Args: rewriteExps(e.Args, f), Type: e.Type}
+	case *Select:
+		arms := make([]SelectArm, len(e.Arms))
+		for i, arm := range e.Arms {
+			arms[i] = SelectArm{Id: arm.Id, Body: f(arm.Body)}
+			if arm.Chan != nil {
+				arms[i].Chan = f(arm.Chan)
+			}
+			if arm.Value != nil {
+				arms[i].Value = f(arm.Value)
+			}
+		}
+		return &Select{Arms: arms, Type: e.Type}
+	}
+	// the other expressions have no children.
+	return exp
+}
+
+// RewriteDecs returns copies of declarations whose bodies are rewritten by f. The other declarations are kept.
+func RewriteDecs(decs []Dec, f func(Exp) Exp) []Dec {
+	result := make([]Dec, len(decs))
+	for i, dec := range decs {
+		switch d := dec.(type) {
+		case *ValDec:
+			result[i] = &ValDec{Id: d.Id, Type: d.Type, Body: f(d.Body)}
+		case *FunDec:
+			result[i] = RewriteFun(d, f)
+		case *RecDec:
+			funs := make([]*FunDec, len(d.Funs))
+			for j, fun := range d.Funs {
+				funs[j] = RewriteFun(fun, f)
+			}
+			result[i] = &RecDec{Funs: funs}
+		default:
+			result[i] = dec
+		}
+	}
+	return result
+}
+
+// RewriteFun returns a copy of a function whose body is rewritten by f.
+func RewriteFun(d *FunDec, f func(Exp) Exp) *FunDec {
+	return &FunDec{Id: d.Id, Type: d.Type, Args: d.Args, Env: d.Env, Body: f(d.Body)}
+}
+
+func rewriteExps(exps []Exp, f func(Exp) Exp) []Exp {
+	result := make([]Exp, len(exps))
+	for i, exp := range exps {
+		result[i] = f(exp)
+	}
+	return result
+}
@@ -0,0 +1,299 @@
+// Package lift lifts the local functions which do not escape to top level functions.
+//
+// A local function escapes if it is referred other than being applied, e.g. returned or passed to another function,
+// and it remains a Go closure then. The other local functions become top level Go functions, whose free variables are
+// passed as extra parameters with the first argument, so that a call allocates no closure for them.
+package lift
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/common"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// binding is a local variable in scope, which is a lifted function if fun is not nil.
+type binding struct {
+	t   types.Type
+	fun *lifted
+}
+
+// lifted is a lifted function, whose body is nil until it is complete.
+type lifted struct {
+	dec *ir.FunDec
+}
+
+type scope = *common.Env[string, binding]
+
+type lifter struct {
+	escaping map[string]bool     // the local functions which escape
+	names    map[string]bool     // the names of top level declarations
+	lifted   []ir.Dec            // the lifted functions of the current top level declaration
+	envs     map[string][]ir.Arg // the free variables of each lifted function
+	previous map[string][]ir.Arg // the free variables found by the previous round
+	stable   bool                // whether the free variables are the same as the previous round
+}
+
+// Lift lifts the non-escaping local functions of a module.
+// A lifted function precedes the top level declaration which it is lifted from.
+//
+// A function may be called before its free variables are known, i.e. in its own body, so the calls get the free variables
+// found by the previous round, and the module is lifted again until they do not change.
+func Lift(module *ir.Module) *ir.Module {
+	escaping := escapingFuncs(module)
+	var previous map[string][]ir.Arg
+	for {
+		l := &lifter{escaping: escaping, names: map[string]bool{}, envs: map[string][]ir.Arg{}, previous: previous, stable: true}
+		result := l.lift(module)
+		if l.stable {
+			return result
+		}
+		previous = l.envs
+	}
+}
+
+func (l *lifter) lift(module *ir.Module) *ir.Module {
+	for _, dec := range module.Decs {
+		for _, name := range decNames(dec) {
+			l.names[name] = true
+		}
+	}
+	var decs []ir.Dec
+	for _, dec := range module.Decs {
+		var result ir.Dec
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			result = &ir.ValDec{Id: d.Id, Type: d.Type, Body: l.exp(d.Body, common.NewEnv[string, binding](nil))}
+		case *ir.FunDec:
+			result = l.topFun(d)
+		case *ir.RecDec:
+			funs := make([]*ir.FunDec, len(d.Funs))
+			for i, fun := range d.Funs {
+				funs[i] = l.topFun(fun)
+			}
+			result = &ir.RecDec{Funs: funs}
+		default:
+			result = dec
+		}
+		decs = append(decs, l.lifted...)
+		decs = append(decs, result)
+		l.lifted = nil
+	}
+	return &ir.Module{Decs: decs}
+}
+
+func (l *lifter) topFun(d *ir.FunDec) *ir.FunDec {
+	s := common.NewEnv[string, binding](nil)
+	for _, args := range [][]ir.Arg{d.Env, d.Args} {
+		for _, arg := range args {
+			s.Add(arg.Id.Value, binding{t: arg.Type})
+		}
+	}
+	return &ir.FunDec{Id: d.Id, Type: d.Type, Args: d.Args, Env: d.Env, Body: l.exp(d.Body, s)}
+}
+
+func decNames(dec ir.Dec) []string {
+	switch d := dec.(type) {
+	case *ir.ValDec:
+		return []string{d.Id.Value}
+	case *ir.FunDec:
+		return []string{d.Id.Value}
+	case *ir.RecDec:
+		names := make([]string, len(d.Funs))
+		for i, fun := range d.Funs {
+			names[i] = fun.Id.Value
+		}
+		return names
+	case *ir.ExternDec:
+		return []string{d.Id.Value}
+	}
+	return nil
+}
+
+// escapingFuncs finds the local functions which are referred other than being applied.
+func escapingFuncs(module *ir.Module) map[string]bool {
+	heads := map[*ir.Var]bool{}
+	var refs []*ir.Var
+	for _, dec := range module.Decs {
+		ir.InspectDec(dec, func(exp ir.Exp) bool {
+			switch e := exp.(type) {
+			case *ir.App:
+				if v, ok := e.Fun.(*ir.Var); ok {
+					heads[v] = true
+				}
+			case *ir.Var:
+				refs = append(refs, e)
+			}
+			return true
+		})
+	}
+	escaping := map[string]bool{}
+	for _, v := range refs {
+		if !heads[v] {
+			escaping[v.Id.Value] = true
+		}
+	}
+	return escaping
+}
+
+// liftFuns lifts local functions, which are a recursive declaration if there are more than one.
+// The free variables of a function are the local variables in scope which its body refers,
+// including those passed to the lifted functions which it calls.
+func (l *lifter) liftFuns(ds []*ir.FunDec, s scope) {
+	funs := make([]*lifted, len(ds))
+	for i, d := range ds {
+		id := d.Id
+		for j := 2; l.names[id.Value]; j++ {
+			// the instances of a polymorphic function may lift the same local function more than once.
+			id.Value = fmt.Sprintf("%s$%d", d.Id.Value, j)
+		}
+		l.names[id.Value] = true
+		funs[i] = &lifted{dec: &ir.FunDec{Id: id, Type: d.Type, Args: d.Args}}
+		s.Add(d.Id.Value, binding{t: d.Type, fun: funs[i]})
+	}
+
+	decs := make([]*ir.FunDec, len(ds))
+	for i, d := range ds {
+		dec := funs[i].dec
+		inner := common.NewEnv(s)
+		for _, arg := range d.Args {
+			inner.Add(arg.Id.Value, binding{t: arg.Type})
+		}
+		dec.Body = l.exp(d.Body, inner)
+		for _, v := range ir.FreeVars(dec.Body) {
+			if b, ok := s.LookUp(v.Value); ok && b.fun == nil {
+				dec.Env = append(dec.Env, ir.Arg{Id: v, Type: b.t})
+			}
+		}
+		l.envs[dec.Id.Value] = dec.Env
+		if !sameVars(dec.Env, l.previous[dec.Id.Value]) {
+			l.stable = false
+		}
+		decs[i] = dec
+	}
+	if len(decs) == 1 {
+		l.lifted = append(l.lifted, decs[0])
+	} else {
+		l.lifted = append(l.lifted, &ir.RecDec{Funs: decs})
+	}
+}
+
+func sameVars(xs, ys []ir.Arg) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i].Id.Value != ys[i].Id.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// call makes a call of a lifted function at a position, which passes the free variables with the argument.
+func call(v *ir.Var, dec *ir.FunDec, env []ir.Arg, arg ir.Exp, pos string) *ir.Call {
+	args := make([]ir.Exp, len(env)+1)
+	t := v.Type
+	for i := len(env) - 1; i >= 0; i-- {
+		args[i] = &ir.Var{Id: env[i].Id, Type: env[i].Type}
+		t = types.Arrow(env[i].Type, t)
+	}
+	args[len(env)] = arg
+	return &ir.Call{Fun: &ir.Var{Id: dec.Id, Type: t}, Args: args, Pos: pos}
+}
+
+func (l *lifter) decs(decs []ir.Dec, s scope) []ir.Dec {
+	var result []ir.Dec
+	for _, dec := range decs {
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			result = append(result, &ir.ValDec{Id: d.Id, Type: d.Type, Body: l.exp(d.Body, s)})
+			s.Add(d.Id.Value, binding{t: d.Type})
+		case *ir.FunDec:
+			if !l.escaping[d.Id.Value] {
+				l.liftFuns([]*ir.FunDec{d}, s)
+				continue
+			}
+			s.Add(d.Id.Value, binding{t: d.Type})
+			result = append(result, l.localFun(d, s))
+		case *ir.RecDec:
+			// the functions are lifted together, unless any of them escapes.
+			escaping := false
+			for _, fun := range d.Funs {
+				escaping = escaping || l.escaping[fun.Id.Value]
+			}
+			if !escaping {
+				l.liftFuns(d.Funs, s)
+				continue
+			}
+			for _, fun := range d.Funs {
+				s.Add(fun.Id.Value, binding{t: fun.Type})
+			}
+			funs := make([]*ir.FunDec, len(d.Funs))
+			for i, fun := range d.Funs {
+				funs[i] = l.localFun(fun, s)
+			}
+			result = append(result, &ir.RecDec{Funs: funs})
+		default:
+			result = append(result, dec)
+		}
+	}
+	return result
+}
+
+// localFun copies a local function which remains a closure.
+func (l *lifter) localFun(d *ir.FunDec, s scope) *ir.FunDec {
+	inner := common.NewEnv(s)
+	for _, arg := range d.Args {
+		inner.Add(arg.Id.Value, binding{t: arg.Type})
+	}
+	return &ir.FunDec{Id: d.Id, Type: d.Type, Args: d.Args, Body: l.exp(d.Body, inner)}
+}
+
+// exp copies an expression, where the local functions are lifted and their applications become calls.
+func (l *lifter) exp(exp ir.Exp, s scope) ir.Exp {
+	switch e := exp.(type) {
+	case *ir.App:
+		if v, ok := e.Fun.(*ir.Var); ok {
+			if b, ok := s.LookUp(v.Id.Value); ok && b.fun != nil {
+				dec := b.fun.dec
+				env := dec.Env
+				if dec.Body == nil {
+					env = l.previous[dec.Id.Value]
+				}
+				return call(v, dec, env, l.exp(e.Arg, s), e.Pos)
+			}
+		}
+	case *ir.LetIn:
+		inner := common.NewEnv(s)
+		decs := l.decs(e.Decs, inner)
+		body := l.exp(e.Body, inner)
+		if len(decs) == 0 {
+			return body
+		}
+		return &ir.LetIn{Decs: decs, Body: body}
+	case *ir.Fn:
+		arg, _, _ := types.AsArrow(e.Type)
+		inner := common.NewEnv(s)
+		inner.Add(e.Id.Value, binding{t: arg})
+		return &ir.Fn{Id: e.Id, Type: e.Type, Body: l.exp(e.Body, inner)}
+	case *ir.Select:
+		arms := make([]ir.SelectArm, len(e.Arms))
+		for i, arm := range e.Arms {
+			inner := common.NewEnv(s)
+			if arm.Chan != nil {
+				arms[i].Chan = l.exp(arm.Chan, s)
+			}
+			if arm.Value != nil {
+				arms[i].Value = l.exp(arm.Value, s)
+			}
+			if arm.Id != nil {
+				arms[i].Id = arm.Id
+				inner.Add(arm.Id.Id.Value, binding{t: arm.Id.Type})
+			}
+			arms[i].Body = l.exp(arm.Body, inner)
+		}
+		return &ir.Select{Arms: arms, Type: e.Type}
+	}
+	return ir.Rewrite(exp, func(child ir.Exp) ir.Exp { return l.exp(child, s) })
+}
@@ -0,0 +1,48 @@
+package lift
+
+import (
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// adder makes fun name (x : int) = let fun add (y : int) = x + y in body end, where body is of the type result.
+func adder(name string, result types.Type, body ir.Exp) *ir.FunDec {
+	x, y := irtest.Var("x", types.IntType), irtest.Var("y", types.IntType)
+	add := irtest.Fun("add", irtest.IntToInt, []ir.Arg{irtest.Arg("y", types.IntType)}, ir.NewBinaryOp(ir.Add, x, y))
+	return irtest.Fun(name, types.Arrow(types.IntType, result), []ir.Arg{irtest.Arg("x", types.IntType)},
+		&ir.LetIn{Decs: []ir.Dec{add}, Body: body})
+}
+
+func TestLift(t *testing.T) {
+	module := Lift(&ir.Module{Decs: []ir.Dec{adder("f", types.IntType, &ir.App{Fun: irtest.Var("add", irtest.IntToInt), Arg: irtest.Int(1)})}})
+	assert.Equal(t, "fun add$1 [x$1 : int] (y$1 : int) = x$1 + y$1\n"+
+		"fun f$1 (x$1 : int) = call add$1 (x$1, 1)", module.String())
+}
+
+func TestEscapingFunction(t *testing.T) {
+	module := Lift(&ir.Module{Decs: []ir.Dec{
+		adder("f", irtest.IntToInt, irtest.Var("add", irtest.IntToInt)),
+		adder("g", types.IntType, &ir.App{Fun: irtest.Var("apply", types.Arrow(irtest.IntToInt, irtest.IntToInt)), Arg: irtest.Var("add", irtest.IntToInt)}),
+	}})
+	assert.Equal(t, "fun f$1 (x$1 : int) = let fun add$1 (y$1 : int) = x$1 + y$1 in add$1 end\n"+
+		"fun g$1 (x$1 : int) = let fun add$1 (y$1 : int) = x$1 + y$1 in apply$1 add$1 end", module.String())
+}
+
+func TestLiftRecursiveFunctions(t *testing.T) {
+	// fun f k = let fun loop n = if n = 0 then k else count n and count n = loop (n - 1) in loop 3 end,
+	// where count refers to k through loop.
+	k, n := irtest.Var("k", types.IntType), irtest.Var("n", types.IntType)
+	loop := irtest.Fun("loop", irtest.IntToInt, []ir.Arg{irtest.Arg("n", types.IntType)},
+		&ir.IfThen{Cond: ir.NewBinaryOp(ir.Eq, n, &ir.Int{}), Then: k, Else: &ir.App{Fun: irtest.Var("count", irtest.IntToInt), Arg: n}})
+	count := irtest.Fun("count", irtest.IntToInt, []ir.Arg{irtest.Arg("n", types.IntType)},
+		&ir.App{Fun: irtest.Var("loop", irtest.IntToInt), Arg: ir.NewBinaryOp(ir.Minus, n, irtest.Int(1))})
+	f := irtest.Fun("f", irtest.IntToInt, []ir.Arg{irtest.Arg("k", types.IntType)},
+		&ir.LetIn{Decs: []ir.Dec{&ir.RecDec{Funs: []*ir.FunDec{loop, count}}}, Body: &ir.App{Fun: irtest.Var("loop", irtest.IntToInt), Arg: irtest.Int(3)}})
+	module := Lift(&ir.Module{Decs: []ir.Dec{f}})
+	assert.Equal(t, "fun loop$1 [k$1 : int] (n$1 : int) = if n$1 = 0 then k$1 else call count$1 (k$1, n$1)"+
+		" and count$1 [k$1 : int] (n$1 : int) = call loop$1 (k$1, n$1 - 1)\n"+
+		"fun f$1 (k$1 : int) = call loop$1 (k$1, 3)", module.String())
+}
@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Conn reads and writes the messages of the base protocol, where a message is a header of its Content-Length,
+// followed by its JSON content. The server and its clients, e.g. an in-process client of a test, use it.
+type Conn struct {
+	reader *bufio.Reader
+	writer io.Writer
+	mutex  sync.Mutex // writes a message at a time
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{reader: bufio.NewReader(r), writer: w}
+}
+
+// Read reads the next message, and returns io.EOF at the end of the input.
+func (c *Conn) Read() (*Message, error) {
+	length := -1
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("lsp: reading header: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("lsp: invalid header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("lsp: invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("lsp: missing Content-Length")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, content); err != nil {
+		return nil, fmt.Errorf("lsp: reading content: %w", err)
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(content, msg); err != nil {
+		return nil, &ResponseError{Code: ParseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+func (c *Conn) Write(msg *Message) error {
+	msg.JSONRPC = "2.0"
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = c.writer.Write(content)
+	return err
+}
+
+// Request writes a request or a notification if id is nil.
+func (c *Conn) Request(id *json.RawMessage, method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.Write(&Message{ID: id, Method: method, Params: raw})
+}
+
+// Reply writes the response of a request, whose result is null if it is nil.
+func (c *Conn) Reply(id *json.RawMessage, result interface{}, err *ResponseError) error {
+	if err != nil {
+		return c.Write(&Message{ID: id, Error: err})
+	}
+	raw, e := json.Marshal(result)
+	if e != nil {
+		return e
+	}
+	return c.Write(&Message{ID: id, Result: raw})
+}
@@ -0,0 +1,262 @@
+package lsp
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/rename"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/lilac/fun-lang/pkg/typing"
+	"github.com/rhysd/locerr"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+)
+
+// document is the analysis of the text of an open document.
+type document struct {
+	uri         string
+	text        string
+	lines       []string
+	module      *ast.Module // nil if the text has syntax errors
+	env         typing.TypeEnv
+	inference   *typing.TypeInference
+	diagnostics []Diagnostic
+	// occurrences are the identifiers of the document, and definitions are the declarations by their alpha-renamed names.
+	occurrences []occurrence
+	definitions map[string]occurrence
+}
+
+// occurrence is an identifier which declares or refers to a variable.
+type occurrence struct {
+	id  ast.Identifier
+	rng Range
+	exp ast.Exp // the variable of a reference, or nil for a declaration
+}
+
+// analyse checks a document like the check command, and indexes its identifiers unless it has syntax errors.
+func analyse(uri string, text string) *document {
+	doc := &document{uri: uri, text: text, lines: strings.Split(text, "\n"), definitions: map[string]occurrence{}}
+	src := &syntax.Source{Reader: strings.NewReader(text), Path: pathOf(uri)}
+	typed, diagnostics := compiler.Analyse(src)
+	doc.add(diagnostics...)
+	if typed == nil {
+		return doc
+	}
+	doc.module, doc.env, doc.inference = typed.Module, typed.Env, typed.Inference
+	doc.index()
+	return doc
+}
+
+// add converts the diagnostics, where a diagnostic without a position is at the start of the document.
+func (doc *document) add(diagnostics ...*diag.Diagnostic) {
+	for _, d := range diagnostics {
+		lines := append(append([]string{d.Message}, d.Notes...), d.Suggestions...)
+		result := Diagnostic{Severity: SeverityError, Code: d.Code, Source: "fun", Message: strings.Join(lines, "\n")}
+		if d.Severity == diag.Warning {
+			result.Severity = SeverityWarning
+		}
+		if d.Span.Start.File != nil {
+			result.Range = Range{Start: doc.fromPos(d.Span.Start), End: doc.fromPos(d.Span.End)}
+			if d.Span.End.File == nil {
+				result.Range.End = result.Range.Start
+			}
+		}
+		doc.diagnostics = append(doc.diagnostics, result)
+	}
+}
+
+// index collects the declarations and the references of the variables.
+func (doc *document) index() {
+	ast.Inspect(doc.module, doc.visit)
+}
+
+func (doc *document) visit(node interface{}) bool {
+	switch n := node.(type) {
+	case *ast.ValDec:
+		// the name is in scope after the body, which is after it in the source.
+		ast.Inspect(n.Body, doc.visit)
+		doc.declare(n.Arg.Id, n.Token)
+		return false
+	case *ast.FunDec:
+		doc.declare(n.Binds[0].Id, n.Binds[0].Token)
+		for _, bind := range n.Binds[1:] {
+			// the other clauses repeat the name of the function.
+			doc.occurrences = append(doc.occurrences, occurrence{id: n.Binds[0].Id, rng: doc.rangeOf(bind.Token)})
+		}
+	case *ast.ExternDec:
+		doc.declare(n.Arg.Id, n.Token)
+	case *ast.VarPattern:
+		doc.declare(n.Id, n.Token)
+	case *ast.Var:
+		doc.occurrences = append(doc.occurrences, occurrence{id: n.Id, rng: doc.rangeOf(n.Token), exp: n})
+	}
+	return true
+}
+
+func (doc *document) declare(id ast.Identifier, tok *token.Token) {
+	o := occurrence{id: id, rng: doc.rangeOf(tok)}
+	doc.occurrences = append(doc.occurrences, o)
+	doc.definitions[id.Value] = o
+}
+
+// at returns the identifier at a position, which may be just after its end like a cursor after a word.
+func (doc *document) at(pos Position) (occurrence, bool) {
+	for _, o := range doc.occurrences {
+		if contains(o.rng, pos) {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// typeOf returns the type of an identifier, which is the generic type of its declaration if it is declared in the document,
+// or the type of the reference otherwise, e.g. the instance of a built-in function.
+func (doc *document) typeOf(o occurrence) types.Type {
+	if t, ok := doc.env[o.id.Value]; ok && t != nil {
+		return t
+	}
+	if o.exp != nil && doc.inference != nil {
+		return doc.inference.TypeOf(o.exp)
+	}
+	return nil
+}
+
+func (doc *document) hover(pos Position) *Hover {
+	o, ok := doc.at(pos)
+	if !ok {
+		return nil
+	}
+	t := doc.typeOf(o)
+	if t == nil {
+		return nil
+	}
+	code := fmt.Sprintf("val %s : %s", o.id.Name, types.Scheme(t))
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: "```sml\n" + code + "\n```"}, Range: &o.rng}
+}
+
+func (doc *document) definition(pos Position) *Location {
+	o, ok := doc.at(pos)
+	if !ok {
+		return nil
+	}
+	def, ok := doc.definitions[o.id.Value]
+	if !ok {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: def.rng}
+}
+
+// rename returns the edits which rename the variable at a position, or fails with the conflicts of the renaming.
+func (doc *document) rename(pos Position, name string) (*WorkspaceEdit, *ResponseError) {
+	src := &syntax.Source{Reader: strings.NewReader(doc.text), Path: pathOf(doc.uri)}
+	edits, err := rename.Rename(src, pos.Line+1, doc.column(pos), name)
+	if err != nil {
+		var messages []string
+		for _, d := range diag.From(err) {
+			messages = append(messages, fmt.Sprintf("%d:%d: %s", d.Span.Start.Line, d.Span.Start.Column, d.Message))
+		}
+		if messages == nil {
+			messages = []string{err.Error()}
+		}
+		return nil, &ResponseError{Code: RequestFailed, Message: strings.Join(messages, "\n")}
+	}
+	changes := make([]TextEdit, len(edits))
+	for i, e := range edits {
+		changes[i] = TextEdit{Range: Range{Start: doc.fromPos(e.Start), End: doc.fromPos(e.End)}, NewText: e.Text}
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{doc.uri: changes}}, nil
+}
+
+// symbols returns the val and fun declarations at top level.
+func (doc *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	if doc.module == nil {
+		return symbols
+	}
+	symbol := func(id ast.Identifier, kind SymbolKind, name *token.Token, end locerr.Pos) {
+		s := DocumentSymbol{Name: id.Name, Kind: kind, SelectionRange: doc.rangeOf(name)}
+		s.Range = Range{Start: s.SelectionRange.Start, End: doc.fromPos(end)}
+		if t, ok := doc.env[id.Value]; ok && t != nil {
+			s.Detail = types.Scheme(t)
+		}
+		symbols = append(symbols, s)
+	}
+	fun := func(f *ast.FunDec) {
+		last := f.Binds[len(f.Binds)-1]
+		symbol(f.Binds[0].Id, SymbolFunction, f.Binds[0].Token, last.Exp.End())
+	}
+	for _, dec := range doc.module.Decs {
+		switch d := dec.(type) {
+		case *ast.ValDec:
+			symbol(d.Arg.Id, SymbolVariable, d.Token, d.Body.End())
+		case *ast.FunDec:
+			fun(d)
+		case *ast.RecDec:
+			for _, f := range d.Funs {
+				fun(f)
+			}
+		}
+	}
+	return symbols
+}
+
+// pathOf returns the path of a file URI, or the URI itself if it is not a file URI.
+func pathOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+// fromPos converts a one based position of an error, whose column counts the code points of the line before it,
+// to a zero based position, whose character counts their UTF-16 code units.
+func (doc *document) fromPos(pos locerr.Pos) Position {
+	p := Position{Line: pos.Line - 1, Character: pos.Column - 1}
+	if p.Line < 0 {
+		p.Line = 0
+	}
+	if p.Character < 0 {
+		p.Character = 0
+	}
+	if p.Line < len(doc.lines) {
+		line := []rune(doc.lines[p.Line])
+		if p.Character <= len(line) {
+			p.Character = len(utf16.Encode(line[:p.Character]))
+		} else {
+			p.Character += len(utf16.Encode(line)) - len(line)
+		}
+	}
+	return p
+}
+
+// column converts the character of a position to the one based column of its line, which counts code points.
+func (doc *document) column(pos Position) int {
+	column, units := 1, 0
+	if pos.Line < len(doc.lines) {
+		for _, r := range doc.lines[pos.Line] {
+			if units >= pos.Character {
+				return column
+			}
+			units += len(utf16.Encode([]rune{r}))
+			column++
+		}
+	}
+	return column + pos.Character - units
+}
+
+func (doc *document) rangeOf(tok *token.Token) Range {
+	return Range{Start: doc.fromPos(tok.Start()), End: doc.fromPos(tok.End())}
+}
+
+func contains(r Range, pos Position) bool {
+	return !less(pos, r.Start) && !less(r.End, pos)
+}
+
+func less(a, b Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
@@ -0,0 +1,178 @@
+// Package lsp implements a server of the Language Server Protocol for the Fun language, which talks JSON-RPC
+// over a pair of streams, e.g. STDIN and STDOUT.
+//
+// The server keeps the text of the open documents, and analyses a document whenever it changes,
+// i.e. it parses, renames and type-checks the document like the compiler. Then it publishes the errors as diagnostics,
+// and answers the hover, definition and document symbol requests from the analysis.
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type Server struct {
+	conn      *Conn
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{conn: NewConn(r, w), documents: map[string]*document{}}
+}
+
+// Serve handles the messages until the exit notification or the end of the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if e, ok := err.(*ResponseError); ok {
+				// a message which is not JSON has no id to reply to.
+				if err := s.conn.Reply(nil, nil, e); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or a notification, and returns an error only if the reply cannot be written.
+func (s *Server) handle(msg *Message) error {
+	result, err := s.dispatch(msg)
+	if msg.ID == nil {
+		return nil
+	}
+	return s.conn.Reply(msg.ID, result, err)
+}
+
+func (s *Server) dispatch(msg *Message) (interface{}, *ResponseError) {
+	if s.shutdown && msg.ID != nil {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "the server is shut down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       TextDocumentSyncFull,
+				HoverProvider:          true,
+				DefinitionProvider:     true,
+				DocumentSymbolProvider: true,
+				RenameProvider:         true,
+			},
+			ServerInfo: ServerInfo{Name: "fun"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := unmarshal(msg, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := unmarshal(msg, &params); err != nil {
+			return nil, err
+		}
+		changes := params.ContentChanges
+		if len(changes) == 0 {
+			return nil, nil
+		}
+		return nil, s.open(params.TextDocument.URI, changes[len(changes)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := unmarshal(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []Diagnostic{})
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		doc, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		if hover := doc.hover(params.Position); hover != nil {
+			return hover, nil
+		}
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		doc, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		if location := doc.definition(params.Position); location != nil {
+			return location, nil
+		}
+		return nil, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		doc, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.symbols(), nil
+	case "textDocument/rename":
+		var params RenameParams
+		doc, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.rename(params.Position, params.NewName)
+	}
+	return nil, &ResponseError{Code: MethodNotFound, Message: fmt.Sprintf("method %s is not supported", msg.Method)}
+}
+
+// open analyses the text of a document, and publishes its diagnostics.
+func (s *Server) open(uri, text string) *ResponseError {
+	doc := analyse(uri, text)
+	s.documents[uri] = doc
+	diagnostics := doc.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	return s.publish(uri, diagnostics)
+}
+
+func (s *Server) publish(uri string, diagnostics []Diagnostic) *ResponseError {
+	params := PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics}
+	if err := s.conn.Request(nil, "textDocument/publishDiagnostics", params); err != nil {
+		return &ResponseError{Code: InternalError, Message: err.Error()}
+	}
+	return nil
+}
+
+// document decodes the params of a request on a document, and returns the open document.
+func (s *Server) document(msg *Message, params interface{}, id *TextDocumentIdentifier) (*document, *ResponseError) {
+	if err := unmarshal(msg, params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[id.URI]
+	if !ok {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("document %s is not open", id.URI)}
+	}
+	return doc, nil
+}
+
+func unmarshal(msg *Message, params interface{}) *ResponseError {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package lsp
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// client talks to a server in process through pipes.
+type client struct {
+	t             *testing.T
+	conn          *Conn
+	nextID        int
+	notifications []*Message
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, conn: NewConn(clientIn, clientOut), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+	})
+	return c
+}
+
+// call sends a request, and decodes the result of its response into result.
+// The notifications before the response are kept.
+func (c *client) call(method string, params interface{}, result interface{}) *ResponseError {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	if !assert.NoError(c.t, c.conn.Request(&id, method, params)) {
+		c.t.FailNow()
+	}
+	for {
+		msg, err := c.conn.Read()
+		if !assert.NoError(c.t, err) {
+			c.t.FailNow()
+		}
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		assert.Equal(c.t, string(id), string(*msg.ID))
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			assert.NoError(c.t, json.Unmarshal(msg.Result, result))
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	assert.NoError(c.t, c.conn.Request(nil, method, params))
+}
+
+// diagnostics waits for the diagnostics of a document.
+func (c *client) diagnostics(uri string) []Diagnostic {
+	for {
+		var msg *Message
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			var err error
+			msg, err = c.conn.Read()
+			if !assert.NoError(c.t, err) {
+				c.t.FailNow()
+			}
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		assert.NoError(c.t, json.Unmarshal(msg.Params, &params))
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+const uri = "file:///work/main.fun"
+
+func open(c *client, lines ...string) []Diagnostic {
+	var result InitializeResult
+	assert.Nil(c.t, c.call("initialize", map[string]interface{}{}, &result))
+	assert.True(c.t, result.Capabilities.HoverProvider)
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "sml", Version: 1, Text: strings.Join(lines, "\n")},
+	})
+	return c.diagnostics(uri)
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{line, character}}
+}
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	diagnostics := open(c,
+		"fun twice f x = f (f x)",
+		"val n = twice (fn y => y + 1) 0",
+		"fun fact 0 = 1",
+		"  | fact k = k * fact (k - 1)",
+	)
+	assert.Empty(t, diagnostics)
+
+	var hover Hover
+	assert.Nil(t, c.call("textDocument/hover", at(0, 4), &hover))
+	assert.Contains(t, hover.Contents.Value, "val twice : ('a -> 'a) -> 'a -> 'a")
+	assert.Nil(t, c.call("textDocument/hover", at(1, 4), &hover))
+	assert.Contains(t, hover.Contents.Value, "val n : int")
+	assert.Nil(t, c.call("textDocument/hover", at(1, 19), &hover))
+	assert.Contains(t, hover.Contents.Value, "val y : int")
+
+	var location Location
+	assert.Nil(t, c.call("textDocument/definition", at(1, 9), &location))
+	assert.Equal(t, Location{URI: uri, Range: Range{Position{0, 4}, Position{0, 9}}}, location)
+	assert.Nil(t, c.call("textDocument/definition", at(3, 18), &location))
+	assert.Equal(t, Range{Position{2, 4}, Position{2, 8}}, location.Range)
+	assert.Nil(t, c.call("textDocument/definition", at(3, 23), &location))
+	assert.Equal(t, Range{Position{3, 9}, Position{3, 10}}, location.Range)
+
+	var symbols []DocumentSymbol
+	params := DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+	assert.Nil(t, c.call("textDocument/documentSymbol", params, &symbols))
+	if assert.Len(t, symbols, 3) {
+		assert.Equal(t, "twice", symbols[0].Name)
+		assert.Equal(t, SymbolFunction, symbols[0].Kind)
+		assert.Equal(t, "('a -> 'a) -> 'a -> 'a", symbols[0].Detail)
+		assert.Equal(t, "n", symbols[1].Name)
+		assert.Equal(t, SymbolVariable, symbols[1].Kind)
+		assert.Equal(t, "int", symbols[1].Detail)
+		assert.Equal(t, "fact", symbols[2].Name)
+		assert.Equal(t, Range{Position{2, 4}, Position{3, 28}}, symbols[2].Range)
+	}
+
+	assert.Nil(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	diagnostics := open(c, "val a = b + 1")
+	// the type inference does not report the undefined variable again.
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "Undefined variable 'b'", diagnostics[0].Message)
+		assert.Equal(t, Range{Position{0, 8}, Position{0, 9}}, diagnostics[0].Range)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "val a = 1\nval b = (a"}},
+	})
+	diagnostics = c.diagnostics(uri)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Contains(t, diagnostics[0].Message, "parse error")
+		assert.Equal(t, 1, diagnostics[0].Range.Start.Line)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "val f = fn true => 1"}},
+	})
+	diagnostics = c.diagnostics(uri)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, SeverityWarning, diagnostics[0].Severity)
+		assert.Equal(t, "non-exhaustive-match", diagnostics[0].Code)
+		assert.Equal(t, "non-exhaustive match: false is not matched\nadd a match for false", diagnostics[0].Message)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 4},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "val a = 1"}},
+	})
+	assert.Empty(t, c.diagnostics(uri))
+
+	err := c.call("textDocument/formatting", at(0, 0), nil)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, MethodNotFound, err.Code)
+	}
+	err = c.call("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: "file:///x.fun"}}, nil)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, InvalidParams, err.Code)
+	}
+}
+
+func TestRename(t *testing.T) {
+	c := newClient(t)
+	assert.Empty(t, open(c,
+		"val y = 1",
+		"fun f x = x + y",
+		"val z = f y",
+	))
+
+	var edit WorkspaceEdit
+	params := RenameParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{2, 8}, NewName: "g"}
+	assert.Nil(t, c.call("textDocument/rename", params, &edit))
+	assert.Equal(t, map[string][]TextEdit{uri: {
+		{Range{Position{1, 4}, Position{1, 5}}, "g"},
+		{Range{Position{2, 8}, Position{2, 9}}, "g"},
+	}}, edit.Changes)
+
+	params = RenameParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{1, 6}, NewName: "y"}
+	err := c.call("textDocument/rename", params, nil)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, RequestFailed, err.Code)
+		assert.Equal(t, "2:15: cannot rename 'x' to 'y': 'y' here would refer to the declaration at /work/main.fun:2:7 "+
+			"instead of the declaration at /work/main.fun:1:5", err.Message)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	c := newClient(t)
+	// the characters of the positions count the UTF-16 code units of 'é' and '😀' as 1 and 2, not their bytes.
+	assert.Empty(t, open(c,
+		`val s = "é😀"`,
+		`val u = ("😀", s)`,
+	))
+
+	var hover Hover
+	assert.Nil(t, c.call("textDocument/hover", at(1, 15), &hover))
+	assert.Contains(t, hover.Contents.Value, "val s : string")
+	assert.Equal(t, &Range{Position{1, 15}, Position{1, 16}}, hover.Range)
+
+	var edit WorkspaceEdit
+	params := RenameParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{1, 15}, NewName: "v"}
+	assert.Nil(t, c.call("textDocument/rename", params, &edit))
+	assert.Equal(t, map[string][]TextEdit{uri: {
+		{Range{Position{0, 4}, Position{0, 5}}, "v"},
+		{Range{Position{1, 15}, Position{1, 16}}, "v"},
+	}}, edit.Changes)
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: `val s = ("é😀", t)`}},
+	})
+	diagnostics := c.diagnostics(uri)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, Range{Position{0, 16}, Position{0, 17}}, diagnostics[0].Range)
+	}
+}
@@ -0,0 +1,267 @@
+// Package match checks the patterns of the functions, i.e. whether the clauses of a function match all the values
+// of its arguments, and whether a clause is redundant since the clauses before it match all the values it matches.
+// The pattern of a receive of a select is checked like a function of a single clause.
+// It reports the problems as warnings, since a value which no clause matches is a match failure at run time.
+//
+// The check follows "Warnings for pattern matching" by Luc Maranget, where a pattern is a matrix of rows of patterns.
+// The constructors of a column of the matrix are complete if they are a signature of a type, e.g. true and false,
+// or Ok and Err. Otherwise, e.g. for the constants of integers, a variable is needed to match the other values.
+package match
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/types"
+	"strings"
+)
+
+// Check returns the warnings of the non-exhaustive and the redundant matches of the module.
+func Check(module *ast.Module) []*diag.Diagnostic {
+	c := &checker{}
+	ast.Inspect(module, c.visit)
+	return c.diagnostics
+}
+
+type checker struct {
+	diagnostics []*diag.Diagnostic
+}
+
+// row is a row of the patterns of a clause, where a nil pattern is a wildcard made by the check.
+type row = []ast.Pattern
+
+// signatures are the complete sets of constructors.
+var signatures = [][]string{
+	{"true", "false"},
+	{"()"},
+	{types.OkCtor, types.ErrCtor},
+}
+
+func (c *checker) visit(node interface{}) bool {
+	switch n := node.(type) {
+	case *ast.Fn:
+		rows := make([]row, len(n.Matches))
+		for i, m := range n.Matches {
+			rows[i] = row{m.Pattern}
+		}
+		for _, i := range redundant(rows) {
+			p := n.Matches[i].Pattern
+			c.warn(diag.Warningf(diag.RedundantMatch, p.Start(), p.End(),
+				"redundant match: the previous patterns match all the values of %s", p).Suggest("remove the match"))
+		}
+		if w, ok := witness(rows, 1); ok {
+			c.warn(diag.Warningf(diag.NonExhaustiveMatch, n.Token.Start(), n.Token.End(),
+				"non-exhaustive match: %s is not matched", w[0]).Suggest("add a match for %s", w[0]))
+		}
+	case *ast.FunDec:
+		rows := make([]row, len(n.Binds))
+		for i, bind := range n.Binds {
+			if len(bind.Patterns) != len(n.Binds[0].Patterns) {
+				// the inconsistent arity is an error of the alpha transformation.
+				return true
+			}
+			rows[i] = bind.Patterns
+		}
+		for _, i := range redundant(rows) {
+			patterns := n.Binds[i].Patterns
+			start, end := patterns[0].Start(), patterns[len(patterns)-1].End()
+			c.warn(diag.Warningf(diag.RedundantMatch, start, end,
+				"redundant clause: the previous clauses of '%s' match all the values of its patterns", n.Binds[i].Id.Name).
+				Suggest("remove the clause"))
+		}
+		name := n.Binds[0]
+		if w, ok := witness(rows, len(name.Patterns)); ok {
+			example := name.Id.Name
+			for _, p := range w {
+				example += " " + atom(p)
+			}
+			c.warn(diag.Warningf(diag.NonExhaustiveMatch, name.Token.Start(), name.Token.End(),
+				"non-exhaustive clauses: %s is not matched", example).Suggest("add a clause for %s", example))
+		}
+	case *ast.Select:
+		for _, arm := range n.Arms {
+			if arm.Pattern == nil {
+				continue
+			}
+			if w, ok := witness([]row{{arm.Pattern}}, 1); ok {
+				p := arm.Pattern
+				c.warn(diag.Warningf(diag.NonExhaustiveMatch, p.Start(), p.End(),
+					"non-exhaustive receive: %s is not matched", w[0]).
+					Note("the value is received before it is matched, so no other arm takes it").
+					Suggest("receive into a variable, and match it in the body of the arm"))
+			}
+		}
+	}
+	return true
+}
+
+func (c *checker) warn(d *diag.Diagnostic) {
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// redundant returns the indices of the rows which are not useful after the rows before them.
+func redundant(rows []row) []int {
+	var result []int
+	for i := range rows {
+		if !useful(rows[:i], rows[i]) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// useful returns whether some values which the rows do not match match the row q.
+func useful(rows []row, q row) bool {
+	if len(q) == 0 {
+		return len(rows) == 0
+	}
+	if ctor, args, ok := head(q[0]); ok {
+		return useful(specialize(rows, ctor, len(args)), append(args, q[1:]...))
+	}
+	if signature := complete(heads(rows)); signature != nil {
+		for _, ctor := range signature {
+			n := arity(ctor)
+			if useful(specialize(rows, ctor, n), append(make(row, n), q[1:]...)) {
+				return true
+			}
+		}
+		return false
+	}
+	return useful(defaults(rows), q[1:])
+}
+
+// witness returns the patterns of n columns of a value which the rows do not match, if there is one.
+func witness(rows []row, n int) ([]string, bool) {
+	if n == 0 {
+		return nil, len(rows) == 0
+	}
+	ctors := heads(rows)
+	if signature := complete(ctors); signature != nil {
+		for _, ctor := range signature {
+			k := arity(ctor)
+			if w, ok := witness(specialize(rows, ctor, k), k+n-1); ok {
+				return append([]string{apply(ctor, w[:k])}, w[k:]...), true
+			}
+		}
+		return nil, false
+	}
+	w, ok := witness(defaults(rows), n-1)
+	if !ok {
+		return nil, false
+	}
+	example := "_"
+	if ctor := missing(ctors); ctor != "" {
+		example = apply(ctor, strings.Split(strings.Repeat("_", arity(ctor)), ""))
+	}
+	return append([]string{example}, w...), true
+}
+
+// head returns the constructor and the arguments of a pattern, or false if it matches any value.
+func head(p ast.Pattern) (string, []ast.Pattern, bool) {
+	switch p := p.(type) {
+	case *ast.ConstPattern:
+		return p.String(), nil, true
+	case *ast.CtorPattern:
+		return p.Ctor.Name, []ast.Pattern{p.Arg}, true
+	}
+	return "", nil, false
+}
+
+// heads returns the constructors of the first column of the rows.
+func heads(rows []row) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, r := range rows {
+		if ctor, _, ok := head(r[0]); ok && !seen[ctor] {
+			seen[ctor] = true
+			result = append(result, ctor)
+		}
+	}
+	return result
+}
+
+// specialize returns the rows which match the constructor of the arity, where its arguments replace their first patterns.
+func specialize(rows []row, ctor string, arity int) []row {
+	var result []row
+	for _, r := range rows {
+		c, args, ok := head(r[0])
+		if !ok {
+			args = make(row, arity)
+		} else if c != ctor {
+			continue
+		}
+		result = append(result, append(append(row{}, args...), r[1:]...))
+	}
+	return result
+}
+
+// defaults returns the rows whose first patterns match any value, without their first patterns.
+func defaults(rows []row) []row {
+	var result []row
+	for _, r := range rows {
+		if _, _, ok := head(r[0]); !ok {
+			result = append(result, r[1:])
+		}
+	}
+	return result
+}
+
+func arity(ctor string) int {
+	if ctor == types.OkCtor || ctor == types.ErrCtor {
+		return 1
+	}
+	return 0
+}
+
+// complete returns the signature of the constructors if they are all its constructors.
+func complete(ctors []string) []string {
+	for _, signature := range signatures {
+		if len(ctors) > 0 && includes(ctors, signature) {
+			return signature
+		}
+	}
+	return nil
+}
+
+// missing returns a constructor of the signature of the constructors which is not one of them,
+// or an empty string if the signature is unknown, e.g. of integers.
+func missing(ctors []string) string {
+	for _, signature := range signatures {
+		if len(ctors) > 0 && includes(signature, ctors[:1]) {
+			for _, ctor := range signature {
+				if !includes(ctors, []string{ctor}) {
+					return ctor
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func includes(set []string, elements []string) bool {
+	for _, e := range elements {
+		found := false
+		for _, s := range set {
+			found = found || s == e
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// apply renders the pattern of a constructor with its arguments, e.g. Ok (Err _).
+func apply(ctor string, args []string) string {
+	if len(args) == 0 {
+		return ctor
+	}
+	return ctor + " " + atom(args[0])
+}
+
+// atom parenthesizes a pattern of a constructor with an argument.
+func atom(pattern string) string {
+	if strings.Contains(pattern, " ") {
+		return "(" + pattern + ")"
+	}
+	return pattern
+}
@@ -0,0 +1,88 @@
+package match
+
+import (
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func check(t *testing.T, code string) []*diag.Diagnostic {
+	module, err := syntax.Parse(syntax.NewDummySource(code))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return Check(module)
+}
+
+func messages(diagnostics []*diag.Diagnostic) []string {
+	var result []string
+	for _, d := range diagnostics {
+		result = append(result, d.Message)
+	}
+	return result
+}
+
+func TestExhaustive(t *testing.T) {
+	assert.Empty(t, check(t, "val f = fn true => 1 | false => 0"))
+	assert.Empty(t, check(t, "fun get (Ok x) d = x | get (Err _) d = d"))
+	assert.Empty(t, check(t, "fun fact 0 = 1 | fact n = n * fact (n - 1)"))
+	assert.Empty(t, check(t, "val g = fn Ok (Ok x) => x | Ok (Err y) => y | Err _ => 0"))
+	assert.Empty(t, check(t, "val u = fn () => 1"))
+}
+
+func TestNonExhaustive(t *testing.T) {
+	assert.Equal(t, []string{"non-exhaustive match: false is not matched"},
+		messages(check(t, "val f = fn true => 1")))
+	assert.Equal(t, []string{"non-exhaustive match: _ is not matched"},
+		messages(check(t, "val h = fn 0 => 1 | 1 => 0")))
+	assert.Equal(t, []string{"non-exhaustive match: Ok (Err _) is not matched"},
+		messages(check(t, "val g = fn Ok (Ok x) => x | Err _ => 0")))
+	assert.Equal(t, []string{"non-exhaustive clauses: both true false is not matched"},
+		messages(check(t, "fun both true true = 1 | both false _ = 0")))
+
+	diagnostics := check(t, "fun get (Ok x) = x")
+	if assert.Len(t, diagnostics, 1) {
+		d := diagnostics[0]
+		assert.Equal(t, diag.Warning, d.Severity)
+		assert.Equal(t, diag.NonExhaustiveMatch, d.Code)
+		assert.Equal(t, "non-exhaustive clauses: get (Err _) is not matched", d.Message)
+		assert.Equal(t, []string{"add a clause for get (Err _)"}, d.Suggestions)
+		assert.Equal(t, 5, d.Span.Start.Column)
+		assert.Equal(t, 8, d.Span.End.Column)
+	}
+}
+
+func TestNonExhaustiveReceive(t *testing.T) {
+	assert.Empty(t, check(t, "val f = fn c => select c ? () => 1 | c ? _ => 2 end"))
+	diagnostics := check(t, "val f = fn c => fn d => select c ? Ok x => x | d ? 0 => 1 | else => 2 end")
+	assert.Equal(t, []string{
+		"non-exhaustive receive: Err _ is not matched",
+		"non-exhaustive receive: _ is not matched",
+	}, messages(diagnostics))
+	if assert.Len(t, diagnostics, 2) {
+		assert.Equal(t, 36, diagnostics[0].Span.Start.Column)
+		assert.Equal(t, []string{"receive into a variable, and match it in the body of the arm"}, diagnostics[0].Suggestions)
+	}
+}
+
+func TestRedundant(t *testing.T) {
+	diagnostics := check(t, "fun f 0 = 1 | f n = n | f 1 = 2")
+	if assert.Len(t, diagnostics, 1) {
+		d := diagnostics[0]
+		assert.Equal(t, diag.RedundantMatch, d.Code)
+		assert.Equal(t, "redundant clause: the previous clauses of 'f' match all the values of its patterns", d.Message)
+		assert.Equal(t, 27, d.Span.Start.Column)
+	}
+	assert.Equal(t, []string{"redundant match: the previous patterns match all the values of Ok _"},
+		messages(check(t, "val g = fn Ok (Ok x) => x | Ok (Err y) => y | Ok _ => 1 | Err _ => 0")))
+	assert.Equal(t, []string{"redundant match: the previous patterns match all the values of true"},
+		messages(check(t, "val f = fn b => 1 | true => 0")))
+}
+
+func TestNestedFunctions(t *testing.T) {
+	diagnostics := check(t, "fun f x = let val g = fn true => 1 in g x end")
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, 23, diagnostics[0].Span.Start.Column)
+	}
+}
@@ -0,0 +1,444 @@
+// Package mono specializes polymorphic functions per instance, so that the generated Go code has no generic functions.
+package mono
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+	"strings"
+	"unicode"
+)
+
+// poly is a polymorphic function or value and its instances.
+// A polymorphic value is a syntactic value, e.g. an alias of a function, so that its copies have the same value.
+type poly struct {
+	dec       ir.Dec                    // the *ir.FunDec or *ir.ValDec
+	base      map[*types.Var]types.Type // the bindings of the enclosing instance
+	vars      []*types.Var
+	instances []*instance
+	pending   []*instance // the instances whose bodies are not specialized yet
+	names     map[string]bool
+	boxed     bool // whether an instance for type variables keeps the variables of the value, i.e. the empty interface
+}
+
+// instance is a polymorphic function or value with its type variables bound to types.
+type instance struct {
+	types    []types.Type // the types of the variables in order
+	bindings map[*types.Var]types.Type
+	dec      ir.Dec // the *ir.FunDec or *ir.ValDec of the instance, whose body is specialized by drain
+}
+
+type specializer struct {
+	polys  map[string]*poly // the polymorphic functions by unique name
+	locals bool             // whether only the local functions are specialized, and type variables are distinct
+}
+
+// Monomorphize specializes every polymorphic function or value, top level or local, per type instance found in the whole module.
+// An instance is named by the types of its type variables, e.g. id$1$int, and the functions and values which are never used
+// are dropped. The type variables which are still unbound, e.g. the element type of an unused channel, remain in the instances.
+func Monomorphize(module *ir.Module) *ir.Module {
+	s := &specializer{polys: map[string]*poly{}}
+	polys := s.register(module.Decs, nil)
+	decs := make([]ir.Dec, len(module.Decs))
+	for i, dec := range module.Decs {
+		decs[i] = s.dec(dec, nil)
+	}
+	s.drain(polys)
+	return &ir.Module{Decs: s.expand(module.Decs, decs)}
+}
+
+// SpecializeLocals specializes the polymorphic local functions and values per instance, which Go cannot make generic,
+// and keeps the top level ones, which become Go generic functions or values of the empty interface.
+// The type variables of an instance are distinct, since they are the type parameters of the enclosing function,
+// e.g. inner in fun pair x = let fun inner y = (x, y) in inner end is specialized for the second type parameter of pair.
+func SpecializeLocals(module *ir.Module) *ir.Module {
+	return specializeLocals(module, false)
+}
+
+// SpecializeValues specializes the polymorphic top level values per instance too, like SpecializeLocals, since a value
+// of the empty interface cannot be added or compared, e.g. val add = fn x => fn y => x + y. The values which are never
+// used are dropped, and an instance for the type parameters of a generic function is a value of the empty interface.
+// The code generator takes its result, but the interpreter keeps the values, which it prints and a session refers to.
+func SpecializeValues(module *ir.Module) *ir.Module {
+	return specializeLocals(module, true)
+}
+
+func specializeLocals(module *ir.Module, values bool) *ir.Module {
+	s := &specializer{polys: map[string]*poly{}, locals: true}
+	var polys []*poly
+	if values {
+		var decs []ir.Dec
+		for _, dec := range module.Decs {
+			if d, ok := dec.(*ir.ValDec); ok {
+				decs = append(decs, d)
+			}
+		}
+		polys = s.register(decs, nil)
+		for _, p := range polys {
+			p.boxed = true
+		}
+	}
+	decs := make([]ir.Dec, len(module.Decs))
+	for i, dec := range module.Decs {
+		decs[i] = s.dec(dec, nil)
+	}
+	s.drain(polys)
+	return &ir.Module{Decs: s.expand(module.Decs, decs)}
+}
+
+// register makes a poly for each function declaration whose type has type variables under the bindings,
+// including the functions of recursive declarations, and for each such value declaration of a syntactic value.
+func (s *specializer) register(decs []ir.Dec, bindings map[*types.Var]types.Type) []*poly {
+	var polys []*poly
+	add := func(dec ir.Dec, id ast.Identifier, t types.Type) {
+		vars := types.Vars(types.Substitute(t, bindings))
+		if len(vars) > 0 {
+			p := &poly{dec: dec, base: bindings, vars: vars, names: map[string]bool{}}
+			s.polys[id.Value] = p
+			polys = append(polys, p)
+		}
+	}
+	for _, dec := range decs {
+		if d, ok := dec.(*ir.ValDec); ok && isValue(d.Body) {
+			add(d, d.Id, d.Type)
+		}
+		for _, d := range funDecs(dec) {
+			add(d, d.Id, d.EnvType())
+		}
+	}
+	return polys
+}
+
+// isValue tells whether an expression is a syntactic value, which the type checker generalizes,
+// and whose copies are the same value since it has no effects.
+func isValue(exp ir.Exp) bool {
+	switch e := exp.(type) {
+	case *ir.Unit, *ir.Bool, *ir.Int, *ir.Float, *ir.String, *ir.Char, *ir.Var, *ir.Fn, *ir.Primitive, *ir.Member:
+		return true
+	case *ir.Tuple:
+		for _, element := range e.Elements {
+			if !isValue(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// id returns the name of the polymorphic function or value.
+func (p *poly) id() ast.Identifier {
+	if d, ok := p.dec.(*ir.ValDec); ok {
+		return d.Id
+	}
+	return p.dec.(*ir.FunDec).Id
+}
+
+// declType returns the type of the function, including its free variables, or the type of the value.
+func (p *poly) declType() types.Type {
+	if d, ok := p.dec.(*ir.ValDec); ok {
+		return d.Type
+	}
+	return p.dec.(*ir.FunDec).EnvType()
+}
+
+// id returns the name of the instance.
+func (inst *instance) id() ast.Identifier {
+	if d, ok := inst.dec.(*ir.ValDec); ok {
+		return d.Id
+	}
+	return inst.dec.(*ir.FunDec).Id
+}
+
+func funDecs(dec ir.Dec) []*ir.FunDec {
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		return []*ir.FunDec{d}
+	case *ir.RecDec:
+		return d.Funs
+	}
+	return nil
+}
+
+// poly returns the poly of a function or value declaration, or nil if it is monomorphic.
+func (s *specializer) poly(dec ir.Dec) *poly {
+	var id ast.Identifier
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		id = d.Id
+	case *ir.ValDec:
+		id = d.Id
+	}
+	if p, ok := s.polys[id.Value]; ok && p.dec == dec {
+		return p
+	}
+	return nil
+}
+
+// drain specializes the bodies of the pending instances, which may request more instances.
+func (s *specializer) drain(polys []*poly) {
+	for more := true; more; {
+		more = false
+		for _, p := range polys {
+			if len(p.pending) == 0 {
+				continue
+			}
+			more = true
+			inst := p.pending[0]
+			p.pending = p.pending[1:]
+			switch d := p.dec.(type) {
+			case *ir.FunDec:
+				inst.dec.(*ir.FunDec).Body = s.exp(d.Body, inst.bindings)
+			case *ir.ValDec:
+				inst.dec.(*ir.ValDec).Body = s.exp(d.Body, inst.bindings)
+			}
+		}
+	}
+}
+
+// expand replaces each polymorphic function or value with its instances in the copies of the declarations.
+func (s *specializer) expand(decs []ir.Dec, copies []ir.Dec) []ir.Dec {
+	var result []ir.Dec
+	for i, dec := range decs {
+		switch d := dec.(type) {
+		case *ir.FunDec, *ir.ValDec:
+			if p := s.poly(d); p != nil {
+				for _, inst := range p.instances {
+					result = append(result, inst.dec)
+				}
+				continue
+			}
+		case *ir.RecDec:
+			var funs []*ir.FunDec
+			for j, fun := range d.Funs {
+				if p := s.poly(fun); p != nil {
+					for _, inst := range p.instances {
+						funs = append(funs, inst.dec.(*ir.FunDec))
+					}
+				} else {
+					funs = append(funs, copies[i].(*ir.RecDec).Funs[j])
+				}
+			}
+			if len(funs) > 0 {
+				result = append(result, &ir.RecDec{Funs: funs})
+			}
+			continue
+		}
+		result = append(result, copies[i])
+	}
+	return result
+}
+
+// instantiate finds or makes the instance of a polymorphic function or value for the type of a reference.
+func (s *specializer) instantiate(p *poly, t types.Type) *instance {
+	bindings := map[*types.Var]types.Type{}
+	types.Match(types.Substitute(p.declType(), p.base), t, bindings)
+	ts := make([]types.Type, len(p.vars))
+	for i, v := range p.vars {
+		if bound, ok := bindings[v]; ok {
+			ts[i] = bound
+		} else {
+			ts[i] = v
+		}
+	}
+	if p.boxed && len(types.Vars(types.TupleType(ts))) > 0 {
+		// a top level value cannot have the type parameters of a generic function, which would make them its own.
+		bindings = map[*types.Var]types.Type{}
+		for i, v := range p.vars {
+			ts[i] = v
+		}
+	}
+	for _, inst := range p.instances {
+		if s.sameTypes(inst.types, ts) {
+			return inst
+		}
+	}
+
+	// the variables of the enclosing instance are bound too, so that the body is specialized by one substitution.
+	for v, t := range p.base {
+		bindings[v] = types.Substitute(t, bindings)
+	}
+	name := s.mangle(p.id().Value, ts)
+	for i := 2; p.names[name]; i++ {
+		name = fmt.Sprintf("%s%d", s.mangle(p.id().Value, ts), i)
+	}
+	p.names[name] = true
+	id := ast.Identifier{Name: p.id().Name, Value: name}
+	var dec ir.Dec
+	switch d := p.dec.(type) {
+	case *ir.FunDec:
+		dec = &ir.FunDec{
+			Id:   id,
+			Type: types.Substitute(d.Type, bindings),
+			Args: s.args(d.Args, bindings),
+			Env:  s.args(d.Env, bindings),
+		}
+	case *ir.ValDec:
+		dec = &ir.ValDec{Id: id, Type: types.Substitute(d.Type, bindings)}
+	}
+	inst := &instance{types: ts, bindings: bindings, dec: dec}
+	p.instances = append(p.instances, inst)
+	p.pending = append(p.pending, inst)
+	return inst
+}
+
+// mangle names an instance by the strings of the types, e.g. pair$1$int_string for int and string.
+// If only the local functions are specialized, the type variables are left out, since they are type parameters.
+func (s *specializer) mangle(name string, ts []types.Type) string {
+	var parts []string
+	for _, t := range ts {
+		if _, ok := t.Prune().(*types.Var); ok {
+			if !s.locals {
+				// an unbound type variable is the empty interface.
+				parts = append(parts, "any")
+			}
+			continue
+		}
+		str := strings.NewReplacer("->", " to ", "*", " x ").Replace(t.String())
+		parts = append(parts, strings.Join(strings.FieldsFunc(str, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}), "_"))
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return name + "$" + strings.Join(parts, "_")
+}
+
+// sameTypes tells whether the types are the same, where all type variables are the same since they are boxed alike,
+// unless only the local functions are specialized.
+func (s *specializer) sameTypes(ts, us []types.Type) bool {
+	if len(ts) != len(us) {
+		return false
+	}
+	for i := range ts {
+		if !s.sameType(ts[i], us[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *specializer) sameType(t, u types.Type) bool {
+	switch ty := t.Prune().(type) {
+	case *types.Var:
+		other, ok := u.Prune().(*types.Var)
+		return ok && (!s.locals || ty == other)
+	case *types.CtorType:
+		other, ok := u.Prune().(*types.CtorType)
+		return ok && ty.Ctor == other.Ctor && s.sameTypes(ty.Args, other.Args)
+	}
+	return false
+}
+
+// dec copies a declaration with the types substituted by the bindings, where the polymorphic functions and values are nil,
+// since they are replaced by their instances.
+func (s *specializer) dec(dec ir.Dec, bindings map[*types.Var]types.Type) ir.Dec {
+	switch d := dec.(type) {
+	case *ir.ValDec:
+		if s.poly(d) != nil {
+			return nil
+		}
+		return &ir.ValDec{Id: d.Id, Type: types.Substitute(d.Type, bindings), Body: s.exp(d.Body, bindings)}
+	case *ir.FunDec:
+		if s.poly(d) != nil {
+			return nil
+		}
+		return s.fun(d, bindings)
+	case *ir.RecDec:
+		funs := make([]*ir.FunDec, len(d.Funs))
+		for i, fun := range d.Funs {
+			if s.poly(fun) == nil {
+				funs[i] = s.fun(fun, bindings)
+			}
+		}
+		return &ir.RecDec{Funs: funs}
+	}
+	return dec
+}
+
+func (s *specializer) fun(d *ir.FunDec, bindings map[*types.Var]types.Type) *ir.FunDec {
+	return &ir.FunDec{
+		Id:   d.Id,
+		Type: types.Substitute(d.Type, bindings),
+		Args: s.args(d.Args, bindings),
+		Env:  s.args(d.Env, bindings),
+		Body: s.exp(d.Body, bindings),
+	}
+}
+
+func (s *specializer) args(args []ir.Arg, bindings map[*types.Var]types.Type) []ir.Arg {
+	if args == nil {
+		return nil
+	}
+	result := make([]ir.Arg, len(args))
+	for i, arg := range args {
+		result[i] = s.arg(arg, bindings)
+	}
+	return result
+}
+
+func (s *specializer) arg(arg ir.Arg, bindings map[*types.Var]types.Type) ir.Arg {
+	return ir.Arg{Id: arg.Id, Type: types.Substitute(arg.Type, bindings)}
+}
+
+func (s *specializer) exps(exps []ir.Exp, bindings map[*types.Var]types.Type) []ir.Exp {
+	result := make([]ir.Exp, len(exps))
+	for i, exp := range exps {
+		result[i] = s.exp(exp, bindings)
+	}
+	return result
+}
+
+// exp copies an expression with the types substituted by the bindings, and refers to the instances of polymorphic functions.
+func (s *specializer) exp(exp ir.Exp, bindings map[*types.Var]types.Type) ir.Exp {
+	subst := func(t types.Type) types.Type { return types.Substitute(t, bindings) }
+	switch e := exp.(type) {
+	case *ir.Var:
+		t := subst(e.Type)
+		if p, ok := s.polys[e.Id.Value]; ok {
+			return &ir.Var{Id: s.instantiate(p, t).id(), Type: t}
+		}
+		return &ir.Var{Id: e.Id, Type: t}
+	case *ir.LetIn:
+		polys := s.register(e.Decs, bindings)
+		decs := make([]ir.Dec, len(e.Decs))
+		for i, dec := range e.Decs {
+			decs[i] = s.dec(dec, bindings)
+		}
+		body := s.exp(e.Body, bindings)
+		s.drain(polys)
+		return &ir.LetIn{Decs: s.expand(e.Decs, decs), Body: body}
+	case *ir.Fn:
+		return &ir.Fn{Id: e.Id, Type: subst(e.Type), Body: s.exp(e.Body, bindings)}
+	case *ir.MatchFailure:
+		return &ir.MatchFailure{Type: subst(e.Type)}
+	case *ir.Variant:
+		return &ir.Variant{Ctor: e.Ctor, Arg: s.exp(e.Arg, bindings), Type: subst(e.Type)}
+	case *ir.Payload:
+		return &ir.Payload{Ctor: e.Ctor, Value: s.exp(e.Value, bindings), Type: subst(e.Type)}
+	case *ir.Primitive:
+		return &ir.Primitive{Name: e.Name, Type: subst(e.Type), Pos: e.Pos}
+	case *ir.Call:
+		return &ir.Call{Fun: s.exp(e.Fun, bindings).(*ir.Var), Args: s.exps(e.Args, bindings), Pos: e.Pos}
+	case *ir.Select:
+		arms := make([]ir.SelectArm, len(e.Arms))
+		for i, arm := range e.Arms {
+			arms[i] = ir.SelectArm{Body: s.exp(arm.Body, bindings)}
+			if arm.Chan != nil {
+				arms[i].Chan = s.exp(arm.Chan, bindings)
+			}
+			if arm.Value != nil {
+				arms[i].Value = s.exp(arm.Value, bindings)
+			}
+			if arm.Id != nil {
+				id := s.arg(*arm.Id, bindings)
+				arms[i].Id = &id
+			}
+		}
+		return &ir.Select{Arms: arms, Type: subst(e.Type)}
+	}
+	// the other expressions have no types, e.g. the constants and the members.
+	return ir.Rewrite(exp, func(child ir.Exp) ir.Exp { return s.exp(child, bindings) })
+}
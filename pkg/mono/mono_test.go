@@ -0,0 +1,49 @@
+package mono
+
+import (
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// identity makes fun name (x : 'a) = x, which is polymorphic in 'a.
+func identity(name string) *ir.FunDec {
+	a := types.NewVar(1)
+	return irtest.Fun(name, types.Arrow(a, a), []ir.Arg{irtest.Arg("x", a)}, irtest.Var("x", a))
+}
+
+// uses makes the pair of the applications of a function to 1 and true.
+func uses(name string) ir.Exp {
+	return &ir.Tuple{Elements: []ir.Exp{
+		&ir.App{Fun: irtest.Var(name, types.Arrow(types.IntType, types.IntType)), Arg: irtest.Int(1)},
+		&ir.App{Fun: irtest.Var(name, types.Arrow(types.BoolType, types.BoolType)), Arg: &ir.Bool{Value: true}},
+	}}
+}
+
+var pair = types.TupleType([]types.Type{types.IntType, types.BoolType})
+
+func TestMonomorphize(t *testing.T) {
+	module := Monomorphize(&ir.Module{Decs: []ir.Dec{
+		identity("identity"),
+		identity("unused"),
+		irtest.Val("a", pair, uses("identity")),
+	}})
+	assert.Equal(t, "fun identity$1$int (x$1 : int) = x$1\n"+
+		"fun identity$1$bool (x$1 : bool) = x$1\n"+
+		"val a$1 : int * bool = (identity$1$int 1, identity$1$bool true)", module.String())
+}
+
+func TestSpecializeLocals(t *testing.T) {
+	module := SpecializeLocals(&ir.Module{Decs: []ir.Dec{
+		identity("identity"),
+		irtest.Val("a", pair, &ir.LetIn{Decs: []ir.Dec{identity("local")}, Body: uses("local")}),
+	}})
+	if assert.Len(t, module.Decs, 2) {
+		// the top level function remains generic.
+		assert.Regexp(t, `^fun identity\$1 \(x\$1 : '\w+\) = x\$1$`, ir.DecString(module.Decs[0]))
+		assert.Equal(t, "val a$1 : int * bool = let fun local$1$int (x$1 : int) = x$1 fun local$1$bool (x$1 : bool) = x$1"+
+			" in (local$1$int 1, local$1$bool true) end", ir.DecString(module.Decs[1]))
+	}
+}
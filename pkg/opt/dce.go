@@ -0,0 +1,99 @@
+package opt
+
+import "github.com/lilac/fun-lang/pkg/ir"
+
+// EliminateDeadCode removes the let bindings which are not used, unless the value may have side effects.
+// The declarations at top level are kept, since they are the interface of the module.
+func EliminateDeadCode(module *ir.Module) *ir.Module {
+	return &ir.Module{Decs: ir.RewriteDecs(module.Decs, dce)}
+}
+
+func dce(exp ir.Exp) ir.Exp {
+	exp = ir.Rewrite(exp, dce)
+	let, ok := exp.(*ir.LetIn)
+	if !ok {
+		return exp
+	}
+	// the declarations are visited from the last, since a declaration may only be used by a later one which is removed.
+	used := map[string]bool{}
+	refer(let.Body, used)
+	var decs []ir.Dec
+	for i := len(let.Decs) - 1; i >= 0; i-- {
+		dec := let.Decs[i]
+		if dead(dec, used) {
+			continue
+		}
+		decs = append([]ir.Dec{dec}, decs...)
+		ir.InspectDec(dec, func(e ir.Exp) bool {
+			refer(e, used)
+			return false
+		})
+	}
+	if len(decs) == 0 {
+		return let.Body
+	}
+	return &ir.LetIn{Decs: decs, Body: let.Body}
+}
+
+// refer adds the variables which an expression refers to.
+func refer(exp ir.Exp, used map[string]bool) {
+	ir.Inspect(exp, func(e ir.Exp) bool {
+		switch e := e.(type) {
+		case *ir.Var:
+			used[e.Id.Value] = true
+		case *ir.Jump:
+			used[e.Fun.Id.Value] = true
+		}
+		return true
+	})
+}
+
+// dead returns whether a declaration can be removed, where the recursive calls of a function do not count.
+func dead(dec ir.Dec, used map[string]bool) bool {
+	switch d := dec.(type) {
+	case *ir.ValDec:
+		return !used[d.Id.Value] && pure(d.Body)
+	case *ir.FunDec:
+		return !used[d.Id.Value]
+	case *ir.RecDec:
+		for _, fun := range d.Funs {
+			if used[fun.Id.Value] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// pure returns whether evaluating an expression has no side effects, which includes failing.
+func pure(exp ir.Exp) bool {
+	switch e := exp.(type) {
+	case *ir.Unit, *ir.Bool, *ir.Int, *ir.Float, *ir.String, *ir.Char, *ir.Var, *ir.Fn, *ir.Primitive:
+		return true
+	case *ir.Not:
+		return pure(e.Child)
+	case *ir.Neg:
+		return pure(e.Child)
+	case *ir.BinaryOp:
+		return e.Op != ir.Div && e.Op != ir.Mod && pure(e.Left) && pure(e.Right)
+	case *ir.Tuple:
+		return allPure(e.Elements)
+	case *ir.Variant:
+		return pure(e.Arg)
+	case *ir.IsVariant:
+		return pure(e.Value)
+	case *ir.IfThen:
+		return pure(e.Cond) && pure(e.Then) && pure(e.Else)
+	}
+	return false
+}
+
+func allPure(exps []ir.Exp) bool {
+	for _, exp := range exps {
+		if !pure(exp) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package opt
+
+import "github.com/lilac/fun-lang/pkg/ir"
+
+// Fold evaluates the operations on integer and boolean constants, and the conditions which are constants.
+// The let bindings of constants are substituted for their variables, so that the operations on them are evaluated too.
+// A division by zero is not folded, and the code generator divides by a variable, so that it fails at run time
+// rather than when Go compiles the constant expression.
+func Fold(module *ir.Module) *ir.Module {
+	return &ir.Module{Decs: ir.RewriteDecs(module.Decs, fold)}
+}
+
+func fold(exp ir.Exp) ir.Exp {
+	if let, ok := exp.(*ir.LetIn); ok {
+		return propagate(let, func(decs []ir.Dec) []ir.Dec { return ir.RewriteDecs(decs, fold) }, fold, constant)
+	}
+	exp = ir.Rewrite(exp, fold)
+	switch e := exp.(type) {
+	case *ir.Not:
+		if b, ok := e.Child.(*ir.Bool); ok {
+			return &ir.Bool{Value: !b.Value}
+		}
+	case *ir.Neg:
+		if i, ok := e.Child.(*ir.Int); ok {
+			return &ir.Int{Value: -i.Value}
+		}
+	case *ir.BinaryOp:
+		if result := foldInts(e); result != nil {
+			return result
+		}
+		return foldBools(e)
+	case *ir.IfThen:
+		if b, ok := e.Cond.(*ir.Bool); ok {
+			if b.Value {
+				return e.Then
+			}
+			return e.Else
+		}
+	}
+	return exp
+}
+
+// foldInts evaluates an operation on two integer constants, or returns nil.
+func foldInts(e *ir.BinaryOp) ir.Exp {
+	left, ok := e.Left.(*ir.Int)
+	if !ok {
+		return nil
+	}
+	right, ok := e.Right.(*ir.Int)
+	if !ok {
+		return nil
+	}
+	l, r := left.Value, right.Value
+	switch e.Op {
+	case ir.Add:
+		return &ir.Int{Value: l + r}
+	case ir.Minus:
+		return &ir.Int{Value: l - r}
+	case ir.Mul:
+		return &ir.Int{Value: l * r}
+	case ir.Div:
+		if r != 0 {
+			return &ir.Int{Value: l / r}
+		}
+	case ir.Mod:
+		if r != 0 {
+			return &ir.Int{Value: l % r}
+		}
+	case ir.Eq:
+		return &ir.Bool{Value: l == r}
+	case ir.NotEq:
+		return &ir.Bool{Value: l != r}
+	case ir.Less:
+		return &ir.Bool{Value: l < r}
+	case ir.LessEq:
+		return &ir.Bool{Value: l <= r}
+	case ir.Greater:
+		return &ir.Bool{Value: l > r}
+	case ir.GreaterEq:
+		return &ir.Bool{Value: l >= r}
+	}
+	return nil
+}
+
+// foldBools evaluates an operation on boolean constants, where a constant on the left of && and || decides the result
+// without the right operand. The right operand is kept if it is not a constant, since it may have side effects.
+func foldBools(e *ir.BinaryOp) ir.Exp {
+	left, leftOk := e.Left.(*ir.Bool)
+	right, rightOk := e.Right.(*ir.Bool)
+	switch {
+	case leftOk && rightOk && e.Op == ir.Eq:
+		return &ir.Bool{Value: left.Value == right.Value}
+	case leftOk && rightOk && e.Op == ir.NotEq:
+		return &ir.Bool{Value: left.Value != right.Value}
+	case leftOk && e.Op == ir.And:
+		if left.Value {
+			return e.Right
+		}
+		return left
+	case leftOk && e.Op == ir.Or:
+		if left.Value {
+			return left
+		}
+		return e.Right
+	case rightOk && e.Op == ir.And && right.Value, rightOk && e.Op == ir.Or && !right.Value:
+		return e.Left
+	}
+	return e
+}
@@ -0,0 +1,282 @@
+package opt
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/types"
+)
+
+// maxInlineSize is the number of nodes of the largest function body which is inlined.
+const maxInlineSize = 20
+
+// maxInlineDepth limits the inlining in the inlined bodies, where a function passed as an argument may be inlined in turn.
+const maxInlineDepth = 4
+
+type inliner struct {
+	funs  map[string]*ir.FunDec // the functions which may be inlined, whose bodies are already optimised
+	depth int
+	time  uint // a monotonically increasing number to make the names of the copied variables unique
+}
+
+// Inline replaces the applications of small non-recursive functions to all their arguments with copies of their bodies,
+// and the applications of fn expressions with their bodies, i.e. beta reduction.
+//
+// An argument which is a constant or a variable is substituted for the parameter, and the others are bound by let,
+// so that they are evaluated once and in order. The let bindings of constants and variables are substituted likewise.
+// Only monomorphic functions are inlined, since the types in a polymorphic body are not those of the application.
+func Inline(module *ir.Module) *ir.Module {
+	in := &inliner{funs: map[string]*ir.FunDec{}}
+	return &ir.Module{Decs: in.decs(module.Decs)}
+}
+
+// newId makes a unique variable of a copy of a body.
+func (in *inliner) newId(id ast.Identifier) ast.Identifier {
+	in.time++
+	return ast.Identifier{Name: id.Name, Value: fmt.Sprintf("%s$%d", id.Value, in.time)}
+}
+
+// decs rewrites declarations in order, so that a function is optimised before the applications in its scope.
+func (in *inliner) decs(decs []ir.Dec) []ir.Dec {
+	result := make([]ir.Dec, len(decs))
+	for i, dec := range decs {
+		result[i] = ir.RewriteDecs([]ir.Dec{dec}, in.exp)[0]
+		if fun, ok := result[i].(*ir.FunDec); ok && inlinable(fun) {
+			in.funs[fun.Id.Value] = fun
+		}
+	}
+	return result
+}
+
+func inlinable(fun *ir.FunDec) bool {
+	if len(fun.Env) > 0 || len(types.Vars(fun.Type)) > 0 {
+		return false
+	}
+	size, recursive := 0, false
+	ir.Inspect(fun.Body, func(e ir.Exp) bool {
+		size++
+		if v, ok := e.(*ir.Var); ok && v.Id.Value == fun.Id.Value {
+			recursive = true
+		}
+		return true
+	})
+	return !recursive && size <= maxInlineSize
+}
+
+func (in *inliner) exp(exp ir.Exp) ir.Exp {
+	switch e := exp.(type) {
+	case *ir.LetIn:
+		return propagate(e, in.decs, in.exp, atomic)
+	case *ir.App:
+		exp = ir.Rewrite(exp, in.exp)
+		head, args := spine(exp)
+		var result ir.Exp
+		switch h := head.(type) {
+		case *ir.Fn:
+			argType, _, _ := types.AsArrow(h.Type)
+			result, args = in.bind([]ir.Arg{{Id: h.Id, Type: argType}}, args, h.Body, false), args[1:]
+		case *ir.Var:
+			fun := in.funs[h.Id.Value]
+			if fun == nil || len(args) < len(fun.Args) || in.depth >= maxInlineDepth {
+				return exp
+			}
+			result, args = in.bind(fun.Args, args, fun.Body, true), args[len(fun.Args):]
+			in.depth++
+			result = in.exp(result)
+			in.depth--
+		default:
+			return exp
+		}
+		for _, arg := range args {
+			result = &ir.App{Fun: result, Arg: arg, Pos: e.Pos}
+		}
+		return result
+	}
+	return ir.Rewrite(exp, in.exp)
+}
+
+// bind substitutes the arguments for the parameters of a body, or binds them by let if they are not atomic.
+// The body is copied with new variables if it is the body of a function, which may be inlined many times.
+func (in *inliner) bind(params []ir.Arg, args []ir.Exp, body ir.Exp, copied bool) ir.Exp {
+	s := &substitution{in: in, env: map[string]ir.Exp{}, rename: copied}
+	var decs []ir.Dec
+	for i, param := range params {
+		if atomic(args[i]) {
+			s.env[param.Id.Value] = args[i]
+			continue
+		}
+		decs = append(decs, &ir.ValDec{Id: s.bind(param.Id), Type: param.Type, Body: args[i]})
+	}
+	body = s.exp(body)
+	if len(decs) == 0 {
+		return body
+	}
+	return &ir.LetIn{Decs: decs, Body: body}
+}
+
+// propagate rewrites a let expression, and substitutes the values of the let bindings which satisfy the predicate
+// for their variables in the rest, where the bindings are removed.
+func propagate(let *ir.LetIn, decs func([]ir.Dec) []ir.Dec, f func(ir.Exp) ir.Exp, substituted func(ir.Exp) bool) ir.Exp {
+	s := &substitution{env: map[string]ir.Exp{}}
+	var result []ir.Dec
+	for _, dec := range let.Decs {
+		dec = decs(s.decs([]ir.Dec{dec}))[0]
+		if val, ok := dec.(*ir.ValDec); ok && substituted(val.Body) {
+			s.env[val.Id.Value] = val.Body
+			continue
+		}
+		result = append(result, dec)
+	}
+	body := f(s.exp(let.Body))
+	if len(result) == 0 {
+		return body
+	}
+	return &ir.LetIn{Decs: result, Body: body}
+}
+
+// spine returns the function and the arguments of nested applications.
+func spine(exp ir.Exp) (ir.Exp, []ir.Exp) {
+	var args []ir.Exp
+	for {
+		app, ok := exp.(*ir.App)
+		if !ok {
+			return exp, args
+		}
+		args = append([]ir.Exp{app.Arg}, args...)
+		exp = app.Fun
+	}
+}
+
+// atomic returns whether an expression is a constant or a variable, which can be duplicated.
+func atomic(exp ir.Exp) bool {
+	_, ok := exp.(*ir.Var)
+	return ok || constant(exp)
+}
+
+func constant(exp ir.Exp) bool {
+	switch exp.(type) {
+	case *ir.Unit, *ir.Bool, *ir.Int, *ir.Float, *ir.String, *ir.Char:
+		return true
+	}
+	return false
+}
+
+// substitution replaces variables with atomic expressions, and the variables bound in the expression with new ones
+// if rename is true.
+type substitution struct {
+	in     *inliner
+	env    map[string]ir.Exp
+	rename bool
+}
+
+func (s *substitution) bind(id ast.Identifier) ast.Identifier {
+	if !s.rename {
+		return id
+	}
+	fresh := s.in.newId(id)
+	s.env[id.Value] = &ir.Var{Id: fresh}
+	return fresh
+}
+
+func (s *substitution) arg(arg ir.Arg) ir.Arg {
+	return ir.Arg{Id: s.bind(arg.Id), Type: arg.Type}
+}
+
+func (s *substitution) args(args []ir.Arg) []ir.Arg {
+	result := make([]ir.Arg, len(args))
+	for i, arg := range args {
+		result[i] = s.arg(arg)
+	}
+	return result
+}
+
+// fun substitutes the variable of a called function, which is a variable.
+func (s *substitution) fun(v *ir.Var) *ir.Var {
+	if value, ok := s.env[v.Id.Value].(*ir.Var); ok {
+		return &ir.Var{Id: value.Id, Type: v.Type}
+	}
+	return v
+}
+
+func (s *substitution) exp(exp ir.Exp) ir.Exp {
+	if len(s.env) == 0 && !s.rename {
+		return exp
+	}
+	switch e := exp.(type) {
+	case *ir.Var:
+		value, ok := s.env[e.Id.Value]
+		if !ok {
+			return exp
+		}
+		if v, ok := value.(*ir.Var); ok {
+			// the type of a variable is the type at the reference, which may be an instance of a polymorphic value.
+			return &ir.Var{Id: v.Id, Type: e.Type}
+		}
+		return value
+	case *ir.Fn:
+		id := s.bind(e.Id)
+		return &ir.Fn{Id: id, Type: e.Type, Body: s.exp(e.Body)}
+	case *ir.LetIn:
+		return &ir.LetIn{Decs: s.decs(e.Decs), Body: s.exp(e.Body)}
+	case *ir.Call:
+		call := ir.Rewrite(e, s.exp).(*ir.Call)
+		call.Fun = s.fun(e.Fun)
+		return call
+	case *ir.Jump:
+		jump := ir.Rewrite(e, s.exp).(*ir.Jump)
+		jump.Fun = s.fun(e.Fun)
+		return jump
+	case *ir.Select:
+		arms := make([]ir.SelectArm, len(e.Arms))
+		for i, arm := range e.Arms {
+			if arm.Chan != nil {
+				arms[i].Chan = s.exp(arm.Chan)
+			}
+			if arm.Value != nil {
+				arms[i].Value = s.exp(arm.Value)
+			}
+			if arm.Id != nil {
+				id := s.arg(*arm.Id)
+				arms[i].Id = &id
+			}
+			arms[i].Body = s.exp(arm.Body)
+		}
+		return &ir.Select{Arms: arms, Type: e.Type}
+	}
+	return ir.Rewrite(exp, s.exp)
+}
+
+// decs substitutes declarations, where a function is bound before its body, which may refer to it,
+// and the functions of a recursive declaration are bound before all the bodies.
+func (s *substitution) decs(decs []ir.Dec) []ir.Dec {
+	result := make([]ir.Dec, len(decs))
+	for i, dec := range decs {
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			body := s.exp(d.Body)
+			result[i] = &ir.ValDec{Id: s.bind(d.Id), Type: d.Type, Body: body}
+		case *ir.FunDec:
+			id := s.bind(d.Id)
+			result[i] = s.funDec(id, d)
+		case *ir.RecDec:
+			ids := make([]ast.Identifier, len(d.Funs))
+			for j, fun := range d.Funs {
+				ids[j] = s.bind(fun.Id)
+			}
+			funs := make([]*ir.FunDec, len(d.Funs))
+			for j, fun := range d.Funs {
+				funs[j] = s.funDec(ids[j], fun)
+			}
+			result[i] = &ir.RecDec{Funs: funs}
+		default:
+			result[i] = dec
+		}
+	}
+	return result
+}
+
+func (s *substitution) funDec(id ast.Identifier, d *ir.FunDec) *ir.FunDec {
+	env := s.args(d.Env)
+	args := s.args(d.Args)
+	return &ir.FunDec{Id: id, Type: d.Type, Args: args, Env: env, Body: s.exp(d.Body)}
+}
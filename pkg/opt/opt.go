@@ -0,0 +1,65 @@
+// Package opt optimises ir modules by passes, which a Manager runs in order.
+//
+// The optimisations are constant folding, the inlining of small functions with beta reduction,
+// and the elimination of unused let bindings. A level selects them:
+//
+//	0: none
+//	1: constant folding and dead code elimination
+//	2: inlining, then the passes of level 1
+//
+// The passes rely on the unique names of the alpha transformation, so that a substitution never captures a variable.
+package opt
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"io"
+)
+
+// MaxLevel is the highest optimisation level.
+const MaxLevel = 2
+
+// Pass is a named transformation of a module.
+type Pass struct {
+	Name string
+	Run  func(*ir.Module) *ir.Module
+}
+
+// Manager runs passes in order, and prints the module after each pass to Dump if it is not nil.
+type Manager struct {
+	Passes []Pass
+	Dump   io.Writer
+}
+
+// Add appends a pass.
+func (m *Manager) Add(name string, run func(*ir.Module) *ir.Module) {
+	m.Passes = append(m.Passes, Pass{Name: name, Run: run})
+}
+
+// Run runs the passes on a module, and returns the result of the last one.
+func (m *Manager) Run(module *ir.Module) *ir.Module {
+	for _, pass := range m.Passes {
+		module = pass.Run(module)
+		if m.Dump != nil {
+			Dump(m.Dump, "after "+pass.Name, module)
+		}
+	}
+	return module
+}
+
+// Dump prints a module with a comment of the stage of the compilation.
+func Dump(w io.Writer, stage string, module *ir.Module) {
+	fmt.Fprintf(w, "(* %s *)\n%v\n\n", stage, module)
+}
+
+// Passes returns the optimisation passes of a level, which is clamped to the range [0, MaxLevel].
+func Passes(level int) []Pass {
+	var passes []Pass
+	if level >= 2 {
+		passes = append(passes, Pass{Name: "inline", Run: Inline})
+	}
+	if level >= 1 {
+		passes = append(passes, Pass{Name: "fold", Run: Fold}, Pass{Name: "dce", Run: EliminateDeadCode})
+	}
+	return passes
+}
@@ -0,0 +1,82 @@
+package opt
+
+import (
+	"bytes"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	x := irtest.Var("x", types.IntType)
+	module := Fold(&ir.Module{Decs: []ir.Dec{
+		irtest.Val("a", types.IntType, ir.NewBinaryOp(ir.Mul, ir.NewBinaryOp(ir.Add, irtest.Int(1), irtest.Int(2)), &ir.Neg{Child: irtest.Int(4)})),
+		irtest.Val("b", types.IntType, &ir.IfThen{Cond: &ir.Not{Child: ir.NewBinaryOp(ir.Less, irtest.Int(1), irtest.Int(2))},
+			Then: irtest.Int(1), Else: irtest.Int(2)}),
+		irtest.Val("c", types.IntType, ir.NewBinaryOp(ir.Div, irtest.Int(1), &ir.Int{})),
+		irtest.Val("d", types.IntType, &ir.LetIn{Decs: []ir.Dec{irtest.Val("x", types.IntType, irtest.Int(6))}, Body: ir.NewBinaryOp(ir.Mod, x, irtest.Int(4))}),
+	}})
+	assert.Equal(t, "val a$1 : int = -12\n"+
+		"val b$1 : int = 2\n"+
+		"val c$1 : int = 1 / 0\n"+
+		"val d$1 : int = 2", module.String())
+}
+
+func TestEliminateDeadCode(t *testing.T) {
+	x, y := irtest.Var("x", types.IntType), irtest.Var("y", types.IntType)
+	log := irtest.Var("log", types.Arrow(types.StringType, types.UnitType))
+	body := &ir.LetIn{Decs: []ir.Dec{
+		irtest.Val("x", types.IntType, irtest.Int(1)),
+		irtest.Val("y", types.IntType, ir.NewBinaryOp(ir.Add, x, irtest.Int(1))),
+		irtest.Val("z", types.UnitType, &ir.App{Fun: log, Arg: &ir.String{Value: "effect"}}),
+		irtest.Fun("f", irtest.IntToInt, []ir.Arg{irtest.Arg("y", types.IntType)}, y),
+	}, Body: x}
+	module := EliminateDeadCode(&ir.Module{Decs: []ir.Dec{irtest.Val("unused", types.IntType, &ir.Int{}), irtest.Val("a", types.IntType, body)}})
+	assert.Equal(t, "val unused$1 : int = 0\n"+
+		"val a$1 : int = let val x$1 : int = 1 val z$1 : unit = log$1 \"effect\" in x$1 end", module.String())
+}
+
+func TestInline(t *testing.T) {
+	x := irtest.Var("x", types.IntType)
+	double := irtest.Fun("double", irtest.IntToInt, []ir.Arg{irtest.Arg("x", types.IntType)}, ir.NewBinaryOp(ir.Add, x, x))
+	call := &ir.App{Fun: irtest.Var("double", irtest.IntToInt), Arg: &ir.App{Fun: irtest.Var("g", irtest.IntToInt), Arg: irtest.Int(1)}}
+	module := Inline(&ir.Module{Decs: []ir.Dec{double,
+		irtest.Val("a", types.IntType, &ir.App{Fun: irtest.Var("double", irtest.IntToInt), Arg: irtest.Int(3)}),
+		irtest.Val("b", types.IntType, call),
+		irtest.Val("c", types.IntType, &ir.App{Fun: &ir.Fn{Id: x.Id, Type: irtest.IntToInt, Body: ir.NewBinaryOp(ir.Mul, x, x)}, Arg: irtest.Int(5)}),
+	}})
+	assert.Equal(t, "fun double$1 (x$1 : int) = x$1 + x$1\n"+
+		"val a$1 : int = 3 + 3\n"+
+		"val b$1 : int = let val x$1$1 : int = g$1 1 in x$1$1 + x$1$1 end\n"+
+		"val c$1 : int = 5 * 5", module.String())
+}
+
+func TestInlineNoRecursiveOrPolymorphicFunctions(t *testing.T) {
+	n := irtest.Var("n", types.IntType)
+	loop := irtest.Fun("loop", irtest.IntToInt, []ir.Arg{irtest.Arg("n", types.IntType)},
+		&ir.App{Fun: irtest.Var("loop", irtest.IntToInt), Arg: n})
+	a := types.NewVar(1)
+	identity := irtest.Fun("identity", types.Arrow(a, a), []ir.Arg{irtest.Arg("y", a)}, irtest.Var("y", a))
+	module := Inline(&ir.Module{Decs: []ir.Dec{loop, identity,
+		irtest.Val("a", types.IntType, &ir.App{Fun: irtest.Var("loop", irtest.IntToInt), Arg: irtest.Int(1)}),
+		irtest.Val("b", types.IntType, &ir.App{Fun: irtest.Var("identity", irtest.IntToInt), Arg: irtest.Int(1)}),
+	}})
+	assert.Contains(t, module.String(), "val a$1 : int = loop$1 1\nval b$1 : int = identity$1 1")
+}
+
+func TestManager(t *testing.T) {
+	var dump bytes.Buffer
+	manager := &Manager{Dump: &dump}
+	for _, pass := range Passes(MaxLevel) {
+		manager.Add(pass.Name, pass.Run)
+	}
+	x := irtest.Var("x", types.IntType)
+	double := irtest.Fun("double", irtest.IntToInt, []ir.Arg{irtest.Arg("x", types.IntType)}, ir.NewBinaryOp(ir.Add, x, x))
+	module := manager.Run(&ir.Module{Decs: []ir.Dec{double, irtest.Val("a", types.IntType, &ir.App{Fun: irtest.Var("double", irtest.IntToInt), Arg: irtest.Int(3)})}})
+	assert.Equal(t, "fun double$1 (x$1 : int) = x$1 + x$1\nval a$1 : int = 6", module.String())
+	assert.Contains(t, dump.String(), "(* after inline *)\nfun double$1 (x$1 : int) = x$1 + x$1\nval a$1 : int = 3 + 3\n\n(* after fold *)")
+	assert.Contains(t, dump.String(), "(* after dce *)")
+	assert.Empty(t, Passes(0))
+}
@@ -0,0 +1,148 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// doc is a document of a layout after "A prettier printer" by Philip Wadler, i.e. a text, a line, a concatenation,
+// a nested or aligned document, or a group. A group is printed on one line if it fits in the width,
+// where its lines are spaces, or all its lines are broken otherwise.
+type doc interface{}
+
+type text string
+
+// line is a space if its group is flat, or a new line at the indentation otherwise.
+// A hard line is always a new line, so that its groups are never flat, e.g. after a comment to the end of the line.
+type line struct {
+	hard bool
+}
+
+type concat []doc
+
+// nest indents the lines of a document more than the indentation of its parent.
+type nest struct {
+	indent int
+	doc    doc
+}
+
+// align indents the lines of a document to the column where it starts.
+type align struct {
+	doc doc
+}
+
+type group struct {
+	doc doc
+}
+
+var (
+	softLine = line{}
+	hardLine = line{hard: true}
+)
+
+type mode int
+
+const (
+	flat mode = iota
+	broken
+)
+
+// command is a document to print at an indentation in a mode.
+type command struct {
+	indent int
+	mode   mode
+	doc    doc
+}
+
+// render prints a document in the width, where there are no trailing spaces on the lines.
+func render(d doc, width int) string {
+	var buf []byte
+	column := 0
+	newLine := func(indent int) {
+		buf = append(bytes.TrimRight(buf, " "), '\n')
+		buf = append(buf, strings.Repeat(" ", indent)...)
+		column = indent
+	}
+	stack := []command{{0, broken, d}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case text:
+			buf = append(buf, d...)
+			if i := strings.LastIndexByte(string(d), '\n'); i >= 0 {
+				column = utf8.RuneCountInString(string(d[i+1:]))
+			} else {
+				column += utf8.RuneCountInString(string(d))
+			}
+		case line:
+			if c.mode == flat && !d.hard {
+				buf = append(buf, ' ')
+				column++
+			} else {
+				newLine(c.indent)
+			}
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.mode, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.indent, c.mode, d.doc})
+		case align:
+			stack = append(stack, command{column, c.mode, d.doc})
+		case group:
+			m := broken
+			if c.mode == flat || fits(width-column, command{c.indent, flat, d.doc}, stack) {
+				m = flat
+			}
+			stack = append(stack, command{c.indent, m, d.doc})
+		case nil:
+		default:
+			panic("unknown document")
+		}
+	}
+	return string(bytes.TrimRight(buf, " "))
+}
+
+// fits returns whether a command fits in the width up to the first broken line of it or of the rest of the commands.
+func fits(width int, c command, rest []command) bool {
+	stack := []command{c}
+	for width >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.doc.(type) {
+		case text:
+			if i := strings.IndexByte(string(d), '\n'); i >= 0 {
+				return width >= utf8.RuneCountInString(string(d[:i]))
+			}
+			width -= utf8.RuneCountInString(string(d))
+		case line:
+			if d.hard {
+				return c.mode == broken
+			}
+			if c.mode == broken {
+				return true
+			}
+			width--
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.mode, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.indent, c.mode, d.doc})
+		case align:
+			stack = append(stack, command{c.indent, c.mode, d.doc})
+		case group:
+			stack = append(stack, command{c.indent, c.mode, d.doc})
+		}
+	}
+	return false
+}
@@ -0,0 +1,592 @@
+// Package printer formats the code of the Fun language in the canonical layout, like gofmt for Go.
+//
+// The printer lays out the AST with minimal parentheses, and breaks the lines of a declaration or an expression
+// which does not fit in the width, e.g.
+//
+//	fun sum xs acc =
+//	  let
+//	    val n = length xs
+//	  in
+//	    if n = 0 then acc else sum (tail xs) (acc + head xs)
+//	  end
+//
+// It keeps the comments, which the lexer keeps as trivia of the module. A comment is printed before the next token
+// after it, on its own line if it is at the end of a line in the source, and a comment after the last token
+// of a declaration on the same line stays at the end of the line. The printing is idempotent, i.e. the code
+// which it prints is printed as it is.
+package printer
+
+import (
+	"bytes"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
+	"io"
+)
+
+// Config is the configuration of the layout.
+type Config struct {
+	// Width is the maximum width of the lines, which a line may exceed if it cannot be broken. It is 80 by default.
+	Width int
+}
+
+const (
+	defaultWidth = 80
+	indent       = 2
+)
+
+// Format parses the source, and returns its code in the canonical layout, or the syntax errors of it.
+func Format(src *syntax.Source, config Config) ([]byte, error) {
+	code, err := io.ReadAll(src.Reader)
+	if err != nil {
+		return nil, err
+	}
+	module, err := syntax.Parse(&syntax.Source{Reader: bytes.NewReader(code), Path: src.Path})
+	if err != nil {
+		return nil, err
+	}
+	width := config.Width
+	if width <= 0 {
+		width = defaultWidth
+	}
+	p := &printer{code: code, comments: module.Comments}
+	return []byte(render(p.module(module), width)), nil
+}
+
+type printer struct {
+	code     []byte
+	comments []*token.Token // the comments which are not printed yet
+}
+
+func (p *printer) module(module *ast.Module) doc {
+	var result concat
+	end := -1 // the offset of the end of the last printed item, or -1 at the start of the file
+	// separate puts the next item on a new line, after a blank line if there is one before it in the source.
+	separate := func(start int) {
+		if end >= 0 {
+			result = append(result, hardLine)
+			if bytes.Count(p.code[end:start], []byte("\n")) > 1 {
+				result = append(result, hardLine)
+			}
+		}
+	}
+	for i, dec := range module.Decs {
+		start, last := span(dec)
+		for len(p.comments) > 0 && p.comments[0].Location.Start.Offset < start.Offset {
+			c := p.comments[0]
+			p.comments = p.comments[1:]
+			separate(c.Location.Start.Offset)
+			result = append(result, text(c.Value))
+			end = c.Location.End.Offset
+		}
+		separate(start.Offset)
+		result = append(result, p.dec(dec))
+		end = last.Offset
+		next := len(p.code)
+		if i+1 < len(module.Decs) {
+			s, _ := span(module.Decs[i+1])
+			next = s.Offset
+		}
+		// the comments at the end of the last line of the declaration
+		for len(p.comments) > 0 && p.comments[0].Location.Start.Offset < next &&
+			p.comments[0].Location.Start.Line == last.Line {
+			c := p.comments[0]
+			p.comments = p.comments[1:]
+			result = append(result, text(" "+c.Value))
+			end = c.Location.End.Offset
+		}
+	}
+	for _, c := range p.comments {
+		separate(c.Location.Start.Offset)
+		result = append(result, text(c.Value))
+		end = c.Location.End.Offset
+	}
+	p.comments = nil
+	if len(result) > 0 {
+		result = append(result, hardLine)
+	}
+	return result
+}
+
+// span returns the start and the end of a declaration, where the start is at its name for a value declaration.
+func span(dec ast.Dec) (locerr.Pos, locerr.Pos) {
+	switch d := dec.(type) {
+	case *ast.ValDec:
+		return d.Start(), d.Body.End()
+	case *ast.FunDec:
+		return d.Binds[0].Start(), d.Binds[len(d.Binds)-1].End()
+	case *ast.RecDec:
+		start, _ := span(d.Funs[0])
+		_, end := span(d.Funs[len(d.Funs)-1])
+		return start, end
+	case *ast.ExternDec:
+		return d.Start(), d.GoName.End()
+	case *ast.ExternTypeDec:
+		return d.Start(), d.GoName.End()
+	}
+	panic("unknown declaration " + dec.String())
+}
+
+// flush returns the comments before a token, which are printed before it.
+func (p *printer) flush(tok *token.Token) doc {
+	if tok == nil {
+		return nil
+	}
+	var result concat
+	for len(p.comments) > 0 && p.comments[0].Location.Start.Offset < tok.Location.Start.Offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		result = append(result, text(c.Value))
+		if p.endsLine(c.Location.End.Offset) {
+			result = append(result, hardLine)
+		} else {
+			result = append(result, text(" "))
+		}
+	}
+	return result
+}
+
+// endsLine returns whether only spaces follow an offset on its line.
+func (p *printer) endsLine(offset int) bool {
+	rest := p.code[offset:]
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	return len(bytes.TrimSpace(rest)) == 0
+}
+
+func (p *printer) dec(dec ast.Dec) doc {
+	switch d := dec.(type) {
+	case *ast.ValDec:
+		return concat{p.flush(d.Token), group{concat{text("val " + d.Arg.Id.Name + " ="), p.body(d.Body)}}}
+	case *ast.FunDec:
+		return concat{p.flush(d.Binds[0].Token), group{concat{text("fun "), p.binds(d)}}}
+	case *ast.RecDec:
+		result := concat{p.flush(d.Funs[0].Binds[0].Token), text("fun "), p.binds(d.Funs[0])}
+		for _, f := range d.Funs[1:] {
+			result = append(result, softLine, text("and "), p.binds(f))
+		}
+		return group{result}
+	case *ast.ExternDec:
+		return concat{p.flush(d.Token), text("extern val " + d.Arg.Id.Name + " : " + d.Arg.Type.String() + " = "),
+			p.exp(d.GoName)}
+	case *ast.ExternTypeDec:
+		return concat{p.flush(d.Token), text("extern type " + d.Name.Name + " = "), p.exp(d.GoName)}
+	}
+	panic("unknown declaration " + dec.String())
+}
+
+// body returns the body of a declaration or a match after its '=' or '=>', which is on the next line if it is broken.
+func (p *printer) body(exp ast.Exp) doc {
+	return nest{indent, concat{softLine, p.exp(exp)}}
+}
+
+// binds returns the clauses of a function, which are separated by '|'.
+func (p *printer) binds(f *ast.FunDec) doc {
+	var result concat
+	for i, bind := range f.Binds {
+		head := concat{p.flush(bind.Token), text(bind.Id.Name)}
+		for _, pattern := range bind.Patterns {
+			head = append(head, text(" "), p.pattern(pattern, true))
+		}
+		if bind.ResultType != nil {
+			head = append(head, text(" : "+bind.ResultType.String()))
+		}
+		exp := bind.Exp
+		clause := group{concat{head, text(" ="), p.body(parenthesized{exp, i+1 < len(f.Binds) && open(exp)})}}
+		if i == 0 {
+			result = append(result, clause)
+		} else {
+			result = append(result, nest{indent, concat{softLine, text("| "), clause}})
+		}
+	}
+	return result
+}
+
+// parenthesized is an expression in parentheses if paren is true, e.g. a function before a '|' which it may take.
+type parenthesized struct {
+	ast.Exp
+	paren bool
+}
+
+// The precedences of the expressions, where a higher one binds tighter.
+const (
+	precLowest = iota // if and fn, which take the code up to the end of their parent
+	precSequence
+	precOr
+	precAnd
+	precCompare
+	precAdd
+	precMul
+	precUnary
+	precApply
+	precAtom
+)
+
+func precedence(exp ast.Exp) int {
+	switch e := exp.(type) {
+	case parenthesized:
+		if e.paren {
+			return precAtom
+		}
+		return precedence(e.Exp)
+	case *ast.IfThen, *ast.Fn:
+		return precLowest
+	case *ast.Tuple, *ast.Sequence:
+		return precSequence
+	case *ast.InfixApp:
+		return operatorPrecedence(e.Op.Name)
+	case *ast.Not, *ast.Neg:
+		return precUnary
+	case *ast.Apply:
+		return precApply
+	}
+	return precAtom
+}
+
+func operatorPrecedence(op string) int {
+	switch op {
+	case ast.Or:
+		return precOr
+	case ast.And:
+		return precAnd
+	case ast.Eq, ast.NotEq, ast.Less, ast.LessEq, ast.Greater, ast.GreaterEq:
+		return precCompare
+	case ast.Add, ast.Minus:
+		return precAdd
+	}
+	return precMul
+}
+
+// simple returns whether an expression is an argument of an application without parentheses.
+func simple(exp ast.Exp) bool {
+	switch e := exp.(type) {
+	case parenthesized:
+		return e.paren || simple(e.Exp)
+	case *ast.Var, *ast.Member, *ast.Unit, *ast.Bool, *ast.Int, *ast.Float, *ast.String, *ast.Char:
+		return true
+	}
+	return false
+}
+
+// open returns whether an expression ends with a function without parentheses, which would take a following '|'.
+func open(exp ast.Exp) bool {
+	switch e := exp.(type) {
+	case *ast.Fn:
+		return true
+	case *ast.IfThen:
+		return open(e.Else)
+	case *ast.Tuple:
+		return open(e.Elements[len(e.Elements)-1])
+	case *ast.Sequence:
+		return open(e.Elements[len(e.Elements)-1])
+	}
+	return false
+}
+
+// operand returns an expression in parentheses if paren is true.
+func (p *printer) operand(exp ast.Exp, paren bool) doc {
+	if paren {
+		return concat{text("("), align{p.exp(exp)}, text(")")}
+	}
+	return p.exp(exp)
+}
+
+// exp returns an expression after the comments before it, which are out of its groups, so that a comment
+// on its own line does not break them.
+func (p *printer) exp(exp ast.Exp) doc {
+	return concat{p.flush(first(exp)), p.layout(exp)}
+}
+
+func (p *printer) layout(exp ast.Exp) doc {
+	switch e := exp.(type) {
+	case parenthesized:
+		return p.operand(e.Exp, e.paren)
+	case *ast.Unit:
+		return concat{p.flush(e.Token), text("()")}
+	case *ast.Bool, *ast.Int, *ast.Float, *ast.String, *ast.Char:
+		return p.constant(e.(ast.Constant))
+	case *ast.Var:
+		return concat{p.flush(e.Token), text(e.Id.Name)}
+	case *ast.Member:
+		return concat{p.flush(e.Token), text(e.Type.Name + "." + e.Name.Name)}
+	case *ast.Not:
+		return concat{p.flush(e.Token), text("not "), p.operand(e.Child, precedence(e.Child) < precUnary)}
+	case *ast.Neg:
+		return concat{p.flush(e.Token), text("-"), p.operand(e.Child, precedence(e.Child) < precUnary)}
+	case *ast.InfixApp:
+		return p.infix(e)
+	case *ast.Apply:
+		return p.apply(e)
+	case *ast.Tuple:
+		return p.elements(e.Elements, ",")
+	case *ast.Sequence:
+		return p.elements(e.Elements, ";")
+	case *ast.IfThen:
+		return p.ifThen(e)
+	case *ast.LetIn:
+		let := p.flush(e.Token)
+		decs := make(concat, 0, 2*len(e.Decs))
+		for i, dec := range e.Decs {
+			if i > 0 {
+				decs = append(decs, softLine)
+			}
+			decs = append(decs, p.dec(dec))
+		}
+		return group{concat{let, text("let"), nest{indent, concat{softLine, decs}},
+			softLine, text("in"), p.body(e.Body), softLine, p.flush(e.EndToken), text("end")}}
+	case *ast.Fn:
+		return p.fn(e)
+	case *ast.Select:
+		return p.sel(e)
+	}
+	// e.g. a type annotation, which the parser does not make yet.
+	return text(exp.String())
+}
+
+// constant returns the text of a constant in the source, e.g. 1.5 rather than the float 1.500000.
+func (p *printer) constant(c ast.Constant) doc {
+	var tok *token.Token
+	switch c := c.(type) {
+	case *ast.Unit:
+		return p.exp(c)
+	case *ast.Bool:
+		tok = c.Token
+	case *ast.Int:
+		tok = c.Token
+	case *ast.Float:
+		tok = c.Token
+	case *ast.String:
+		tok = c.Token
+	}
+	if tok == nil {
+		return text(c.String())
+	}
+	return concat{p.flush(tok), text(tok.Value)}
+}
+
+// infix returns an infix application, where the operands of a chain of operators of the same precedence
+// are on the lines after the first one if they are broken, e.g.
+//
+//	a +
+//	  b -
+//	  c
+func (p *printer) infix(e *ast.InfixApp) doc {
+	prec := operatorPrecedence(e.Op.Name)
+	var operands []*ast.InfixApp // the applications of the chain from the right
+	var exp ast.Exp = e
+	for {
+		infix, ok := exp.(*ast.InfixApp)
+		if !ok || operatorPrecedence(infix.Op.Name) != prec {
+			break
+		}
+		operands = append(operands, infix)
+		exp = infix.Left
+	}
+	// the operands are printed from the left, so that the comments are in order.
+	first := p.exp(parenthesized{exp, precedence(exp) < prec})
+	var rest concat
+	for i := len(operands) - 1; i >= 0; i-- {
+		right := operands[i].Right
+		rest = append(rest, text(" "+operands[i].Op.Name), softLine, p.exp(parenthesized{right, precedence(right) <= prec}))
+	}
+	return group{concat{first, nest{indent, rest}}}
+}
+
+// apply returns an application of a function to its arguments, which are on the lines after the function
+// if they are broken.
+func (p *printer) apply(e *ast.Apply) doc {
+	var args []ast.Exp // the arguments from the right
+	var fun ast.Exp = e
+	for {
+		apply, ok := fun.(*ast.Apply)
+		if !ok {
+			break
+		}
+		args = append(args, apply.Arg)
+		fun = apply.Fun
+	}
+	head := p.exp(parenthesized{fun, precedence(fun) < precApply})
+	var rest concat
+	for i := len(args) - 1; i >= 0; i-- {
+		rest = append(rest, softLine, p.exp(parenthesized{args[i], !simple(args[i])}))
+	}
+	return group{concat{head, nest{indent, rest}}}
+}
+
+// elements returns the elements of a tuple or a sequence, where the last one may be a function or a condition.
+func (p *printer) elements(elements []ast.Exp, separator string) doc {
+	var result concat
+	for i, element := range elements {
+		if i > 0 {
+			result = append(result, text(separator), softLine)
+		}
+		paren := precedence(element) <= precSequence
+		if i+1 == len(elements) {
+			paren = precedence(element) == precSequence
+		}
+		result = append(result, p.exp(parenthesized{element, paren}))
+	}
+	return group{result}
+}
+
+// ifThen returns a condition, whose branches are on their own lines if they are broken, e.g.
+//
+//	if n = 0 then
+//	  1
+//	else if n = 1 then
+//	  2
+//	else
+//	  3
+func (p *printer) ifThen(e *ast.IfThen) doc {
+	result := concat{p.flush(e.Token), text("if "), p.exp(e.Cond), text(" then"), p.body(e.Then), softLine, text("else")}
+	if elseIf, ok := e.Else.(*ast.IfThen); ok {
+		result = append(result, text(" "), p.exp(elseIf))
+	} else {
+		result = append(result, p.body(e.Else))
+	}
+	return group{result}
+}
+
+// fn returns a function, whose matches are aligned after the first one if they are broken, e.g.
+//
+//	fn 0 => 1
+//	 | n => n
+//
+// The body of a function of one match is on the line of a function which it may be, e.g. fn x => fn y =>
+func (p *printer) fn(e *ast.Fn) doc {
+	result := concat{p.flush(e.Token), text("fn ")}
+	if len(e.Matches) == 1 {
+		m := e.Matches[0]
+		pattern := p.pattern(m.Pattern, false)
+		if body, ok := m.Exp.(*ast.Fn); ok && len(body.Matches) == 1 {
+			return append(result, pattern, text(" => "), p.exp(body))
+		}
+		return append(result, group{concat{pattern, text(" =>"), p.body(m.Exp)}})
+	}
+	for i, m := range e.Matches {
+		if i > 0 {
+			result = append(result, softLine, p.flush(tokenOf(m.Pattern)), text("| "))
+		}
+		body := parenthesized{m.Exp, i+1 < len(e.Matches) && open(m.Exp)}
+		result = append(result, group{concat{p.pattern(m.Pattern, false), text(" =>"), p.body(body)}})
+	}
+	return align{nest{1, group{result}}}
+}
+
+// sel returns a select, whose arms are on their own lines if they are broken, e.g.
+//
+//	select
+//	  c ? x => x
+//	  | else => 0
+//	end
+func (p *printer) sel(e *ast.Select) doc {
+	start := p.flush(e.Token)
+	var arms concat
+	for i, arm := range e.Arms {
+		var head doc
+		switch {
+		case arm.Chan == nil:
+			head = text("else")
+		case arm.Value != nil:
+			head = concat{p.exp(parenthesized{arm.Chan, !simple(arm.Chan)}), text(" ! "),
+				p.exp(parenthesized{arm.Value, !simple(arm.Value)})}
+		default:
+			head = concat{p.exp(parenthesized{arm.Chan, !simple(arm.Chan)}), text(" ? "), p.pattern(arm.Pattern, false)}
+		}
+		if i > 0 {
+			arms = append(arms, softLine, text("| "))
+		}
+		body := parenthesized{arm.Exp, i+1 < len(e.Arms) && open(arm.Exp)}
+		arms = append(arms, group{concat{head, text(" =>"), p.body(body)}})
+	}
+	return group{concat{start, text("select"), nest{indent, concat{softLine, arms}}, softLine,
+		p.flush(e.EndToken), text("end")}}
+}
+
+// pattern returns a pattern, which is parenthesized if it must be atomic but it is a constructor with an argument.
+func (p *printer) pattern(pattern ast.Pattern, atomic bool) doc {
+	switch pat := pattern.(type) {
+	case *ast.ConstPattern:
+		return p.exp(pat.Constant)
+	case *ast.VarPattern:
+		return concat{p.flush(pat.Token), text(pat.Id.Name)}
+	case *ast.CtorPattern:
+		result := concat{p.flush(pat.Token), text(pat.Ctor.Name + " "), p.pattern(pat.Arg, true)}
+		if atomic {
+			return concat{text("("), result, text(")")}
+		}
+		return result
+	}
+	return text(pattern.String())
+}
+
+// first returns the first token of an expression, or nil if it is unknown.
+func first(exp ast.Exp) *token.Token {
+	switch e := exp.(type) {
+	case parenthesized:
+		return first(e.Exp)
+	case ast.Pattern:
+		return tokenOf(e)
+	case *ast.Unit:
+		return e.Token
+	case *ast.Bool:
+		return e.Token
+	case *ast.Int:
+		return e.Token
+	case *ast.Float:
+		return e.Token
+	case *ast.String:
+		return e.Token
+	case *ast.Var:
+		return e.Token
+	case *ast.Member:
+		return e.Token
+	case *ast.Not:
+		return e.Token
+	case *ast.Neg:
+		return e.Token
+	case *ast.IfThen:
+		return e.Token
+	case *ast.LetIn:
+		return e.Token
+	case *ast.Fn:
+		return e.Token
+	case *ast.Select:
+		return e.Token
+	case *ast.InfixApp:
+		return first(e.Left)
+	case *ast.Apply:
+		return first(e.Fun)
+	case *ast.Tuple:
+		return first(e.Elements[0])
+	case *ast.Sequence:
+		return first(e.Elements[0])
+	}
+	return nil
+}
+
+// tokenOf returns the first token of a pattern, or nil if it is unknown.
+func tokenOf(pattern ast.Pattern) *token.Token {
+	switch pat := pattern.(type) {
+	case *ast.ConstPattern:
+		switch c := pat.Constant.(type) {
+		case *ast.Unit:
+			return c.Token
+		case *ast.Bool:
+			return c.Token
+		case *ast.Int:
+			return c.Token
+		case *ast.Float:
+			return c.Token
+		case *ast.String:
+			return c.Token
+		}
+	case *ast.VarPattern:
+		return pat.Token
+	case *ast.CtorPattern:
+		return pat.Token
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package printer
+
+import (
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func format(t *testing.T, code string, width int) string {
+	formatted, err := Format(syntax.NewDummySource(code), Config{Width: width})
+	if !assert.NoError(t, err, code) {
+		t.FailNow()
+	}
+	return string(formatted)
+}
+
+// assertFormatted checks that the code is formatted as it is, and that the formatted code is the same program.
+func assertFormatted(t *testing.T, code string, width int, expected ...string) {
+	formatted := format(t, code, width)
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", formatted)
+	assert.Equal(t, formatted, format(t, formatted, width), "the formatting is not idempotent")
+	before, err := syntax.Parse(syntax.NewDummySource(code))
+	assert.NoError(t, err)
+	after, err := syntax.Parse(syntax.NewDummySource(formatted))
+	assert.NoError(t, err)
+	assert.Equal(t, before.String(), after.String())
+}
+
+func TestFormatSpacesAndParentheses(t *testing.T) {
+	assertFormatted(t, "val a=(1+2)*3-(4-5)\nfun f(x)=f(x-1)", 80,
+		"val a = (1 + 2) * 3 - (4 - 5)",
+		"fun f x = f (x - 1)",
+	)
+	assertFormatted(t, "val b = 1.50 + f (-x) - - y\nval c = not (a && b) || \"s\\n\" = g (h x)", 80,
+		"val b = 1.50 + f (-x) - -y",
+		`val c = not (a && b) || "s\n" = g (h x)`,
+	)
+}
+
+func TestFormatFunctionsInMatches(t *testing.T) {
+	// the inner functions take the following matches without parentheses.
+	assertFormatted(t, "val g = fn 0 => (fn y => y) | n => (if n > 0 then fn y => n else fn y => y)", 80,
+		"val g = fn 0 => (fn y => y) | n => if n > 0 then fn y => n else fn y => y",
+	)
+	assertFormatted(t, "fun f 0 = (fn y => y) | f n = fn y => n\nval a = (if b then 1 else 2) + f (fn x => x) 1", 80,
+		"fun f 0 = (fn y => y) | f n = fn y => n",
+		"val a = (if b then 1 else 2) + f (fn x => x) 1",
+	)
+}
+
+func TestFormatBreaksLines(t *testing.T) {
+	assertFormatted(t, "fun sum xs acc = let val n = length xs in if n = 0 then acc else sum (tail xs) (acc + head xs) end", 60,
+		"fun sum xs acc =",
+		"  let",
+		"    val n = length xs",
+		"  in",
+		"    if n = 0 then acc else sum (tail xs) (acc + head xs)",
+		"  end",
+	)
+	assertFormatted(t, "val s = select c ? x => x | d ! 1 => 0 | else => -1 end\nfun f 0 = 1 | f n = n * f (n - 1)", 20,
+		"val s =",
+		"  select",
+		"    c ? x => x",
+		"    | d ! 1 => 0",
+		"    | else => -1",
+		"  end",
+		"fun f 0 = 1",
+		"  | f n =",
+		"    n * f (n - 1)",
+	)
+	assertFormatted(t, "val c = if a then 1 else if b then 2 else 3\nval add = fn x => fn y => x + y", 20,
+		"val c =",
+		"  if a then",
+		"    1",
+		"  else if b then",
+		"    2",
+		"  else",
+		"    3",
+		"val add =",
+		"  fn x => fn y =>",
+		"    x + y",
+	)
+}
+
+func TestFormatComments(t *testing.T) {
+	assertFormatted(t, "(* header *)\n\n\nval a = 1 (* one *)\n(* b *)\nval b = (* two *) 2\nval c = let\n  (* x *)\n  val x = a\nin x end\n(* end *)", 80,
+		"(* header *)",
+		"",
+		"val a = 1 (* one *)",
+		"(* b *)",
+		"val b = (* two *) 2",
+		"val c =",
+		"  let",
+		"    (* x *)",
+		"    val x = a",
+		"  in",
+		"    x",
+		"  end",
+		"(* end *)",
+	)
+}
+
+func TestFormatIsIdempotentAtAnyWidth(t *testing.T) {
+	code := strings.Join([]string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		`fun mk n acc = if n = 0 then acc else mk (n - 1) (fn u => n + acc u) (* trailing *)`,
+		`fun even n = n = 0 || odd (n - 1) and odd n = n <> 0 && even (n - 1)`,
+		`fun m (Ok x) = x | m (Err (Ok e)) = e`,
+		`val s = (print "a"; (* b *) print "b"; if a > 1 then 1 else 2)`,
+		`val g = fn 0 => fn y => y | n => fn y => n`,
+	}, "\n")
+	for _, width := range []int{1, 10, 20, 40, 80} {
+		formatted := format(t, code, width)
+		assert.Equal(t, formatted, format(t, formatted, width), "width %d", width)
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	_, err := Format(syntax.NewDummySource("val a = "), Config{})
+	assert.Error(t, err)
+}
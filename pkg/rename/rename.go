@@ -0,0 +1,215 @@
+// Package rename renames a variable, i.e. its declaration and the references to it, which the alpha conversion
+// resolves to the same unique name, e.g. x$2.
+//
+// A renaming must not change what the other identifiers refer to, e.g. a reference to another variable must not
+// be captured by the renamed one, and a reference to the renamed variable must not be shadowed by another one.
+// The renaming checks it by resolving the renamed code again, and reports every identifier which would refer to
+// another declaration as a conflict.
+package rename
+
+import (
+	"bytes"
+	"fmt"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Edit replaces the code from Start to End with Text.
+type Edit struct {
+	Start locerr.Pos
+	End   locerr.Pos
+	Text  string
+}
+
+// occurrence is an identifier which declares or refers to a variable, with the unique name which it resolves to,
+// or an empty name if it does not resolve, e.g. a duplicate identifier of a pattern.
+type occurrence struct {
+	tok         *token.Token
+	name        string
+	declaration bool
+}
+
+// Rename returns the edits of the code of the source, which rename the variable at a position to a name,
+// where the line and the column are one based. It returns the conflicts of the renaming as the diagnostics
+// of an error, or the syntax errors of the source.
+func Rename(src *syntax.Source, line, column int, name string) ([]Edit, error) {
+	code, err := io.ReadAll(src.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_, occurrences, err := resolve(code, src.Path)
+	if err != nil {
+		return nil, err
+	}
+	target, ok := find(occurrences, line, column)
+	if !ok {
+		pos := locerr.Pos{Line: line, Column: column, File: &locerr.Source{Path: src.Path, Code: code}}
+		return nil, diag.Errorf(diag.InvalidRename, pos, pos, "no variable to rename at %d:%d", line, column)
+	}
+	old := target.tok.Value
+	switch {
+	case target.name == "":
+		return nil, diag.Errorf(diag.InvalidRename, target.tok.Start(), target.tok.End(), "'%s' is not declared", old)
+	case !strings.Contains(target.name, "$"):
+		return nil, diag.Errorf(diag.InvalidRename, target.tok.Start(), target.tok.End(), "cannot rename the built-in '%s'", old)
+	case !identifier(name):
+		return nil, diag.Errorf(diag.InvalidRename, target.tok.Start(), target.tok.End(), "'%s' is not a valid name of a variable", name)
+	case name == old:
+		return nil, nil
+	}
+
+	var edits []Edit
+	for _, o := range occurrences {
+		if o.name == target.name {
+			edits = append(edits, Edit{o.tok.Start(), o.tok.End(), name})
+		}
+	}
+	_, renamed, err := resolve([]byte(Apply(string(code), edits)), src.Path)
+	if err != nil || len(renamed) != len(occurrences) {
+		// the identifiers are replaced by identifiers, which keeps the syntax.
+		return nil, fmt.Errorf("bug: the renamed code of %s does not parse like the code: %v", src.Path, err)
+	}
+	if err := conflicts(occurrences, renamed, old, name, declaration(occurrences, target.name)); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// Apply applies the edits to the code, where the edits do not overlap.
+func Apply(code string, edits []Edit) string {
+	sorted := append([]Edit{}, edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Offset < sorted[j].Start.Offset
+	})
+	var buf strings.Builder
+	offset := 0
+	for _, e := range sorted {
+		buf.WriteString(code[offset:e.Start.Offset])
+		buf.WriteString(e.Text)
+		offset = e.End.Offset
+	}
+	buf.WriteString(code[offset:])
+	return buf.String()
+}
+
+// resolve parses and renames the code, and returns the identifiers of it in the order of the source.
+// The errors of the alpha conversion are ignored, since an undefined variable does not resolve.
+func resolve(code []byte, path string) (*syntax.File, []occurrence, error) {
+	file, err := syntax.ParseFile(&syntax.Source{Reader: bytes.NewReader(code), Path: path})
+	if err != nil {
+		return nil, nil, err
+	}
+	alpha.NewTransformer().Transform(file.Module)
+	var result []occurrence
+	ast.Inspect(file.Module, func(node interface{}) bool {
+		switch n := node.(type) {
+		case *ast.ValDec:
+			result = append(result, occurrence{n.Token, n.Arg.Id.Value, true})
+		case *ast.FunDec:
+			// the alpha conversion renames the name of the first clause only.
+			for _, bind := range n.Binds {
+				result = append(result, occurrence{bind.Token, n.Binds[0].Id.Value, true})
+			}
+		case *ast.ExternDec:
+			// the name is after 'extern val'.
+			if first, _, ok := file.Range(n); ok && first+2 < len(file.Tokens) {
+				result = append(result, occurrence{file.Tokens[first+2], n.Arg.Id.Value, true})
+			}
+		case *ast.VarPattern:
+			result = append(result, occurrence{n.Token, n.Id.Value, true})
+		case *ast.Var:
+			result = append(result, occurrence{n.Token, n.Id.Value, false})
+		}
+		return true
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].tok.Location.Start.Offset < result[j].tok.Location.Start.Offset
+	})
+	return file, result, nil
+}
+
+// find returns the identifier at a position, which may be just after its end like a cursor after a word.
+func find(occurrences []occurrence, line, column int) (occurrence, bool) {
+	for _, o := range occurrences {
+		start, end := o.tok.Location.Start, o.tok.Location.End
+		if start.Line == line && start.Column <= column && column <= end.Column {
+			return o, true
+		}
+	}
+	return occurrence{}, false
+}
+
+// identifier returns whether a name is an identifier of a variable, rather than a keyword or another token.
+func identifier(name string) bool {
+	tokens := syntax.NewLexer(syntax.NewDummySource(name)).LexAll()
+	return name != "_" && len(tokens) == 1 && tokens[0].Kind == syntax.Ident && tokens[0].Value == name
+}
+
+// declaration returns the first occurrence of a unique name, which is its declaration.
+func declaration(occurrences []occurrence, name string) occurrence {
+	for _, o := range occurrences {
+		if o.name == name {
+			return o
+		}
+	}
+	return occurrence{}
+}
+
+// bindings returns the index of the first identifier of the unique name of each identifier,
+// or -1 for an identifier which does not resolve.
+func bindings(occurrences []occurrence) []int {
+	first := map[string]int{}
+	result := make([]int, len(occurrences))
+	for i, o := range occurrences {
+		if o.name == "" {
+			result[i] = -1
+			continue
+		}
+		if _, ok := first[o.name]; !ok {
+			first[o.name] = i
+		}
+		result[i] = first[o.name]
+	}
+	return result
+}
+
+// conflicts returns the identifiers which resolve to other declarations after the renaming.
+func conflicts(before, after []occurrence, old, name string, renamed occurrence) error {
+	var result error
+	bindingsBefore, bindingsAfter := bindings(before), bindings(after)
+	// describe describes what an identifier resolves to at the positions of the code before the renaming.
+	describe := func(occurrences []occurrence, bindings []int, i int) string {
+		switch {
+		case bindings[i] < 0:
+			return "nothing"
+		case !strings.Contains(occurrences[i].name, "$"):
+			return fmt.Sprintf("the built-in '%s'", occurrences[i].name)
+		}
+		return fmt.Sprintf("the declaration at %s", before[bindings[i]].tok.Start())
+	}
+	for i, o := range before {
+		if bindingsBefore[i] == bindingsAfter[i] {
+			continue
+		}
+		var d *diag.Diagnostic
+		if o.declaration {
+			d = diag.Errorf(diag.RenameConflict, o.tok.Start(), o.tok.End(),
+				"cannot rename '%s' to '%s': the declaration of '%s' here would be a duplicate", old, name, after[i].tok.Value)
+		} else {
+			d = diag.Errorf(diag.RenameConflict, o.tok.Start(), o.tok.End(),
+				"cannot rename '%s' to '%s': '%s' here would refer to %s instead of %s", old, name, after[i].tok.Value,
+				describe(after, bindingsAfter, i), describe(before, bindingsBefore, i))
+		}
+		d.Note("the renamed declaration is at %s", renamed.tok.Start())
+		result = merror.Append(result, d)
+	}
+	return result
+}
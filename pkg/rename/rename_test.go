@@ -0,0 +1,121 @@
+package rename
+
+import (
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// rename renames the variable at a position of the lines, and returns the renamed code.
+func rename(t *testing.T, lines []string, line, column int, name string) (string, error) {
+	code := strings.Join(lines, "\n")
+	edits, err := Rename(syntax.NewDummySource(code), line, column, name)
+	if err != nil {
+		return "", err
+	}
+	return Apply(code, edits), nil
+}
+
+func TestRenameDeclarationAndReferences(t *testing.T) {
+	code, err := rename(t, []string{
+		"fun f 0 = 1 | f n = n * f (n - 1)",
+		"val n = f 3 (* not the parameter *)",
+		"val m = n + f n",
+	}, 1, 5, "fact")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"fun fact 0 = 1 | fact n = n * fact (n - 1)",
+		"val n = fact 3 (* not the parameter *)",
+		"val m = n + fact n",
+	}, "\n"), code)
+
+	// a reference renames its declaration, and only the variables of the same scope.
+	code, err = rename(t, []string{
+		"fun f 0 = 1 | f n = n * f (n - 1)",
+		"val n = f 3",
+	}, 1, 22, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "fun f 0 = 1 | f k = k * f (k - 1)\nval n = f 3", code)
+}
+
+func TestRenameExtern(t *testing.T) {
+	code, err := rename(t, []string{
+		`extern val exit : int -> unit = "os.Exit"`,
+		"val _ = exit 0",
+	}, 2, 9, "quit")
+	assert.NoError(t, err)
+	assert.Equal(t, "extern val quit : int -> unit = \"os.Exit\"\nval _ = quit 0", code)
+}
+
+func diagnostics(t *testing.T, err error) []*diag.Diagnostic {
+	if !assert.Error(t, err) {
+		t.FailNow()
+	}
+	return diag.From(err)
+}
+
+func TestRenameRefusesCapture(t *testing.T) {
+	_, err := rename(t, []string{
+		"val y = 1",
+		"fun f x = x + y",
+	}, 2, 7, "y")
+	ds := diagnostics(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Equal(t, diag.RenameConflict, ds[0].Code)
+		assert.Equal(t, "cannot rename 'x' to 'y': 'y' here would refer to the declaration at <dummy>:2:7 "+
+			"instead of the declaration at <dummy>:1:5", ds[0].Message)
+		assert.Equal(t, 2, ds[0].Span.Start.Line)
+		assert.Equal(t, 15, ds[0].Span.Start.Column)
+		assert.Equal(t, []string{"the renamed declaration is at <dummy>:2:7"}, ds[0].Notes)
+	}
+}
+
+func TestRenameRefusesShadowing(t *testing.T) {
+	// the reference to a after val b would refer to b.
+	_, err := rename(t, []string{
+		"val a = 1",
+		"val b = 2",
+		"val c = a + b",
+	}, 1, 5, "b")
+	ds := diagnostics(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Equal(t, 3, ds[0].Span.Start.Line)
+		assert.Equal(t, 9, ds[0].Span.Start.Column)
+	}
+
+	_, err = rename(t, []string{"fun f x y = x"}, 1, 7, "y")
+	ds = diagnostics(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Equal(t, "cannot rename 'x' to 'y': the declaration of 'y' here would be a duplicate", ds[0].Message)
+	}
+
+	// a built-in is shadowed by the renamed variable.
+	_, err = rename(t, []string{"fun f x = spawn x"}, 1, 7, "spawn")
+	ds = diagnostics(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Contains(t, ds[0].Message, "instead of the built-in 'spawn'")
+	}
+}
+
+func TestRenameInvalid(t *testing.T) {
+	for _, c := range []struct {
+		line, column  int
+		name, message string
+	}{
+		{1, 2, "b", "no variable to rename at 1:2"},
+		{1, 9, "b", "cannot rename the built-in 'spawn'"},
+		{1, 15, "b", "'undefined' is not declared"},
+		{1, 5, "end", "'end' is not a valid name of a variable"},
+		{1, 5, "_", "'_' is not a valid name of a variable"},
+		{1, 5, "a b", "'a b' is not a valid name of a variable"},
+	} {
+		_, err := rename(t, []string{"val a = spawn undefined"}, c.line, c.column, c.name)
+		ds := diagnostics(t, err)
+		if assert.Len(t, ds, 1) {
+			assert.Equal(t, diag.InvalidRename, ds[0].Code)
+			assert.Equal(t, c.message, ds[0].Message)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package repl implements the interactive loop of the language, which reads declarations and expressions,
+// evaluates them with the interpreter, and prints their values and types.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/eval"
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/lilac/fun-lang/pkg/types"
+	"io"
+	"os"
+	"strings"
+)
+
+// The prompts of the first line of an input, and of the next lines of an incomplete input.
+const (
+	Prompt       = "- "
+	Continuation = "= "
+)
+
+// REPL evaluates the inputs of an interactive session, where an input may refer to the declarations of the previous
+// ones. An input is declarations, an expression, whose value is declared as it, or one of the commands.
+//
+//	:type exp   print the type of an expression
+//	:load file  evaluate the declarations of a file
+//	:reset      forget all the declarations
+//	:quit       end the session
+type REPL struct {
+	options compiler.Options
+	out     io.Writer
+	session *compiler.Session
+	machine *eval.Machine
+}
+
+func New(options compiler.Options, out io.Writer) *REPL {
+	r := &REPL{options: options, out: out}
+	r.Reset()
+	return r
+}
+
+// Reset forgets the declarations of the previous inputs.
+func (r *REPL) Reset() {
+	r.session = compiler.NewSession(r.options)
+	r.machine = eval.NewMachine()
+}
+
+// Run reads the inputs until the end of in or :quit, where an input continues on the next lines while it is incomplete,
+// and prints the results, or the errors, of the inputs.
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var lines []string
+	fmt.Fprint(r.out, Prompt)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		input := strings.Join(lines, "\n")
+		if !strings.HasPrefix(strings.TrimSpace(input), ":") && Incomplete(input) {
+			fmt.Fprint(r.out, Continuation)
+			continue
+		}
+		lines = nil
+		if !r.Eval(input) {
+			return nil
+		}
+		fmt.Fprint(r.out, Prompt)
+	}
+	fmt.Fprintln(r.out)
+	return scanner.Err()
+}
+
+// Eval evaluates a complete input, and returns false if the input ends the session.
+func (r *REPL) Eval(input string) bool {
+	input = strings.TrimSpace(input)
+	switch {
+	case input == "":
+	case strings.HasPrefix(input, ":"):
+		return r.command(input[1:])
+	case isDeclaration(input):
+		r.exec(r.session.Lower, source(input, "<repl>"))
+	default:
+		r.exec(r.session.LowerExp, source(input, "<repl>"))
+	}
+	return true
+}
+
+// Load evaluates the declarations of a file.
+func (r *REPL) Load(file string) {
+	code, err := os.ReadFile(file)
+	if err != nil {
+		r.report(err)
+		return
+	}
+	r.exec(r.session.Lower, source(string(code), file))
+}
+
+func (r *REPL) command(input string) bool {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "type", "t":
+		t, err := r.session.TypeOf(source(arg, "<repl>"))
+		if err != nil {
+			r.report(err)
+			break
+		}
+		fmt.Fprintf(r.out, "%s : %s\n", arg, types.Scheme(t))
+	case "load", "l":
+		r.Load(arg)
+	case "reset":
+		r.Reset()
+	case "quit", "q":
+		return false
+	default:
+		fmt.Fprintf(r.out, "Unknown command :%s\n", name)
+	}
+	return true
+}
+
+// exec evaluates a module in the session, which lower compiles from the source, and prints the values of its declarations.
+func (r *REPL) exec(lower func(*syntax.Source) (*ir.Module, error), src *syntax.Source) {
+	module, err := lower(src)
+	if err != nil {
+		r.report(err)
+		return
+	}
+	bindings, err := r.machine.Exec(module)
+	for _, b := range bindings {
+		if b.Id.Name != "_" {
+			fmt.Fprintf(r.out, "val %s : %s = %s\n", b.Id.Name, types.Scheme(b.Type), eval.Format(b.Value))
+		}
+	}
+	if err != nil {
+		r.report(err)
+	}
+}
+
+// report prints an error, where the errors of a multierror, e.g. of the passes of the compiler, are printed like
+// the diagnostics of the check command.
+func (r *REPL) report(err error) {
+	var multi *merror.Error
+	if !errors.As(err, &multi) {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	for i, d := range diag.From(err) {
+		if i > 0 {
+			fmt.Fprintln(r.out)
+		}
+		fmt.Fprintln(r.out, strings.TrimRight(d.Error(), "\n"))
+	}
+}
+
+func source(code string, path string) *syntax.Source {
+	return &syntax.Source{Reader: strings.NewReader(code), Path: path}
+}
+
+// openers are the tokens which a token of closers must close.
+var (
+	openers = map[int]bool{syntax.Let: true, syntax.Select: true, syntax.LParen: true, syntax.LBracket: true}
+	closers = map[int]bool{syntax.End: true, syntax.RParen: true, syntax.RBracket: true}
+)
+
+// continuers are the tokens which an input cannot end with, since a part of an expression or a declaration must
+// follow them.
+var continuers = map[int]bool{
+	syntax.Val: true, syntax.Fun: true, syntax.And: true, syntax.Extern: true, syntax.Type: true,
+	syntax.Fn: true, syntax.If: true, syntax.Then: true, syntax.Else: true, syntax.In: true,
+	syntax.Equal: true, syntax.Arrow: true, syntax.MinusGreater: true, syntax.Bar: true, syntax.Comma: true,
+	syntax.Semicolon: true, syntax.Colon: true, syntax.Dot: true, syntax.Question: true, syntax.Bang: true,
+	syntax.Not: true, syntax.Plus: true, syntax.Minus: true, syntax.Star: true, syntax.Slash: true,
+	syntax.Percent: true, syntax.AndAnd: true, syntax.BarBar: true, syntax.Less: true, syntax.Greater: true,
+	syntax.LessEqual: true, syntax.GreaterEqual: true, syntax.LessGreater: true,
+}
+
+// Incomplete reports whether an input continues on the next line, i.e. a let, a select or a parenthesis of it is not
+// closed, or it ends with a keyword or an operator.
+func Incomplete(code string) bool {
+	depth, last := 0, 0
+	for _, tok := range tokens(code) {
+		switch {
+		case openers[tok.Kind]:
+			depth++
+		case closers[tok.Kind]:
+			depth--
+		}
+		last = tok.Kind
+	}
+	return depth > 0 || continuers[last]
+}
+
+// isDeclaration reports whether an input is declarations rather than an expression.
+func isDeclaration(code string) bool {
+	toks := tokens(code)
+	if len(toks) == 0 {
+		return false
+	}
+	switch toks[0].Kind {
+	case syntax.Val, syntax.Fun, syntax.Extern:
+		return true
+	}
+	return false
+}
+
+// tokens lexes an input except the comments.
+func tokens(code string) []*token.Token {
+	lexer := syntax.NewLexer(source(code, "<repl>"))
+	var result []*token.Token
+	for _, tok := range lexer.LexAll() {
+		if tok.Kind != syntax.Comment {
+			result = append(result, tok)
+		}
+	}
+	return result
+}
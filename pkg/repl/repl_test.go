@@ -0,0 +1,120 @@
+package repl
+
+import (
+	"bytes"
+	"github.com/lilac/fun-lang/pkg/compiler"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run runs a session on the lines, and returns the lines of its output without the prompts.
+func run(t *testing.T, lines ...string) []string {
+	var out bytes.Buffer
+	r := New(compiler.Options{}, &out)
+	err := r.Run(strings.NewReader(strings.Join(lines, "\n")))
+	assert.NoError(t, err)
+	var result []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimLeft(line, Prompt+Continuation)
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func TestIncomplete(t *testing.T) {
+	assert.False(t, Incomplete("val x = 1"))
+	assert.False(t, Incomplete("let val x = 1 in x end (* done *)"))
+	assert.True(t, Incomplete("let val x = 1"))
+	assert.True(t, Incomplete("let val x = 1 in"))
+	assert.True(t, Incomplete("select c ? x => x"))
+	assert.True(t, Incomplete("(1,"))
+	assert.True(t, Incomplete("fun f x ="))
+	assert.True(t, Incomplete("1 +"))
+}
+
+func TestRepl(t *testing.T) {
+	output := run(t,
+		"val x = 1 + 2",
+		"x * 2",
+		"fun id y = y",
+		"(id 1, id \"s\")",
+		"let val a = 1",
+		"  val b = 2",
+		"in a + b + x",
+		"end",
+		"fun fact 0 = 1 | fact n =",
+		"  n * fact (n - 1)",
+		"fact 5",
+		"fun const x y = x",
+		":type fn z => (z, id)",
+		`"tab\tquote\""`,
+	)
+	assert.Equal(t, []string{
+		"val x : int = 3",
+		"val it : int = 6",
+		"val id : 'a -> 'a = fn",
+		`val it : int * string = (1, "s")`,
+		"val it : int = 6",
+		"val fact : int -> int = fn",
+		"val it : int = 120",
+		// the type variables are named from 'a in each type, whatever the variables of the session are.
+		"val const : 'a -> 'b -> 'a = fn",
+		"fn z => (z, id) : 'a -> 'a * ('b -> 'b)",
+		`val it : string = "tab\tquote\""`,
+	}, output)
+}
+
+func TestReplErrors(t *testing.T) {
+	output := run(t,
+		"val x = 1",
+		"val y = x + true",
+		"1 / 0",
+		"x",
+		"x + \"s\"",
+	)
+	// the errors are printed like the diagnostics of the check command.
+	if assert.Len(t, output, 9) {
+		assert.Equal(t, "val x : int = 1", output[0])
+		assert.Equal(t, "Error: type mismatch: expected int, but got bool (at <repl>:1:13)", output[1])
+		assert.Equal(t, ">             ^^^^", output[3])
+		assert.Equal(t, "Runtime error: integer divide by zero", output[4])
+		assert.Equal(t, "val it : int = 1", output[5])
+		// an expression is not declared in the code of its error.
+		assert.Equal(t, "Error: type mismatch: expected int, but got string (at <repl>:1:5)", output[6])
+		assert.Equal(t, "> x + \"s\"", output[7])
+		assert.Equal(t, ">     ^^^", output[8])
+	}
+}
+
+func TestReplCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.fun")
+	err := os.WriteFile(file, []byte("fun double n = n * 2\nval ten = double 5\n"), 0644)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	output := run(t,
+		":load "+file,
+		":type double",
+		":type fn z => z + 1.0",
+		":reset",
+		"ten",
+		":what",
+		":quit",
+		"1",
+	)
+	if assert.Len(t, output, 8) {
+		assert.Equal(t, "val double : int -> int = fn", output[0])
+		assert.Equal(t, "val ten : int = 10", output[1])
+		assert.Equal(t, "double : int -> int", output[2])
+		assert.Equal(t, "fn z => z + 1.0 : float -> float", output[3])
+		// the position and the snippet are those of the input.
+		assert.Equal(t, "Error: Undefined variable 'ten' (at <repl>:1:1)", output[4])
+		assert.Equal(t, "> ten", output[5])
+		assert.Equal(t, "Unknown command :what", output[7])
+	}
+}
@@ -101,11 +101,12 @@ func NewIfThen(tok *token.Token, cond, then, els ast.Exp) *ast.IfThen {
 	}
 }
 
-func NewLet(tok *token.Token, dec []ast.Dec, exp ast.Exp) *ast.LetIn {
+func NewLet(tok *token.Token, dec []ast.Dec, exp ast.Exp, end *token.Token) *ast.LetIn {
 	return &ast.LetIn{
 		HasToken: ast.HasToken{Token: tok},
 		Decs:     dec,
 		Body:     exp,
+		EndToken: end,
 	}
 }
 
@@ -113,6 +114,14 @@ func NewVarPattern(tok *token.Token) *ast.VarPattern {
 	return &ast.VarPattern{HasToken: ast.HasToken{Token: tok}, Id: ast.Identifier{Name: tok.Value}}
 }
 
+func NewSelect(tok *token.Token, arms []ast.SelectArm, end *token.Token) *ast.Select {
+	return &ast.Select{HasToken: ast.HasToken{Token: tok}, Arms: arms, EndToken: end}
+}
+
+func NewCtorPattern(tok *token.Token, arg ast.Pattern) *ast.CtorPattern {
+	return &ast.CtorPattern{HasToken: ast.HasToken{Token: tok}, Ctor: ast.Identifier{Name: tok.Value}, Arg: arg}
+}
+
 func NewConstPattern(exp ast.Exp) *ast.ConstPattern {
 	return &ast.ConstPattern{Constant: exp.(ast.Constant)}
 }
@@ -133,9 +142,10 @@ func NewFn(tok *token.Token, matches []ast.Match) *ast.Fn {
 
 func NewValDec(tok *token.Token, body ast.Exp) ast.Dec {
 	return &ast.ValDec{
-		Vars: []ast.Var{},
-		Arg:  ast.Arg{Id: ast.Identifier{Name: tok.Value}, Type: nil},
-		Body: body,
+		HasToken: ast.HasToken{Token: tok},
+		Vars:     []ast.Var{},
+		Arg:      ast.Arg{Id: ast.Identifier{Name: tok.Value}, Type: nil},
+		Body:     body,
 	}
 }
 
@@ -155,3 +165,64 @@ func NewFunDec(binds []ast.FunBind) *ast.FunDec {
 		Binds: binds,
 	}
 }
+
+// NewFunDecs makes a function declaration, or a recursive declaration of the functions joined by 'and'.
+func NewFunDecs(binds [][]ast.FunBind) ast.Dec {
+	if len(binds) == 1 {
+		return NewFunDec(binds[0])
+	}
+	funs := make([]*ast.FunDec, len(binds))
+	for i, bind := range binds {
+		funs[i] = NewFunDec(bind)
+	}
+	return &ast.RecDec{Funs: funs}
+}
+
+func NewExternDec(tok *token.Token, id *token.Token, ty types.Type, goName *ast.String) *ast.ExternDec {
+	return &ast.ExternDec{
+		HasToken: ast.HasToken{Token: tok},
+		Arg:      ast.Arg{Id: ast.Identifier{Name: id.Value}, Type: ty},
+		GoName:   goName,
+	}
+}
+
+func NewExternTypeDec(tok *token.Token, id *token.Token, goName *ast.String) *ast.ExternTypeDec {
+	return &ast.ExternTypeDec{
+		HasToken: ast.HasToken{Token: tok},
+		Name:     ast.Identifier{Name: id.Value},
+		GoName:   goName,
+	}
+}
+
+func NewMember(typeTok *token.Token, nameTok *token.Token) *ast.Member {
+	return &ast.Member{
+		HasToken: ast.HasToken{Token: typeTok},
+		Type:     ast.Identifier{Name: typeTok.Value},
+		Name:     ast.Identifier{Name: nameTok.Value},
+		EndToken: nameTok,
+	}
+}
+
+// NewCtorType makes a type from a type constructor name, where primitive types are shared.
+func NewCtorType(tok *token.Token, args []types.Type) types.Type {
+	if len(args) == 0 {
+		switch tok.Value {
+		case "unit":
+			return types.UnitType
+		case "bool":
+			return types.BoolType
+		case "int":
+			return types.IntType
+		case "float":
+			return types.FloatType
+		case "string":
+			return types.StringType
+		case "char":
+			return types.CharType
+		}
+	}
+	return &types.CtorType{
+		Ctor: tok.Value,
+		Args: args,
+	}
+}
@@ -0,0 +1,242 @@
+package syntax
+
+import "strings"
+
+// The syntax errors of goyacc name at most four expected tokens, and none if the state of the error reduces by
+// default, e.g. after an expression which may go on with an operator. So the lexer replays the tokens on the tables
+// of the parser to find the tokens which the parser can shift after the reductions of the state of an error.
+
+// automaton runs the tables of the parser on the kinds of tokens like funParserImpl.Parse, without the actions
+// of the rules but with the recovery from errors.
+type automaton struct {
+	stack   []int // the states of the parser
+	errflag int   // the number of tokens to shift until the parser reports errors again
+}
+
+// run parses the kinds of tokens, and calls onError with the stack and the token of each error which the parser
+// reports. It stops when it needs a token after the kinds, or when the parser accepts or aborts.
+// It returns true if the parser aborts in the recovery of an error at the end of file.
+func (a *automaton) run(kinds []int, onError func(stack []int, tok int)) bool {
+	a.stack = []int{0}
+	for len(kinds) > 0 || !needsToken(a.top()) {
+		tok := -1
+		if len(kinds) > 0 {
+			tok = translate(kinds[0])
+		}
+		if next, ok := shift(a.top(), tok); ok {
+			a.stack = append(a.stack, next)
+			kinds = kinds[1:]
+			if a.errflag > 0 {
+				a.errflag--
+			}
+			continue
+		}
+		rule := reduction(a.top(), tok)
+		switch {
+		case rule < 0:
+			return false
+		case rule > 0:
+			a.reduce(rule)
+			continue
+		}
+		switch a.errflag {
+		case 0:
+			onError(a.stack, tok)
+			fallthrough
+		case 1, 2:
+			a.errflag = 3
+			if !a.recover() {
+				return false
+			}
+		case 3:
+			if tok == funEofCode {
+				return true
+			}
+			kinds = kinds[1:]
+		}
+	}
+	return false
+}
+
+func (a *automaton) top() int {
+	return a.stack[len(a.stack)-1]
+}
+
+// reduce pops the states of the right side of a rule, and goes to the state after its left side.
+func (a *automaton) reduce(rule int) {
+	a.stack = a.stack[:len(a.stack)-int(funR2[rule])]
+	a.stack = append(a.stack, goTo(a.top(), int(funR1[rule])))
+}
+
+// recover pops the states until one shifts the error token, and shifts it. It returns false if no state does.
+func (a *automaton) recover() bool {
+	for len(a.stack) > 0 {
+		if next, ok := shift(a.top(), funErrCode); ok {
+			a.stack = append(a.stack, next)
+			return true
+		}
+		a.stack = a.stack[:len(a.stack)-1]
+	}
+	return false
+}
+
+// needsToken tells whether the parser reads the next token in a state, i.e. the state is not simple.
+func needsToken(state int) bool {
+	return int(funPact[state]) > funFlag || funDef[state] == -2
+}
+
+// translate maps the kind of a token to its number in the tables like funlex1.
+func translate(char int) int {
+	tok := 0
+	switch {
+	case char <= 0:
+		tok = int(funTok1[0])
+	case char < len(funTok1):
+		tok = int(funTok1[char])
+	case char >= funPrivate && char < funPrivate+len(funTok2):
+		tok = int(funTok2[char-funPrivate])
+	default:
+		for i := 0; i < len(funTok3); i += 2 {
+			if int(funTok3[i]) == char {
+				tok = int(funTok3[i+1])
+				break
+			}
+		}
+	}
+	if tok == 0 {
+		tok = int(funTok2[1])
+	}
+	return tok
+}
+
+// shift returns the state after a token if the state shifts it.
+func shift(state, tok int) (int, bool) {
+	base := int(funPact[state])
+	if base <= funFlag || tok < 0 {
+		return 0, false
+	}
+	if n := base + tok; n >= 0 && n < funLast {
+		if next := int(funAct[n]); int(funChk[next]) == tok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// reduction returns the rule by which a state reduces before a token, 0 on an error and -1 on the acceptance.
+func reduction(state, tok int) int {
+	rule := int(funDef[state])
+	if rule != -2 {
+		return rule
+	}
+	i := 0
+	for funExca[i] != -1 || int(funExca[i+1]) != state {
+		i += 2
+	}
+	for i += 2; funExca[i] >= 0 && int(funExca[i]) != tok; i += 2 {
+	}
+	return int(funExca[i+1])
+}
+
+// goTo returns the state after the nonterminal of a rule in a state.
+func goTo(state, nonterminal int) int {
+	g := int(funPgo[nonterminal])
+	if j := g + state + 1; j < funLast {
+		if next := int(funAct[j]); int(funChk[next]) == -nonterminal {
+			return next
+		}
+	}
+	return int(funAct[g])
+}
+
+// accepts tells whether the parser shifts a token in the state on the top of a stack, after its reductions.
+func accepts(stack []int, tok int) bool {
+	a := &automaton{stack: append([]int(nil), stack...)}
+	for {
+		if _, ok := shift(a.top(), tok); ok {
+			return true
+		}
+		rule := reduction(a.top(), tok)
+		if rule <= 0 {
+			return rule < 0
+		}
+		a.reduce(rule)
+	}
+}
+
+// tokenGroups name the sets of tokens which an error names as one if the parser expects all of them,
+// and some of them are not named by a group before.
+var tokenGroups = []struct {
+	name  string
+	kinds []int
+}{
+	{"an operator", []int{Plus, Minus, Star, Slash, Percent, Equal, LessGreater, Less, LessEqual, Greater,
+		GreaterEqual, AndAnd, BarBar}},
+	{"an expression", []int{LParen, Ident, Bool, Int, Float, StringLiteral, Not, Minus, If, Let, Fn, Select}},
+	{"an argument", []int{LParen, Ident, Bool, Int, Float, StringLiteral}},
+}
+
+// expecting returns the names of the tokens other than the end of file which the parser shifts in the state
+// on the top of a stack, e.g. "end or an operator".
+func expecting(stack []int) string {
+	expected := map[int]bool{}
+	var toks []int
+	for tok := 4; tok-1 < len(funToknames); tok++ {
+		// the lexer makes ExpStart, which is never in the input.
+		if tok != translate(ExpStart) && accepts(stack, tok) {
+			expected[tok] = true
+			toks = append(toks, tok)
+		}
+	}
+	var names []string
+	grouped := map[int]bool{}
+	for _, group := range tokenGroups {
+		all, named := true, true
+		for _, kind := range group.kinds {
+			all = all && expected[translate(kind)]
+			named = named && grouped[translate(kind)]
+		}
+		if all && !named {
+			names = append(names, group.name)
+			for _, kind := range group.kinds {
+				grouped[translate(kind)] = true
+			}
+		}
+	}
+	var single []string
+	for _, tok := range toks {
+		if !grouped[tok] {
+			single = append(single, funTokname(tok))
+		}
+	}
+	return strings.Join(append(single, names...), " or ")
+}
+
+// syntaxError returns the message of the error of the parser at the last one of the kinds of tokens.
+func syntaxError(kinds []int) string {
+	tok, expected := 0, ""
+	(&automaton{}).run(kinds, func(stack []int, t int) {
+		tok, expected = t, expecting(stack)
+	})
+	return unexpected(tok, expected)
+}
+
+// unfinished returns the message of an error at the end of file, where the parser aborts in the recovery of an
+// earlier error, e.g. in a let expression without its end. It is empty if the parser does not abort there,
+// or reports the end of file itself.
+func unfinished(kinds []int) string {
+	a := &automaton{}
+	last := 0
+	if !a.run(kinds, func(_ []int, tok int) { last = tok }) || last == funEofCode {
+		return ""
+	}
+	return unexpected(funEofCode, expecting(a.stack))
+}
+
+func unexpected(tok int, expected string) string {
+	msg := "syntax error: unexpected " + funTokname(tok)
+	if expected != "" {
+		msg += ", expecting " + expected
+	}
+	return msg
+}
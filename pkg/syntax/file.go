@@ -0,0 +1,277 @@
+package syntax
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
+	"strings"
+)
+
+// File is a parsed file with the tokens of its code, which keep the trivia before them, i.e. the spaces
+// and the comments. The tokens and the trivia at the end reproduce the code of the file byte for byte,
+// if the lexer has read the whole file, e.g. there is no illegal token.
+//
+// The nodes of the module have the exact ranges of their tokens in the file, including the parentheses
+// around them, e.g. of (f x) + (1, 2), so that the tools make minimal edits of the code.
+type File struct {
+	Module   *ast.Module
+	Tokens   []*token.Token
+	Trailing string // the trivia after the last token
+
+	index  map[*token.Token]int // the indices of the tokens
+	parens []int                // the index of the matching parenthesis of a parenthesis, or -1
+}
+
+func newFile(module *ast.Module, tokens []*token.Token, trailing string) *File {
+	f := &File{Module: module, Tokens: tokens, Trailing: trailing, index: map[*token.Token]int{}}
+	f.parens = make([]int, len(tokens))
+	var open []int
+	for i, tok := range tokens {
+		f.index[tok] = i
+		f.parens[i] = -1
+		switch tok.Kind {
+		case LParen:
+			open = append(open, i)
+		case RParen:
+			if len(open) > 0 {
+				j := open[len(open)-1]
+				open = open[:len(open)-1]
+				f.parens[i], f.parens[j] = j, i
+			}
+		}
+	}
+	return f
+}
+
+// Code returns the code of the file, i.e. its tokens with their trivia.
+func (f *File) Code() string {
+	var buf strings.Builder
+	for _, tok := range f.Tokens {
+		buf.WriteString(tok.Leading)
+		buf.WriteString(tok.Value)
+	}
+	buf.WriteString(f.Trailing)
+	return buf.String()
+}
+
+// Range returns the indices of the first and the last tokens of an expression, a pattern or a declaration,
+// or false if it is not a node of the file.
+func (f *File) Range(node interface{}) (int, int, bool) {
+	first, last := f.bounds(node)
+	if first < 0 || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// Span returns the start and the end of the code of a node, without the trivia before it.
+func (f *File) Span(node interface{}) (locerr.Pos, locerr.Pos, bool) {
+	first, last, ok := f.Range(node)
+	if !ok {
+		return locerr.Pos{}, locerr.Pos{}, false
+	}
+	return f.Tokens[first].Start(), f.Tokens[last].End(), true
+}
+
+// Text returns the code of a node as it is in the file, with the trivia between its tokens.
+func (f *File) Text(node interface{}) string {
+	first, last, ok := f.Range(node)
+	if !ok {
+		return ""
+	}
+	var buf strings.Builder
+	for i := first; i <= last; i++ {
+		if i > first {
+			buf.WriteString(f.Tokens[i].Leading)
+		}
+		buf.WriteString(f.Tokens[i].Value)
+	}
+	return buf.String()
+}
+
+// bounds returns the indices of the first and the last tokens of a node, with the parentheses around it.
+// An index is -1 if it is unknown.
+func (f *File) bounds(node interface{}) (int, int) {
+	first, last := f.inner(node)
+	if _, ok := node.(ast.Dec); ok || first < 0 || last < 0 {
+		return first, last
+	}
+	for first > 0 && last+1 < len(f.Tokens) && f.Tokens[first-1].Kind == LParen && f.parens[first-1] == last+1 {
+		first, last = first-1, last+1
+	}
+	return first, last
+}
+
+// inner returns the indices of the first and the last tokens of a node without the parentheses around it.
+func (f *File) inner(node interface{}) (int, int) {
+	switch n := node.(type) {
+	case *ast.Unit:
+		// the unit is the parentheses, or an erroneous expression from its first token
+		i := f.at(n.Token)
+		if i >= 0 && f.Tokens[i].Kind == LParen {
+			return i, f.parens[i]
+		}
+		return i, i
+	case *ast.Bool:
+		return f.token(n.Token)
+	case *ast.Int:
+		return f.token(n.Token)
+	case *ast.Float:
+		return f.token(n.Token)
+	case *ast.String:
+		return f.token(n.Token)
+	case *ast.Var:
+		return f.token(n.Token)
+	case *ast.Member:
+		return f.at(n.Token), f.at(n.EndToken)
+	case *ast.Not:
+		return f.from(n.Token, n.Child)
+	case *ast.Neg:
+		return f.from(n.Token, n.Child)
+	case *ast.InfixApp:
+		return f.between(n.Left, n.Right)
+	case *ast.Apply:
+		return f.between(n.Fun, n.Arg)
+	case *ast.Tuple:
+		return f.between(n.Elements[0], n.Elements[len(n.Elements)-1])
+	case *ast.Sequence:
+		return f.between(n.Elements[0], n.Elements[len(n.Elements)-1])
+	case *ast.IfThen:
+		return f.from(n.Token, n.Else)
+	case *ast.LetIn:
+		return f.at(n.Token), f.at(n.EndToken)
+	case *ast.Fn:
+		return f.from(n.Token, n.Matches[len(n.Matches)-1].Exp)
+	case *ast.Select:
+		return f.at(n.Token), f.at(n.EndToken)
+	case *ast.ConstPattern:
+		return f.bounds(n.Constant)
+	case *ast.VarPattern:
+		return f.token(n.Token)
+	case *ast.CtorPattern:
+		return f.from(n.Token, n.Arg)
+	case *ast.ValDec:
+		// from 'val' before the name
+		first, _ := f.token(n.Token)
+		_, last := f.bounds(n.Body)
+		return first - 1, last
+	case *ast.FunDec:
+		// from 'fun', or 'and' of a recursive declaration, before the name
+		first, _ := f.token(n.Binds[0].Token)
+		_, last := f.bounds(n.Binds[len(n.Binds)-1].Exp)
+		return first - 1, last
+	case *ast.RecDec:
+		first, _ := f.bounds(n.Funs[0])
+		_, last := f.bounds(n.Funs[len(n.Funs)-1])
+		return first, last
+	case *ast.ExternDec:
+		return f.at(n.Token), f.at(n.GoName.Token)
+	case *ast.ExternTypeDec:
+		return f.at(n.Token), f.at(n.GoName.Token)
+	}
+	return -1, -1
+}
+
+// at returns the index of a token, or -1 if it is not a token of the file.
+func (f *File) at(tok *token.Token) int {
+	if i, ok := f.index[tok]; ok {
+		return i
+	}
+	return -1
+}
+
+func (f *File) token(tok *token.Token) (int, int) {
+	i := f.at(tok)
+	return i, i
+}
+
+// from returns the range from a token to the end of a node.
+func (f *File) from(tok *token.Token, node interface{}) (int, int) {
+	_, last := f.bounds(node)
+	return f.at(tok), last
+}
+
+// between returns the range from the start of a node to the end of another one.
+func (f *File) between(a, b interface{}) (int, int) {
+	first, _ := f.bounds(a)
+	_, last := f.bounds(b)
+	return first, last
+}
+
+// docs returns the documentation comments of the top-level declarations, where a comment (** ... *) on its own
+// lines documents the declaration after it unless there is another comment or a blank line between them.
+func (f *File) docs() map[ast.Dec]string {
+	docs := map[ast.Dec]string{}
+	attach := func(dec ast.Dec) {
+		if text, ok := f.doc(dec); ok {
+			docs[dec] = text
+		}
+	}
+	for _, dec := range f.Module.Decs {
+		switch d := dec.(type) {
+		case *ast.RecDec:
+			for _, fun := range d.Funs {
+				attach(fun)
+			}
+		default:
+			attach(dec)
+		}
+	}
+	return docs
+}
+
+// doc returns the text of the documentation comment of a declaration.
+func (f *File) doc(dec ast.Dec) (string, bool) {
+	first, _, ok := f.Range(dec)
+	if !ok {
+		return "", false
+	}
+	tok := f.Tokens[first]
+	var prev locerr.Pos
+	if first > 0 {
+		prev = f.Tokens[first-1].End()
+	}
+	// the last comment between the previous token and the declaration
+	var comment *token.Token
+	for _, c := range f.Module.Comments {
+		if c.Start().Offset >= prev.Offset && c.Start().Offset < tok.Start().Offset {
+			comment = c
+		}
+	}
+	if comment == nil || !isDocComment(comment.Value) || tok.Start().Line-comment.End().Line > 1 ||
+		first > 0 && comment.Start().Line == prev.Line {
+		return "", false
+	}
+	return docText(comment.Value), true
+}
+
+// isDocComment returns whether a comment is a documentation comment, e.g. (** doc *), but not (**) or (*** ***).
+func isDocComment(comment string) bool {
+	return strings.HasPrefix(comment, "(**") && !strings.HasPrefix(comment, "(***") && comment != "(**)"
+}
+
+// docText returns the text of a documentation comment without its delimiters, the blank lines around it and the
+// indentation which its lines have in common, e.g. of the lines after the first one.
+func docText(comment string) string {
+	lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(comment, "(**"), "*)"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	lines[0] = strings.TrimLeft(lines[0], " \t")
+	indent := -1
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,129 @@
+package syntax
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func parseFile(t *testing.T, code string) *File {
+	file, err := ParseFile(NewDummySource(code))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return file
+}
+
+func TestFileReproducesCode(t *testing.T) {
+	for _, code := range []string{
+		"",
+		"  \n(* only a comment *)\n",
+		"(* head *)\nval a = 1 (* one *) +\t2\r\nval b =(a)  \n\n(* tail *)  ",
+		"fun f 0 = 1\n  | f n = n * f (n - 1)\n\nval s = select c ? x => x | else => () end",
+	} {
+		assert.Equal(t, code, parseFile(t, code).Code())
+	}
+}
+
+func TestFileReproducesTestData(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("test-data", "*.*ml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		code, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the files may have syntax errors, but the lexer reads them to the end.
+		file, _ := ParseFile(NewDummySource(string(code)))
+		assert.Equal(t, string(code), file.Code(), name)
+	}
+}
+
+func TestFileRanges(t *testing.T) {
+	file := parseFile(t, "val a = ((f) x) + (1, (2))\nfun g (Ok x) = x | g _ = (  )")
+	val := file.Module.Decs[0].(*ast.ValDec)
+	infix := val.Body.(*ast.InfixApp)
+	assert.Equal(t, "val a = ((f) x) + (1, (2))", file.Text(val))
+	assert.Equal(t, "((f) x) + (1, (2))", file.Text(infix))
+	assert.Equal(t, "((f) x)", file.Text(infix.Left))
+	assert.Equal(t, "(f)", file.Text(infix.Left.(*ast.Apply).Fun))
+	assert.Equal(t, "(1, (2))", file.Text(infix.Right))
+	assert.Equal(t, "(2)", file.Text(infix.Right.(*ast.Tuple).Elements[1]))
+
+	fun := file.Module.Decs[1].(*ast.FunDec)
+	assert.Equal(t, "fun g (Ok x) = x | g _ = (  )", file.Text(fun))
+	assert.Equal(t, "(Ok x)", file.Text(fun.Binds[0].Patterns[0]))
+	assert.Equal(t, "(  )", file.Text(fun.Binds[1].Exp))
+
+	start, end, ok := file.Span(infix.Right)
+	if assert.True(t, ok) {
+		assert.Equal(t, 19, start.Column)
+		assert.Equal(t, 27, end.Column)
+	}
+	_, _, ok = file.Range(&ast.Var{})
+	assert.False(t, ok)
+}
+
+func TestTokensKeepTrivia(t *testing.T) {
+	file := parseFile(t, "val a = (* one *)\n  1")
+	assert.Equal(t, []string{"", " ", " ", " (* one *)\n  "}, leadings(file))
+	assert.Equal(t, "", file.Trailing)
+}
+
+func leadings(file *File) []string {
+	result := make([]string, len(file.Tokens))
+	for i, tok := range file.Tokens {
+		result[i] = tok.Leading
+	}
+	return result
+}
+
+func TestDocComments(t *testing.T) {
+	module := parseFile(t, `(* not a doc *)
+(** The answer. *)
+val answer = 42
+(** Doubles a number,
+    e.g. twice 2 = 4.
+
+    It is not recursive. *)
+fun twice n = n * 2
+
+(** Detached by a blank line. *)
+
+val a = 1 (** trailing *)
+val b = 2
+(** even *)
+fun even n = n = 0 || odd (n - 1)
+(** odd *)
+and odd n = n <> 0 && even (n - 1)
+(** The exit of the os. *)
+(* a comment after it *)
+extern val exit : int -> unit = "os.Exit"
+(**) (*** not a doc ***)
+extern type builder = "strings.Builder"
+(** The square root. *)
+extern val sqrt : float -> float = "math.Sqrt"
+`).Module
+	docs := map[string]string{}
+	for dec, text := range module.Docs {
+		switch d := dec.(type) {
+		case *ast.ValDec:
+			docs[d.Arg.Id.Name] = text
+		case *ast.FunDec:
+			docs[d.Binds[0].Id.Name] = text
+		default:
+			docs[dec.Kind()] = text
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"answer": "The answer.",
+		"twice":  "Doubles a number,\ne.g. twice 2 = 4.\n\nIt is not recursive.",
+		"even":   "even",
+		"odd":    "odd",
+		"extern": "The square root.",
+	}, docs)
+}
@@ -12,6 +12,7 @@ package syntax
 import (
 	"github.com/lilac/fun-lang/pkg/token"
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/types"
 )
 %}
 
@@ -22,8 +23,13 @@ import (
 	patterns []ast.Pattern
 	match []ast.Match
 	funBind	[]ast.FunBind
+	funBinds [][]ast.FunBind
 	dec []ast.Dec
 	mod *ast.Module
+	ty types.Type
+	tys []types.Type
+	arm *ast.SelectArm
+	arms []ast.SelectArm
 }
 
 %token<token> Illegal
@@ -72,6 +78,12 @@ import (
 %token<token> Type
 %token<token> LBracket
 %token<token> RBracket
+%token<token> Extern
+%token<token> Select
+%token<token> Question
+%token<token> Bang
+%token<token> And
+%token<token> ExpStart
 
 %right prec_if
 %right prec_fn
@@ -90,10 +102,15 @@ import (
 %type<mod> module
 %type<dec> dec
 %type<exp> exp con simple_exp
-%type<pattern> pattern
+%type<pattern> atom_pattern pattern
 %type<match> match
 %type<patterns> patterns
 %type<funBind> fun_bind
+%type<funBinds> fun_binds
+%type<ty> ty tuple_ty app_ty atom_ty
+%type<tys> star_tys comma_tys
+%type<arm> select_arm
+%type<arms> select_arms
 
 %start module
 
@@ -102,9 +119,14 @@ import (
 module:
 	dec
 	{
-	 	$$ = &ast.Module{$1}
+	 	$$ = &ast.Module{Decs: $1}
 	 	funrcvr.lval.mod = $$
 	}
+|	ExpStart exp
+	{
+		/* the lexer starts an expression by ExpStart, which the input does not contain. */
+		funrcvr.lval.exp = $2
+	}
 
 dec:
 	/* empty */
@@ -114,11 +136,30 @@ dec:
  		dec := NewValDec($3, $5)
  		$$ = append($1, dec)
  	}
-|	dec Fun fun_bind
+|	dec Fun fun_binds
+	{
+		dec := NewFunDecs($3)
+		$$ = append($1, dec)
+	}
+|	dec Extern Val Ident Colon ty Equal StringLiteral
+	{
+		dec := NewExternDec($2, $4, $6, NewString($8, errorAt(funlex, $8)))
+		$$ = append($1, dec)
+	}
+|	dec Extern Type Ident Equal StringLiteral
 	{
-		dec := NewFunDec($3)
+		dec := NewExternTypeDec($2, $4, NewString($6, errorAt(funlex, $6)))
 		$$ = append($1, dec)
 	}
+|	dec error
+	/* skips an erroneous declaration up to the next one, e.g. at val or fun, so that the parser reports more errors */
+	{ $$ = $1 }
+
+fun_binds:
+	fun_bind
+	{ $$ = [][]ast.FunBind{$1} }
+|	fun_binds And fun_bind
+	{ $$ = append($1, $3) }
 
 fun_bind:
 	Ident patterns Equal exp
@@ -133,9 +174,9 @@ fun_bind:
 	}
 
 patterns:
-	pattern
+	atom_pattern
 	{ $$ = []ast.Pattern{$1} }
-|	patterns pattern
+|	patterns atom_pattern
 	{ $$ = append($1, $2) }
 
 simple_exp:
@@ -143,8 +184,13 @@ simple_exp:
 	{ $$ = $1 }
 |	Ident
 	{ $$ = NewVar($1) }
+|	Ident Dot Ident
+	{ $$ = NewMember($1, $3) }
 |	LParen exp RParen
 	{ $$ = $2 }
+|	LParen error RParen
+	/* an erroneous expression is a unit, which is never compiled since the module has errors */
+	{ $$ = NewUnit($1) }
 
 exp:
 	simple_exp
@@ -186,6 +232,8 @@ exp:
 	{ $$ = NewTuple($1, $3) }
 |	exp Semicolon exp
 	{ $$ = NewSequence($1, $3) }
+|	exp Semicolon error
+	{ $$ = $1 }
 |	exp simple_exp
 	%prec prec_app
 	{ $$ = &ast.Apply{$1, $2} }
@@ -194,10 +242,30 @@ exp:
 	%prec prec_if
 	{ $$ = NewIfThen($1, $2, $4, $6) }
 |	Let dec In exp End
-	{ $$ = NewLet($1, $2, $4) }
+	{ $$ = NewLet($1, $2, $4, $5) }
+|	Let dec In error End
+	{ $$ = NewUnit($1) }
 |	Fn match
 	%prec prec_fn
 	{ $$ = NewFn($1, $2) }
+|	Select select_arms End
+	{ $$ = NewSelect($1, $2, $3) }
+|	Select error End
+	{ $$ = NewUnit($1) }
+
+select_arms:
+	select_arm
+	{ $$ = []ast.SelectArm{*$1} }
+|	select_arms Bar select_arm
+	{ $$ = append($1, *$3) }
+
+select_arm:
+	simple_exp Question pattern Arrow exp
+	{ $$ = &ast.SelectArm{Chan: $1, Pattern: $3, Exp: $5} }
+|	simple_exp Bang simple_exp Arrow exp
+	{ $$ = &ast.SelectArm{Chan: $1, Value: $3, Exp: $5} }
+|	Else Arrow exp
+	{ $$ = &ast.SelectArm{Exp: $3} }
 
 match:
 	pattern Arrow exp
@@ -212,10 +280,56 @@ match:
 	}
 
 pattern:
+	atom_pattern
+	{ $$ = $1 }
+|	Ident atom_pattern
+	{ $$ = NewCtorPattern($1, $2) }
+
+atom_pattern:
 	con
 	{ $$ = NewConstPattern($1) }
 |	Ident
 	{ $$ = NewVarPattern($1) }
+|	LParen pattern RParen
+	{ $$ = $2 }
+
+ty:
+	tuple_ty
+	{ $$ = $1 }
+|	tuple_ty MinusGreater ty
+	{ $$ = types.Arrow($1, $3) }
+
+tuple_ty:
+	app_ty
+	{ $$ = $1 }
+|	star_tys
+	{ $$ = types.TupleType($1) }
+
+star_tys:
+	app_ty Star app_ty
+	{ $$ = []types.Type{$1, $3} }
+|	star_tys Star app_ty
+	{ $$ = append($1, $3) }
+
+app_ty:
+	atom_ty
+	{ $$ = $1 }
+|	app_ty Ident
+	{ $$ = NewCtorType($2, []types.Type{$1}) }
+|	LParen ty Comma comma_tys RParen Ident
+	{ $$ = NewCtorType($6, append([]types.Type{$2}, $4...)) }
+
+comma_tys:
+	ty
+	{ $$ = []types.Type{$1} }
+|	comma_tys Comma ty
+	{ $$ = append($1, $3) }
+
+atom_ty:
+	Ident
+	{ $$ = NewCtorType($1, nil) }
+|	LParen ty RParen
+	{ $$ = $2 }
 
 con:
 	LParen RParen
@@ -223,11 +337,11 @@ con:
 |	Bool
 	{ $$ = NewBool($1) }
 |	Int
-	{ $$ = NewInt($1, funlex.Error) }
+	{ $$ = NewInt($1, errorAt(funlex, $1)) }
 |	Float
-	{ $$ = NewFloat($1, funlex.Error) }
+	{ $$ = NewFloat($1, errorAt(funlex, $1)) }
 |	StringLiteral
-	{ $$ = NewString($1, funlex.Error) }
+	{ $$ = NewString($1, errorAt(funlex, $1)) }
 %%
 
 // The parser expects the lexer to return 0 on the end of file.
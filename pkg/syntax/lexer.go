@@ -3,7 +3,9 @@ package syntax
 import (
 	"bufio"
 	"fmt"
+	"github.com/lilac/fun-lang/pkg/diag"
 	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
 	"io"
 	"unicode"
 	"unicode/utf8"
@@ -16,23 +18,54 @@ type Lexer struct {
 	state   stateFn
 	start   token.Position
 	current token.Position
-	src     string // the path to the source code
+	src     string         // the path to the source code
+	file    *locerr.Source // the code which has been read, for the snippets of errors
 	input   io.RuneReader
 	token   *token.Token
 	buffer  []rune // partial runes of the current token being parsed
 	top     rune
 	eof     bool
-	OnError ErrorFun // error listener
-}
-
+	OnError ErrorListener // error listener
+	// Comments are the comments which Lex has skipped, in the order of the source.
+	Comments []*token.Token
+	trivia   []rune         // the spaces before the current token
+	skipped  string         // the trivia and the comments which Lex has skipped since the last token
+	tokens   []*token.Token // the tokens which Lex has returned
+	lead     int            // the kind of the token which Lex returns before the input, e.g. ExpStart, or 0
+	led      bool           // whether Lex has returned the lead
+}
+
+// ErrorListener receives an error of the lexer or the parser with its diagnostic code, e.g. diag.SyntaxError,
+// and the span of the code where it occurs.
+type ErrorListener = func(code string, start, end locerr.Pos, msg string)
+
+// Lex returns the next token of the grammar to the parser. It keeps the comments as trivia, which the parser
+// never sees, e.g. for the formatter.
 func (l *Lexer) Lex(lval *funSymType) int {
-	if l.state != nil && l.Next() != nil {
+	if l.lead != 0 && !l.led {
+		l.led = true
+		return l.lead
+	}
+	for l.state != nil && l.Next() != nil {
+		if l.token.Kind == Comment {
+			l.Comments = append(l.Comments, l.token)
+			l.skipped += l.token.Leading + l.token.Value
+			continue
+		}
+		l.token.Leading = l.skipped + l.token.Leading
+		l.skipped = ""
+		l.tokens = append(l.tokens, l.token)
 		lval.token = l.token
 		return lval.token.Kind
 	}
 	return Eof
 }
 
+// Trailing returns the trivia after the last token which Lex has returned, at the end of the file.
+func (l *Lexer) Trailing() string {
+	return l.skipped + string(l.trivia)
+}
+
 // Next consumes the input until a token is parsed, and nil is returned when end of file reached.
 func (l *Lexer) Next() *token.Token {
 	l.token = nil // reset the current token
@@ -42,13 +75,52 @@ func (l *Lexer) Next() *token.Token {
 	return l.token
 }
 
+// Error reports a syntax error at the last token to the error listener, or at the current position at the end of file.
+// An error at an illegal token is not reported, since the lexer has reported it.
+// The message of the parser is replaced by one which names all the tokens that the parser expects.
 func (l Lexer) Error(s string) {
-	fmt.Printf("Parsing error near %s(%v): %s\n", l.src, l.current, s)
+	s = syntaxError(l.kinds())
+	if l.token == nil {
+		pos := l.position(l.current)
+		l.report(diag.SyntaxError, pos, pos, s)
+	} else if l.token.Kind != Illegal {
+		l.report(diag.SyntaxError, l.token.Start(), l.token.End(), s)
+	}
+}
+
+// kinds returns the kinds of the tokens which Lex has returned, and the end of file after them if Lex has returned it.
+func (l Lexer) kinds() []int {
+	kinds := make([]int, 0, len(l.tokens)+2)
+	if l.led {
+		kinds = append(kinds, l.lead)
+	}
+	for _, tok := range l.tokens {
+		kinds = append(kinds, tok.Kind)
+	}
+	if l.token == nil {
+		kinds = append(kinds, Eof)
+	}
+	return kinds
+}
+
+// report reports an error to the error listener, or drops it if there is no listener.
+func (l Lexer) report(code string, start, end locerr.Pos, msg string) {
 	if l.OnError != nil {
-		l.OnError(s)
+		l.OnError(code, start, end, msg)
+	}
+}
+
+// errorAt returns the handler of the errors of a token, e.g. of an invalid literal.
+func (l *Lexer) errorAt(tok *token.Token) ErrorFun {
+	return func(msg string) {
+		l.report(diag.InvalidLiteral, tok.Start(), tok.End(), msg)
 	}
 }
 
+func (l Lexer) position(pos token.Position) locerr.Pos {
+	return locerr.Pos{Offset: pos.Offset, Line: pos.Line, Column: pos.Column, File: l.file}
+}
+
 func (l Lexer) Current() token.Position {
 	return l.current
 }
@@ -63,6 +135,7 @@ func (l Lexer) newToken(kind int) *token.Token {
 		Start: l.start,
 		End:   l.current,
 		Path:  l.src,
+		File:  l.file,
 	}
 	tok.Kind = kind
 	return tok
@@ -80,6 +153,7 @@ func NewLexer(src *Source) *Lexer {
 		current: start,
 		input:   bufio.NewReader(src.Reader),
 		src:     src.Path,
+		file:    &locerr.Source{Path: src.Path},
 		buffer:  nil,
 	}
 	// Look ahead to start parsing
@@ -102,6 +176,8 @@ func (l *Lexer) LexAll() []*token.Token {
 
 func (l *Lexer) emit(kind int) {
 	l.token = l.newToken(kind)
+	l.token.Leading = string(l.trivia)
+	l.trivia = nil
 	// reset the start position
 	l.start = l.current
 	l.buffer = nil // reset the buffer
@@ -145,6 +221,12 @@ func (l *Lexer) emitIdent(ident string) {
 		l.emit(Fun)
 	case "type":
 		l.emit(Type)
+	case "extern":
+		l.emit(Extern)
+	case "select":
+		l.emit(Select)
+	case "and":
+		l.emit(And)
 
 	default:
 		l.emit(Ident)
@@ -183,12 +265,14 @@ func (l *Lexer) lookAhead() {
 		return
 	}
 
+	l.file.Code = utf8.AppendRune(l.file.Code, r)
 	l.top = r
 	l.eof = false
 }
 
 // move ahead
 func (l *Lexer) shift() {
+	l.current.Offset += utf8.RuneLen(l.top)
 	// TODO: Consider \n\r
 	if l.top == '\n' {
 		l.current.Line++
@@ -205,18 +289,20 @@ func (l *Lexer) eat() {
 	l.lookAhead()
 }
 
-// skip the current char
+// skip the current char, which is a trivia of the next token
 func (l *Lexer) consume() {
 	if l.eof {
 		return
 	}
+	l.trivia = append(l.trivia, l.top)
 	l.shift()
 	l.lookAhead()
 	l.start = l.current
 }
 
+// reportError reports an error at the text of the token being lexed.
 func (l *Lexer) reportError(msg string) {
-	l.Error(msg)
+	l.report(diag.IllegalToken, l.position(l.start), l.position(l.current), msg)
 }
 
 func (l *Lexer) eatIdent() bool {
@@ -493,6 +579,12 @@ func lex(l *Lexer) stateFn {
 	case ':':
 		l.eat()
 		l.emit(Colon)
+	case '?':
+		l.eat()
+		l.emit(Question)
+	case '!':
+		l.eat()
+		l.emit(Bang)
 	case '[':
 		return lexLBracket
 	case ']':
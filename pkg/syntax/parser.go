@@ -1,9 +1,11 @@
 package syntax
 
 import (
-	"fmt"
 	merror "github.com/hashicorp/go-multierror"
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/token"
+	"github.com/rhysd/locerr"
 	"io"
 	"os"
 	"strings"
@@ -40,24 +42,131 @@ func NewDummySource(code string) *Source {
 	return ParseReader(src)
 }*/
 
+// Parse parses the source code, and reports all the syntax errors of it, since the parser skips an erroneous
+// declaration or expression to go on. The module is incomplete if there are errors.
 func Parse(src *Source) (*ast.Module, error) {
+	file, err := ParseFile(src)
+	return file.Module, err
+}
+
+// ParseFile parses the source code like Parse, and keeps its tokens with their trivia in the file.
+func ParseFile(src *Source) (*File, error) {
+	file, _, err := parse(src, 0)
+	return file, err
+}
+
+// ParseExp parses the source code of an expression, e.g. an input of the REPL, whose positions are those in the code.
+func ParseExp(src *Source) (ast.Exp, error) {
+	_, exp, err := parse(src, ExpStart)
+	return exp, err
+}
+
+// parse parses a module, or an expression if the lexer starts with the token ExpStart.
+func parse(src *Source, lead int) (*File, ast.Exp, error) {
 	var err error
 	lexer := NewLexer(src)
-	lexer.OnError = func(s string) {
-		e := fmt.Errorf("parse error at %v: %s", src.Path, s)
-		err = merror.Append(err, e)
+	lexer.lead = lead
+	lexer.OnError = func(code string, start, end locerr.Pos, msg string) {
+		err = merror.Append(err, diag.Errorf(code, start, end, "parse error: %s", msg))
 	}
 	parser := funNewParser()
 	status := parser.Parse(lexer)
 	//fmt.Printf("Parse %s: status = %d\n", src.Path, status)
-	module := parser.(*funParserImpl).lval.mod
+	module, exp := parser.(*funParserImpl).lval.mod, parser.(*funParserImpl).lval.exp
+	if module != nil {
+		module.Comments = lexer.Comments
+	}
+	file := newFile(module, lexer.tokens, lexer.Trailing())
+	if module != nil {
+		module.Docs = file.docs()
+	}
+	if status != 0 {
+		// the parser aborts without an error at the end of file, if it is in the recovery of an earlier error.
+		if msg := unfinished(lexer.kinds()); msg != "" {
+			pos := lexer.position(lexer.Current())
+			lexer.report(diag.SyntaxError, pos, pos, msg)
+		}
+	}
 	if err != nil {
-		return module, err
+		return file, exp, err
 	} else if status == 0 {
-		return module, nil
+		return file, exp, nil
 	} else {
-		pos := lexer.Current()
-		err := fmt.Errorf("parse error at line %d column %d", pos.Line, pos.Column)
-		return module, err
+		pos := lexer.position(lexer.Current())
+		return file, exp, locerr.ErrorAt(pos, "parse error")
+	}
+}
+
+// errorAt returns the handler of the errors of a token of the lexer.
+func errorAt(lexer funLexer, tok *token.Token) ErrorFun {
+	if l, ok := lexer.(*Lexer); ok {
+		return l.errorAt(tok)
+	}
+	return lexer.Error
+}
+
+// tokenNames are the names of the tokens in the syntax errors, e.g. "unexpected ')', expecting in or end".
+var tokenNames = map[string]string{
+	"$end":          "end of file",
+	"$unk":          "unknown token",
+	"Illegal":       "illegal token",
+	"LParen":        "'('",
+	"RParen":        "')'",
+	"Ident":         "identifier",
+	"Bool":          "boolean",
+	"Not":           "not",
+	"Int":           "integer",
+	"Float":         "float",
+	"Minus":         "'-'",
+	"Plus":          "'+'",
+	"Equal":         "'='",
+	"LessGreater":   "'<>'",
+	"LessEqual":     "'<='",
+	"Less":          "'<'",
+	"Greater":       "'>'",
+	"GreaterEqual":  "'>='",
+	"If":            "if",
+	"Then":          "then",
+	"Else":          "else",
+	"Let":           "let",
+	"In":            "in",
+	"End":           "end",
+	"Val":           "val",
+	"Rec":           "rec",
+	"Comma":         "','",
+	"Dot":           "'.'",
+	"LessMinus":     "'<-'",
+	"Semicolon":     "';'",
+	"Star":          "'*'",
+	"Slash":         "'/'",
+	"BarBar":        "'||'",
+	"AndAnd":        "'&&'",
+	"StringLiteral": "string",
+	"Percent":       "'%'",
+	"Match":         "match",
+	"With":          "with",
+	"Bar":           "'|'",
+	"MinusGreater":  "'->'",
+	"Arrow":         "'=>'",
+	"Fn":            "fn",
+	"Fun":           "fun",
+	"Colon":         "':'",
+	"Type":          "type",
+	"LBracket":      "'['",
+	"RBracket":      "']'",
+	"Extern":        "extern",
+	"Select":        "select",
+	"Question":      "'?'",
+	"Bang":          "'!'",
+	"And":           "and",
+}
+
+func init() {
+	// the syntax errors name the unexpected token and the expected ones.
+	funErrorVerbose = true
+	for i, name := range funToknames {
+		if s, ok := tokenNames[name]; ok {
+			funToknames[i] = s
+		}
 	}
 }
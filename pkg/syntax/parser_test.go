@@ -1,6 +1,7 @@
 package syntax
 
 import (
+	"github.com/lilac/fun-lang/pkg/diag"
 	"github.com/stretchr/testify/assert"
 	"strings"
 	"testing"
@@ -102,3 +103,186 @@ func TestPrecedence(t *testing.T) {
 		assert.Equal(t, lines[i], d.String())
 	}
 }
+
+func TestParseExtern(t *testing.T) {
+	lines := []string{
+		`extern val sqrt : float -> float = "math.Sqrt"`,
+		`extern val repeat : string * int -> string = "strings.Repeat"`,
+		`extern val fields : string -> string list = "strings.Fields"`,
+		`extern val index : (string, int) map -> unit = "x.Index"`,
+		`extern type builder = "strings.Builder"`,
+		`val n = builder.Len (builder.new ())`,
+	}
+	src := NewDummySource(strings.Join(lines, "\n"))
+	module, err := Parse(src)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for i, d := range module.Decs {
+		assert.Equal(t, lines[i], d.String())
+	}
+}
+
+func TestParseCtorPattern(t *testing.T) {
+	lines := []string{
+		"val f = fn Ok x => x | Err (Ok y) => y | Err _ => 0",
+		"fun g (Ok x) = x | g (Err e) = e",
+	}
+	src := NewDummySource(strings.Join(lines, "\n"))
+	module, err := Parse(src)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for i, d := range module.Decs {
+		assert.Equal(t, lines[i], d.String())
+	}
+}
+
+func TestParseSelect(t *testing.T) {
+	lines := []string{
+		"val a = select c ? Ok x => x | (recv d) ? _ => 0 | c ! (f 1) => 1 | else => 2 end",
+		"val b = select c ? x => x + 1 end",
+	}
+	src := NewDummySource(strings.Join(lines, "\n"))
+	module, err := Parse(src)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for i, d := range module.Decs {
+		assert.Equal(t, lines[i], d.String())
+	}
+}
+
+func TestParseRecDec(t *testing.T) {
+	lines := []string{
+		"fun even n = if n = 0 then true else odd (n - 1) and odd n = if n = 0 then false else even (n - 1)",
+		"fun f 0 = 1 | f n = g n and g n = f (n - 1)",
+	}
+	src := NewDummySource(strings.Join(lines, "\n"))
+	module, err := Parse(src)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for i, d := range module.Decs {
+		assert.Equal(t, lines[i], d.String())
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	src := NewDummySource("(* a *)\nval a = 1 (* one *) + 2\nval b = a (* two *)")
+	module, err := Parse(src)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	assert.Equal(t, "val a = 1 + 2\nval b = a", module.String())
+	if assert.Len(t, module.Comments, 3) {
+		assert.Equal(t, "(* one *)", module.Comments[1].Value)
+		assert.Equal(t, 2, module.Comments[1].Location.Start.Line)
+	}
+}
+
+// parseErrors parses the lines, and returns the diagnostics of the errors.
+func parseErrors(t *testing.T, lines ...string) []*diag.Diagnostic {
+	_, err := Parse(NewDummySource(strings.Join(lines, "\n")))
+	assert.Error(t, err)
+	return diag.From(err)
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	errs := parseErrors(t,
+		"val a = (1 +)",
+		"val b = 2",
+		"fun f x = x +",
+		"val c = let val d = in 1 end",
+		"val e = let in 1 2 ) end",
+	)
+	if assert.Len(t, errs, 4) {
+		assert.Equal(t, "parse error: syntax error: unexpected ')', expecting an expression", errs[0].Message)
+		assert.Equal(t, diag.SyntaxError, errs[0].Code)
+		assert.Equal(t, 1, errs[0].Span.Start.Line)
+		assert.Equal(t, 13, errs[0].Span.Start.Column)
+		assert.Equal(t, 14, errs[0].Span.End.Column)
+		assert.Contains(t, errs[1].Message, "unexpected val")
+		assert.Equal(t, 4, errs[1].Span.Start.Line)
+		assert.Contains(t, errs[2].Message, "unexpected in")
+		assert.Equal(t, 4, errs[2].Span.Start.Line)
+		assert.Equal(t, "parse error: syntax error: unexpected ')', expecting end or ',' or ';' or an operator or an argument", errs[3].Message)
+		assert.Equal(t, 5, errs[3].Span.Start.Line)
+	}
+}
+
+func TestParseErrorExpectedTokens(t *testing.T) {
+	errs := parseErrors(t, "val a = 1 )", "val b = 2")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "parse error: syntax error: unexpected ')', expecting val or fun or extern", errs[0].Message)
+	}
+	errs = parseErrors(t, "val a = if 1 then")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "parse error: syntax error: unexpected end of file, expecting an expression", errs[0].Message)
+		assert.Equal(t, 18, errs[0].Span.Start.Column)
+	}
+	errs = parseErrors(t, "fun f x = x +", "val b = 2")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "parse error: syntax error: unexpected val, expecting an expression", errs[0].Message)
+	}
+	errs = parseErrors(t, "val a = (1, 2")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "parse error: syntax error: unexpected end of file, expecting ')' or ',' or ';' or an operator or an argument", errs[0].Message)
+		assert.Equal(t, 14, errs[0].Span.Start.Column)
+	}
+}
+
+func TestParseErrorAtEndOfFile(t *testing.T) {
+	// the recovery from the error in the let expression skips to its end, which the end of file comes before.
+	errs := parseErrors(t, "val a = let val b = 1 in b", "val c = (1, 2")
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "parse error: syntax error: unexpected val, expecting end or ',' or ';' or an operator or an argument", errs[0].Message)
+		assert.Equal(t, 2, errs[0].Span.Start.Line)
+		assert.Equal(t, "parse error: syntax error: unexpected end of file, expecting end", errs[1].Message)
+		assert.Equal(t, 2, errs[1].Span.Start.Line)
+		assert.Equal(t, 14, errs[1].Span.Start.Column)
+	}
+}
+
+func TestIllegalTokenReportedOnce(t *testing.T) {
+	// the parser does not report the illegal token again as a syntax error.
+	errs := parseErrors(t, "val a = 1 # 2")
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Message, "but got '#'")
+		assert.Equal(t, diag.IllegalToken, errs[0].Code)
+		assert.Equal(t, 11, errs[0].Span.Start.Column)
+	}
+}
+
+func TestInvalidLiteralAt(t *testing.T) {
+	errs := parseErrors(t, "val a = 1", "val b = 1 + 123456789123456789123456789")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, diag.InvalidLiteral, errs[0].Code)
+		assert.Equal(t, 2, errs[0].Span.Start.Line)
+		assert.Equal(t, 13, errs[0].Span.Start.Column)
+		assert.Equal(t, 40, errs[0].Span.End.Column)
+	}
+}
+
+func TestParseExp(t *testing.T) {
+	exp, err := ParseExp(NewDummySource("f (1 + 2)"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "f (1 + 2)", exp.String())
+		assert.Equal(t, 1, exp.Start().Column)
+	}
+	_, err = ParseExp(NewDummySource("1 + )"))
+	if errs := diag.From(err); assert.Len(t, errs, 1) {
+		// the position is in the code of the expression.
+		assert.Equal(t, "parse error: syntax error: unexpected ')', expecting an expression", errs[0].Message)
+		assert.Equal(t, 5, errs[0].Span.Start.Column)
+	}
+	// a declaration is not an expression, and ExpStart, which only the lexer makes, is never expected.
+	_, err = ParseExp(NewDummySource("val a = 1"))
+	if errs := diag.From(err); assert.Len(t, errs, 1) {
+		assert.Equal(t, "parse error: syntax error: unexpected val, expecting an expression", errs[0].Message)
+	}
+	errs := parseErrors(t, ")")
+	if assert.Len(t, errs, 1) {
+		assert.NotContains(t, errs[0].Message, "ExpStart")
+	}
+}
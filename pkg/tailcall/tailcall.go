@@ -0,0 +1,241 @@
+// Package tailcall eliminates the tail calls of functions to themselves and to each other, since Go makes every call on the stack.
+//
+// A tail call of a function to itself, or to another function of its recursive declaration, becomes an ir.Jump,
+// which the code generator makes a loop of. The other tail calls remain calls, and are reported with the reason.
+package tailcall
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ir"
+)
+
+// Miss is a tail call which remains a call.
+type Miss struct {
+	Pos    string // the position of the call in the source, e.g. main.fun:3:9, or empty if it is unknown
+	Caller string // the function whose body makes the call
+	Callee string
+	Reason string
+}
+
+// String prints the miss after its position like a diagnostic, e.g.
+// main.fun:3:18: the tail call of f in apply is not optimised: f is not declared with apply
+func (m Miss) String() string {
+	msg := fmt.Sprintf("the tail call of %s in %s is not optimised: %s", m.Callee, m.Caller, m.Reason)
+	if m.Pos == "" {
+		return msg
+	}
+	return m.Pos + ": " + msg
+}
+
+// loop is the function whose body is being rewritten, and the functions which its tail calls may jump to.
+type loop struct {
+	caller string
+	funs   map[string]*ir.FunDec // nil in a fn expression
+	reason string                // why the calls of funs do not jump, or empty if they do
+}
+
+type eliminator struct {
+	externs map[string]bool // the Go functions, whose calls are not reported
+	misses  []Miss
+}
+
+// Eliminate replaces the tail calls with jumps where possible, and returns the tail calls which remain.
+func Eliminate(module *ir.Module) (*ir.Module, []Miss) {
+	e := &eliminator{externs: map[string]bool{}}
+	for _, dec := range module.Decs {
+		if d, ok := dec.(*ir.ExternDec); ok {
+			e.externs[d.Id.Value] = true
+		}
+	}
+	return &ir.Module{Decs: e.decs(module.Decs, "")}, e.misses
+}
+
+// decs rewrites declarations in the function named enclosing, which is empty at top level.
+func (e *eliminator) decs(decs []ir.Dec, enclosing string) []ir.Dec {
+	result := make([]ir.Dec, len(decs))
+	for i, dec := range decs {
+		switch d := dec.(type) {
+		case *ir.ValDec:
+			name := enclosing
+			if name == "" {
+				name = d.Id.Name
+			}
+			result[i] = &ir.ValDec{Id: d.Id, Type: d.Type, Body: e.exp(d.Body, name)}
+		case *ir.FunDec:
+			result[i] = e.fun(d, []*ir.FunDec{d})
+		case *ir.RecDec:
+			funs := make([]*ir.FunDec, len(d.Funs))
+			for j, fun := range d.Funs {
+				funs[j] = e.fun(fun, d.Funs)
+			}
+			result[i] = &ir.RecDec{Funs: funs}
+		default:
+			result[i] = dec
+		}
+	}
+	return result
+}
+
+// fun rewrites the body of a function of a recursive declaration, or of a function by itself.
+// The calls do not jump if a closure captures the parameters, since a jump overwrites them.
+func (e *eliminator) fun(d *ir.FunDec, group []*ir.FunDec) *ir.FunDec {
+	l := &loop{caller: d.Id.Name, funs: map[string]*ir.FunDec{}}
+	params := map[string]bool{}
+	for _, fun := range group {
+		l.funs[fun.Id.Value] = fun
+		for _, args := range [][]ir.Arg{fun.Env, fun.Args} {
+			for _, arg := range args {
+				params[arg.Id.Value] = true
+			}
+		}
+	}
+	for _, fun := range group {
+		if captured(fun.Body, params) {
+			l.reason = fmt.Sprintf("a closure in %s captures its parameters", fun.Id.Name)
+		}
+	}
+	return &ir.FunDec{Id: d.Id, Type: d.Type, Args: d.Args, Env: d.Env, Body: e.tail(d.Body, l)}
+}
+
+// captured returns whether a closure in an expression refers to any of the variables.
+func captured(exp ir.Exp, vars map[string]bool) bool {
+	found := false
+	refers := func(body ir.Exp) {
+		ir.Inspect(body, func(exp ir.Exp) bool {
+			if v, ok := exp.(*ir.Var); ok && vars[v.Id.Value] {
+				found = true
+			}
+			return !found
+		})
+	}
+	ir.Inspect(exp, func(exp ir.Exp) bool {
+		switch e := exp.(type) {
+		case *ir.Fn:
+			refers(e.Body)
+		case *ir.LetIn:
+			for _, dec := range e.Decs {
+				for _, fun := range funDecs(dec) {
+					refers(fun.Body)
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func funDecs(dec ir.Dec) []*ir.FunDec {
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		return []*ir.FunDec{d}
+	case *ir.RecDec:
+		return d.Funs
+	}
+	return nil
+}
+
+// tail rewrites an expression in tail position of a function body.
+func (e *eliminator) tail(exp ir.Exp, l *loop) ir.Exp {
+	switch x := exp.(type) {
+	case *ir.IfThen:
+		return &ir.IfThen{Cond: e.exp(x.Cond, l.caller), Then: e.tail(x.Then, l), Else: e.tail(x.Else, l)}
+	case *ir.LetIn:
+		return &ir.LetIn{Decs: e.decs(x.Decs, l.caller), Body: e.tail(x.Body, l)}
+	case *ir.Sequence:
+		last := len(x.Elements) - 1
+		elements := e.exps(x.Elements[:last], l.caller)
+		return &ir.Sequence{Elements: append(elements, e.tail(x.Elements[last], l))}
+	case *ir.Select:
+		arms := make([]ir.SelectArm, len(x.Arms))
+		for i, arm := range x.Arms {
+			arms[i] = ir.SelectArm{Id: arm.Id, Body: e.tail(arm.Body, l)}
+			if arm.Chan != nil {
+				arms[i].Chan = e.exp(arm.Chan, l.caller)
+			}
+			if arm.Value != nil {
+				arms[i].Value = e.exp(arm.Value, l.caller)
+			}
+		}
+		return &ir.Select{Arms: arms, Type: x.Type}
+	case *ir.App, *ir.Call:
+		if jump := e.jump(exp, l); jump != nil {
+			return jump
+		}
+	}
+	return e.exp(exp, l.caller)
+}
+
+// jump makes a jump of a tail call, or returns nil and reports the call if it is a call of a function which cannot jump.
+func (e *eliminator) jump(exp ir.Exp, l *loop) *ir.Jump {
+	head, args := spine(exp)
+	if head == nil || e.externs[head.Id.Value] {
+		return nil
+	}
+	fun, ok := l.funs[head.Id.Value]
+	pos := position(exp)
+	switch {
+	case l.funs == nil:
+		e.miss(l, head, pos, "it is in a fn expression")
+	case !ok:
+		e.miss(l, head, pos, fmt.Sprintf("%s is not declared with %s", head.Id.Name, l.caller))
+	case len(args) != len(fun.Env)+len(fun.Args):
+		e.miss(l, head, pos, fmt.Sprintf("it applies %d arguments to %s, which takes %d", len(args), head.Id.Name, len(fun.Env)+len(fun.Args)))
+	case l.reason != "":
+		e.miss(l, head, pos, l.reason)
+	default:
+		return &ir.Jump{Fun: &ir.Var{Id: fun.Id, Type: fun.EnvType()}, Args: e.exps(args, l.caller), Type: ir.TypeOf(exp)}
+	}
+	return nil
+}
+
+func (e *eliminator) miss(l *loop, callee *ir.Var, pos, reason string) {
+	e.misses = append(e.misses, Miss{Pos: pos, Caller: l.caller, Callee: callee.Id.Name, Reason: reason})
+}
+
+// position returns the position of an application or a call.
+func position(exp ir.Exp) string {
+	switch x := exp.(type) {
+	case *ir.App:
+		return x.Pos
+	case *ir.Call:
+		return x.Pos
+	}
+	return ""
+}
+
+// spine returns the function variable and the arguments of nested applications and a call, or nil if the function is not a variable.
+func spine(exp ir.Exp) (*ir.Var, []ir.Exp) {
+	var args []ir.Exp
+	for {
+		switch x := exp.(type) {
+		case *ir.App:
+			args = append([]ir.Exp{x.Arg}, args...)
+			exp = x.Fun
+		case *ir.Call:
+			return x.Fun, append(append([]ir.Exp{}, x.Args...), args...)
+		case *ir.Var:
+			return x, args
+		default:
+			return nil, nil
+		}
+	}
+}
+
+func (e *eliminator) exps(exps []ir.Exp, enclosing string) []ir.Exp {
+	result := make([]ir.Exp, len(exps))
+	for i, exp := range exps {
+		result[i] = e.exp(exp, enclosing)
+	}
+	return result
+}
+
+// exp rewrites the functions in an expression which is not in tail position.
+func (e *eliminator) exp(exp ir.Exp, enclosing string) ir.Exp {
+	switch x := exp.(type) {
+	case *ir.LetIn:
+		return &ir.LetIn{Decs: e.decs(x.Decs, enclosing), Body: e.exp(x.Body, enclosing)}
+	case *ir.Fn:
+		return &ir.Fn{Id: x.Id, Type: x.Type, Body: e.tail(x.Body, &loop{caller: "fn in " + enclosing})}
+	}
+	return ir.Rewrite(exp, func(child ir.Exp) ir.Exp { return e.exp(child, enclosing) })
+}
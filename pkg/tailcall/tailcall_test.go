@@ -0,0 +1,70 @@
+package tailcall
+
+import (
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// countdown makes fun name (n : int) = if n = 0 then 0 else body.
+func countdown(name string, body ir.Exp) *ir.FunDec {
+	n := irtest.Var("n", types.IntType)
+	return irtest.Fun(name, irtest.IntToInt, []ir.Arg{irtest.Arg("n", types.IntType)},
+		&ir.IfThen{Cond: ir.NewBinaryOp(ir.Eq, n, &ir.Int{}), Then: &ir.Int{}, Else: body})
+}
+
+func TestSelfTailCall(t *testing.T) {
+	n, acc := irtest.Var("n", types.IntType), irtest.Var("acc", types.IntType)
+	sum := &ir.FunDec{Id: irtest.Id("sum"), Type: types.Arrow(types.IntType, irtest.IntToInt),
+		Args: []ir.Arg{irtest.Arg("n", types.IntType), irtest.Arg("acc", types.IntType)}}
+	sum.Body = &ir.IfThen{
+		Cond: ir.NewBinaryOp(ir.Eq, n, &ir.Int{}),
+		Then: acc,
+		Else: irtest.Apply(irtest.Var("sum", sum.Type), ir.NewBinaryOp(ir.Minus, n, irtest.Int(1)), ir.NewBinaryOp(ir.Add, acc, n)),
+	}
+	module, misses := Eliminate(&ir.Module{Decs: []ir.Dec{sum}})
+	assert.Empty(t, misses)
+	assert.Equal(t, "fun sum$1 (n$1 : int) (acc$1 : int) = if n$1 = 0 then acc$1 else jump sum$1 (n$1 - 1, acc$1 + n$1)",
+		module.String())
+}
+
+func TestMutualTailCalls(t *testing.T) {
+	n := irtest.Var("n", types.IntType)
+	even := countdown("even", irtest.Apply(irtest.Var("odd", irtest.IntToInt), ir.NewBinaryOp(ir.Minus, n, irtest.Int(1))))
+	odd := countdown("odd", irtest.Apply(irtest.Var("even", irtest.IntToInt), ir.NewBinaryOp(ir.Minus, n, irtest.Int(1))))
+	module, misses := Eliminate(&ir.Module{Decs: []ir.Dec{&ir.RecDec{Funs: []*ir.FunDec{even, odd}}}})
+	assert.Empty(t, misses)
+	assert.Equal(t, "fun even$1 (n$1 : int) = if n$1 = 0 then 0 else jump odd$1 (n$1 - 1)"+
+		" and odd$1 (n$1 : int) = if n$1 = 0 then 0 else jump even$1 (n$1 - 1)", module.String())
+}
+
+func TestMissedTailCalls(t *testing.T) {
+	n := irtest.Var("n", types.IntType)
+	twice := countdown("twice", irtest.Apply(irtest.Var("twice", irtest.IntToInt), ir.NewBinaryOp(ir.Minus, n, irtest.Int(1))))
+	other := countdown("other", &ir.App{Fun: irtest.Var("twice", irtest.IntToInt), Arg: n, Pos: "main.fun:2:40"})
+	calls := countdown("calls", irtest.Apply(irtest.Var("add", types.Arrow(types.IntType, irtest.IntToInt)), n))
+	add := irtest.Fun("add", types.Arrow(types.IntType, irtest.IntToInt), []ir.Arg{irtest.Arg("x", types.IntType), irtest.Arg("y", types.IntType)},
+		irtest.Var("x", types.IntType))
+	inFn := irtest.Val("f", irtest.IntToInt,
+		&ir.Fn{Id: n.Id, Type: irtest.IntToInt, Body: irtest.Apply(irtest.Var("twice", irtest.IntToInt), n)})
+	module, misses := Eliminate(&ir.Module{Decs: []ir.Dec{twice, other, add, calls, inFn}})
+	assert.Contains(t, module.String(), "jump twice$1 (n$1 - 1)")
+	assert.Equal(t, []Miss{
+		{Pos: "main.fun:2:40", Caller: "other", Callee: "twice", Reason: "twice is not declared with other"},
+		{Caller: "calls", Callee: "add", Reason: "add is not declared with calls"},
+		{Caller: "fn in f", Callee: "twice", Reason: "it is in a fn expression"},
+	}, misses)
+	assert.Equal(t, "main.fun:2:40: the tail call of twice in other is not optimised: twice is not declared with other", misses[0].String())
+	assert.Equal(t, "the tail call of add in calls is not optimised: add is not declared with calls", misses[1].String())
+}
+
+func TestCapturedParameters(t *testing.T) {
+	n := irtest.Var("n", types.IntType)
+	closure := &ir.Fn{Id: irtest.Id("x"), Type: irtest.IntToInt, Body: n}
+	loop := countdown("loop", irtest.Apply(irtest.Var("loop", irtest.IntToInt), irtest.Apply(closure, irtest.Int(1))))
+	module, misses := Eliminate(&ir.Module{Decs: []ir.Dec{loop}})
+	assert.NotContains(t, module.String(), "jump")
+	assert.Equal(t, []Miss{{Caller: "loop", Callee: "loop", Reason: "a closure in loop captures its parameters"}}, misses)
+}
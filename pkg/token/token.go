@@ -12,6 +12,8 @@ type Position struct {
 	Line int
 	// Column number.
 	Column int
+	// Offset in bytes from the beginning of the file.
+	Offset int
 }
 
 // Location denotes a range in a file
@@ -19,12 +21,17 @@ type Location struct {
 	Start Position
 	End   Position
 	Path  string
+	// File holds the code of the file for the snippets of errors, if it is not nil.
+	File *locerr.Source
 }
 
 type Token struct {
 	Kind     Kind
 	Value    string
 	Location Location
+	// Leading is the trivia before the token, i.e. the spaces, and the comments which the parser skips,
+	// so that the code of a file is the leading trivia and the values of its tokens.
+	Leading string
 }
 
 func NewToken(text string) *Token {
@@ -32,13 +39,19 @@ func NewToken(text string) *Token {
 }
 
 func (t Token) Start() locerr.Pos {
-	pos := t.Location.Start
-	return locerr.Pos{Line: pos.Line, Column: pos.Column, File: &locerr.Source{Path: t.Location.Path}}
+	return t.Location.pos(t.Location.Start)
 }
 
 func (t Token) End() locerr.Pos {
-	pos := t.Location.End
-	return locerr.Pos{Line: pos.Line, Column: pos.Column, File: &locerr.Source{Path: t.Location.Path}}
+	return t.Location.pos(t.Location.End)
+}
+
+func (l Location) pos(pos Position) locerr.Pos {
+	file := l.File
+	if file == nil {
+		file = &locerr.Source{Path: l.Path}
+	}
+	return locerr.Pos{Offset: pos.Offset, Line: pos.Line, Column: pos.Column, File: file}
 }
 
 func (t Token) String() string {
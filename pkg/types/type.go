@@ -29,8 +29,33 @@ type VarId int
 
 // Var denotes a type variable
 type Var struct {
-	Id  VarId
-	Ref Type
+	Id    VarId
+	Ref   Type
+	Class Class // the types which the variable stands for, by the operators which apply to its values
+}
+
+// Class is a class of types, each of which contains the next ones.
+type Class int
+
+const (
+	AnyClass     Class = iota
+	NumberClass        // int and float, whose values are added, negated or ordered
+	IntegerClass       // int, whose values are the operands of the remainder
+)
+
+// Admits returns whether a type constructor is in the class.
+func (c Class) Admits(t *CtorType) bool {
+	switch c {
+	case NumberClass:
+		return t.Equal(IntType) || t.Equal(FloatType)
+	case IntegerClass:
+		return t.Equal(IntType)
+	}
+	return true
+}
+
+func (c Class) String() string {
+	return [...]string{"any type", "a number", "an integer"}[c]
 }
 
 func (v Var) VarSet() map[VarId]struct{} {
@@ -82,12 +107,141 @@ func TupleType(ts []Type) Type {
 	}
 }
 
+// AsArrow returns the argument and result types if the type is an arrow type.
+func AsArrow(t Type) (Type, Type, bool) {
+	if c, ok := t.Prune().(*CtorType); ok && c.Ctor == "->" {
+		return c.Args[0], c.Args[1], true
+	}
+	return nil, nil, false
+}
+
+// AsTuple returns the element types if the type is a tuple type.
+func AsTuple(t Type) ([]Type, bool) {
+	if c, ok := t.Prune().(*CtorType); ok && c.Ctor == "*" {
+		return c.Args, true
+	}
+	return nil, false
+}
+
+// ResultCtor is the type constructor of the built-in datatype of results, which are either a value or an error.
+//
+//	datatype ('a, 'e) result = Ok of 'a | Err of 'e
+const ResultCtor = "result"
+
+// The value constructors of results.
+const (
+	OkCtor  = "Ok"
+	ErrCtor = "Err"
+)
+
+// Constructors maps the value constructors of the built-in datatypes to their type constructors.
+var Constructors = map[string]string{
+	OkCtor:  ResultCtor,
+	ErrCtor: ResultCtor,
+}
+
+func ResultType(value, err Type) Type {
+	return &CtorType{
+		Ctor: ResultCtor,
+		Args: []Type{value, err},
+	}
+}
+
+// AsResult returns the value and error types if the type is a result type.
+func AsResult(t Type) (Type, Type, bool) {
+	if c, ok := t.Prune().(*CtorType); ok && c.Ctor == ResultCtor && len(c.Args) == 2 {
+		return c.Args[0], c.Args[1], true
+	}
+	return nil, nil, false
+}
+
+// Result returns the result type of an arrow type.
+func Result(t Type) Type {
+	_, res, ok := AsArrow(t)
+	if !ok {
+		panic(fmt.Sprintf("Bug: %s is not an arrow type", t))
+	}
+	return res
+}
+
+// Vars returns the type variables of a type in order of first occurrence.
+func Vars(t Type) []*Var {
+	var vars []*Var
+	seen := map[*Var]bool{}
+	var visit func(t Type)
+	visit = func(t Type) {
+		switch ty := t.Prune().(type) {
+		case *Var:
+			if !seen[ty] {
+				seen[ty] = true
+				vars = append(vars, ty)
+			}
+		case *CtorType:
+			for _, arg := range ty.Args {
+				visit(arg)
+			}
+		}
+	}
+	visit(t)
+	return vars
+}
+
+// Scheme prints a type whose type variables are named 'a, 'b and so on in the order of their occurrence, e.g.
+// ('a -> 'b) -> 'a -> 'b, rather than by the ids which the inference numbers them with.
+func Scheme(t Type) string {
+	bindings := map[*Var]Type{}
+	for i, v := range Vars(t) {
+		bindings[v] = NewVar(VarId(i))
+	}
+	return Substitute(t, bindings).String()
+}
+
+// Match binds the type variables of a polymorphic type to the types at the same places of an instance.
+func Match(t, instance Type, bindings map[*Var]Type) {
+	switch ty := t.Prune().(type) {
+	case *Var:
+		if _, ok := bindings[ty]; !ok {
+			bindings[ty] = instance
+		}
+	case *CtorType:
+		if inst, ok := instance.Prune().(*CtorType); ok && len(inst.Args) == len(ty.Args) {
+			for i, arg := range ty.Args {
+				Match(arg, inst.Args[i], bindings)
+			}
+		}
+	}
+}
+
+// Substitute returns a type with the bound type variables replaced by their types.
+func Substitute(t Type, bindings map[*Var]Type) Type {
+	switch ty := t.Prune().(type) {
+	case *Var:
+		if bound, ok := bindings[ty]; ok {
+			return bound
+		}
+	case *CtorType:
+		if len(ty.Args) == 0 {
+			return ty
+		}
+		args := make([]Type, len(ty.Args))
+		for i, arg := range ty.Args {
+			args[i] = Substitute(arg, bindings)
+		}
+		return &CtorType{Ctor: ty.Ctor, Args: args}
+	}
+	return t.Prune()
+}
+
 func (v Var) String() string {
 	if v.Ref != nil {
 		return v.Ref.String()
 	}
-	c := 'a' + int(v.Id)
-	return "'" + string(rune(c))
+	// 'a to 'z, then 'a1 to 'z1 and so on.
+	name := "'" + string(rune('a'+int(v.Id)%26))
+	if v.Id >= 26 {
+		name += fmt.Sprint(int(v.Id) / 26)
+	}
+	return name
 }
 
 func (v *Var) Equal(t Type) bool {
@@ -109,9 +263,16 @@ func (c CtorType) String() string {
 	if count == 0 {
 		return c.Ctor
 	} else if count == 1 {
-		return fmt.Sprintf("%s %s", c.Args[0].String(), c.Ctor)
-	} else if count == 2 && !unicode.IsLetter(rune(c.Ctor[0])) {
-		return fmt.Sprintf("%s %s %s", c.Args[0].String(), c.Ctor, c.Args[1].String())
+		return fmt.Sprintf("%s %s", operand(c.Args[0], "->", "*"), c.Ctor)
+	} else if c.Ctor == "->" {
+		// the arrow is right associative, and binds looser than the tuple.
+		return fmt.Sprintf("%s -> %s", operand(c.Args[0], "->"), c.Args[1].String())
+	} else if !unicode.IsLetter(rune(c.Ctor[0])) {
+		args := make([]string, count)
+		for i, v := range c.Args {
+			args[i] = operand(v, "->", c.Ctor)
+		}
+		return strings.Join(args, fmt.Sprintf(" %s ", c.Ctor))
 	} else {
 		args := make([]string, count)
 		for i, v := range c.Args {
@@ -122,6 +283,18 @@ func (c CtorType) String() string {
 	}
 }
 
+// operand prints a type as an operand of a type constructor, where a type of the infix constructors is parenthesized.
+func operand(t Type, infix ...string) string {
+	if c, ok := t.Prune().(*CtorType); ok && len(c.Args) > 1 {
+		for _, ctor := range infix {
+			if c.Ctor == ctor {
+				return "(" + c.String() + ")"
+			}
+		}
+	}
+	return t.String()
+}
+
 func (c CtorType) Equal(t Type) bool {
 	switch ot := t.Prune().(type) {
 	case *CtorType:
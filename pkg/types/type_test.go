@@ -31,4 +31,45 @@ func TestCtor(t *testing.T) {
 func TestVar(t *testing.T) {
 	v := NewVar(0)
 	assert.Equal(t, "'a", v.String())
+	assert.Equal(t, "'z", NewVar(25).String())
+	assert.Equal(t, "'b1", NewVar(27).String())
+}
+
+func TestScheme(t *testing.T) {
+	a, b := NewVar(40), NewVar(7)
+	assert.Equal(t, "('a -> 'b) -> 'a -> 'b", Scheme(Arrow(Arrow(a, b), Arrow(a, b))))
+	assert.Equal(t, "'a * int -> 'b", Scheme(Arrow(TupleType([]Type{b, IntType}), a)))
+	assert.Equal(t, "int", Scheme(IntType))
+}
+
+func TestAsArrow(t *testing.T) {
+	v := NewVar(0)
+	v.Ref = Arrow(IntType, BoolType)
+	arg, res, ok := AsArrow(v)
+	assert.True(t, ok)
+	assert.Equal(t, IntType, arg)
+	assert.Equal(t, BoolType, res)
+	_, _, ok = AsArrow(IntType)
+	assert.False(t, ok)
+}
+
+func TestSubstitute(t *testing.T) {
+	a, b := NewVar(0), NewVar(1)
+	poly := Arrow(a, TupleType([]Type{a, b}))
+	assert.Equal(t, []*Var{a, b}, Vars(poly))
+
+	bindings := map[*Var]Type{}
+	Match(poly, Arrow(IntType, TupleType([]Type{IntType, StringType})), bindings)
+	assert.Equal(t, IntType, bindings[a])
+	assert.Equal(t, StringType, bindings[b])
+	assert.Equal(t, "int -> int * string", Substitute(poly, bindings).String())
+	assert.Equal(t, "'a -> 'a * 'b", poly.String())
+}
+
+func TestParenthesizedTypes(t *testing.T) {
+	f := Arrow(IntType, IntType)
+	assert.Equal(t, "(int -> int) -> int -> int", Arrow(f, f).String())
+	assert.Equal(t, "int * (int -> int) * (int * int)", TupleType([]Type{IntType, f, TupleType([]Type{IntType, IntType})}).String())
+	assert.Equal(t, "int * int -> int", Arrow(TupleType([]Type{IntType, IntType}), IntType).String())
+	assert.Equal(t, "(int -> int) chan", (&CtorType{Ctor: "chan", Args: []Type{f}}).String())
 }
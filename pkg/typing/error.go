@@ -0,0 +1,70 @@
+package typing
+
+import (
+	"fmt"
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/diag"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/rhysd/locerr"
+)
+
+// Error is a type error of an expression, which is rendered like its diagnostic, with a snippet of the code
+// where carets mark the expression.
+//
+//	Error: type mismatch: expected int, but got bool (at main.fun:2:11)
+//	  Note: in the argument of the application at main.fun:2:9
+//
+//	> val a = f true
+//	>           ^^^^
+type Error struct {
+	Code    string // the code of the diagnostic, e.g. diag.TypeMismatch
+	Start   locerr.Pos
+	End     locerr.Pos
+	Message string
+	// Expected and Actual are the types of a type mismatch, or nil for another error.
+	Expected types.Type
+	Actual   types.Type
+	// Notes are the contexts of the expression from the innermost one, e.g. the application of which it is the argument.
+	Notes []string
+}
+
+func errorAt(exp ast.Exp, code string, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Start: exp.Start(), End: exp.End(), Message: fmt.Sprintf(format, args...)}
+}
+
+// mismatch makes the error of an expression whose type is not the expected type,
+// where cause is the error of the unification, e.g. of the mismatched types in them.
+func mismatch(exp ast.Exp, expected, actual types.Type, cause error) *Error {
+	err := errorAt(exp, diag.TypeMismatch, "type mismatch: expected %s, but got %s", expected, actual)
+	err.Expected, err.Actual = expected, actual
+	if c, ok := cause.(*conflict); ok {
+		if c.recursive {
+			err.Code = diag.RecursiveType
+		}
+		a, b := expected.Prune(), actual.Prune()
+		if !c.recursive && !c.class && (c.a == a && c.b == b || c.a == b && c.b == a) {
+			// the conflict is the types themselves.
+			return err
+		}
+	}
+	if cause != nil {
+		err.Notes = append(err.Notes, cause.Error())
+	}
+	return err
+}
+
+// Note adds a context to the error.
+func (e *Error) Note(format string, args ...interface{}) *Error {
+	e.Notes = append(e.Notes, fmt.Sprintf(format, args...))
+	return e
+}
+
+func (e *Error) Diagnostic() *diag.Diagnostic {
+	d := diag.Errorf(e.Code, e.Start, e.End, "%s", e.Message)
+	d.Notes = e.Notes
+	return d
+}
+
+func (e *Error) Error() string {
+	return e.Diagnostic().Error()
+}
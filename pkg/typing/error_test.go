@@ -0,0 +1,123 @@
+package typing
+
+import (
+	merror "github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// typeErrors runs the inference of the lines, and returns its type errors.
+func typeErrors(t *testing.T, lines ...string) []*Error {
+	_, err := run(t, lines)
+	var errs []*Error
+	if multi, ok := err.(*merror.Error); ok {
+		for _, e := range multi.Errors {
+			if te, ok := e.(*Error); assert.True(t, ok, "%v is not a type error", e) {
+				errs = append(errs, te)
+			}
+		}
+	}
+	return errs
+}
+
+func TestMismatchInArgument(t *testing.T) {
+	errs := typeErrors(t,
+		"fun f x = x + 1",
+		"val a = f true",
+	)
+	if assert.Len(t, errs, 1) {
+		err := errs[0]
+		assert.Equal(t, "type mismatch: expected int, but got bool", err.Message)
+		assert.Equal(t, "int", err.Expected.String())
+		assert.Equal(t, "bool", err.Actual.String())
+		assert.Equal(t, 2, err.Start.Line)
+		assert.Equal(t, 11, err.Start.Column)
+		assert.Equal(t, 15, err.End.Column)
+		assert.Equal(t, []string{"in the argument of the application at <dummy>:2:9"}, err.Notes)
+		assert.Equal(t, "Error: type mismatch: expected int, but got bool (at <dummy>:2:11)\n"+
+			"  Note: in the argument of the application at <dummy>:2:9\n\n"+
+			"> val a = f true\n"+
+			">           ^^^^\n", err.Error())
+	}
+}
+
+func TestMismatchOfFullTypes(t *testing.T) {
+	errs := typeErrors(t,
+		"fun apply f = f (1, \"s\")",
+		"val a = apply (fn p => p + 1)",
+	)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "type mismatch: expected int * string -> int, but got int -> int", errs[0].Message)
+		assert.Equal(t, []string{
+			"int * string is incompatible with int",
+			"in the argument of the application at <dummy>:2:9",
+		}, errs[0].Notes)
+	}
+}
+
+func TestOperandsOfGenericFunction(t *testing.T) {
+	errs := typeErrors(t,
+		"fun add x y = x + y",
+		"fun lt x y = x < y",
+		"fun rem x y = x % y",
+		"val a = add true false",
+		"val b = lt \"a\" \"b\"",
+		"val c = rem 1.5 2.0",
+		"val d = 1.5 % 2.0",
+	)
+	if assert.Len(t, errs, 7) {
+		// the call site is wrong, rather than the generated code of the generic function.
+		assert.Equal(t, 4, errs[0].Start.Line)
+		assert.Equal(t, 13, errs[0].Start.Column)
+		assert.Contains(t, errs[0].Notes[0], "bool is not a number")
+		assert.Equal(t, 5, errs[2].Start.Line)
+		assert.Contains(t, errs[2].Notes[0], "string is not a number")
+		assert.Equal(t, 6, errs[4].Start.Line)
+		assert.Contains(t, errs[4].Notes[0], "float is not an integer")
+		assert.Equal(t, "arithmetic operator % can only be applied to an integer, but got float", errs[6].Message)
+	}
+}
+
+func TestErrorsOfBranches(t *testing.T) {
+	errs := typeErrors(t, "val b = if 1 then 2 else \"s\"")
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "type mismatch: expected bool, but got int", errs[0].Message)
+		assert.Equal(t, 12, errs[0].Start.Column)
+		assert.Equal(t, "type mismatch: expected int, but got string", errs[1].Message)
+		assert.Equal(t, 26, errs[1].Start.Column)
+	}
+}
+
+func TestApplicationOfNonFunction(t *testing.T) {
+	errs := typeErrors(t, "val n = 1", "val a = n 2")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "type mismatch: expected int -> 'a, but got int", errs[0].Message)
+		assert.Equal(t, []string{"it is applied to the argument at <dummy>:2:11"}, errs[0].Notes)
+		assert.Contains(t, errs[0].Error(), "> val a = n 2\n>         ^\n")
+	}
+}
+
+func TestSnippetWithTabs(t *testing.T) {
+	errs := typeErrors(t, "val a =\n\t1 + true")
+	if assert.Len(t, errs, 1) {
+		// the tabs are kept, so that the carets are under the expression.
+		assert.Contains(t, errs[0].Error(), "> \t1 + true\n> \t    ^^^^\n")
+	}
+}
+
+func TestIncomparableAssertEqual(t *testing.T) {
+	errs := typeErrors(t,
+		"fun same x y = assertEqual x y",
+		"val _ = same (1, true) (1, true)",
+		"val _ = assertEqual (fn x => x + 1) (fn x => x)",
+		"val _ = assertEqual (1, fn x => x) (1, fn x => x)",
+	)
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "invalid-operand", errs[0].Code)
+		assert.Equal(t, "assertEqual can only compare values which have equality, but got int -> int", errs[0].Message)
+		assert.Equal(t, 3, errs[0].Start.Line)
+		assert.Equal(t, 9, errs[0].Start.Column)
+		assert.Regexp(t, `but got int \* \('\w+ -> '\w+\)$`, errs[1].Message)
+		assert.Regexp(t, `the values of the type '\w+ -> '\w+ cannot be compared`, errs[1].Notes[0])
+	}
+}
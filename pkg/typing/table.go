@@ -0,0 +1,54 @@
+package typing
+
+import (
+	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/rhysd/locerr"
+	"sort"
+)
+
+// TypedExp is an expression with its inferred type.
+type TypedExp struct {
+	Exp  ast.Exp
+	Type types.Type
+}
+
+// Types returns the expressions which ti has inferred with their types, including the patterns,
+// ordered by their positions in the source, where an expression is before the expressions in it.
+func (ti *TypeInference) Types() []TypedExp {
+	result := make([]TypedExp, 0, len(ti.expTypes))
+	for exp, t := range ti.expTypes {
+		result = append(result, TypedExp{exp, t})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Exp, result[j].Exp
+		if a.Start().Offset != b.Start().Offset {
+			return a.Start().Offset < b.Start().Offset
+		}
+		if a.End().Offset != b.End().Offset {
+			return a.End().Offset > b.End().Offset
+		}
+		// e.g. the parentheses of an expression do not make another node, which may have the span of the expression.
+		return a.String() < b.String()
+	})
+	return result
+}
+
+// TypeAt returns the innermost expression at a position and its type, where the line and the column are one based,
+// or false if there is no expression at the position.
+func (ti *TypeInference) TypeAt(line, column int) (TypedExp, bool) {
+	pos := locerr.Pos{Line: line, Column: column}
+	var result TypedExp
+	found := false
+	for _, typed := range ti.Types() {
+		// the later expressions which contain the position are in the earlier ones.
+		if !before(pos, typed.Exp.Start()) && before(pos, typed.Exp.End()) {
+			result, found = typed, true
+		}
+	}
+	return result, found
+}
+
+func before(a, b locerr.Pos) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
@@ -0,0 +1,55 @@
+package typing
+
+import (
+	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/syntax"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// infer runs the inference of the lines, and returns the inference with the types of their expressions.
+func infer(t *testing.T, lines ...string) *TypeInference {
+	ti := &TypeInference{}
+	module, err := syntax.Parse(syntax.NewDummySource(strings.Join(lines, "\n")))
+	assert.NoError(t, err, "parsing error")
+	transformer := alpha.NewTransformer()
+	transformer.Transform(module)
+	assert.NoError(t, transformer.Error())
+	_, err = ti.Infer(module)
+	assert.NoError(t, err, "type inference error")
+	return ti
+}
+
+func TestTypesInOrder(t *testing.T) {
+	ti := infer(t, "val a = 1 + 2", "val b = a = 3")
+	var result []string
+	for _, typed := range ti.Types() {
+		result = append(result, typed.Exp.String()+" : "+typed.Type.String())
+	}
+	assert.Equal(t, []string{
+		"1 + 2 : int",
+		"1 : int",
+		"2 : int",
+		"a$1 = 3 : bool",
+		"a$1 : int",
+		"3 : int",
+	}, result)
+}
+
+func TestTypeAt(t *testing.T) {
+	ti := infer(t, "fun f x = x + 1", "val a = f 2")
+	typed, ok := ti.TypeAt(2, 9)
+	if assert.True(t, ok) {
+		assert.Equal(t, "f$1", typed.Exp.String())
+		assert.Equal(t, "int -> int", typed.Type.String())
+	}
+	// the space between the function and the argument is in the application only.
+	typed, ok = ti.TypeAt(2, 10)
+	if assert.True(t, ok) {
+		assert.Equal(t, "f$1 2", typed.Exp.String())
+		assert.Equal(t, "int", typed.Type.String())
+	}
+	_, ok = ti.TypeAt(2, 1)
+	assert.False(t, ok)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	merror "github.com/hashicorp/go-multierror"
 	"github.com/lilac/fun-lang/pkg/ast"
+	"github.com/lilac/fun-lang/pkg/builtin"
 	"github.com/lilac/fun-lang/pkg/common"
+	"github.com/lilac/fun-lang/pkg/diag"
 	"github.com/lilac/fun-lang/pkg/types"
 )
 
@@ -15,6 +17,18 @@ type VarSet = common.Env[*types.Var, bool]
 
 type TypeInference struct {
 	nextVarId types.VarId
+	expTypes  map[ast.Exp]types.Type // the inferred type of each expression
+	env       TypeEnv                // the declarations of the inferred modules
+	// nonGenericVars are the type variables of the values at top level which are not generic.
+	nonGenericVars *VarSet
+	Externals      Externals
+	// comparisons are the occurrences of assertEqual, whose argument types are checked once they are inferred.
+	comparisons []*ast.Var
+}
+
+// Externals provides the types of the members of extern types, e.g. the methods of Go types.
+type Externals interface {
+	MemberType(typeName, name string) (types.Type, error)
 }
 
 func (ti *TypeInference) generateVar() *types.Var {
@@ -23,15 +37,66 @@ func (ti *TypeInference) generateVar() *types.Var {
 	return newVar
 }
 
+func (ti *TypeInference) newTypeVar() types.Type {
+	return ti.generateVar()
+}
+
+// Infer infers the types of the declarations of a module, where the module may refer to the declarations of the modules
+// which ti has inferred before, as in an interactive session. It returns the types of all the declarations,
+// which are kept for the next modules unless the module has errors.
 func (ti *TypeInference) Infer(module *ast.Module) (TypeEnv, error) {
 	var errors *merror.Error
-	env := TypeEnv{}
-	nonGenericVars := VarSet{}
+	env, nonGenericVars := ti.scope()
 	for _, dec := range module.Decs {
-		err := ti.inferDec(env, nonGenericVars, dec)
+		err := ti.inferDec(env, *nonGenericVars, dec)
 		errors = merror.Append(errors, err)
 	}
-	return env, errors.ErrorOrNil()
+	errors = merror.Append(errors, ti.checkComparisons())
+	err := errors.ErrorOrNil()
+	if err == nil {
+		ti.env, ti.nonGenericVars = env, nonGenericVars
+	}
+	return env, err
+}
+
+// InferExp infers the type of an expression in the scope of the modules which ti has inferred, without declaring anything.
+func (ti *TypeInference) InferExp(exp ast.Exp) (types.Type, error) {
+	var errors *merror.Error
+	env, nonGenericVars := ti.scope()
+	t, err := ti.inferExp(env, *nonGenericVars, exp)
+	errors = merror.Append(errors, err)
+	errors = merror.Append(errors, ti.checkComparisons())
+	return t, errors.ErrorOrNil()
+}
+
+// checkComparisons reports the occurrences of assertEqual since the last check, whose arguments have a type
+// which cannot be compared, e.g. of functions, which the generated code would compare by the Go operator !=.
+func (ti *TypeInference) checkComparisons() error {
+	var errors *merror.Error
+	for _, node := range ti.comparisons {
+		t, _, _ := types.AsArrow(ti.expTypes[node])
+		if part := builtin.Incomparable(t); part != nil {
+			err := errorAt(node, diag.InvalidOperand, "assertEqual can only compare values which have equality, but got %s", t)
+			if !part.Equal(t) {
+				err.Note("the values of the type %s cannot be compared", part)
+			}
+			errors = merror.Append(errors, err)
+		}
+	}
+	ti.comparisons = nil
+	return errors.ErrorOrNil()
+}
+
+// scope returns the environments of a new module, which extend those of the inferred modules without changing them.
+func (ti *TypeInference) scope() (TypeEnv, *VarSet) {
+	env := TypeEnv{}
+	for name, t := range ti.env {
+		env[name] = t
+	}
+	if ti.nonGenericVars == nil {
+		ti.nonGenericVars = common.NewEnv[*types.Var, bool](nil)
+	}
+	return env, common.NewEnv(ti.nonGenericVars)
 }
 
 func (ti *TypeInference) inferDec(env TypeEnv, nonGenericVars VarSet, dec ast.Dec) error {
@@ -41,43 +106,37 @@ func (ti *TypeInference) inferDec(env TypeEnv, nonGenericVars VarSet, dec ast.De
 		t, err := ti.inferExp(env, nonGenericVars, decl.Body)
 		errors = merror.Append(errors, err)
 		if annotatedType := decl.Arg.Type; annotatedType != nil {
-			err := unify(annotatedType, t)
+			err := expect(decl.Body, annotatedType, t)
 			errors = merror.Append(errors, err)
 		}
+		if !isValue(decl.Body) {
+			// only values are generic, since other expressions like channel 0 may make shared mutable values.
+			for _, v := range types.Vars(t) {
+				nonGenericVars.Add(v, true)
+			}
+		}
 		name := decl.Arg.Id.String()
 		env[name] = t
+	case *ast.ExternDec:
+		name := decl.Arg.Id.String()
+		env[name] = decl.Arg.Type
+	case *ast.ExternTypeDec:
+		// an extern type only introduces a type name.
 	case *ast.FunDec:
-		arity := len(decl.Binds[0].Patterns)
-		argTypes := make([]types.Type, arity)
 		newNonGenericVars := common.NewEnv(&nonGenericVars)
-		for i := 0; i < arity; i++ {
-			v := ti.generateVar()
-			argTypes[i] = v
-			newNonGenericVars.Add(v, true)
+		argTypes, resType := ti.declareFun(env, newNonGenericVars, decl)
+		return ti.inferFun(env, *newNonGenericVars, decl, argTypes, resType)
+	case *ast.RecDec:
+		// the functions are not generic in their bodies, i.e. they are monomorphic in the recursive calls.
+		newNonGenericVars := common.NewEnv(&nonGenericVars)
+		argTypes := make([][]types.Type, len(decl.Funs))
+		resTypes := make([]types.Type, len(decl.Funs))
+		for i, fun := range decl.Funs {
+			argTypes[i], resTypes[i] = ti.declareFun(env, newNonGenericVars, fun)
 		}
-		resType := ti.generateVar()
-		newNonGenericVars.Add(resType, true)
-		var funType = types.Arrow(argTypes[arity-1], resType)
-		for i := arity - 2; i >= 0; i-- {
-			funType = types.Arrow(argTypes[i], funType)
-		}
-		name := decl.Binds[0].Id.String()
-		env[name] = funType
-		for _, bind := range decl.Binds {
-			for i, pattern := range bind.Patterns {
-				t, err := ti.inferExp(env, *newNonGenericVars, pattern)
-				errors = merror.Append(errors, err)
-				err = unify(t, argTypes[i])
-				errors = merror.Append(errors, err)
-			}
-			t, err := ti.inferExp(env, *newNonGenericVars, bind.Exp)
-			errors = merror.Append(errors, err)
-			err = unify(resType, t)
+		for i, fun := range decl.Funs {
+			err := ti.inferFun(env, *newNonGenericVars, fun, argTypes[i], resTypes[i])
 			errors = merror.Append(errors, err)
-			if bind.ResultType != nil {
-				err = unify(resType, bind.ResultType)
-				errors = merror.Append(errors, err)
-			}
 		}
 		return errors
 	default:
@@ -86,24 +145,102 @@ func (ti *TypeInference) inferDec(env TypeEnv, nonGenericVars VarSet, dec ast.De
 	return errors
 }
 
+// declareFun binds a function to the type of fresh variables for its arguments and result, which are non-generic in its body.
+func (ti *TypeInference) declareFun(env TypeEnv, nonGenericVars *VarSet, decl *ast.FunDec) ([]types.Type, types.Type) {
+	arity := len(decl.Binds[0].Patterns)
+	argTypes := make([]types.Type, arity)
+	for i := 0; i < arity; i++ {
+		v := ti.generateVar()
+		argTypes[i] = v
+		nonGenericVars.Add(v, true)
+	}
+	resType := ti.generateVar()
+	nonGenericVars.Add(resType, true)
+	var funType = types.Arrow(argTypes[arity-1], resType)
+	for i := arity - 2; i >= 0; i-- {
+		funType = types.Arrow(argTypes[i], funType)
+	}
+	env[decl.Binds[0].Id.String()] = funType
+	return argTypes, resType
+}
+
+// inferFun infers the clauses of a declared function.
+func (ti *TypeInference) inferFun(env TypeEnv, nonGenericVars VarSet, decl *ast.FunDec, argTypes []types.Type, resType types.Type) error {
+	var errors error
+	for _, bind := range decl.Binds {
+		for i, pattern := range bind.Patterns {
+			t, err := ti.inferExp(env, nonGenericVars, pattern)
+			errors = merror.Append(errors, err)
+			if err := unify(t, argTypes[i]); err != nil {
+				errors = merror.Append(errors, mismatch(pattern, argTypes[i], t, err))
+			}
+		}
+		t, err := ti.inferExp(env, nonGenericVars, bind.Exp)
+		errors = merror.Append(errors, err)
+		err = expect(bind.Exp, resType, t)
+		errors = merror.Append(errors, err)
+		if bind.ResultType != nil {
+			if err := unify(resType, bind.ResultType); err != nil {
+				errors = merror.Append(errors, mismatch(bind.Exp, bind.ResultType, resType, err))
+			}
+		}
+	}
+	return errors
+}
+
+// TypeOf returns the inferred type of an expression, or nil if the expression has not been inferred.
+func (ti *TypeInference) TypeOf(exp ast.Exp) types.Type {
+	return ti.expTypes[exp]
+}
+
 func (ti *TypeInference) inferExp(env TypeEnv, nonGenericVars common.Env[*types.Var, bool], exp ast.Exp) (types.Type, error) {
+	t, err := ti.inferNode(env, nonGenericVars, exp)
+	if t != nil {
+		if ti.expTypes == nil {
+			ti.expTypes = map[ast.Exp]types.Type{}
+		}
+		ti.expTypes[exp] = t
+	}
+	return t, err
+}
+
+func (ti *TypeInference) inferNode(env TypeEnv, nonGenericVars common.Env[*types.Var, bool], exp ast.Exp) (types.Type, error) {
 	var errors error = nil
 	switch node := exp.(type) {
 	case ast.Constant:
 		return node.Type(), nil
 	case *ast.Var:
-		return ti.typeOfId(env, nonGenericVars, node.String())
+		if t := ti.constructorType(node.String()); t != nil {
+			return t, nil
+		}
+		if t := builtin.Type(node.String(), ti.newTypeVar); t != nil {
+			if node.String() == builtin.AssertEqual {
+				ti.comparisons = append(ti.comparisons, node)
+			}
+			return t, nil
+		}
+		return ti.typeOfId(env, nonGenericVars, node)
+	case *ast.Member:
+		// the type of an invalid member is unknown, so that the inference goes on.
+		if ti.Externals == nil {
+			return ti.generateVar(), errorAt(node, diag.UndefinedMember, "undefined member %s", node)
+		}
+		t, err := ti.Externals.MemberType(node.Type.Name, node.Name.Name)
+		if err != nil {
+			return ti.generateVar(), errorAt(node, diag.UndefinedMember, "%s: %v", node, err)
+		}
+		return t, nil
 	case *ast.Not:
 		t, err := ti.inferExp(env, nonGenericVars, node.Child)
 		errors = merror.Append(errors, err)
-		err = unify(types.BoolType, t)
+		err = expect(node.Child, types.BoolType, t)
 		errors = merror.Append(errors, err)
 		return types.BoolType, errors
 	case *ast.Neg:
 		t, err := ti.inferExp(env, nonGenericVars, node.Child)
 		errors = merror.Append(errors, err)
-		if t != types.IntType && t != types.FloatType {
-			err = fmt.Errorf("negation operator can only be applied to a number, but got %s", t)
+		if !constrain(t, types.NumberClass) {
+			err = errorAt(node, diag.InvalidOperand, "negation operator can only be applied to a number, but got %s", t)
 			errors = merror.Append(errors, err)
 		}
 		return t, errors
@@ -112,25 +249,37 @@ func (ti *TypeInference) inferExp(env TypeEnv, nonGenericVars common.Env[*types.
 		errors = merror.Append(errors, err)
 		bt, err := ti.inferExp(env, nonGenericVars, node.Right)
 		errors = merror.Append(errors, err)
-		err = unify(bt, at)
-		errors = merror.Append(errors, err)
+		// the right operand has the type of the left one.
+		if err := unify(bt, at); err != nil {
+			errors = merror.Append(errors, mismatch(node.Right, at, bt, err))
+		}
 		switch node.Op.String() {
-		// todo: unify with type var, when at is not a concrete type
 		case ast.Add, ast.Minus, ast.Mul, ast.Div, ast.Mod:
-			if _, ok := at.Prune().(*types.CtorType); ok && !at.Equal(types.IntType) && !at.Equal(types.FloatType) {
-				err = fmt.Errorf("arithmethic operator can only be applied to a number, but got %s", at)
+			class := types.NumberClass
+			if node.Op.String() == ast.Mod {
+				class = types.IntegerClass
+			}
+			if !constrain(at, class) {
+				err = errorAt(node, diag.InvalidOperand, "arithmetic operator %s can only be applied to %s, but got %s", node.Op, class, at)
 				errors = merror.Append(errors, err)
 			}
 			return at, errors
-		case ast.Eq, ast.NotEq, ast.Less, ast.LessEq, ast.Greater, ast.GreaterEq:
+		case ast.Eq, ast.NotEq:
+			// the type variable of values which are compared for equality is not a number, e.g. of strings.
 			if _, ok := at.Prune().(*types.CtorType); ok && !at.Equal(types.IntType) && !at.Equal(types.FloatType) {
-				err = fmt.Errorf("arithmethic operator can only be applied to a number, but got %s", at)
+				err = errorAt(node, diag.InvalidOperand, "arithmetic operator %s can only be applied to a number, but got %s", node.Op, at)
+				errors = merror.Append(errors, err)
+			}
+			return types.BoolType, errors
+		case ast.Less, ast.LessEq, ast.Greater, ast.GreaterEq:
+			if !constrain(at, types.NumberClass) {
+				err = errorAt(node, diag.InvalidOperand, "arithmetic operator %s can only be applied to a number, but got %s", node.Op, at)
 				errors = merror.Append(errors, err)
 			}
 			return types.BoolType, errors
 		case ast.And, ast.Or:
 			if _, ok := at.Prune().(*types.CtorType); ok && !at.Equal(types.BoolType) {
-				err = fmt.Errorf("logical operator can only be applied to a boolean value, but got %s", at)
+				err = errorAt(node, diag.InvalidOperand, "logical operator %s can only be applied to a boolean value, but got %s", node.Op, at)
 				errors = merror.Append(errors, err)
 			}
 			return types.BoolType, errors
@@ -140,12 +289,13 @@ func (ti *TypeInference) inferExp(env TypeEnv, nonGenericVars common.Env[*types.
 	case *ast.IfThen:
 		condType, err := ti.inferExp(env, nonGenericVars, node.Cond)
 		errors = merror.Append(errors, err)
-		err = unify(types.BoolType, condType)
+		err = expect(node.Cond, types.BoolType, condType)
+		errors = merror.Append(errors, err)
 		thenType, err := ti.inferExp(env, nonGenericVars, node.Then)
 		errors = merror.Append(errors, err)
 		elseType, err := ti.inferExp(env, nonGenericVars, node.Else)
 		errors = merror.Append(errors, err)
-		err = unify(thenType, elseType)
+		err = expect(node.Else, thenType, elseType)
 		errors = merror.Append(errors, err)
 		return thenType, errors
 	case *ast.Fn:
@@ -156,26 +306,77 @@ func (ti *TypeInference) inferExp(env TypeEnv, nonGenericVars common.Env[*types.
 		for _, match := range node.Matches {
 			t, err := ti.inferExp(env, *newNonGenericVars, match.Pattern)
 			errors = merror.Append(errors, err)
-			err = unify(t, argType)
-			errors = merror.Append(errors, err)
+			if err := unify(t, argType); err != nil {
+				errors = merror.Append(errors, mismatch(match.Pattern, argType, t, err))
+			}
 			bodyType, err := ti.inferExp(env, *newNonGenericVars, match.Exp)
 			errors = merror.Append(errors, err)
-			err = unify(resType, bodyType)
+			err = expect(match.Exp, resType, bodyType)
 			errors = merror.Append(errors, err)
 		}
 		return types.Arrow(argType, resType), errors
 	case *ast.Apply:
 		resultType := ti.generateVar()
 		argType, err := ti.inferExp(env, nonGenericVars, node.Arg)
-		errors = merror.Append(errors, err)
+		errors = merror.Append(errors, inArgument(err, node))
 		funType, err := ti.inferExp(env, nonGenericVars, node.Fun)
 		errors = merror.Append(errors, err)
+		if paramType, resType, ok := types.AsArrow(funType); ok {
+			err = inArgument(expect(node.Arg, paramType, argType), node)
+			errors = merror.Append(errors, err, unify(resType, resultType))
+			return resultType, errors
+		}
 		expectedType := types.Arrow(argType, resultType)
-		err = unify(funType, expectedType)
-		errors = merror.Append(errors, err)
+		if err := unify(expectedType, funType); err != nil {
+			e := mismatch(node.Fun, expectedType, funType, err).Note("it is applied to the argument at %s", node.Arg.Start())
+			errors = merror.Append(errors, e)
+		}
 		return resultType, errors
 	case *ast.ConstPattern:
 		return node.Type(), nil
+	case *ast.Select:
+		resType := ti.generateVar()
+		for _, arm := range node.Arms {
+			armEnv := env
+			if arm.Chan != nil {
+				chanType, err := ti.inferExp(env, nonGenericVars, arm.Chan)
+				errors = merror.Append(errors, err)
+				elemType := ti.generateVar()
+				if err := unify(chanType, builtin.ChanType(elemType)); err != nil {
+					errors = merror.Append(errors, mismatch(arm.Chan, builtin.ChanType(elemType), chanType, err))
+				}
+				if arm.Value != nil {
+					valueType, err := ti.inferExp(env, nonGenericVars, arm.Value)
+					errors = merror.Append(errors, err)
+					errors = merror.Append(errors, expect(arm.Value, elemType, valueType))
+				} else {
+					patternType, err := ti.inferExp(armEnv, nonGenericVars, arm.Pattern)
+					errors = merror.Append(errors, err)
+					errors = merror.Append(errors, expect(arm.Pattern, elemType, patternType))
+				}
+			}
+			t, err := ti.inferExp(armEnv, nonGenericVars, arm.Exp)
+			errors = merror.Append(errors, err)
+			errors = merror.Append(errors, expect(arm.Exp, resType, t))
+		}
+		return resType, errors
+	case *ast.CtorPattern:
+		argType, err := ti.inferExp(env, nonGenericVars, node.Arg)
+		errors = merror.Append(errors, err)
+		ctorType := ti.constructorType(node.Ctor.String())
+		if ctorType == nil {
+			errors = merror.Append(errors, errorAt(node, diag.UndefinedConstructor, "undefined constructor '%s'", node.Ctor))
+			return ti.generateVar(), errors
+		}
+		resType := ti.generateVar()
+		paramType, ctorResType, ok := types.AsArrow(ctorType)
+		if !ok {
+			errors = merror.Append(errors, errorAt(node, diag.InvalidPattern, "constructor '%s' takes no argument", node.Ctor))
+			return resType, errors
+		}
+		err = expect(node.Arg, paramType, argType)
+		errors = merror.Append(errors, err, unify(ctorResType, resType))
+		return resType, errors
 	case *ast.VarPattern:
 		v := ti.generateVar()
 		name := node.Id.String()
@@ -210,12 +411,26 @@ func (ti *TypeInference) inferExp(env TypeEnv, nonGenericVars common.Env[*types.
 	}
 }
 
-func (ti *TypeInference) typeOfId(env TypeEnv, nonGenericVars VarSet, name string) (types.Type, error) {
-	if t, ok := env[name]; ok {
+// constructorType returns a fresh type of a built-in constructor, or nil if the name is not a constructor.
+func (ti *TypeInference) constructorType(name string) types.Type {
+	switch name {
+	case types.OkCtor:
+		value, err := ti.generateVar(), ti.generateVar()
+		return types.Arrow(value, types.ResultType(value, err))
+	case types.ErrCtor:
+		value, err := ti.generateVar(), ti.generateVar()
+		return types.Arrow(err, types.ResultType(value, err))
+	}
+	return nil
+}
+
+func (ti *TypeInference) typeOfId(env TypeEnv, nonGenericVars VarSet, v *ast.Var) (types.Type, error) {
+	if t, ok := env[v.String()]; ok {
 		return ti.fresh(nonGenericVars, t), nil
 	} else {
-		err := fmt.Errorf("undefined symbol '%s'", name)
-		return nil, err
+		// the type of an undefined symbol is unknown, so that the inference goes on.
+		err := errorAt(v, diag.UndefinedSymbol, "undefined symbol '%s'", v.Id.Name)
+		return ti.generateVar(), err
 	}
 }
 
@@ -233,6 +448,7 @@ func (ti *TypeInference) freshType(nonGenericVars VarSet, t types.Type, varMap m
 				return v
 			} else {
 				newVar := ti.generateVar()
+				newVar.Class = ty.Class
 				varMap[ty] = newVar
 				return newVar
 			}
@@ -251,14 +467,68 @@ func (ti *TypeInference) freshType(nonGenericVars VarSet, t types.Type, varMap m
 	return t
 }
 
+// expect unifies the type of an expression with the expected type, and returns an error at the expression if they differ.
+func expect(exp ast.Exp, expected, actual types.Type) error {
+	if err := unify(expected, actual); err != nil {
+		return mismatch(exp, expected, actual, err)
+	}
+	return nil
+}
+
+// inArgument adds the context of the argument of an application to the errors of the argument.
+func inArgument(err error, app *ast.Apply) error {
+	switch e := err.(type) {
+	case *Error:
+		e.Note("in the argument of the application at %s", app.Start())
+	case *merror.Error:
+		for _, err := range e.Errors {
+			inArgument(err, app)
+		}
+	}
+	return err
+}
+
+// constrain restricts a type to a class, which a type variable records so that the types which it is unified with are
+// in the class, e.g. the arguments of a generic function which adds them. It returns false if the type is not in the class.
+func constrain(t types.Type, class types.Class) bool {
+	switch pt := t.Prune().(type) {
+	case *types.Var:
+		if class > pt.Class {
+			pt.Class = class
+		}
+	case *types.CtorType:
+		return class.Admits(pt)
+	}
+	return true
+}
+
+// conflict is the innermost pair of types which cannot be unified.
+type conflict struct {
+	a, b      types.Type
+	recursive bool // a is a type variable which occurs in b
+	class     bool // a is a type variable whose class does not admit b
+}
+
+func (c *conflict) Error() string {
+	if c.recursive {
+		return fmt.Sprintf("recursive type unification: %s occurs in %s", c.a, c.b)
+	}
+	if c.class {
+		return fmt.Sprintf("%s is not %s, which the operators on the values of %s require", c.b, c.a.(*types.Var).Class, c.a)
+	}
+	return fmt.Sprintf("%s is incompatible with %s", c.a, c.b)
+}
+
+// unify makes two types equal by binding their type variables, and returns the first conflict of them if they differ.
 func unify(a, b types.Type) error {
 	bt := b.Prune()
 	switch at := a.Prune().(type) {
 	case *types.Var:
 		if at != bt {
 			if occursInType(at, bt) {
-				err := fmt.Errorf("recursive type unification")
-				return err
+				return &conflict{a: at, b: bt, recursive: true}
+			} else if !constrain(bt, at.Class) {
+				return &conflict{a: at, b: bt, class: true}
 			} else {
 				at.Ref = bt
 			}
@@ -270,16 +540,16 @@ func unify(a, b types.Type) error {
 			return unify(bt, at)
 		case *types.CtorType:
 			if at.Ctor != bt.Ctor || len(at.Args) != len(bt.Args) {
-				err := fmt.Errorf("type mismatch: %s != %s", at.Ctor, bt.Ctor)
-				return err
-			} else if len(at.Args) > 0 {
-				var errors error = nil
-				for i, t := range at.Args {
-					err := unify(t, bt.Args[i])
-					errors = merror.Append(errors, err)
+				return &conflict{a: at, b: bt}
+			}
+			// the other arguments are unified even if one of them conflicts, so that the inference goes on.
+			var first error
+			for i, t := range at.Args {
+				if err := unify(t, bt.Args[i]); err != nil && first == nil {
+					first = err
 				}
-				return errors
-			} // else can be skipped since args are empty.
+			}
+			return first
 		default:
 			panic("Bug: unexpected types.")
 		}
@@ -289,6 +559,22 @@ func unify(a, b types.Type) error {
 	return nil
 }
 
+// isValue tells whether an expression is a syntactic value, whose type can be generalized.
+func isValue(exp ast.Exp) bool {
+	switch node := exp.(type) {
+	case *ast.Unit, *ast.Bool, *ast.Int, *ast.Float, *ast.String, *ast.Char, *ast.Var, *ast.Fn:
+		return true
+	case *ast.Tuple:
+		for _, element := range node.Elements {
+			if !isValue(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // isGeneric returns if a type variable is generic
 func isGeneric(nonGenericVars common.Env[*types.Var, bool], v *types.Var) bool {
 	var ts = make([]types.Type, 0, len(nonGenericVars.Keys()))
@@ -2,6 +2,7 @@ package typing
 
 import (
 	"github.com/lilac/fun-lang/pkg/alpha"
+	"github.com/lilac/fun-lang/pkg/builtin"
 	"github.com/lilac/fun-lang/pkg/syntax"
 	"github.com/lilac/fun-lang/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -102,14 +103,20 @@ func TestInference_Cyclical_Type(t *testing.T) {
 }
 
 func TestArithmeticOp(t *testing.T) {
-	t.Skip("Skip a todo work") // todo: enable it
 	lines := []string{
 		"fun add x y = x + y",
+		"fun rem x y = x % y",
+		"val i = add 1 2",
+		"val f = add 1.5 2.0",
 	}
 	env, _ := runWithoutError(t, lines)
-	//fmt.Println(env)
-	aVar := types.NewVar(0)
-	assert.Equal(t, types.Arrow(aVar, types.Arrow(aVar, aVar)).String(), env["add$1"].String())
+	add, _, _ := types.AsArrow(env["add$1"])
+	rem, _, _ := types.AsArrow(env["rem$4"])
+	// the operators restrict the types of the operands to numbers.
+	assert.Equal(t, types.NumberClass, add.Prune().(*types.Var).Class)
+	assert.Equal(t, types.IntegerClass, rem.Prune().(*types.Var).Class)
+	assert.Equal(t, types.IntType.String(), env["i$7"].String())
+	assert.Equal(t, types.FloatType.String(), env["f$8"].String())
 }
 
 func TestLetInExpression(t *testing.T) {
@@ -123,6 +130,56 @@ func TestLetInExpression(t *testing.T) {
 	assert.Equal(t, types.IntType.String(), env["i$3"].String())
 }
 
+func TestResultInference(t *testing.T) {
+	lines := []string{
+		"val r = Ok 1",
+		"fun get (Ok x) _ = x | get (Err _) d = d",
+		"val n = get (Err \"e\") 2",
+	}
+	env, _ := runWithoutError(t, lines)
+	value, _, ok := types.AsResult(env["r$1"])
+	assert.True(t, ok)
+	assert.Equal(t, types.IntType, value.Prune())
+	assert.Equal(t, types.IntType, env["n$7"].Prune())
+
+	_, err := run(t, []string{"val x = (fn Ok x => x | Err e => e) (Err 1) + 1", "val y = (fn Ok x => x) 1"})
+	assertErrorContains(t, err, "result")
+}
+
+func TestChannelInference(t *testing.T) {
+	lines := []string{
+		"val c = channel 0",
+		"val _ = spawn (fn () => send c 1)",
+		"val n = select c ? x => x | else => 0 end",
+	}
+	env, _ := runWithoutError(t, lines)
+	elem, ok := builtin.AsChan(env["c$1"])
+	assert.True(t, ok)
+	assert.Equal(t, types.IntType, elem.Prune())
+	assert.Equal(t, types.IntType, env["n$4"].Prune())
+
+	_, err := run(t, []string{"val c = channel 0", "val _ = (send c 1; send c true)"})
+	assertErrorContains(t, err, "bool")
+}
+
+func TestRecDecInference(t *testing.T) {
+	lines := []string{
+		"fun even n = if n = 0 then true else odd (n - 1) and odd n = if n = 0 then false else even (n - 1)",
+		"fun f x = g x and g y = f y",
+		"val a = f 1",
+		"val b = f true",
+	}
+	env, _ := runWithoutError(t, lines)
+	assert.Equal(t, "int -> bool", env["odd$2"].String())
+	// the functions are generic after the declaration.
+	assert.Equal(t, env["f$5"].String(), env["g$6"].String())
+	_, ok := env["a$9"].Prune().(*types.Var)
+	assert.True(t, ok)
+
+	_, err := run(t, []string{"fun f x = (g 1; g x) and g y = f true"})
+	assertErrorContains(t, err, "bool")
+}
+
 func runWithoutError(t *testing.T, lines []string) (TypeEnv, error) {
 	env, err := run(t, lines)
 	assert.NoError(t, err, "type inference error")
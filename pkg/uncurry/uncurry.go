@@ -0,0 +1,102 @@
+// Package uncurry makes the applications of declared functions to all their arguments calls,
+// so that a function declaration is a Go function of several parameters instead of nested closures.
+//
+// A declared function takes its free variables and all its arguments at once. An application to fewer arguments,
+// and a use of the function as a value, remain applications of the function variable, which the code generator
+// wraps in curried closures.
+package uncurry
+
+import "github.com/lilac/fun-lang/pkg/ir"
+
+type uncurrier struct {
+	arities map[string]int // the number of parameters of each declared function
+}
+
+// Uncurry turns the applications of the declared functions to all their arguments into calls,
+// where the extra arguments of an application are applied to the result of the call.
+func Uncurry(module *ir.Module) *ir.Module {
+	u := &uncurrier{arities: map[string]int{}}
+	for _, dec := range module.Decs {
+		u.declare(dec)
+		ir.InspectDec(dec, func(exp ir.Exp) bool {
+			if let, ok := exp.(*ir.LetIn); ok {
+				for _, d := range let.Decs {
+					u.declare(d)
+				}
+			}
+			return true
+		})
+	}
+	return &ir.Module{Decs: ir.RewriteDecs(module.Decs, u.exp)}
+}
+
+func (u *uncurrier) declare(dec ir.Dec) {
+	switch d := dec.(type) {
+	case *ir.FunDec:
+		u.arities[d.Id.Value] = len(d.Env) + len(d.Args)
+	case *ir.RecDec:
+		for _, fun := range d.Funs {
+			u.declare(fun)
+		}
+	}
+}
+
+// apply rewrites nested applications and calls of a declared function, which are a call if there are enough arguments.
+// They start at the same position, which is the position of the call and of the applications to the extra arguments.
+func (u *uncurrier) apply(head *ir.Var, args []ir.Exp, pos string) ir.Exp {
+	args = u.exps(args)
+	var result ir.Exp = head
+	if n := u.arities[head.Id.Value]; len(args) >= n {
+		result = &ir.Call{Fun: head, Args: args[:n], Pos: pos}
+		args = args[n:]
+	}
+	for _, arg := range args {
+		result = &ir.App{Fun: result, Arg: arg, Pos: pos}
+	}
+	return result
+}
+
+// spine returns the function variable and the arguments of nested applications and a call,
+// or nil if the function is not a declared function.
+func (u *uncurrier) spine(exp ir.Exp) (*ir.Var, []ir.Exp) {
+	var args []ir.Exp
+	for {
+		switch e := exp.(type) {
+		case *ir.App:
+			args = append([]ir.Exp{e.Arg}, args...)
+			exp = e.Fun
+		case *ir.Call:
+			return e.Fun, append(append([]ir.Exp{}, e.Args...), args...)
+		case *ir.Var:
+			if _, ok := u.arities[e.Id.Value]; ok {
+				return e, args
+			}
+			return nil, nil
+		default:
+			return nil, nil
+		}
+	}
+}
+
+func (u *uncurrier) exps(exps []ir.Exp) []ir.Exp {
+	result := make([]ir.Exp, len(exps))
+	for i, exp := range exps {
+		result[i] = u.exp(exp)
+	}
+	return result
+}
+
+// exp rewrites the applications of declared functions in an expression.
+func (u *uncurrier) exp(exp ir.Exp) ir.Exp {
+	switch e := exp.(type) {
+	case *ir.App:
+		if head, args := u.spine(exp); head != nil {
+			return u.apply(head, args, e.Pos)
+		}
+	case *ir.Call:
+		if head, args := u.spine(exp); head != nil {
+			return u.apply(head, args, e.Pos)
+		}
+	}
+	return ir.Rewrite(exp, u.exp)
+}
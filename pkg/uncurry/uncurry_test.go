@@ -0,0 +1,48 @@
+package uncurry
+
+import (
+	"github.com/lilac/fun-lang/pkg/ir"
+	"github.com/lilac/fun-lang/pkg/ir/irtest"
+	"github.com/lilac/fun-lang/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUncurry(t *testing.T) {
+	x, y := irtest.Var("x", types.IntType), irtest.Var("y", types.IntType)
+	add := irtest.Fun("add", irtest.Binary, []ir.Arg{irtest.Arg("x", types.IntType), irtest.Arg("y", types.IntType)},
+		ir.NewBinaryOp(ir.Add, x, y))
+	// adder x returns a function, which takes the extra argument of an application.
+	adder := irtest.Fun("adder", irtest.Binary, []ir.Arg{irtest.Arg("x", types.IntType)},
+		irtest.Apply(irtest.Var("add", irtest.Binary), x))
+	module := Uncurry(&ir.Module{Decs: []ir.Dec{add, adder,
+		irtest.Val("a", types.IntType, irtest.Apply(irtest.Var("add", irtest.Binary), irtest.Int(1), irtest.Int(2))),
+		irtest.Val("b", types.IntType, irtest.Apply(irtest.Var("adder", irtest.Binary), irtest.Int(1), irtest.Int(2))),
+		irtest.Val("c", irtest.Binary, irtest.Var("add", irtest.Binary)),
+		irtest.Val("d", types.IntType, irtest.Apply(irtest.Var("c", irtest.Binary), irtest.Int(1), irtest.Int(2))),
+	}})
+	assert.Equal(t, []string{
+		"fun add$1 (x$1 : int) (y$1 : int) = x$1 + y$1",
+		"fun adder$1 (x$1 : int) = add$1 x$1",
+		"val a$1 : int = call add$1 (1, 2)",
+		"val b$1 : int = (call adder$1 (1)) 2",
+		"val c$1 : int -> int -> int = add$1",
+		"val d$1 : int = c$1 1 2",
+	}, irtest.Lines(module))
+}
+
+func TestUncurryLocalFunctions(t *testing.T) {
+	k, x := irtest.Var("k", types.IntType), irtest.Var("x", types.IntType)
+	// a lifted function takes its free variables before its arguments.
+	lifted := &ir.FunDec{Id: irtest.Id("scale"), Type: irtest.IntToInt, Env: []ir.Arg{irtest.Arg("k", types.IntType)},
+		Args: []ir.Arg{irtest.Arg("x", types.IntType)}, Body: ir.NewBinaryOp(ir.Mul, k, x)}
+	local := irtest.Fun("inc", irtest.IntToInt, []ir.Arg{irtest.Arg("x", types.IntType)},
+		ir.NewBinaryOp(ir.Add, x, irtest.Int(1)))
+	body := &ir.LetIn{Decs: []ir.Dec{local},
+		Body: irtest.Apply(irtest.Var("inc", irtest.IntToInt), irtest.Apply(irtest.Var("scale", irtest.Binary), irtest.Int(2), irtest.Int(3)))}
+	module := Uncurry(&ir.Module{Decs: []ir.Dec{lifted, irtest.Val("a", types.IntType, body)}})
+	assert.Equal(t, []string{
+		"fun scale$1 [k$1 : int] (x$1 : int) = k$1 * x$1",
+		"val a$1 : int = let fun inc$1 (x$1 : int) = x$1 + 1 in call inc$1 (call scale$1 (2, 3)) end",
+	}, irtest.Lines(module))
+}